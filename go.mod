@@ -3,9 +3,21 @@ module github.com/danielgom/bookstore_oauthapi
 go 1.16
 
 require (
+	github.com/alicebob/miniredis/v2 v2.14.3
 	github.com/danielgom/bookstore_utils-go v0.0.0-20210502224501-f568d5553e1e // indirect
+	github.com/fergusstrange/embedded-postgres v1.10.0
+	github.com/go-ldap/ldap/v3 v3.3.0
+	github.com/go-redis/redis/v8 v8.11.4
 	github.com/gocql/gocql v0.0.0-20210303210847-f18e0979d243
 	github.com/golang/mock v1.5.0 // indirect
 	github.com/labstack/echo/v4 v4.2.0
-
+	github.com/lib/pq v1.10.2
+	github.com/prometheus/client_golang v1.10.0
+	go.opentelemetry.io/otel v1.0.0
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp v1.0.0
+	go.opentelemetry.io/otel/exporters/stdout/stdouttrace v1.0.0
+	go.opentelemetry.io/otel/sdk v1.0.0
+	go.opentelemetry.io/otel/trace v1.0.0
+	go.uber.org/zap v1.16.0
+	golang.org/x/crypto v0.0.0-20210421170649-83a5a9bb288b
 )
@@ -1,38 +1,226 @@
 package app
 
 import (
+	"context"
+	"expvar"
+	"github.com/danielgom/bookstore_oauthapi/src/audit"
+	"github.com/danielgom/bookstore_oauthapi/src/config"
 	"github.com/danielgom/bookstore_oauthapi/src/datasource/clients/cassandra"
 	"github.com/danielgom/bookstore_oauthapi/src/http"
+	"github.com/danielgom/bookstore_oauthapi/src/logger"
+	"github.com/danielgom/bookstore_oauthapi/src/metrics"
+	"github.com/danielgom/bookstore_oauthapi/src/oauth"
+	"github.com/danielgom/bookstore_oauthapi/src/repository/clientsdb"
 	"github.com/danielgom/bookstore_oauthapi/src/repository/db"
+	"github.com/danielgom/bookstore_oauthapi/src/repository/devicedb"
+	"github.com/danielgom/bookstore_oauthapi/src/repository/mfadb"
+	"github.com/danielgom/bookstore_oauthapi/src/repository/pgdb"
+	"github.com/danielgom/bookstore_oauthapi/src/repository/redisdb"
 	"github.com/danielgom/bookstore_oauthapi/src/repository/usersdb"
 	"github.com/danielgom/bookstore_oauthapi/src/services/accesstoken"
+	"github.com/danielgom/bookstore_oauthapi/src/services/clients"
+	"github.com/danielgom/bookstore_oauthapi/src/services/device"
+	"github.com/danielgom/bookstore_oauthapi/src/services/mfa"
+	"github.com/danielgom/bookstore_oauthapi/src/services/oidc"
+	"github.com/danielgom/bookstore_oauthapi/src/tracing"
 	"github.com/labstack/echo/v4"
-	"github.com/labstack/echo/v4/middleware"
+	"go.uber.org/zap"
+	nethttp "net/http"
+)
+
+const (
+	// envAdminAddr is the address of the listener serving /metrics and /debug/vars
+	envAdminAddr = "ADMIN_ADDR"
 )
 
 var (
-	router    = echo.New()
-	atHandler = http.NewHandler(accesstoken.NewService(db.NewRepository(), usersdb.NewRepository()))
+	router          = echo.New()
+	adminRouter     = echo.New()
+	atHandler       http.AccessTokenHandler
+	mfaHandler      http.MfaHandler
+	adminHandler    http.AdminHandler
+	sessionsHandler http.SessionsHandler
+	deviceHandler   http.DeviceHandler
+	oidcHandler     http.OidcHandler
+	validator       oauth.Validator
+	clientsService  clients.Service
 )
 
 func StartApplication() {
 
-	cassandra.Init()
+	log, err := logger.NewFromConfig()
+	if err != nil {
+		panic(err)
+	}
+	zap.ReplaceGlobals(log)
+
+	shutdownTracing, err := tracing.InitFromConfig()
+	if err != nil {
+		panic(err)
+	}
+
+	// Cassandra is only connected for the cassandra token store, MFA is not served otherwise
+	cassandraEnabled := db.StoreFromConfig() == db.StoreCassandra
+	if cassandraEnabled {
+		if err = cassandra.InitFromConfig(); err != nil {
+			log.Fatal("cassandra unavailable", zap.Error(err))
+		}
+	} else {
+		log.Info("cassandra disabled, mfa is unavailable", zap.String("tokenStore", db.StoreFromConfig()))
+	}
+
+	usersRepository, err := usersdb.NewRepositoryFromConfig()
+	if err != nil {
+		panic(err)
+	}
+
+	clientsRepository, err := newClientsRepository()
+	if err != nil {
+		panic(err)
+	}
+	auditSink, err := audit.NewSinkFromConfig()
+	if err != nil {
+		panic(err)
+	}
+
+	var clientsOptions []clients.Option
+	if auditSink != nil {
+		clientsOptions = append(clientsOptions, clients.WithAudit(auditSink))
+	}
+	if clientsService, err = clients.NewService(clientsRepository, clientsOptions...); err != nil {
+		panic(err)
+	}
+	metrics.SetClientRegistry(func(clientId int64) bool {
+		_, err := clientsRepository.GetByID(context.Background(), clientId)
+		return err == nil
+	})
+
+	dbRepository, err := newTokenRepository()
+	if err != nil {
+		panic(err)
+	}
+	if cached, ok := dbRepository.(db.CachedRepository); ok {
+		expvar.Publish("tokenCache", expvar.Func(func() interface{} { return cached.Stats() }))
+		metrics.RegisterCounterFunc("token_cache_hits_total", "Token cache hits, including negative hits.",
+			func() float64 { return float64(cached.Stats().Hits + cached.Stats().NegativeHits) })
+		metrics.RegisterCounterFunc("token_cache_misses_total", "Token cache misses.",
+			func() float64 { return float64(cached.Stats().Misses) })
+	}
+
+	var atOptions []accesstoken.Option
+	if cassandraEnabled {
+		mfaService := mfa.NewService(mfadb.NewRepository())
+		mfaHandler = http.NewMfaHandler(mfaService)
+		atOptions = append(atOptions, accesstoken.WithMfa(mfaService))
+	}
+	if auditSink != nil {
+		atOptions = append(atOptions, accesstoken.WithAudit(auditSink))
+	}
+	atOptions = append(atOptions, accesstoken.WithClients(clientsService))
+
+	// device authorizations are shared through Cassandra, other deployments keep them per instance
+	if deviceConfig := device.NewConfigFromConfig(); deviceConfig.Enabled() {
+		deviceRepository := devicedb.NewMemoryRepository()
+		if cassandraEnabled {
+			deviceRepository = devicedb.NewRepository()
+		}
+		deviceService := device.NewService(deviceRepository, clientsService, deviceConfig)
+		deviceHandler = http.NewDeviceHandler(deviceService)
+		atOptions = append(atOptions, accesstoken.WithDevice(deviceService))
+	} else {
+		log.Info("device flow disabled, DEVICE_VERIFICATION_URI is not set")
+	}
+
+	oidcConfig, err := oidc.NewConfigFromConfig()
+	if err != nil {
+		panic(err)
+	}
+	if oidcConfig.KeyGenerated {
+		log.Warn("oidc signing key generated, id tokens only verify against this instance until it restarts")
+	}
+	oidcService := oidc.NewService(usersdb.NewProfilesRepository(), oidcConfig)
+	atOptions = append(atOptions, accesstoken.WithOidc(oidcService))
+
+	lifetimes, err := accesstoken.NewLifetimePolicyFromConfig()
+	if err != nil {
+		panic(err)
+	}
+	atOptions = append(atOptions, accesstoken.WithLifetimePolicy(lifetimes))
 
-	router.Use(middleware.LoggerWithConfig(middleware.LoggerConfig{
-		Skipper:          nil,
-		Format:           "[ECHO] ${time_rfc3339} | ${status} |   ${latency_human} | ${method}  \"${uri}\" ${protocol}\n",
-		CustomTimeFormat: "",
-		Output:           nil,
-	}))
+	scopes, err := accesstoken.NewScopePolicyFromConfig()
+	if err != nil {
+		panic(err)
+	}
+	atOptions = append(atOptions, accesstoken.WithScopePolicy(scopes))
+	if sliding := accesstoken.NewSlidingExpirationFromConfig(); sliding.Enabled() {
+		atOptions = append(atOptions, accesstoken.WithSlidingExpiration(sliding))
+	}
+
+	atService := accesstoken.NewService(dbRepository, usersRepository, atOptions...)
+
+	atHandler = http.NewHandlerFromConfig(atService)
+	adminHandler = http.NewAdminHandler(atService, clientsService)
+	sessionsHandler = http.NewSessionsHandler(atService)
+	validator = oauth.NewLocalValidator(atService)
+	oidcHandler = http.NewOidcHandler(oidcService, atService)
+
+	if router.IPExtractor, err = http.NewIPExtractorFromConfig(); err != nil {
+		panic(err)
+	}
+
+	router.Use(tracing.EchoMiddleware())
+	router.Use(logger.EchoMiddleware(log))
+	router.Use(audit.EchoMiddleware())
 
 	mapUrls()
+	mapAdminUrls()
+
+	go func() {
+		err := adminRouter.Start(config.GetString(envAdminAddr, "127.0.0.1:9090"))
+		log.Fatal("admin server stopped", zap.Error(err))
+	}()
+
+	tlsConfig, err := http.NewTLSConfigFromConfig()
+	if err != nil {
+		panic(err)
+	}
+
+	// pending spans are flushed before exiting
+	if tlsConfig != nil {
+		err = router.StartServer(&nethttp.Server{Addr: ":8080", TLSConfig: tlsConfig})
+	} else {
+		err = router.Start(":8080")
+	}
+	_ = shutdownTracing(context.Background())
+	log.Fatal("server stopped", zap.Error(err))
+
+}
+
+// newClientsRepository builds the CLIENTS_STORE repository, the CLIENTS_FILE registry unless it is postgres
+func newClientsRepository() (clientsdb.ClientsRepository, error) {
+	if clientsdb.StoreFromConfig() == pgdb.StorePostgres {
+		return pgdb.NewClientsRepositoryFromConfig()
+	}
+	return clientsdb.NewRepositoryFromConfig()
+}
+
+// newTokenRepository builds the TOKEN_STORE repository, behind the token cache when it is enabled
+func newTokenRepository() (db.DRepository, error) {
 
-	// Run with https or http 2
-	//router.Logger.Fatal(router.StartTLS(":8080",
-	//	"/Users/danielg/cert.pem", "/Users/danielg/key.pem"))
+	var repository db.DRepository
+	var err error
 
-	// Normal run
-	router.Logger.Fatal(router.Start(":8080"))
+	switch db.StoreFromConfig() {
+	case pgdb.StorePostgres:
+		repository, err = pgdb.NewRepositoryFromConfig()
+	case redisdb.StoreRedis:
+		repository, err = redisdb.NewRepositoryFromConfig()
+	default:
+		repository, err = db.NewStoreFromConfig()
+	}
+	if err != nil {
+		return nil, err
+	}
 
+	return db.NewCachedRepositoryFromConfig(repository), nil
 }
@@ -1,7 +1,54 @@
 package app
 
+import (
+	"expvar"
+	atDomain "github.com/danielgom/bookstore_oauthapi/src/domain/accesstoken"
+	clientDomain "github.com/danielgom/bookstore_oauthapi/src/domain/clients"
+	"github.com/danielgom/bookstore_oauthapi/src/domain/oidc"
+	"github.com/danielgom/bookstore_oauthapi/src/http"
+	"github.com/danielgom/bookstore_oauthapi/src/metrics"
+	"github.com/danielgom/bookstore_oauthapi/src/oauth"
+	"github.com/labstack/echo/v4"
+)
+
+// mapAdminUrls serves the operational endpoints on the admin listener, kept off the public port
+func mapAdminUrls() {
+	adminRouter.GET("/debug/vars", echo.WrapHandler(expvar.Handler()))
+	adminRouter.GET("/metrics", echo.WrapHandler(metrics.Handler()))
+}
+
+// mapUrls names the routes advertised by the OpenID Connect discovery after the oidc.Route* constants
 func mapUrls() {
-	router.GET("/oauth/accessToken/:atId", atHandler.GetById)
-	router.POST("/oauth/accessToken", atHandler.Create)
+	router.GET("/oauth/accessToken/:atId", atHandler.GetById,
+		http.ClientAuthMiddleware(clientsService, clientDomain.RoleResourceServer))
+	router.POST("/oauth/accessToken", atHandler.Create).Name = oidc.RouteToken
 	router.GET("/health", atHandler.Health)
+
+	router.GET("/.well-known/openid-configuration", oidcHandler.Configuration)
+	router.GET("/.well-known/jwks.json", oidcHandler.Keys).Name = oidc.RouteKeys
+	router.GET("/oauth/userinfo", oidcHandler.UserInfo, oauth.EchoMiddleware(validator, oidc.ScopeOpenId)).Name = oidc.RouteUserInfo
+
+	if deviceHandler != nil {
+		router.POST("/oauth/device_authorization", deviceHandler.Authorize).Name = oidc.RouteDeviceAuthorization
+		device := router.Group("/oauth/device", oauth.EchoMiddleware(validator))
+		device.POST("/approve", deviceHandler.Approve)
+		device.POST("/deny", deviceHandler.Deny)
+	}
+
+	sessions := router.Group("/oauth/sessions", oauth.EchoMiddleware(validator))
+	sessions.GET("", sessionsHandler.List)
+	sessions.DELETE("/:id", sessionsHandler.Revoke)
+
+	admin := router.Group("/oauth/admin", oauth.EchoMiddleware(validator, atDomain.ScopeAdmin))
+	admin.GET("/users/:userId/tokens", adminHandler.ListUserTokens)
+	admin.DELETE("/users/:userId/tokens", adminHandler.RevokeUserTokens)
+	admin.DELETE("/clients/:clientId/tokens", adminHandler.RevokeClientTokens)
+	admin.POST("/clients/:clientId/secret", adminHandler.RotateClientSecret)
+
+	if mfaHandler != nil {
+		mfa := router.Group("/oauth/mfa", oauth.EchoMiddleware(validator))
+		mfa.POST("/enroll", mfaHandler.Enroll)
+		mfa.POST("/confirm", mfaHandler.Confirm)
+		mfa.DELETE("", mfaHandler.Disable)
+	}
 }
@@ -0,0 +1,113 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/danielgom/bookstore_oauthapi/src/datasource/clients/cassandra"
+	"github.com/danielgom/bookstore_oauthapi/src/datasource/migrations"
+	"github.com/danielgom/bookstore_oauthapi/src/repository/clientsdb"
+	"github.com/danielgom/bookstore_oauthapi/src/repository/db"
+	"github.com/danielgom/bookstore_oauthapi/src/repository/pgdb"
+	"io"
+)
+
+const migrateUsage = "usage: migrate up|status|backfill"
+
+// Migrate runs the `migrate up` and `migrate status` subcommands against the oauth keyspace, or the
+// PostgreSQL database with TOKEN_STORE=postgres. CLIENTS_STORE=postgres migrates the database along the keyspace.
+// `migrate backfill` writes the Cassandra lookup rows of the tokens issued before migration 5
+func Migrate(args []string, out io.Writer) error {
+
+	if len(args) != 1 || (args[0] != "up" && args[0] != "status" && args[0] != "backfill") {
+		return errors.New(migrateUsage)
+	}
+
+	if args[0] == "backfill" {
+		return backfill(out)
+	}
+
+	if db.StoreFromConfig() == pgdb.StorePostgres {
+		return migratePostgres(args[0], out)
+	}
+	// the clients table of CLIENTS_STORE=postgres is migrated along the keyspace
+	if clientsdb.StoreFromConfig() == pgdb.StorePostgres {
+		if err := migratePostgres(args[0], out); err != nil {
+			return err
+		}
+	}
+
+	all, err := cassandra.Migrations()
+	if err != nil {
+		return err
+	}
+
+	c, err := cassandra.NewConfigFromConfig()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	keyspace := c.Keyspace
+
+	if args[0] == "up" {
+		c.Keyspace = ""
+		session, err := cassandra.Connect(c)
+		if err != nil {
+			return err
+		}
+		err = cassandra.EnsureKeyspace(ctx, session, keyspace, cassandra.ReplicationFromConfig())
+		session.Close()
+		if err != nil {
+			return fmt.Errorf("creating keyspace %s: %w", keyspace, err)
+		}
+		c.Keyspace = keyspace
+	}
+
+	session, err := cassandra.Connect(c)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	store := cassandra.NewMigrationStore(session)
+	if args[0] == "up" {
+		return migrations.Up(ctx, store, all, out)
+	}
+	return migrations.Status(ctx, store, all, out)
+}
+
+func migratePostgres(command string, out io.Writer) error {
+
+	all, err := pgdb.Migrations()
+	if err != nil {
+		return err
+	}
+
+	database, err := pgdb.Open(pgdb.NewConfigFromConfig())
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	store := pgdb.NewMigrationStore(database)
+	if command == "up" {
+		return migrations.Up(context.Background(), store, all, out)
+	}
+	return migrations.Status(context.Background(), store, all, out)
+}
+
+func backfill(out io.Writer) error {
+
+	if store := db.StoreFromConfig(); store != db.StoreCassandra {
+		return fmt.Errorf("backfill only applies to the %s store, not %s", db.StoreCassandra, store)
+	}
+
+	if err := cassandra.InitFromConfig(); err != nil {
+		return err
+	}
+
+	written, err := db.BackfillLookups(context.Background())
+	fmt.Fprintf(out, "wrote the lookup rows of %d tokens\n", written)
+	return err
+}
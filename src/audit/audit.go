@@ -0,0 +1,81 @@
+package audit
+
+import (
+	"context"
+	"github.com/danielgom/bookstore_oauthapi/src/clock"
+	"github.com/danielgom/bookstore_oauthapi/src/logger"
+	"time"
+)
+
+type EventType string
+
+const (
+	TokenIssued         EventType = "token_issued"
+	LoginFailed         EventType = "login_failed"
+	TokenRevoked        EventType = "token_revoked"
+	TokenExtended       EventType = "token_extended"
+	ClientSecretRotated EventType = "client_secret_rotated"
+)
+
+// Event answers who did what, for which client and from where. It never holds passwords or token values
+type Event struct {
+	Type      EventType `json:"type"`
+	Time      time.Time `json:"time"`
+	UserId    int64     `json:"userId,omitempty"`
+	ClientId  int64     `json:"clientId,omitempty"`
+	Username  string    `json:"username,omitempty"`
+	GrantType string    `json:"grantType,omitempty"`
+	Scope     string    `json:"scope,omitempty"`
+	Expires   int64     `json:"expires,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	RemoteIp  string    `json:"remoteIp,omitempty"`
+	RequestId string    `json:"requestId,omitempty"`
+}
+
+// Sink stores audit events, implementations must be safe for concurrent use
+type Sink interface {
+	Record(context.Context, *Event) error
+}
+
+type SinkFunc func(context.Context, *Event) error
+
+func (f SinkFunc) Record(ctx context.Context, event *Event) error {
+	return f(ctx, event)
+}
+
+type contextKey int
+
+const (
+	remoteIpKey contextKey = iota
+	userAgentKey
+)
+
+func WithRemoteIp(ctx context.Context, remoteIp string) context.Context {
+	return context.WithValue(ctx, remoteIpKey, remoteIp)
+}
+
+// RemoteIp returns the address of the client being served, or an empty string
+func RemoteIp(ctx context.Context) string {
+	remoteIp, _ := ctx.Value(remoteIpKey).(string)
+	return remoteIp
+}
+
+func WithUserAgent(ctx context.Context, userAgent string) context.Context {
+	return context.WithValue(ctx, userAgentKey, userAgent)
+}
+
+// UserAgent returns the User-Agent of the request being served, or an empty string
+func UserAgent(ctx context.Context) string {
+	userAgent, _ := ctx.Value(userAgentKey).(string)
+	return userAgent
+}
+
+// NewEvent returns an event of type t stamped with the time of c and the client address and request id of ctx
+func NewEvent(ctx context.Context, c clock.Clock, t EventType) *Event {
+	return &Event{
+		Type:      t,
+		Time:      c.Now().UTC(),
+		RemoteIp:  RemoteIp(ctx),
+		RequestId: logger.RequestID(ctx),
+	}
+}
@@ -0,0 +1,53 @@
+package audit
+
+import (
+	"fmt"
+	"github.com/danielgom/bookstore_oauthapi/src/config"
+)
+
+const (
+	SinkNone      = "none"
+	SinkStdout    = "stdout"
+	SinkFile      = "file"
+	SinkCassandra = "cassandra"
+
+	envAuditSinks = "AUDIT_SINKS"
+	envAuditFile  = "AUDIT_FILE"
+)
+
+// NewSinkFromConfig builds the sinks listed in AUDIT_SINKS: stdout, file or cassandra.
+// It returns nil when auditing is disabled
+func NewSinkFromConfig() (Sink, error) {
+
+	sinks := make([]Sink, 0)
+	for _, name := range config.GetStrings(envAuditSinks, nil) {
+		switch name {
+		case SinkStdout:
+			sinks = append(sinks, NewStdoutSink())
+		case SinkFile:
+			sink, err := NewFileSink(config.GetString(envAuditFile, "audit.log"))
+			if err != nil {
+				return nil, err
+			}
+			sinks = append(sinks, sink)
+		case SinkCassandra:
+			sink, err := NewCassandraSink()
+			if err != nil {
+				return nil, err
+			}
+			sinks = append(sinks, sink)
+		case SinkNone:
+		default:
+			return nil, fmt.Errorf("unknown audit sink %q", name)
+		}
+	}
+
+	switch len(sinks) {
+	case 0:
+		return nil, nil
+	case 1:
+		return sinks[0], nil
+	default:
+		return NewMultiSink(sinks...), nil
+	}
+}
@@ -0,0 +1,189 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/danielgom/bookstore_oauthapi/src/clock"
+	"github.com/danielgom/bookstore_oauthapi/src/clock/clocktest"
+	"github.com/danielgom/bookstore_oauthapi/src/datasource/cql/cqltest"
+	"github.com/danielgom/bookstore_oauthapi/src/logger"
+	"github.com/danielgom/bookstore_oauthapi/src/repository/db"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNewEvent(t *testing.T) {
+
+	ctx := WithRemoteIp(logger.WithRequestID(context.Background(), "request-1"), "10.0.0.1")
+
+	now := time.Unix(1600000000, 0)
+	event := NewEvent(ctx, clocktest.NewClock(now), TokenIssued)
+	if event.Type != TokenIssued || event.RemoteIp != "10.0.0.1" || event.RequestId != "request-1" {
+		t.Errorf("Unexpected event %+v", event)
+	}
+	if !event.Time.Equal(now) || event.Time.Location().String() != "UTC" {
+		t.Errorf("Event time should be the time of the clock in UTC, received %v", event.Time)
+	}
+
+	if event = NewEvent(context.Background(), clock.System, LoginFailed); event.RemoteIp != "" || event.RequestId != "" {
+		t.Errorf("Unexpected event %+v", event)
+	}
+}
+
+func TestUserAgent(t *testing.T) {
+
+	if userAgent := UserAgent(WithUserAgent(context.Background(), "curl/7.79")); userAgent != "curl/7.79" {
+		t.Errorf("Expected: curl/7.79, Received: %s", userAgent)
+	}
+	if userAgent := UserAgent(context.Background()); userAgent != "" {
+		t.Errorf("User agent should be empty, received %s", userAgent)
+	}
+}
+
+func TestWriterSink(t *testing.T) {
+
+	var buf bytes.Buffer
+	sink := NewWriterSink(&buf)
+
+	if err := sink.Record(context.Background(), &Event{Type: LoginFailed, Username: "daniel@gmail.com", Reason: "invalid_credentials"}); err != nil {
+		t.Fatal("error should be nil")
+	}
+	if err := sink.Record(context.Background(), &Event{Type: TokenIssued, UserId: 1}); err != nil {
+		t.Fatal("error should be nil")
+	}
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, received %d", len(lines))
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(lines[0], &fields); err != nil {
+		t.Fatal(err)
+	}
+	if fields["type"] != "login_failed" || fields["username"] != "daniel@gmail.com" {
+		t.Errorf("Unexpected event %v", fields)
+	}
+	if _, ok := fields["userId"]; ok {
+		t.Error("Empty fields should be omitted")
+	}
+}
+
+func TestFileSink(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	for i := 0; i < 2; i++ {
+		sink, err := NewFileSink(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = sink.Record(context.Background(), &Event{Type: TokenExtended, UserId: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := bytes.Count(content, []byte("\n")); lines != 2 {
+		t.Errorf("Events should be appended, received %d lines", lines)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected: %v, Received: %v", os.FileMode(0600), info.Mode().Perm())
+	}
+}
+
+func TestMultiSink(t *testing.T) {
+
+	var recorded int
+	ok := SinkFunc(func(context.Context, *Event) error {
+		recorded++
+		return nil
+	})
+	failing := SinkFunc(func(context.Context, *Event) error {
+		return errors.New("sink unavailable")
+	})
+
+	err := NewMultiSink(failing, ok, ok).Record(context.Background(), &Event{Type: TokenRevoked})
+	if err == nil || err.Error() != "sink unavailable" {
+		t.Errorf("Expected the sink error, received %v", err)
+	}
+	if recorded != 2 {
+		t.Errorf("Every sink should record the event, recorded %d", recorded)
+	}
+}
+
+func TestNewSinkFromConfig(t *testing.T) {
+
+	t.Run("Should be disabled by default", func(t *testing.T) {
+		_ = os.Unsetenv(envAuditSinks)
+
+		sink, err := NewSinkFromConfig()
+		if err != nil || sink != nil {
+			t.Errorf("Expected no sink, received %v, %v", sink, err)
+		}
+	})
+
+	t.Run("Should combine several sinks", func(t *testing.T) {
+		_ = os.Setenv(envAuditSinks, "stdout,file")
+		_ = os.Setenv(envAuditFile, filepath.Join(t.TempDir(), "audit.log"))
+		defer os.Unsetenv(envAuditSinks)
+		defer os.Unsetenv(envAuditFile)
+
+		sink, err := NewSinkFromConfig()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sinks, ok := sink.(multiSink); !ok || len(sinks) != 2 {
+			t.Errorf("Expected a multi sink of 2, received %T", sink)
+		}
+	})
+
+	t.Run("Should reject unknown sinks", func(t *testing.T) {
+		_ = os.Setenv(envAuditSinks, "syslog")
+		defer os.Unsetenv(envAuditSinks)
+
+		if _, err := NewSinkFromConfig(); err == nil {
+			t.Error("error should not be nil")
+		}
+	})
+}
+
+func TestCassandraSink(t *testing.T) {
+
+	if _, err := NewCassandraSink(); err == nil {
+		t.Error("The sink should not be built without a cassandra session")
+	}
+
+	session := cqltest.NewSession()
+	previous := db.Session
+	db.Session = session
+	defer func() { db.Session = previous }()
+
+	session.On(queryInsertEvent)
+
+	event := &Event{Type: TokenIssued, Time: time.Date(2021, 3, 1, 23, 30, 0, 0, time.UTC), UserId: 1, RequestId: "request-1"}
+	sink, err := NewCassandraSink()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = sink.Record(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+
+	values := session.Executed()[0].Values
+	if values[0] != "2021-03-01" || values[2] != "token_issued" || values[3] != int64(1) || values[11] != "request-1" {
+		t.Errorf("Unexpected values %v", values)
+	}
+}
@@ -0,0 +1,18 @@
+package audit
+
+import (
+	"github.com/labstack/echo/v4"
+)
+
+// EchoMiddleware stores the client address and user agent in the request context for the events recorded
+// and the tokens issued while serving it
+func EchoMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			r := c.Request()
+			ctx := WithUserAgent(WithRemoteIp(r.Context(), c.RealIP()), r.UserAgent())
+			c.SetRequest(r.WithContext(ctx))
+			return next(c)
+		}
+	}
+}
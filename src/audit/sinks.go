@@ -0,0 +1,80 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/danielgom/bookstore_oauthapi/src/repository/db"
+	"io"
+	"os"
+	"sync"
+)
+
+const (
+	queryInsertEvent = `INSERT INTO audit_events(day, time, type, userid, clientid, username, granttype, scope, expires, reason, remoteip, requestid) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`
+)
+
+// NewWriterSink writes every event as a JSON line to w
+func NewWriterSink(w io.Writer) Sink {
+	return &writerSink{encoder: json.NewEncoder(w)}
+}
+
+type writerSink struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+func (s *writerSink) Record(_ context.Context, event *Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.encoder.Encode(event)
+}
+
+// NewStdoutSink writes the events to stdout, for containers shipping their output
+func NewStdoutSink() Sink {
+	return NewWriterSink(os.Stdout)
+}
+
+// NewFileSink appends the events to the file at path, creating it when needed
+func NewFileSink(path string) (Sink, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("opening audit file: %w", err)
+	}
+	return NewWriterSink(f), nil
+}
+
+// NewCassandraSink inserts the events in the audit_events table, partitioned by day. Cassandra must be connected
+func NewCassandraSink() (Sink, error) {
+	if db.Session == nil {
+		return nil, errors.New("the cassandra audit sink needs TOKEN_STORE=cassandra")
+	}
+	return &cassandraSink{}, nil
+}
+
+type cassandraSink struct {
+}
+
+func (s *cassandraSink) Record(ctx context.Context, event *Event) error {
+	return db.Session.Query(queryInsertEvent, event.Time.UTC().Format("2006-01-02"), event.Time, string(event.Type),
+		event.UserId, event.ClientId, event.Username, event.GrantType, event.Scope, event.Expires, event.Reason,
+		event.RemoteIp, event.RequestId).WithContext(ctx).Exec()
+}
+
+// NewMultiSink records every event in all of sinks, returning the first error
+func NewMultiSink(sinks ...Sink) Sink {
+	return multiSink(sinks)
+}
+
+type multiSink []Sink
+
+func (m multiSink) Record(ctx context.Context, event *Event) error {
+	var firstErr error
+	for _, sink := range m {
+		if err := sink.Record(ctx, event); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,20 @@
+package clock
+
+import (
+	"time"
+)
+
+// Clock tells the current time. Time-dependent logic takes one instead of calling time.Now so tests can control
+// it, see clocktest
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// System is the wall clock
+var System Clock = systemClock{}
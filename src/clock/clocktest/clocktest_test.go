@@ -0,0 +1,27 @@
+package clocktest
+
+import (
+	"github.com/danielgom/bookstore_oauthapi/src/clock"
+	"testing"
+	"time"
+)
+
+func TestClock(t *testing.T) {
+
+	start := time.Unix(1600000000, 0)
+	var c clock.Clock = NewClock(start)
+
+	if !c.Now().Equal(start) {
+		t.Errorf("Expected: %v, Received: %v", start, c.Now())
+	}
+
+	c.(*Clock).Advance(time.Minute)
+	if !c.Now().Equal(start.Add(time.Minute)) {
+		t.Errorf("Expected: %v, Received: %v", start.Add(time.Minute), c.Now())
+	}
+
+	c.(*Clock).Set(start)
+	if !c.Now().Equal(start) {
+		t.Errorf("Expected: %v, Received: %v", start, c.Now())
+	}
+}
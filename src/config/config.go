@@ -0,0 +1,68 @@
+package config
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GetString returns the environment variable value for key, or fallback when it is not set
+func GetString(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok && strings.TrimSpace(value) != "" {
+		return strings.TrimSpace(value)
+	}
+	return fallback
+}
+
+// GetStrings returns the comma separated values of key, or fallback when it is not set
+func GetStrings(key string, fallback []string) []string {
+	value := GetString(key, "")
+	if value == "" {
+		return fallback
+	}
+
+	values := make([]string, 0)
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// GetInt returns key parsed as an int, or fallback when it is not set or invalid
+func GetInt(key string, fallback int) int {
+	value, err := strconv.Atoi(GetString(key, ""))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// GetFloat returns key parsed as a float64, or fallback when it is not set or invalid
+func GetFloat(key string, fallback float64) float64 {
+	value, err := strconv.ParseFloat(GetString(key, ""), 64)
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// GetBool returns key parsed as a bool, or fallback when it is not set or invalid
+func GetBool(key string, fallback bool) bool {
+	value, err := strconv.ParseBool(GetString(key, ""))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// GetDuration returns key parsed as a time.Duration, or fallback when it is not set or invalid
+func GetDuration(key string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(GetString(key, ""))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
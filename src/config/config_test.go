@@ -0,0 +1,74 @@
+package config
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestGetString(t *testing.T) {
+
+	_ = os.Setenv("CONFIG_TEST_STRING", "  value ")
+	defer os.Unsetenv("CONFIG_TEST_STRING")
+
+	if v := GetString("CONFIG_TEST_STRING", "fallback"); v != "value" {
+		t.Errorf("Expected: %s, Received: %s", "value", v)
+	}
+
+	if v := GetString("CONFIG_TEST_MISSING", "fallback"); v != "fallback" {
+		t.Errorf("Expected: %s, Received: %s", "fallback", v)
+	}
+}
+
+func TestGetStrings(t *testing.T) {
+
+	_ = os.Setenv("CONFIG_TEST_STRINGS", "http, ldap,,local")
+	defer os.Unsetenv("CONFIG_TEST_STRINGS")
+
+	values := GetStrings("CONFIG_TEST_STRINGS", nil)
+	if len(values) != 3 || values[0] != "http" || values[1] != "ldap" || values[2] != "local" {
+		t.Errorf("Unexpected values %v", values)
+	}
+
+	if values = GetStrings("CONFIG_TEST_MISSING", []string{"http"}); len(values) != 1 {
+		t.Errorf("Fallback should be returned, received %v", values)
+	}
+}
+
+func TestGetTyped(t *testing.T) {
+
+	_ = os.Setenv("CONFIG_TEST_INT", "12")
+	_ = os.Setenv("CONFIG_TEST_FLOAT", "0.25")
+	_ = os.Setenv("CONFIG_TEST_BOOL", "true")
+	_ = os.Setenv("CONFIG_TEST_DURATION", "90s")
+	_ = os.Setenv("CONFIG_TEST_INVALID", "not-a-value")
+	defer func() {
+		_ = os.Unsetenv("CONFIG_TEST_INT")
+		_ = os.Unsetenv("CONFIG_TEST_FLOAT")
+		_ = os.Unsetenv("CONFIG_TEST_BOOL")
+		_ = os.Unsetenv("CONFIG_TEST_DURATION")
+		_ = os.Unsetenv("CONFIG_TEST_INVALID")
+	}()
+
+	if v := GetInt("CONFIG_TEST_INT", 0); v != 12 {
+		t.Errorf("Expected: %d, Received: %d", 12, v)
+	}
+	if v := GetInt("CONFIG_TEST_INVALID", 5); v != 5 {
+		t.Errorf("Expected: %d, Received: %d", 5, v)
+	}
+	if v := GetFloat("CONFIG_TEST_FLOAT", 1); v != 0.25 {
+		t.Errorf("Expected: %f, Received: %f", 0.25, v)
+	}
+	if v := GetFloat("CONFIG_TEST_INVALID", 1); v != 1 {
+		t.Errorf("Expected: %f, Received: %f", 1.0, v)
+	}
+	if v := GetBool("CONFIG_TEST_BOOL", false); !v {
+		t.Error("Value should be true")
+	}
+	if v := GetDuration("CONFIG_TEST_DURATION", 0); v != 90*time.Second {
+		t.Errorf("Expected: %s, Received: %s", 90*time.Second, v)
+	}
+	if v := GetDuration("CONFIG_TEST_INVALID", time.Second); v != time.Second {
+		t.Errorf("Expected: %s, Received: %s", time.Second, v)
+	}
+}
@@ -0,0 +1,128 @@
+package cassandra
+
+import (
+	"fmt"
+	"github.com/danielgom/bookstore_oauthapi/src/config"
+	"github.com/gocql/gocql"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultKeyspace = "oauth"
+
+	envCassandraHosts                = "CASSANDRA_HOSTS"
+	envCassandraKeyspace             = "CASSANDRA_KEYSPACE"
+	envCassandraUsername             = "CASSANDRA_USERNAME"
+	envCassandraPassword             = "CASSANDRA_PASSWORD"
+	envCassandraTLSCa                = "CASSANDRA_TLS_CA"
+	envCassandraTLSCert              = "CASSANDRA_TLS_CERT"
+	envCassandraTLSKey               = "CASSANDRA_TLS_KEY"
+	envCassandraTLSVerifyHost        = "CASSANDRA_TLS_VERIFY_HOST"
+	envCassandraLocalDC              = "CASSANDRA_LOCAL_DC"
+	envCassandraConsistency          = "CASSANDRA_CONSISTENCY"
+	envCassandraConsistencyOverrides = "CASSANDRA_CONSISTENCY_OVERRIDES"
+	envCassandraTimeout              = "CASSANDRA_TIMEOUT"
+	envCassandraConnectTimeout       = "CASSANDRA_CONNECT_TIMEOUT"
+	envCassandraNumConns             = "CASSANDRA_NUM_CONNS"
+	envCassandraQueryRetries         = "CASSANDRA_QUERY_RETRIES"
+	envCassandraReconnectInterval    = "CASSANDRA_RECONNECT_INTERVAL"
+	envCassandraStartupAttempts      = "CASSANDRA_STARTUP_ATTEMPTS"
+	envCassandraStartupBackoff       = "CASSANDRA_STARTUP_BACKOFF"
+	envKeyspaceReplication           = "CASSANDRA_KEYSPACE_REPLICATION"
+
+	defaultReplication = `{'class': 'SimpleStrategy', 'replication_factor': 1}`
+)
+
+type Config struct {
+	Hosts    []string
+	Keyspace string
+	// Username and Password enable the password authenticator when Username is set
+	Username string
+	Password string
+	// TLSCaPath enables TLS, TLSCertPath and TLSKeyPath add a client certificate
+	TLSCaPath     string
+	TLSCertPath   string
+	TLSKeyPath    string
+	TLSVerifyHost bool
+	// LocalDC routes queries to the replicas of that datacenter, token aware. Empty uses every host
+	LocalDC     string
+	Consistency gocql.Consistency
+	// ConsistencyOverrides replaces Consistency for the statements on a table, keyed by "verb table",
+	// e.g. "select access_tokens"
+	ConsistencyOverrides map[string]gocql.Consistency
+	Timeout              time.Duration
+	ConnectTimeout       time.Duration
+	NumConns             int
+	// QueryRetries is the number of times a failed query is retried with exponential backoff
+	QueryRetries int
+	// ReconnectInterval is the first delay before reconnecting to a host marked down
+	ReconnectInterval time.Duration
+	// StartupAttempts is the number of times the first connection is attempted, doubling StartupBackoff between them
+	StartupAttempts int
+	StartupBackoff  time.Duration
+}
+
+// NewConfigFromConfig reads the CASSANDRA_* environment variables
+func NewConfigFromConfig() (Config, error) {
+
+	consistency, err := gocql.ParseConsistencyWrapper(config.GetString(envCassandraConsistency, "QUORUM"))
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid %s: %w", envCassandraConsistency, err)
+	}
+
+	overrides, err := parseConsistencyOverrides(config.GetStrings(envCassandraConsistencyOverrides, nil))
+	if err != nil {
+		return Config{}, err
+	}
+
+	return Config{
+		Hosts:                config.GetStrings(envCassandraHosts, []string{"127.0.0.1"}),
+		Keyspace:             config.GetString(envCassandraKeyspace, DefaultKeyspace),
+		Username:             config.GetString(envCassandraUsername, ""),
+		Password:             config.GetString(envCassandraPassword, ""),
+		TLSCaPath:            config.GetString(envCassandraTLSCa, ""),
+		TLSCertPath:          config.GetString(envCassandraTLSCert, ""),
+		TLSKeyPath:           config.GetString(envCassandraTLSKey, ""),
+		TLSVerifyHost:        config.GetBool(envCassandraTLSVerifyHost, true),
+		LocalDC:              config.GetString(envCassandraLocalDC, ""),
+		Consistency:          consistency,
+		ConsistencyOverrides: overrides,
+		Timeout:              config.GetDuration(envCassandraTimeout, 600*time.Millisecond),
+		ConnectTimeout:       config.GetDuration(envCassandraConnectTimeout, 5*time.Second),
+		NumConns:             config.GetInt(envCassandraNumConns, 2),
+		QueryRetries:         config.GetInt(envCassandraQueryRetries, 2),
+		ReconnectInterval:    config.GetDuration(envCassandraReconnectInterval, time.Second),
+		StartupAttempts:      config.GetInt(envCassandraStartupAttempts, 5),
+		StartupBackoff:       config.GetDuration(envCassandraStartupBackoff, time.Second),
+	}, nil
+}
+
+// parseConsistencyOverrides reads "verb table:CONSISTENCY" entries
+func parseConsistencyOverrides(entries []string) (map[string]gocql.Consistency, error) {
+
+	overrides := make(map[string]gocql.Consistency)
+	for _, entry := range entries {
+		i := strings.LastIndex(entry, ":")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid %s entry %q, expected verb table:CONSISTENCY", envCassandraConsistencyOverrides, entry)
+		}
+
+		key := strings.ToLower(strings.Join(strings.Fields(entry[:i]), " "))
+		if len(strings.Fields(key)) != 2 {
+			return nil, fmt.Errorf("invalid %s entry %q, expected verb table:CONSISTENCY", envCassandraConsistencyOverrides, entry)
+		}
+
+		consistency, err := gocql.ParseConsistencyWrapper(strings.TrimSpace(entry[i+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s entry %q: %w", envCassandraConsistencyOverrides, entry, err)
+		}
+		overrides[key] = consistency
+	}
+	return overrides, nil
+}
+
+// ReplicationFromConfig returns the CQL replication map used when the keyspace is created
+func ReplicationFromConfig() string {
+	return config.GetString(envKeyspaceReplication, defaultReplication)
+}
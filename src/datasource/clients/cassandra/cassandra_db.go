@@ -1,18 +1,196 @@
 package cassandra
 
 import (
+	"context"
+	"fmt"
+	"github.com/danielgom/bookstore_oauthapi/src/datasource/cql"
 	"github.com/danielgom/bookstore_oauthapi/src/repository/db"
+	"github.com/danielgom/bookstore_oauthapi/src/tracing"
 	"github.com/gocql/gocql"
+	"go.uber.org/zap"
+	"strings"
+	"time"
 )
 
-func Init() {
+const (
+	maxStartupBackoff = 30 * time.Second
+)
+
+var createSession = (*gocql.ClusterConfig).CreateSession
+
+// InitFromConfig calls Init with the configuration read from the CASSANDRA_* environment variables
+func InitFromConfig() error {
+	c, err := NewConfigFromConfig()
+	if err != nil {
+		return err
+	}
+	return Init(c)
+}
+
+// Init connects to the cluster and makes the session the one used by the repositories
+func Init(c Config) error {
 
-	cluster := gocql.NewCluster("127.0.0.1")
-	cluster.Keyspace = "oauth"
-	cluster.Consistency = gocql.Quorum
+	session, err := Connect(c)
+	if err != nil {
+		return err
+	}
+
+	if len(c.ConsistencyOverrides) == 0 {
+		db.Session = cql.NewSession(session)
+	} else {
+		db.Session = &overridingSession{Session: cql.NewSession(session), overrides: c.ConsistencyOverrides}
+	}
+	return nil
+}
+
+// Connect opens a session, retrying with exponential backoff while the cluster is unreachable.
+// An empty keyspace gives a session for keyspace level statements
+func Connect(c Config) (*gocql.Session, error) {
+
+	cluster := newCluster(c)
+	backoff := c.StartupBackoff
 
 	var err error
-	if db.Session, err = cluster.CreateSession(); err != nil {
-		panic(err)
+	for attempt := 1; ; attempt++ {
+		var session *gocql.Session
+		if session, err = createSession(cluster); err == nil {
+			return session, nil
+		}
+
+		if attempt >= c.StartupAttempts {
+			break
+		}
+
+		zap.L().Warn("cassandra unavailable, retrying", zap.Strings("hosts", c.Hosts), zap.Int("attempt", attempt),
+			zap.Duration("backoff", backoff), zap.Error(err))
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > maxStartupBackoff {
+			backoff = maxStartupBackoff
+		}
+	}
+
+	return nil, fmt.Errorf("connecting to cassandra %v: %w", c.Hosts, err)
+}
+
+func newCluster(c Config) *gocql.ClusterConfig {
+
+	cluster := gocql.NewCluster(c.Hosts...)
+	cluster.Keyspace = c.Keyspace
+	cluster.Consistency = c.Consistency
+	cluster.Timeout = c.Timeout
+	cluster.ConnectTimeout = c.ConnectTimeout
+	cluster.NumConns = c.NumConns
+	cluster.QueryObserver = tracing.QueryObserver{}
+
+	if c.Username != "" {
+		cluster.Authenticator = gocql.PasswordAuthenticator{Username: c.Username, Password: c.Password}
+	}
+
+	if c.TLSCaPath != "" {
+		cluster.SslOpts = &gocql.SslOptions{
+			CaPath:                 c.TLSCaPath,
+			CertPath:               c.TLSCertPath,
+			KeyPath:                c.TLSKeyPath,
+			EnableHostVerification: c.TLSVerifyHost,
+		}
+	}
+
+	if c.LocalDC != "" {
+		cluster.PoolConfig.HostSelectionPolicy = gocql.TokenAwareHostPolicy(gocql.DCAwareRoundRobinPolicy(c.LocalDC))
+	}
+
+	if c.QueryRetries > 0 {
+		cluster.RetryPolicy = &gocql.ExponentialBackoffRetryPolicy{NumRetries: c.QueryRetries, Min: 50 * time.Millisecond, Max: time.Second}
+	}
+
+	if c.ReconnectInterval > 0 {
+		cluster.ReconnectionPolicy = &gocql.ExponentialReconnectionPolicy{MaxRetries: 10, InitialInterval: c.ReconnectInterval, MaxInterval: time.Minute}
+	}
+
+	return cluster
+}
+
+// overridingSession applies the configured consistency to the statements on the overridden tables. An override
+// wins over the level the repositories set, which wins over CASSANDRA_CONSISTENCY
+type overridingSession struct {
+	cql.Session
+	overrides map[string]gocql.Consistency
+}
+
+func (s *overridingSession) Query(statement string, values ...interface{}) cql.Query {
+	q := s.Session.Query(statement, values...)
+	if consistency, ok := s.overrides[statementKey(statement)]; ok {
+		return &pinnedQuery{q.Consistency(consistency)}
+	}
+	return q
+}
+
+// pinnedQuery ignores the consistency set after the override
+type pinnedQuery struct {
+	cql.Query
+}
+
+func (q *pinnedQuery) WithContext(ctx context.Context) cql.Query {
+	return &pinnedQuery{q.Query.WithContext(ctx)}
+}
+
+func (q *pinnedQuery) Consistency(gocql.Consistency) cql.Query {
+	return q
+}
+
+// statementKey returns the lower case "verb table" of a CQL statement, e.g. "select access_tokens". A batch is keyed
+// on its first statement
+func statementKey(statement string) string {
+
+	fields := skipBatch(strings.Fields(strings.ToLower(statement)))
+	if len(fields) < 2 {
+		return ""
+	}
+
+	verb, table := fields[0], ""
+	switch verb {
+	case "update":
+		table = fields[1]
+	case "insert":
+		if fields[1] == "into" && len(fields) > 2 {
+			table = fields[2]
+		}
+	case "select", "delete":
+		for i := 1; i < len(fields)-1; i++ {
+			if fields[i] == "from" {
+				table = fields[i+1]
+				break
+			}
+		}
+	}
+
+	if i := strings.IndexAny(table, "(;"); i >= 0 {
+		table = table[:i]
+	}
+	if table == "" {
+		return ""
+	}
+	return verb + " " + table
+}
+
+// skipBatch drops the BEGIN [UNLOGGED|LOGGED|COUNTER] BATCH [USING TIMESTAMP n] opening the fields of a batch
+func skipBatch(fields []string) []string {
+
+	if len(fields) == 0 || fields[0] != "begin" {
+		return fields
+	}
+	fields = fields[1:]
+
+	if len(fields) > 0 && (fields[0] == "unlogged" || fields[0] == "logged" || fields[0] == "counter") {
+		fields = fields[1:]
+	}
+	if len(fields) == 0 || fields[0] != "batch" {
+		return nil
+	}
+	fields = fields[1:]
+
+	if len(fields) > 2 && fields[0] == "using" && fields[1] == "timestamp" {
+		fields = fields[3:]
 	}
+	return fields
 }
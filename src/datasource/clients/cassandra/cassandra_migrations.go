@@ -0,0 +1,75 @@
+package cassandra
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"github.com/danielgom/bookstore_oauthapi/src/datasource/migrations"
+	"github.com/gocql/gocql"
+	"io/fs"
+	"time"
+)
+
+const (
+	queryCreateHistory = `CREATE TABLE IF NOT EXISTS schema_migrations(version int PRIMARY KEY, name text, applied_at timestamp);`
+	queryGetHistory    = `SELECT version, name, applied_at FROM schema_migrations;`
+	queryInsertHistory = `INSERT INTO schema_migrations(version, name, applied_at) VALUES (?, ?, ?);`
+)
+
+//go:embed cql/*.cql
+var embedded embed.FS
+
+// Migrations returns the CQL migrations embedded in the binary, sorted by version
+func Migrations() ([]*migrations.Migration, error) {
+	sub, err := fs.Sub(embedded, "cql")
+	if err != nil {
+		return nil, err
+	}
+	return migrations.Load(sub)
+}
+
+// NewMigrationStore runs the migrations with session, which must be bound to the migrated keyspace
+func NewMigrationStore(session *gocql.Session) migrations.Store {
+	return &migrationStore{session}
+}
+
+type migrationStore struct {
+	session *gocql.Session
+}
+
+func (s *migrationStore) Init(ctx context.Context) error {
+	return s.Exec(ctx, queryCreateHistory)
+}
+
+func (s *migrationStore) Exec(ctx context.Context, statement string) error {
+	return s.session.Query(statement).WithContext(ctx).Exec()
+}
+
+func (s *migrationStore) Applied(ctx context.Context) (map[int]time.Time, error) {
+
+	applied := make(map[int]time.Time)
+	iter := s.session.Query(queryGetHistory).WithContext(ctx).Iter()
+
+	var version int
+	var name string
+	var appliedAt time.Time
+	for iter.Scan(&version, &name, &appliedAt) {
+		applied[version] = appliedAt
+	}
+
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	return applied, nil
+}
+
+func (s *migrationStore) Record(ctx context.Context, m *migrations.Migration, appliedAt time.Time) error {
+	return s.session.Query(queryInsertHistory, m.Version, m.Name, appliedAt).WithContext(ctx).Exec()
+}
+
+// EnsureKeyspace creates keyspace with the replication map when it does not exist, session must not be bound
+// to a keyspace
+func EnsureKeyspace(ctx context.Context, session *gocql.Session, keyspace, replication string) error {
+	statement := fmt.Sprintf(`CREATE KEYSPACE IF NOT EXISTS %s WITH replication = %s;`, keyspace, replication)
+	return session.Query(statement).WithContext(ctx).Exec()
+}
@@ -0,0 +1,234 @@
+package cassandra
+
+import (
+	"context"
+	"errors"
+	"github.com/danielgom/bookstore_oauthapi/src/datasource/cql/cqltest"
+	"github.com/danielgom/bookstore_oauthapi/src/repository/db"
+	"github.com/gocql/gocql"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatementKey(t *testing.T) {
+
+	for statement, expected := range map[string]string{
+		`SELECT accesstoken, clientid FROM access_tokens WHERE accesstoken=?;`:    "select access_tokens",
+		`INSERT INTO access_tokens(accesstoken, clientid) VALUES (?, ?);`:         "insert access_tokens",
+		`UPDATE access_tokens SET expires=? WHERE accesstoken=?;`:                 "update access_tokens",
+		`DELETE FROM mfa_secrets WHERE userid=?;`:                                 "delete mfa_secrets",
+		`select version from schema_migrations;`:                                  "select schema_migrations",
+		`CREATE TABLE IF NOT EXISTS access_tokens(accesstoken text PRIMARY KEY);`: "",
+	} {
+		if key := statementKey(statement); key != expected {
+			t.Errorf("%s\n Expected: %q, Received: %q", statement, expected, key)
+		}
+	}
+}
+
+func TestStatementKeyOfBatch(t *testing.T) {
+
+	for statement, expected := range map[string]string{
+		"BEGIN BATCH\nINSERT INTO access_tokens(accesstoken) VALUES (?);\nAPPLY BATCH;":               "insert access_tokens",
+		`BEGIN UNLOGGED BATCH USING TIMESTAMP 1 DELETE FROM mfa_secrets WHERE userid=?; APPLY BATCH;`: "delete mfa_secrets",
+		`BEGIN LOGGED BATCH APPLY BATCH;`: "",
+		`BEGIN TRANSACTION;`:              "",
+	} {
+		if key := statementKey(statement); key != expected {
+			t.Errorf("%s\n Expected: %q, Received: %q", statement, expected, key)
+		}
+	}
+}
+
+func TestParseConsistencyOverrides(t *testing.T) {
+
+	overrides, err := parseConsistencyOverrides([]string{"SELECT  access_tokens:LOCAL_ONE", "insert audit_events:one"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(overrides) != 2 {
+		t.Fatalf("Unexpected overrides %v", overrides)
+	}
+	if _, ok := overrides["select access_tokens"]; !ok {
+		t.Errorf("Keys should be normalized, received %v", overrides)
+	}
+
+	for _, entry := range []string{"access_tokens", "select:ONE"} {
+		if _, err := parseConsistencyOverrides([]string{entry}); err == nil {
+			t.Errorf("%s: error should not be nil", entry)
+		}
+	}
+}
+
+func TestNewConfigFromConfig(t *testing.T) {
+
+	_ = os.Setenv(envCassandraHosts, "cassandra-1, cassandra-2")
+	_ = os.Setenv(envCassandraLocalDC, "dc1")
+	defer os.Unsetenv(envCassandraHosts)
+	defer os.Unsetenv(envCassandraLocalDC)
+
+	c, err := NewConfigFromConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(c.Hosts) != 2 || c.Hosts[1] != "cassandra-2" || c.Keyspace != DefaultKeyspace || c.LocalDC != "dc1" {
+		t.Errorf("Unexpected config %+v", c)
+	}
+	if c.StartupAttempts != 5 || !c.TLSVerifyHost {
+		t.Errorf("Unexpected defaults %+v", c)
+	}
+}
+
+func TestNewCluster(t *testing.T) {
+
+	cluster := newCluster(Config{
+		Hosts:       []string{"cassandra-1"},
+		Keyspace:    DefaultKeyspace,
+		Username:    "oauth",
+		Password:    "secret",
+		TLSCaPath:   "ca.pem",
+		Consistency: gocql.LocalQuorum,
+		Timeout:     time.Second,
+	})
+
+	if cluster.Keyspace != DefaultKeyspace || cluster.Consistency != gocql.LocalQuorum || cluster.Timeout != time.Second {
+		t.Errorf("Unexpected cluster %+v", cluster)
+	}
+	if auth, ok := cluster.Authenticator.(gocql.PasswordAuthenticator); !ok || auth.Username != "oauth" {
+		t.Errorf("Password authenticator should be set, received %+v", cluster.Authenticator)
+	}
+	if cluster.SslOpts == nil || cluster.SslOpts.CaPath != "ca.pem" {
+		t.Errorf("TLS should be enabled, received %+v", cluster.SslOpts)
+	}
+
+	if cluster = newCluster(Config{Hosts: []string{"cassandra-1"}}); cluster.Authenticator != nil || cluster.SslOpts != nil {
+		t.Error("Authentication and TLS should be disabled by default")
+	}
+}
+
+func TestConnectRetries(t *testing.T) {
+
+	defer func() { createSession = (*gocql.ClusterConfig).CreateSession }()
+
+	attempts := 0
+	createSession = func(*gocql.ClusterConfig) (*gocql.Session, error) {
+		attempts++
+		if attempts < 3 {
+			return nil, errors.New("no hosts available")
+		}
+		return &gocql.Session{}, nil
+	}
+
+	if _, err := Connect(Config{StartupAttempts: 3, StartupBackoff: time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 3 {
+		t.Errorf("Expected 3 attempts, received %d", attempts)
+	}
+
+	attempts = 0
+	createSession = func(*gocql.ClusterConfig) (*gocql.Session, error) {
+		attempts++
+		return nil, errors.New("no hosts available")
+	}
+
+	if _, err := Connect(Config{StartupAttempts: 2, StartupBackoff: time.Millisecond}); err == nil {
+		t.Error("error should not be nil")
+	}
+	if attempts != 2 {
+		t.Errorf("Expected 2 attempts, received %d", attempts)
+	}
+}
+
+func TestOverridingSession(t *testing.T) {
+
+	fake := cqltest.NewSession()
+	fake.On(`SELECT accesstoken FROM access_tokens WHERE accesstoken=?;`).Row("abc123")
+	fake.On(`UPDATE access_tokens SET expires=? WHERE accesstoken=?;`)
+
+	session := &overridingSession{Session: fake, overrides: map[string]gocql.Consistency{"select access_tokens": gocql.LocalOne}}
+
+	var token string
+	if err := session.Query(`SELECT accesstoken FROM access_tokens WHERE accesstoken=?;`, "abc123").Scan(&token); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Query(`UPDATE access_tokens SET expires=? WHERE accesstoken=?;`, 1, "abc123").Exec(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := session.Query(`SELECT accesstoken FROM access_tokens WHERE accesstoken=?;`, "abc123").
+		Consistency(gocql.Quorum).WithContext(context.Background()).Scan(&token); err != nil {
+		t.Fatal(err)
+	}
+
+	executed := fake.Executed()
+	if executed[0].Consistency != gocql.LocalOne || executed[1].Consistency != 0 {
+		t.Errorf("Only the overridden statement should change consistency, received %+v", executed)
+	}
+	if executed[2].Consistency != gocql.LocalOne {
+		t.Errorf("The override should win over the consistency set on the query, received %v", executed[2].Consistency)
+	}
+}
+
+func TestOverridingSessionBatch(t *testing.T) {
+
+	const insert = "BEGIN BATCH\n" +
+		"INSERT INTO access_tokens(accesstoken, userid) VALUES (?, ?);\n" +
+		"INSERT INTO access_tokens_by_user(userid, accesstoken) VALUES (?, ?);\n" +
+		"APPLY BATCH;"
+
+	fake := cqltest.NewSession()
+	fake.On(insert)
+
+	session := &overridingSession{Session: fake, overrides: map[string]gocql.Consistency{"insert access_tokens": gocql.One}}
+	if err := session.Query(insert, "abc123", 1, 1, "abc123").Consistency(gocql.LocalQuorum).Exec(); err != nil {
+		t.Fatal(err)
+	}
+
+	if executed := fake.Executed(); len(executed) != 1 || executed[0].Consistency != gocql.One {
+		t.Errorf("The override should reach the batched insert, received %+v", executed)
+	}
+}
+
+func TestOverrideReachesTokenQueries(t *testing.T) {
+
+	fake := cqltest.NewSession()
+	fake.On(`SELECT accesstoken, clientid, expires, userid, scope, maxexpires, created, lastused, useragent, remoteip, act FROM access_tokens WHERE accesstoken=?;`).
+		Row("abc123", int64(1), time.Now().Add(time.Hour).Unix(), int64(2), "", int64(0), int64(0), int64(0), "", "", "")
+
+	previous := db.Session
+	db.Session = &overridingSession{Session: fake, overrides: map[string]gocql.Consistency{"select access_tokens": gocql.One}}
+	defer func() { db.Session = previous }()
+
+	repository := db.NewRepositoryWithConsistency(db.Consistency{Read: gocql.LocalQuorum})
+	if _, err := repository.GetByID(context.Background(), "abc123"); err != nil {
+		t.Fatal(err)
+	}
+
+	if executed := fake.Executed(); len(executed) != 1 || executed[0].Consistency != gocql.One {
+		t.Errorf("The override should reach the executed query, received %+v", executed)
+	}
+}
+
+func TestMigrations(t *testing.T) {
+
+	all, err := Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(all) == 0 || all[0].Version != 1 || all[0].Name != "create_access_tokens" {
+		t.Fatalf("Unexpected migrations %+v", all)
+	}
+	if !strings.Contains(all[0].Statements[0], "CREATE TABLE IF NOT EXISTS access_tokens") {
+		t.Errorf("Unexpected statement %q", all[0].Statements[0])
+	}
+	for i := 1; i < len(all); i++ {
+		if all[i].Version <= all[i-1].Version {
+			t.Errorf("Migrations should be sorted by version, received %d after %d", all[i].Version, all[i-1].Version)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package cql
+
+import (
+	"context"
+	"github.com/gocql/gocql"
+)
+
+// Session creates the queries run by the repositories. NewSession adapts a *gocql.Session and
+// cqltest.NewSession provides an in-memory fake for unit tests
+type Session interface {
+	Query(string, ...interface{}) Query
+}
+
+// Query is the part of *gocql.Query used by the repositories
+type Query interface {
+	WithContext(context.Context) Query
+	Consistency(gocql.Consistency) Query
+	// Scan reads the first row into dest, it returns gocql.ErrNotFound when there is none
+	Scan(...interface{}) error
+	Exec() error
+	// MapScanCAS runs a lightweight transaction and reports whether it was applied, dest receiving the current
+	// values when it was not
+	MapScanCAS(map[string]interface{}) (bool, error)
+	Iter() Iter
+}
+
+// Iter is the part of *gocql.Iter used by the repositories
+type Iter interface {
+	Scan(...interface{}) bool
+	Close() error
+}
+
+func NewSession(session *gocql.Session) Session {
+	return &gocqlSession{session}
+}
+
+type gocqlSession struct {
+	session *gocql.Session
+}
+
+func (s *gocqlSession) Query(statement string, values ...interface{}) Query {
+	return &gocqlQuery{s.session.Query(statement, values...)}
+}
+
+type gocqlQuery struct {
+	query *gocql.Query
+}
+
+func (q *gocqlQuery) WithContext(ctx context.Context) Query {
+	return &gocqlQuery{q.query.WithContext(ctx)}
+}
+
+func (q *gocqlQuery) Consistency(consistency gocql.Consistency) Query {
+	return &gocqlQuery{q.query.Consistency(consistency)}
+}
+
+func (q *gocqlQuery) Scan(dest ...interface{}) error {
+	return q.query.Scan(dest...)
+}
+
+func (q *gocqlQuery) Exec() error {
+	return q.query.Exec()
+}
+
+func (q *gocqlQuery) MapScanCAS(dest map[string]interface{}) (bool, error) {
+	return q.query.MapScanCAS(dest)
+}
+
+func (q *gocqlQuery) Iter() Iter {
+	return q.query.Iter()
+}
@@ -0,0 +1,208 @@
+package cqltest
+
+import (
+	"context"
+	"fmt"
+	"github.com/danielgom/bookstore_oauthapi/src/datasource/cql"
+	"github.com/gocql/gocql"
+	"reflect"
+	"sync"
+)
+
+// Session is an in-memory cql.Session. It answers each statement with the results registered by On and
+// records every executed query
+type Session struct {
+	mu       sync.Mutex
+	results  map[string][]*Result
+	executed []Executed
+}
+
+// Result holds the rows, or the error, returned for a statement
+type Result struct {
+	rows       [][]interface{}
+	err        error
+	notApplied bool
+}
+
+// Executed is a query run against the session
+type Executed struct {
+	Statement   string
+	Values      []interface{}
+	Consistency gocql.Consistency
+}
+
+func NewSession() *Session {
+	return &Session{results: make(map[string][]*Result)}
+}
+
+// On registers a result for statement. Results registered several times are returned in order, the last one
+// answering every later execution
+func (s *Session) On(statement string) *Result {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := new(Result)
+	s.results[statement] = append(s.results[statement], result)
+	return result
+}
+
+// Row appends a row, its values are assigned in order to the Scan destinations
+func (r *Result) Row(values ...interface{}) *Result {
+	r.rows = append(r.rows, values)
+	return r
+}
+
+func (r *Result) Error(err error) *Result {
+	r.err = err
+	return r
+}
+
+// NotApplied fails the condition of a lightweight transaction, which are applied otherwise
+func (r *Result) NotApplied() *Result {
+	r.notApplied = true
+	return r
+}
+
+// Executed returns the queries run so far, in order
+func (s *Session) Executed() []Executed {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Executed(nil), s.executed...)
+}
+
+func (s *Session) Query(statement string, values ...interface{}) cql.Query {
+	return &query{session: s, statement: statement, values: values, ctx: context.Background()}
+}
+
+func (s *Session) execute(q *query) (*Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := q.ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.executed = append(s.executed, Executed{Statement: q.statement, Values: q.values, Consistency: q.consistency})
+
+	results := s.results[q.statement]
+	if len(results) == 0 {
+		return nil, fmt.Errorf("cqltest: unexpected statement %q", q.statement)
+	}
+
+	result := results[0]
+	if len(results) > 1 {
+		s.results[q.statement] = results[1:]
+	}
+	return result, result.err
+}
+
+type query struct {
+	session     *Session
+	statement   string
+	values      []interface{}
+	consistency gocql.Consistency
+	ctx         context.Context
+}
+
+func (q *query) WithContext(ctx context.Context) cql.Query {
+	copied := *q
+	copied.ctx = ctx
+	return &copied
+}
+
+func (q *query) Consistency(consistency gocql.Consistency) cql.Query {
+	copied := *q
+	copied.consistency = consistency
+	return &copied
+}
+
+func (q *query) Scan(dest ...interface{}) error {
+	result, err := q.session.execute(q)
+	if err != nil {
+		return err
+	}
+	if len(result.rows) == 0 {
+		return gocql.ErrNotFound
+	}
+	return scanRow(result.rows[0], dest)
+}
+
+func (q *query) Exec() error {
+	_, err := q.session.execute(q)
+	return err
+}
+
+func (q *query) MapScanCAS(map[string]interface{}) (bool, error) {
+	result, err := q.session.execute(q)
+	if err != nil {
+		return false, err
+	}
+	return !result.notApplied, nil
+}
+
+func (q *query) Iter() cql.Iter {
+	result, err := q.session.execute(q)
+	if err != nil {
+		return &iter{err: err}
+	}
+	return &iter{rows: result.rows}
+}
+
+type iter struct {
+	rows [][]interface{}
+	err  error
+}
+
+func (i *iter) Scan(dest ...interface{}) bool {
+	if i.err != nil || len(i.rows) == 0 {
+		return false
+	}
+
+	row := i.rows[0]
+	i.rows = i.rows[1:]
+	if i.err = scanRow(row, dest); i.err != nil {
+		return false
+	}
+	return true
+}
+
+func (i *iter) Close() error {
+	return i.err
+}
+
+// scanRow assigns row to the dest pointers, converting between numeric types as gocql does
+func scanRow(row []interface{}, dest []interface{}) error {
+
+	if len(row) != len(dest) {
+		return fmt.Errorf("cqltest: row has %d columns, scanned into %d", len(row), len(dest))
+	}
+
+	for i, value := range row {
+		target := reflect.ValueOf(dest[i])
+		if target.Kind() != reflect.Ptr || target.IsNil() {
+			return fmt.Errorf("cqltest: destination %d is not a pointer", i)
+		}
+
+		target = target.Elem()
+		if value == nil {
+			target.Set(reflect.Zero(target.Type()))
+			continue
+		}
+
+		v := reflect.ValueOf(value)
+		switch {
+		case v.Type().AssignableTo(target.Type()):
+			target.Set(v)
+		case isNumber(v.Kind()) && isNumber(target.Kind()):
+			target.Set(v.Convert(target.Type()))
+		default:
+			return fmt.Errorf("cqltest: cannot scan %T into %s", value, target.Type())
+		}
+	}
+	return nil
+}
+
+func isNumber(kind reflect.Kind) bool {
+	return kind >= reflect.Int && kind <= reflect.Float64
+}
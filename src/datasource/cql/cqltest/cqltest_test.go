@@ -0,0 +1,110 @@
+package cqltest
+
+import (
+	"context"
+	"errors"
+	"github.com/gocql/gocql"
+	"testing"
+)
+
+func TestSessionScan(t *testing.T) {
+
+	session := NewSession()
+	session.On("SELECT").Row(1, "name", nil)
+
+	var id int64
+	var name, missing string
+	if err := session.Query("SELECT", 7).WithContext(context.Background()).Consistency(gocql.One).Scan(&id, &name, &missing); err != nil {
+		t.Fatal(err)
+	}
+	if id != 1 || name != "name" || missing != "" {
+		t.Errorf("Unexpected values %d, %q, %q", id, name, missing)
+	}
+
+	executed := session.Executed()
+	if len(executed) != 1 || executed[0].Values[0] != 7 || executed[0].Consistency != gocql.One {
+		t.Errorf("Unexpected queries %+v", executed)
+	}
+
+	if err := session.Query("SELECT").Scan(&name, &id, &missing); err == nil {
+		t.Error("Scanning a number into a string should fail")
+	}
+	if err := session.Query("SELECT").Scan(&id); err == nil {
+		t.Error("Scanning fewer columns should fail")
+	}
+}
+
+func TestSessionResults(t *testing.T) {
+
+	session := NewSession()
+	session.On("SELECT")
+	session.On("SELECT").Row(1)
+	session.On("DELETE").Error(errors.New("timeout"))
+
+	var id int
+	if err := session.Query("SELECT").Scan(&id); err != gocql.ErrNotFound {
+		t.Errorf("Expected: %v, Received: %v", gocql.ErrNotFound, err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := session.Query("SELECT").Scan(&id); err != nil || id != 1 {
+			t.Errorf("The last result should answer every later query, received %d, %v", id, err)
+		}
+	}
+
+	if err := session.Query("DELETE").Exec(); err == nil || err.Error() != "timeout" {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if err := session.Query("UPDATE").Exec(); err == nil {
+		t.Error("Unregistered statements should fail")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := session.Query("SELECT").WithContext(ctx).Scan(&id); err != context.Canceled {
+		t.Errorf("Expected: %v, Received: %v", context.Canceled, err)
+	}
+}
+
+func TestSessionIter(t *testing.T) {
+
+	session := NewSession()
+	session.On("SELECT").Row(1, "a").Row(2, "b")
+
+	iter := session.Query("SELECT").Iter()
+
+	var ids []int
+	var id int
+	var name string
+	for iter.Scan(&id, &name) {
+		ids = append(ids, id)
+	}
+	if err := iter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 2 || ids[0] != 1 || ids[1] != 2 {
+		t.Errorf("Unexpected rows %v", ids)
+	}
+
+	session.On("DELETE").Error(errors.New("timeout"))
+	iter = session.Query("DELETE").Iter()
+	if iter.Scan() || iter.Close() == nil {
+		t.Error("Iter should return the query error on close")
+	}
+}
+
+func TestSessionMapScanCAS(t *testing.T) {
+
+	session := NewSession()
+	session.On("UPDATE").Row()
+	session.On("DELETE").NotApplied()
+
+	if applied, err := session.Query("UPDATE").MapScanCAS(map[string]interface{}{}); err != nil || !applied {
+		t.Errorf("Lightweight transactions should be applied by default, received %v, %v", applied, err)
+	}
+	if applied, err := session.Query("DELETE").MapScanCAS(map[string]interface{}{}); err != nil || applied {
+		t.Errorf("The transaction should not be applied, received %v, %v", applied, err)
+	}
+	if _, err := session.Query("INSERT").MapScanCAS(map[string]interface{}{}); err == nil {
+		t.Error("Unregistered statements should fail")
+	}
+}
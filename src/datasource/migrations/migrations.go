@@ -0,0 +1,84 @@
+package migrations
+
+import (
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var fileNamePattern = regexp.MustCompile(`^(\d+)_(\w+)\.(cql|sql)$`)
+
+// Migration is one versioned .cql or .sql file. Cassandra has no transactional DDL, so a run stopped half way is
+// resumed by running the migration again: tables are created IF NOT EXISTS and Up skips the columns already added
+type Migration struct {
+	Version    int
+	Name       string
+	Statements []string
+}
+
+// Load reads the NNNN_name.cql or NNNN_name.sql files at the root of fsys, sorted by version
+func Load(fsys fs.FS) ([]*Migration, error) {
+
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]*Migration, 0, len(entries))
+	versions := make(map[int]string)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		match := fileNamePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %q, expected NNNN_name.cql or NNNN_name.sql", entry.Name())
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		if other, ok := versions[version]; ok {
+			return nil, fmt.Errorf("migrations %q and %q share version %d", other, entry.Name(), version)
+		}
+		versions[version] = entry.Name()
+
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		statements := splitStatements(string(content))
+		if len(statements) == 0 {
+			return nil, fmt.Errorf("migration %q has no statements", entry.Name())
+		}
+
+		migrations = append(migrations, &Migration{Version: version, Name: match[2], Statements: statements})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// splitStatements drops the -- comment lines and splits content on semicolons
+func splitStatements(content string) []string {
+
+	var b strings.Builder
+	for _, line := range strings.Split(content, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "--") {
+			continue
+		}
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+
+	statements := make([]string, 0)
+	for _, statement := range strings.Split(b.String(), ";") {
+		if statement = strings.TrimSpace(statement); statement != "" {
+			statements = append(statements, statement)
+		}
+	}
+	return statements
+}
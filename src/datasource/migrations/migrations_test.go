@@ -0,0 +1,167 @@
+package migrations
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+type fakeStore struct {
+	applied  map[int]time.Time
+	executed []string
+	failOn   string
+	// failWith is the error of failOn, a syntax error when nil
+	failWith error
+}
+
+func (s *fakeStore) Init(context.Context) error {
+	s.executed = append(s.executed, "init")
+	return nil
+}
+
+func (s *fakeStore) Exec(_ context.Context, statement string) error {
+	if statement == s.failOn {
+		if s.failWith != nil {
+			return s.failWith
+		}
+		return errors.New("syntax error")
+	}
+	s.executed = append(s.executed, statement)
+	return nil
+}
+
+func (s *fakeStore) Applied(context.Context) (map[int]time.Time, error) {
+	applied := make(map[int]time.Time)
+	for version, at := range s.applied {
+		applied[version] = at
+	}
+	return applied, nil
+}
+
+func (s *fakeStore) Record(_ context.Context, m *Migration, appliedAt time.Time) error {
+	s.applied[m.Version] = appliedAt
+	return nil
+}
+
+func TestLoad(t *testing.T) {
+
+	t.Run("Should split statements and skip comments", func(t *testing.T) {
+		migrations, err := Load(fstest.MapFS{
+			"0002_second.cql": {Data: []byte("-- two tables\nCREATE TABLE a(id int PRIMARY KEY);\n\nCREATE TABLE b(id int PRIMARY KEY);\n")},
+			"0001_first.cql":  {Data: []byte("CREATE TABLE c(id int PRIMARY KEY)")},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(migrations) != 2 || migrations[0].Name != "first" || migrations[1].Version != 2 {
+			t.Fatalf("Unexpected migrations %+v", migrations)
+		}
+		if len(migrations[1].Statements) != 2 || migrations[1].Statements[0] != "CREATE TABLE a(id int PRIMARY KEY)" {
+			t.Errorf("Unexpected statements %q", migrations[1].Statements)
+		}
+	})
+
+	t.Run("Should reject invalid files", func(t *testing.T) {
+		for name, fsys := range map[string]fstest.MapFS{
+			"name":      {"create.cql": {Data: []byte("CREATE TABLE a(id int PRIMARY KEY);")}},
+			"duplicate": {"1_a.cql": {Data: []byte("SELECT 1;")}, "0001_b.cql": {Data: []byte("SELECT 1;")}},
+			"empty":     {"0001_a.cql": {Data: []byte("-- nothing yet\n")}},
+		} {
+			if _, err := Load(fsys); err == nil {
+				t.Errorf("%s: error should not be nil", name)
+			}
+		}
+	})
+}
+
+func TestUp(t *testing.T) {
+
+	migrations := []*Migration{
+		{Version: 1, Name: "first", Statements: []string{"one"}},
+		{Version: 2, Name: "second", Statements: []string{"two", "three"}},
+		{Version: 3, Name: "third", Statements: []string{"four"}},
+	}
+
+	t.Run("Should apply pending migrations only", func(t *testing.T) {
+		store := &fakeStore{applied: map[int]time.Time{1: time.Now()}}
+		out := new(bytes.Buffer)
+
+		if err := Up(context.Background(), store, migrations, out); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := strings.Join(store.executed[1:], ","); got != "two,three,four" {
+			t.Errorf("Expected: %s, Received: %s", "two,three,four", got)
+		}
+		if len(store.applied) != 3 {
+			t.Errorf("Every migration should be recorded, received %v", store.applied)
+		}
+		if out.String() != "applied 0002_second\napplied 0003_third\n" {
+			t.Errorf("Unexpected output %q", out.String())
+		}
+
+		out.Reset()
+		if err := Up(context.Background(), store, migrations, out); err != nil || out.String() != "schema is up to date\n" {
+			t.Errorf("Unexpected second run %q, %v", out.String(), err)
+		}
+	})
+
+	t.Run("Should stop at the first failure", func(t *testing.T) {
+		store := &fakeStore{applied: map[int]time.Time{}, failOn: "three"}
+
+		err := Up(context.Background(), store, migrations, new(bytes.Buffer))
+		if err == nil || !strings.Contains(err.Error(), "0002_second statement 2") {
+			t.Fatalf("Unexpected error %v", err)
+		}
+
+		if _, ok := store.applied[2]; ok || len(store.applied) != 1 {
+			t.Errorf("Failed migration should not be recorded, received %v", store.applied)
+		}
+	})
+
+	t.Run("Should skip the columns already added", func(t *testing.T) {
+		alter := []*Migration{{Version: 1, Name: "add_scope", Statements: []string{"ALTER TABLE access_tokens ADD scope text"}}}
+		store := &fakeStore{applied: map[int]time.Time{}, failOn: alter[0].Statements[0],
+			failWith: errors.New("Invalid column name scope because it conflicts with an existing column")}
+
+		if err := Up(context.Background(), store, alter, new(bytes.Buffer)); err != nil || len(store.applied) != 1 {
+			t.Errorf("The migration should be recorded, received %v, %v", store.applied, err)
+		}
+
+		store = &fakeStore{applied: map[int]time.Time{}, failOn: "one", failWith: errors.New("table already exists")}
+		if err := Up(context.Background(), store, migrations, new(bytes.Buffer)); err == nil {
+			t.Error("Only ALTER TABLE ADD statements should be skipped")
+		}
+	})
+}
+
+func TestStatus(t *testing.T) {
+
+	appliedAt := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	store := &fakeStore{applied: map[int]time.Time{1: appliedAt}}
+	out := new(bytes.Buffer)
+
+	err := Status(context.Background(), store, []*Migration{
+		{Version: 1, Name: "first", Statements: []string{"one"}},
+		{Version: 2, Name: "second", Statements: []string{"two"}},
+	}, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Unexpected output %q", out.String())
+	}
+	if !strings.HasPrefix(lines[1], "0001") || !strings.HasSuffix(lines[1], "2021-03-01T10:00:00Z") {
+		t.Errorf("Unexpected line %q", lines[1])
+	}
+	if !strings.HasPrefix(lines[2], "0002") || !strings.HasSuffix(lines[2], "pending") {
+		t.Errorf("Unexpected line %q", lines[2])
+	}
+}
@@ -0,0 +1,94 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Store runs the migration statements and keeps the schema_migrations history
+type Store interface {
+	Init(context.Context) error
+	Exec(context.Context, string) error
+	Applied(context.Context) (map[int]time.Time, error)
+	Record(context.Context, *Migration, time.Time) error
+}
+
+// addColumnPattern matches the ALTER TABLE ... ADD statements, which have no IF NOT EXISTS in Cassandra
+var addColumnPattern = regexp.MustCompile(`(?is)^ALTER\s+TABLE\s+\S+\s+ADD\s`)
+
+// columnExists reports whether err is statement failing on a column a previous run already added
+func columnExists(statement string, err error) bool {
+	if !addColumnPattern.MatchString(statement) {
+		return false
+	}
+	message := err.Error()
+	// Cassandra and PostgreSQL messages
+	return strings.Contains(message, "conflicts with an existing column") || strings.Contains(message, "already exists")
+}
+
+// Up applies the pending migrations in version order, stopping at the first failure. A column already added by
+// an interrupted run is skipped. Each applied migration is printed to out
+func Up(ctx context.Context, store Store, migrations []*Migration, out io.Writer) error {
+
+	if err := store.Init(ctx); err != nil {
+		return fmt.Errorf("creating schema_migrations: %w", err)
+	}
+
+	applied, err := store.Applied(ctx)
+	if err != nil {
+		return fmt.Errorf("reading schema_migrations: %w", err)
+	}
+
+	pending := 0
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		pending++
+
+		for i, statement := range m.Statements {
+			if err := store.Exec(ctx, statement); err != nil && !columnExists(statement, err) {
+				return fmt.Errorf("migration %04d_%s statement %d: %w", m.Version, m.Name, i+1, err)
+			}
+		}
+
+		if err := store.Record(ctx, m, time.Now().UTC()); err != nil {
+			return fmt.Errorf("recording migration %04d_%s: %w", m.Version, m.Name, err)
+		}
+		fmt.Fprintf(out, "applied %04d_%s\n", m.Version, m.Name)
+	}
+
+	if pending == 0 {
+		fmt.Fprintln(out, "schema is up to date")
+	}
+	return nil
+}
+
+// Status prints every migration with the time it was applied, or pending
+func Status(ctx context.Context, store Store, migrations []*Migration, out io.Writer) error {
+
+	if err := store.Init(ctx); err != nil {
+		return fmt.Errorf("creating schema_migrations: %w", err)
+	}
+
+	applied, err := store.Applied(ctx)
+	if err != nil {
+		return fmt.Errorf("reading schema_migrations: %w", err)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+	for _, m := range migrations {
+		state := "pending"
+		if appliedAt, ok := applied[m.Version]; ok {
+			state = appliedAt.UTC().Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%04d\t%s\t%s\n", m.Version, m.Name, state)
+	}
+	return w.Flush()
+}
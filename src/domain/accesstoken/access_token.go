@@ -1,7 +1,7 @@
 package accesstoken
 
 import (
-	"fmt"
+	"github.com/danielgom/bookstore_oauthapi/src/clock"
 	"github.com/danielgom/bookstore_oauthapi/src/utils/cryptoutils"
 	"github.com/danielgom/bookstore_utils-go/errors"
 	"strings"
@@ -9,9 +9,11 @@ import (
 )
 
 const (
-	expirationTime             = 24
-	grantTypePassword          = "password"
-	grantTypeClientCredentials = "clientCredentials"
+	GrantTypePassword          = "password"
+	GrantTypeClientCredentials = "clientCredentials"
+	GrantTypeMfaOtp            = "mfaOtp"
+	// GrantTypeDeviceCode is the RFC 8628 grant polled by devices once their user code was entered
+	GrantTypeDeviceCode = "urn:ietf:params:oauth:grant-type:device_code"
 )
 
 type AtRequest struct {
@@ -27,13 +29,54 @@ type AtRequest struct {
 
 	ClientId     string `json:"clientId,omitempty"`
 	ClientSecret string `json:"clientSecret"`
+
+	// Used for mfaOtp grant type
+
+	MfaToken string `json:"mfaToken,omitempty"`
+	OtpCode  string `json:"otpCode,omitempty"`
+
+	// Used for token exchange grant type, along with the client credentials of the caller
+
+	SubjectToken     string `json:"subjectToken,omitempty"`
+	SubjectTokenType string `json:"subjectTokenType,omitempty"`
+
+	// Used for device code grant type, along with the client id of the device
+
+	DeviceCode string `json:"deviceCode,omitempty"`
 }
 
 func (request *AtRequest) Validate() errors.RestErr {
 	switch request.GrantType {
-	case grantTypePassword:
-
-	case grantTypeClientCredentials:
+	case GrantTypePassword:
+
+	case GrantTypeClientCredentials:
+
+	case GrantTypeMfaOtp:
+		if strings.TrimSpace(request.MfaToken) == "" {
+			return errors.NewBadRequestError("Invalid mfaToken parameter")
+		}
+		if strings.TrimSpace(request.OtpCode) == "" {
+			return errors.NewBadRequestError("Invalid otpCode parameter")
+		}
+
+	case GrantTypeDeviceCode:
+		if strings.TrimSpace(request.DeviceCode) == "" {
+			return errors.NewBadRequestError("Invalid deviceCode parameter")
+		}
+		if strings.TrimSpace(request.ClientId) == "" {
+			return errors.NewBadRequestError("Invalid clientId parameter")
+		}
+
+	case GrantTypeTokenExchange:
+		if strings.TrimSpace(request.SubjectToken) == "" {
+			return errors.NewBadRequestError("Invalid subjectToken parameter")
+		}
+		if request.SubjectTokenType != TokenTypeAccessToken {
+			return errors.NewBadRequestError("Invalid subjectTokenType parameter")
+		}
+		if strings.TrimSpace(request.ClientId) == "" || request.ClientSecret == "" {
+			return errors.NewBadRequestError("Invalid client credentials")
+		}
 
 	default:
 		return errors.NewBadRequestError("Invalid grantType parameter")
@@ -43,11 +86,49 @@ func (request *AtRequest) Validate() errors.RestErr {
 	return nil
 }
 
+// HasScope reports whether the request asks for scope
+func (request *AtRequest) HasScope(scope string) bool {
+	for _, requested := range strings.Fields(request.Scope) {
+		if requested == scope {
+			return true
+		}
+	}
+	return false
+}
+
 type AccessToken struct {
 	AccessToken string `json:"accessToken"`
 	UserId      int64  `json:"userId"`
 	ClientId    int64  `json:"clientId,omitempty"`
 	Expires     int64  `json:"expires"`
+	Scope       string `json:"scope,omitempty"`
+	// MaxExpires caps the sliding expiration of the token, zero for tokens with a fixed expiration
+	MaxExpires int64 `json:"maxExpires,omitempty"`
+	// Act is the client the token was exchanged to, nil for tokens not issued by the token exchange grant
+	Act *Actor `json:"act,omitempty"`
+	// IdToken is the OpenID Connect id token issued along, it is only returned to the client and never stored
+	IdToken string `json:"-"`
+
+	// session metadata, captured at issuance except LastUsed which is refreshed as the token is looked up
+	Created   int64  `json:"created,omitempty"`
+	LastUsed  int64  `json:"lastUsed,omitempty"`
+	UserAgent string `json:"userAgent,omitempty"`
+	RemoteIp  string `json:"remoteIp,omitempty"`
+}
+
+// MfaRequiredError is returned by the password grant when the user must complete a TOTP challenge
+type MfaRequiredError struct {
+	errors.RestErr
+	MfaToken string
+	Expires  int64
+}
+
+func NewMfaRequiredError(mfaToken string, expires int64) *MfaRequiredError {
+	return &MfaRequiredError{
+		RestErr:  errors.NewUnauthorizedError("mfa_required"),
+		MfaToken: mfaToken,
+		Expires:  expires,
+	}
 }
 
 func (at *AccessToken) Validate() errors.RestErr {
@@ -76,15 +157,49 @@ func (at *AccessToken) Validate() errors.RestErr {
 	return nil
 }
 
-func GetNewAccessToken(userId int64) *AccessToken {
-	at := &AccessToken{
-		UserId:  userId,
-		Expires: time.Now().Add(time.Hour * expirationTime).Unix(),
+// GetNewAccessToken returns a token of userId with a random id, issued at the time of c and expiring after
+// lifetime, see LifetimePolicy
+func GetNewAccessToken(c clock.Clock, userId int64, lifetime time.Duration) (*AccessToken, errors.RestErr) {
+	value, err := cryptoutils.GetRandomString(16)
+	if err != nil {
+		return nil, errors.NewInternalServerError("error generating access token", err)
+	}
+
+	now := c.Now()
+	return &AccessToken{
+		AccessToken: value,
+		UserId:      userId,
+		Expires:     now.Add(lifetime).Unix(),
+		Created:     now.Unix(),
+	}, nil
+}
+
+// Lifetime returns the time the token was issued for, its sliding expiration included
+func (at *AccessToken) Lifetime() int64 {
+	return at.Expires - at.Created
+}
+
+// Scopes returns the space separated scope of the token as a list
+func (at *AccessToken) Scopes() []string {
+	return strings.Fields(at.Scope)
+}
+
+// HasScopes reports whether the token was granted every one of scopes
+func (at *AccessToken) HasScopes(scopes ...string) bool {
+	granted := make(map[string]bool)
+	for _, scope := range at.Scopes() {
+		granted[scope] = true
+	}
+
+	for _, scope := range scopes {
+		if !granted[scope] {
+			return false
+		}
 	}
-	at.AccessToken = cryptoutils.GetMd5(fmt.Sprintf("at-%d-%d-ran", at.UserId, at.Expires))
-	return at
+	return true
 }
 
-func (at *AccessToken) IsExpired() bool {
-	return time.Unix(at.Expires, 0).Before(time.Now())
+// IsExpired reports whether the time of c is past Expires, the token is still valid at Expires itself
+func (at *AccessToken) IsExpired(c clock.Clock) bool {
+	return time.Unix(at.Expires, 0).Before(c.Now())
 }
@@ -1,14 +1,15 @@
 package accesstoken
 
 import (
+	"github.com/danielgom/bookstore_oauthapi/src/clock/clocktest"
 	"testing"
 	"time"
 )
 
 func TestAccessTokenConstants(t *testing.T) {
 
-	if expirationTime != 24 {
-		t.Error("Expiration time should be 24 hours")
+	if DefaultLifetime != 24*time.Hour {
+		t.Error("Default lifetime should be 24 hours")
 	}
 }
 
@@ -41,6 +42,79 @@ func TestAtRequestValidate(t *testing.T) {
 		}
 	})
 
+	t.Run("Should throw error on mfaOtp grant_type without code", func(t *testing.T) {
+		t.Parallel()
+		atR := &AtRequest{
+			GrantType: "mfaOtp",
+			MfaToken:  "mfa-token",
+		}
+
+		err := atR.Validate()
+
+		if err == nil {
+			t.Error("error should not be nil")
+		}
+	})
+
+	t.Run("Should pass the validation with mfaOtp grant_type", func(t *testing.T) {
+		t.Parallel()
+		atR := &AtRequest{
+			GrantType: "mfaOtp",
+			MfaToken:  "mfa-token",
+			OtpCode:   "123456",
+		}
+
+		err := atR.Validate()
+
+		if err != nil {
+			t.Error("error should be nil")
+		}
+	})
+
+	t.Run("Should validate the device code grant_type", func(t *testing.T) {
+		t.Parallel()
+		if err := (&AtRequest{GrantType: GrantTypeDeviceCode, DeviceCode: "device-code", ClientId: "7"}).Validate(); err != nil {
+			t.Error("error should be nil")
+		}
+		if err := (&AtRequest{GrantType: GrantTypeDeviceCode, ClientId: "7"}).Validate(); err == nil {
+			t.Error("error should not be nil without device code")
+		}
+		if err := (&AtRequest{GrantType: GrantTypeDeviceCode, DeviceCode: "device-code"}).Validate(); err == nil {
+			t.Error("error should not be nil without client id")
+		}
+	})
+
+	t.Run("Should throw error on token exchange without a valid subject token or client", func(t *testing.T) {
+		t.Parallel()
+		for _, atR := range []*AtRequest{
+			{GrantType: GrantTypeTokenExchange, SubjectTokenType: TokenTypeAccessToken, ClientId: "3", ClientSecret: "secret"},
+			{GrantType: GrantTypeTokenExchange, SubjectToken: "abc123", SubjectTokenType: "urn:ietf:params:oauth:token-type:jwt",
+				ClientId: "3", ClientSecret: "secret"},
+			{GrantType: GrantTypeTokenExchange, SubjectToken: "abc123", SubjectTokenType: TokenTypeAccessToken, ClientId: "3"},
+		} {
+			if err := atR.Validate(); err == nil {
+				t.Errorf("error should not be nil for %v", atR)
+			}
+		}
+	})
+
+	t.Run("Should pass the validation with token exchange grant_type", func(t *testing.T) {
+		t.Parallel()
+		atR := &AtRequest{
+			GrantType:        GrantTypeTokenExchange,
+			SubjectToken:     "abc123",
+			SubjectTokenType: TokenTypeAccessToken,
+			ClientId:         "3",
+			ClientSecret:     "secret",
+		}
+
+		err := atR.Validate()
+
+		if err != nil {
+			t.Error("error should be nil")
+		}
+	})
+
 	t.Run("Should pass the validation with credentials grant_type", func(t *testing.T) {
 		t.Parallel()
 		atR := &AtRequest{
@@ -138,30 +212,89 @@ func TestAccessTokenValidate(t *testing.T) {
 
 func TestGetNewAccessToken(t *testing.T) {
 	t.Parallel()
-	at := GetNewAccessToken(0)
-	if at.IsExpired() {
-		t.Error("Brand access token should not be nil")
+	now := time.Unix(1600000000, 0)
+	c := clocktest.NewClock(now)
+	at, err := GetNewAccessToken(c, 0, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if at.Created != 1600000000 {
+		t.Errorf("Expected created: 1600000000, Received: %d", at.Created)
 	}
 
-	if at.AccessToken == "" {
-		t.Error("New access token should not have defined access token id")
+	if at.Expires != 1600003600 {
+		t.Errorf("Expected expires: 1600003600, Received: %d", at.Expires)
+	}
+
+	if len(at.AccessToken) != 32 {
+		t.Errorf("Unexpected access token id %s", at.AccessToken)
+	}
+
+	// two logins of the same user within a second get distinct ids
+	if other, _ := GetNewAccessToken(c, 0, time.Hour); other.AccessToken == at.AccessToken {
+		t.Errorf("Access token id %s issued twice", at.AccessToken)
 	}
 
 	if at.UserId != 0 {
 		t.Error("New access token should not have an associated user id")
 	}
+
+	if at.Lifetime() != 3600 {
+		t.Errorf("New access token should live 1 hour, received %ds", at.Lifetime())
+	}
 }
 
 func TestIsExpired(t *testing.T) {
 	t.Parallel()
+	c := clocktest.NewClock(time.Unix(1600000000, 0))
+
 	at := AccessToken{}
-	if !at.IsExpired() {
+	if !at.IsExpired(c) {
 		t.Error("Empty access token should be expired by default")
 	}
 
-	at.Expires = time.Now().Add(time.Hour * 3).Unix()
-
-	if at.IsExpired() {
+	at.Expires = 1600000000 + 3*3600
+	if at.IsExpired(c) {
 		t.Error("Access token created for 3 hours should NOT be expired")
 	}
+
+	c.Advance(3 * time.Hour)
+	if at.IsExpired(c) {
+		t.Error("Access token should NOT be expired at its expiration time")
+	}
+
+	c.Advance(time.Nanosecond)
+	if !at.IsExpired(c) {
+		t.Error("Access token should be expired right after its expiration time")
+	}
+}
+
+func TestHasScopes(t *testing.T) {
+	t.Parallel()
+	at := AccessToken{Scope: " books:read  books:write "}
+
+	if len(at.Scopes()) != 2 {
+		t.Errorf("Expected 2 scopes, received %v", at.Scopes())
+	}
+
+	if !at.HasScopes() || !at.HasScopes("books:read") || !at.HasScopes("books:write", "books:read") {
+		t.Error("Access token should have the granted scopes")
+	}
+
+	if at.HasScopes("books:read", "admin") {
+		t.Error("Access token should not have the admin scope")
+	}
+}
+
+func TestAtRequestHasScope(t *testing.T) {
+	t.Parallel()
+	request := AtRequest{Scope: "openid  books:read"}
+
+	if !request.HasScope("openid") || !request.HasScope("books:read") {
+		t.Error("Request should ask for its scopes")
+	}
+	if request.HasScope("open") || request.HasScope("") {
+		t.Error("Request should only ask for whole scopes")
+	}
 }
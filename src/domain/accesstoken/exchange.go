@@ -0,0 +1,56 @@
+package accesstoken
+
+import (
+	"encoding/json"
+	"github.com/danielgom/bookstore_utils-go/errors"
+	"strings"
+)
+
+const (
+	// GrantTypeTokenExchange is the RFC 8693 grant, exchanging a token of a user for a narrower one
+	GrantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+	// TokenTypeAccessToken is the only subject token type accepted by the token exchange grant
+	TokenTypeAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+)
+
+// Actor is the RFC 8693 act claim, the client acting on behalf of the user of a token. Act is the actor of the
+// subject token when it was itself obtained by an exchange
+type Actor struct {
+	ClientId int64  `json:"clientId"`
+	Act      *Actor `json:"act,omitempty"`
+}
+
+// EncodeActor returns the stored form of an actor, empty for tokens without one
+func EncodeActor(act *Actor) string {
+	if act == nil {
+		return ""
+	}
+	encoded, _ := json.Marshal(act)
+	return string(encoded)
+}
+
+// DecodeActor parses the stored form of an actor
+func DecodeActor(encoded string) (*Actor, error) {
+	if encoded == "" {
+		return nil, nil
+	}
+	act := new(Actor)
+	if err := json.Unmarshal([]byte(encoded), act); err != nil {
+		return nil, err
+	}
+	return act, nil
+}
+
+// ExchangeScope returns the scope of a token exchanged for at. Every requested scope must be granted to at, at
+// keeps its whole scope when none is requested
+func (at *AccessToken) ExchangeScope(requested string) (string, errors.RestErr) {
+	scopes := strings.Fields(requested)
+	if len(scopes) == 0 {
+		return at.Scope, nil
+	}
+	if !at.HasScopes(scopes...) {
+		return "", errors.NewBadRequestError("Requested scope exceeds the scope of the subject token")
+	}
+	return strings.Join(scopes, " "), nil
+}
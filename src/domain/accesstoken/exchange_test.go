@@ -0,0 +1,47 @@
+package accesstoken
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestActorEncoding(t *testing.T) {
+
+	if EncodeActor(nil) != "" {
+		t.Error("Tokens without actor should be stored empty")
+	}
+	if act, err := DecodeActor(""); act != nil || err != nil {
+		t.Errorf("Expected no actor, received %+v, %v", act, err)
+	}
+
+	encoded := EncodeActor(&Actor{ClientId: 5, Act: &Actor{ClientId: 3}})
+	if encoded != `{"clientId":5,"act":{"clientId":3}}` {
+		t.Errorf("Unexpected encoding %s", encoded)
+	}
+
+	act, err := DecodeActor(encoded)
+	if err != nil || act.ClientId != 5 || act.Act == nil || act.Act.ClientId != 3 || act.Act.Act != nil {
+		t.Errorf("Unexpected actor %+v, %v", act, err)
+	}
+
+	if _, err = DecodeActor("{"); err == nil {
+		t.Error("error should not be nil")
+	}
+}
+
+func TestExchangeScope(t *testing.T) {
+
+	at := &AccessToken{Scope: "orders:read payments:write payments:read"}
+
+	if scope, err := at.ExchangeScope(""); err != nil || scope != at.Scope {
+		t.Errorf("The subject scope should be kept when none is requested, received %q, %v", scope, err)
+	}
+
+	if scope, err := at.ExchangeScope(" payments:write  payments:read "); err != nil || scope != "payments:write payments:read" {
+		t.Errorf("Unexpected scope %q, %v", scope, err)
+	}
+
+	if _, err := at.ExchangeScope("payments:write admin"); err == nil || err.Status() != http.StatusBadRequest {
+		t.Errorf("Expected bad request, received %v", err)
+	}
+}
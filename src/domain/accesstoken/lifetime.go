@@ -0,0 +1,41 @@
+package accesstoken
+
+import (
+	"time"
+)
+
+// DefaultLifetime applies to the tokens no lifetime rule matches
+const DefaultLifetime = 24 * time.Hour
+
+// LifetimePolicy resolves how long a new token lives. The lifetime of its client applies, else the one of its
+// grant type, else Default. It is then capped by the shortest lifetime of the requested scopes, so asking for a
+// sensitive scope always shortens the token
+type LifetimePolicy struct {
+	// Default of zero is DefaultLifetime
+	Default time.Duration
+	Clients map[int64]time.Duration
+	Grants  map[string]time.Duration
+	Scopes  map[string]time.Duration
+}
+
+func (p LifetimePolicy) Lifetime(clientId int64, grantType string, scopes []string) time.Duration {
+
+	lifetime := p.Default
+	if lifetime <= 0 {
+		lifetime = DefaultLifetime
+	}
+
+	if client, ok := p.Clients[clientId]; ok && clientId != 0 {
+		lifetime = client
+	} else if grant, ok := p.Grants[grantType]; ok {
+		lifetime = grant
+	}
+
+	for _, scope := range scopes {
+		if capped, ok := p.Scopes[scope]; ok && capped < lifetime {
+			lifetime = capped
+		}
+	}
+
+	return lifetime
+}
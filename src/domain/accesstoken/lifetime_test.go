@@ -0,0 +1,40 @@
+package accesstoken
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLifetimePolicy(t *testing.T) {
+
+	policy := LifetimePolicy{
+		Clients: map[int64]time.Duration{12: 24 * time.Hour},
+		Grants:  map[string]time.Duration{GrantTypeClientCredentials: time.Hour},
+		Scopes:  map[string]time.Duration{"admin": 15 * time.Minute, "books:write": 2 * time.Hour},
+	}
+
+	cases := []struct {
+		name      string
+		clientId  int64
+		grantType string
+		scopes    []string
+		expected  time.Duration
+	}{
+		{"default", 0, GrantTypePassword, []string{"books:read"}, DefaultLifetime},
+		{"grant", 0, GrantTypeClientCredentials, nil, time.Hour},
+		{"client over grant", 12, GrantTypeClientCredentials, nil, 24 * time.Hour},
+		{"unknown client", 13, GrantTypeClientCredentials, nil, time.Hour},
+		{"shortest scope", 12, GrantTypePassword, []string{"books:write", "admin"}, 15 * time.Minute},
+		{"scope longer than grant", 0, GrantTypeClientCredentials, []string{"books:write"}, time.Hour},
+	}
+
+	for _, c := range cases {
+		if lifetime := policy.Lifetime(c.clientId, c.grantType, c.scopes); lifetime != c.expected {
+			t.Errorf("%s: expected %v, received %v", c.name, c.expected, lifetime)
+		}
+	}
+
+	if lifetime := (LifetimePolicy{Default: time.Hour}).Lifetime(0, GrantTypePassword, nil); lifetime != time.Hour {
+		t.Errorf("Expected the default lifetime, received %v", lifetime)
+	}
+}
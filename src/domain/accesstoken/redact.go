@@ -0,0 +1,63 @@
+package accesstoken
+
+import (
+	"fmt"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	redacted = "[REDACTED]"
+)
+
+// redact hides secret values, keeping whether they were set at all
+func redact(value string) string {
+	if value == "" {
+		return ""
+	}
+	return redacted
+}
+
+// String keeps the password, client secret, mfa, subject token and device code values out of logs and %v formatting
+func (request AtRequest) String() string {
+	return fmt.Sprintf("{GrantType:%s Scope:%s Username:%s Password:%s ClientId:%s ClientSecret:%s MfaToken:%s OtpCode:%s SubjectToken:%s DeviceCode:%s}",
+		request.GrantType, request.Scope, request.Username, redact(request.Password), request.ClientId,
+		redact(request.ClientSecret), redact(request.MfaToken), redact(request.OtpCode), redact(request.SubjectToken),
+		redact(request.DeviceCode))
+}
+
+func (request AtRequest) GoString() string {
+	return "accesstoken.AtRequest" + request.String()
+}
+
+func (request AtRequest) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("grantType", request.GrantType)
+	enc.AddString("scope", request.Scope)
+	enc.AddString("username", request.Username)
+	enc.AddString("password", redact(request.Password))
+	enc.AddString("clientId", request.ClientId)
+	enc.AddString("clientSecret", redact(request.ClientSecret))
+	enc.AddString("mfaToken", redact(request.MfaToken))
+	enc.AddString("otpCode", redact(request.OtpCode))
+	enc.AddString("subjectToken", redact(request.SubjectToken))
+	enc.AddString("deviceCode", redact(request.DeviceCode))
+	return nil
+}
+
+// String keeps the token value out of logs and %v formatting
+func (at AccessToken) String() string {
+	return fmt.Sprintf("{AccessToken:%s UserId:%d ClientId:%d Expires:%d Scope:%s}",
+		redact(at.AccessToken), at.UserId, at.ClientId, at.Expires, at.Scope)
+}
+
+func (at AccessToken) GoString() string {
+	return "accesstoken.AccessToken" + at.String()
+}
+
+func (at AccessToken) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("accessToken", redact(at.AccessToken))
+	enc.AddInt64("userId", at.UserId)
+	enc.AddInt64("clientId", at.ClientId)
+	enc.AddInt64("expires", at.Expires)
+	enc.AddString("scope", at.Scope)
+	return nil
+}
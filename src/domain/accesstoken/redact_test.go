@@ -0,0 +1,60 @@
+package accesstoken
+
+import (
+	"fmt"
+	"go.uber.org/zap/zapcore"
+	"strings"
+	"testing"
+)
+
+func TestAtRequestRedaction(t *testing.T) {
+
+	request := &AtRequest{
+		GrantType:    GrantTypePassword,
+		Username:     "daniel@gmail.com",
+		Password:     "the_password",
+		ClientSecret: "the_client_secret",
+		OtpCode:      "123456",
+		SubjectToken: "the_subject_token",
+		DeviceCode:   "the_device_code",
+	}
+
+	for _, formatted := range []string{fmt.Sprint(request), fmt.Sprintf("%+v", *request), fmt.Sprintf("%#v", request)} {
+		if strings.Contains(formatted, "the_password") || strings.Contains(formatted, "the_client_secret") ||
+			strings.Contains(formatted, "123456") || strings.Contains(formatted, "the_subject_token") ||
+			strings.Contains(formatted, "the_device_code") {
+			t.Errorf("Secrets should be redacted, received %s", formatted)
+		}
+		if !strings.Contains(formatted, "daniel@gmail.com") {
+			t.Errorf("Username should be kept, received %s", formatted)
+		}
+	}
+
+	enc := zapcore.NewMapObjectEncoder()
+	if err := request.MarshalLogObject(enc); err != nil {
+		t.Fatal("error should be nil")
+	}
+	if enc.Fields["password"] != redacted || enc.Fields["clientSecret"] != redacted || enc.Fields["mfaToken"] != "" ||
+		enc.Fields["subjectToken"] != redacted || enc.Fields["deviceCode"] != redacted {
+		t.Errorf("Unexpected log fields %v", enc.Fields)
+	}
+}
+
+func TestAccessTokenRedaction(t *testing.T) {
+
+	at := &AccessToken{AccessToken: "the_token", UserId: 1, ClientId: 2, Expires: 365}
+
+	for _, formatted := range []string{fmt.Sprint(at), fmt.Sprintf("%+v", *at), fmt.Sprintf("%#v", at)} {
+		if strings.Contains(formatted, "the_token") {
+			t.Errorf("Token should be redacted, received %s", formatted)
+		}
+	}
+
+	enc := zapcore.NewMapObjectEncoder()
+	if err := at.MarshalLogObject(enc); err != nil {
+		t.Fatal("error should be nil")
+	}
+	if enc.Fields["accessToken"] != redacted || enc.Fields["userId"] != int64(1) {
+		t.Errorf("Unexpected log fields %v", enc.Fields)
+	}
+}
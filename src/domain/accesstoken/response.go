@@ -0,0 +1,42 @@
+package accesstoken
+
+const (
+	TokenTypeBearer = "Bearer"
+
+	// ScopeUserId lets the client read the id of the user it was issued a token for
+	ScopeUserId = "user_id"
+)
+
+// Response is the issuance response of RFC 6749 section 5.1. The id of the user is only disclosed to clients
+// granted ScopeUserId
+type Response struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	// ExpiresIn is the lifetime of the token in seconds
+	ExpiresIn int64  `json:"expires_in"`
+	Scope     string `json:"scope,omitempty"`
+	// RefreshToken is empty until refresh tokens are issued
+	RefreshToken string `json:"refresh_token,omitempty"`
+	UserId       int64  `json:"user_id,omitempty"`
+	// IssuedTokenType is only set by the token exchange grant, as required by RFC 8693
+	IssuedTokenType string `json:"issued_token_type,omitempty"`
+	// IdToken is only set for the openid scope
+	IdToken string `json:"id_token,omitempty"`
+}
+
+func (at *AccessToken) Response() Response {
+	response := Response{
+		AccessToken: at.AccessToken,
+		TokenType:   TokenTypeBearer,
+		ExpiresIn:   at.Lifetime(),
+		Scope:       at.Scope,
+		IdToken:     at.IdToken,
+	}
+	if at.HasScopes(ScopeUserId) {
+		response.UserId = at.UserId
+	}
+	if at.Act != nil {
+		response.IssuedTokenType = TokenTypeAccessToken
+	}
+	return response
+}
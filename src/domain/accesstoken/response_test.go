@@ -0,0 +1,36 @@
+package accesstoken
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestResponse(t *testing.T) {
+
+	at := &AccessToken{AccessToken: "abc123", UserId: 1, ClientId: 2, Created: 1600000000, Expires: 1600003600, Scope: "books:read"}
+
+	expected := Response{AccessToken: "abc123", TokenType: "Bearer", ExpiresIn: 3600, Scope: "books:read"}
+	if response := at.Response(); response != expected {
+		t.Errorf("Expected: %+v, Received: %+v", expected, response)
+	}
+
+	body, _ := json.Marshal(at.Response())
+	if string(body) != `{"access_token":"abc123","token_type":"Bearer","expires_in":3600,"scope":"books:read"}` {
+		t.Errorf("Unexpected body %s", body)
+	}
+
+	at.Scope = "books:read user_id"
+	if response := at.Response(); response.UserId != 1 {
+		t.Errorf("The user id should be disclosed with the user_id scope, received %+v", response)
+	}
+
+	at.Act = &Actor{ClientId: 2}
+	if response := at.Response(); response.IssuedTokenType != TokenTypeAccessToken {
+		t.Errorf("Exchanged tokens should carry their issued token type, received %+v", response)
+	}
+
+	at.IdToken = "header.claims.signature"
+	if response := at.Response(); response.IdToken != at.IdToken {
+		t.Errorf("The id token should be returned along the access token, received %+v", response)
+	}
+}
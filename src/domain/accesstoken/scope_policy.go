@@ -0,0 +1,46 @@
+package accesstoken
+
+import (
+	"github.com/danielgom/bookstore_utils-go/errors"
+	"strings"
+)
+
+// ScopeAdmin grants the bulk revocation endpoints
+const ScopeAdmin = "admin"
+
+// RestrictedScopes are only granted to the users a ScopePolicy lists for them, even when it lists nobody
+var RestrictedScopes = []string{ScopeAdmin}
+
+// ScopePolicy restricts who may be granted a scope. The scopes of Users, and RestrictedScopes, are only granted to
+// the users listed for them, any other scope is granted to every user
+type ScopePolicy struct {
+	Users map[string][]int64
+}
+
+// Check returns a bad request error when userId may not be granted one of the space separated scope
+func (p ScopePolicy) Check(userId int64, scope string) errors.RestErr {
+	for _, s := range strings.Fields(scope) {
+		if !p.allows(userId, s) {
+			return errors.NewBadRequestError("Invalid scope parameter")
+		}
+	}
+	return nil
+}
+
+func (p ScopePolicy) allows(userId int64, scope string) bool {
+
+	users, restricted := p.Users[scope]
+	for _, r := range RestrictedScopes {
+		restricted = restricted || r == scope
+	}
+	if !restricted {
+		return true
+	}
+
+	for _, id := range users {
+		if id == userId {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,33 @@
+package accesstoken
+
+import (
+	"testing"
+)
+
+func TestScopePolicy(t *testing.T) {
+
+	policy := ScopePolicy{Users: map[string][]int64{ScopeAdmin: {1}, "payments:write": {2}}}
+
+	cases := []struct {
+		name    string
+		userId  int64
+		scope   string
+		allowed bool
+	}{
+		{"unrestricted", 3, "books:read books:write", true},
+		{"listed user", 1, "books:read admin", true},
+		{"unlisted user", 3, "admin", false},
+		{"listed scope", 2, "payments:write", true},
+		{"other listed scope", 1, "payments:write", false},
+	}
+
+	for _, c := range cases {
+		if err := policy.Check(c.userId, c.scope); (err == nil) != c.allowed {
+			t.Errorf("%s: expected allowed %t, received %v", c.name, c.allowed, err)
+		}
+	}
+
+	if err := (ScopePolicy{}).Check(1, ScopeAdmin); err == nil || err.Status() != 400 {
+		t.Errorf("The admin scope should be restricted without users, received %v", err)
+	}
+}
@@ -0,0 +1,39 @@
+package accesstoken
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// Session describes a token to the user it was issued to, without its value
+type Session struct {
+	Id        string `json:"id"`
+	ClientId  int64  `json:"clientId,omitempty"`
+	Scope     string `json:"scope,omitempty"`
+	Created   int64  `json:"created,omitempty"`
+	LastUsed  int64  `json:"lastUsed,omitempty"`
+	Expires   int64  `json:"expires"`
+	UserAgent string `json:"userAgent,omitempty"`
+	RemoteIp  string `json:"remoteIp,omitempty"`
+	// Current marks the session of the token making the request
+	Current bool `json:"current"`
+}
+
+// SessionId identifies the token without disclosing it
+func (at *AccessToken) SessionId() string {
+	sum := sha256.Sum256([]byte(at.AccessToken))
+	return hex.EncodeToString(sum[:16])
+}
+
+func (at *AccessToken) Session() Session {
+	return Session{
+		Id:        at.SessionId(),
+		ClientId:  at.ClientId,
+		Scope:     at.Scope,
+		Created:   at.Created,
+		LastUsed:  at.LastUsed,
+		Expires:   at.Expires,
+		UserAgent: at.UserAgent,
+		RemoteIp:  at.RemoteIp,
+	}
+}
@@ -0,0 +1,26 @@
+package accesstoken
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSession(t *testing.T) {
+
+	at := &AccessToken{AccessToken: "abc123", UserId: 1, ClientId: 2, Expires: 365, Scope: "read", Created: 100,
+		LastUsed: 200, UserAgent: "curl/7.68.0", RemoteIp: "10.0.0.1"}
+
+	session := at.Session()
+	if len(session.Id) != 32 || strings.Contains(session.Id, "abc123") || session.Id != at.SessionId() {
+		t.Errorf("Unexpected session id %s", session.Id)
+	}
+	if other := (&AccessToken{AccessToken: "def456"}).SessionId(); other == session.Id {
+		t.Error("Session ids of different tokens should differ")
+	}
+
+	expected := Session{Id: session.Id, ClientId: 2, Scope: "read", Created: 100, LastUsed: 200, Expires: 365,
+		UserAgent: "curl/7.68.0", RemoteIp: "10.0.0.1"}
+	if session != expected {
+		t.Errorf("Expected: %+v, Received: %+v", expected, session)
+	}
+}
@@ -0,0 +1,27 @@
+package clients
+
+const (
+	// RoleResourceServer lets a client look tokens up through GET /oauth/accessToken/:atId
+	RoleResourceServer = "resource_server"
+	// RoleTokenExchange lets a client exchange the tokens of users for narrower ones acting on their behalf
+	RoleTokenExchange = "token_exchange"
+	// RoleDevice lets a public client start the device authorization flow with its id alone
+	RoleDevice = "device"
+)
+
+// Client is an application registered to call the oauth api
+type Client struct {
+	Id         int64    `json:"id"`
+	Name       string   `json:"name"`
+	SecretHash string   `json:"-"`
+	Roles      []string `json:"roles,omitempty"`
+}
+
+func (c *Client) HasRole(role string) bool {
+	for _, r := range c.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
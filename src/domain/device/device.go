@@ -0,0 +1,120 @@
+package device
+
+import (
+	"crypto/rand"
+	"github.com/danielgom/bookstore_utils-go/errors"
+	"math/big"
+	"strings"
+)
+
+const (
+	StatusPending  = "pending"
+	StatusApproved = "approved"
+	StatusDenied   = "denied"
+
+	// RFC 8628 section 3.5 errors answered to polling devices, as the message of a bad request
+	ErrAuthorizationPending = "authorization_pending"
+	ErrSlowDown             = "slow_down"
+	ErrAccessDenied         = "access_denied"
+	ErrExpiredToken         = "expired_token"
+	ErrInvalidGrant         = "invalid_grant"
+
+	// SlowDownIncrement is added to the polling interval of a device polling too fast
+	SlowDownIncrement = 5
+
+	// userCodeAlphabet has no vowels nor look-alike characters, so codes spell no words and are easily typed
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength   = 8
+)
+
+// Authorization is a device authorization request. The device polls it with DeviceCode while the user approves
+// it with UserCode, stored normalized. It is expired from Expires on
+type Authorization struct {
+	DeviceCode string
+	UserCode   string
+	ClientId   int64
+	Scope      string
+	Expires    int64
+	// Interval is the number of seconds the device must wait between two polls
+	Interval   int64
+	LastPolled int64
+	Status     string
+	// UserId is the user who approved or denied the request
+	UserId int64
+}
+
+// AuthorizationResponse is the RFC 8628 section 3.2 device authorization response
+type AuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationUri         string `json:"verification_uri"`
+	VerificationUriComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int64  `json:"interval"`
+}
+
+// AuthorizationRequest starts the flow, sent by the device
+type AuthorizationRequest struct {
+	ClientId string `json:"clientId"`
+	Scope    string `json:"scope"`
+}
+
+func (r *AuthorizationRequest) Validate() errors.RestErr {
+	r.ClientId = strings.TrimSpace(r.ClientId)
+	if r.ClientId == "" {
+		return errors.NewBadRequestError("Invalid clientId parameter")
+	}
+	return nil
+}
+
+// ApprovalRequest carries the user code the user read on the device
+type ApprovalRequest struct {
+	UserCode string `json:"userCode"`
+}
+
+func (r *ApprovalRequest) Validate() errors.RestErr {
+	r.UserCode = NormalizeUserCode(r.UserCode)
+	if len(r.UserCode) != userCodeLength {
+		return errors.NewBadRequestError("Invalid userCode parameter")
+	}
+	return nil
+}
+
+// Approval tells the user which client and scope they approved or denied
+type Approval struct {
+	ClientId int64  `json:"clientId"`
+	Scope    string `json:"scope,omitempty"`
+	Status   string `json:"status"`
+}
+
+// NewUserCode returns a random code of userCodeLength characters of userCodeAlphabet
+func NewUserCode() (string, error) {
+	max := big.NewInt(int64(len(userCodeAlphabet)))
+	code := make([]byte, userCodeLength)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = userCodeAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
+
+// NormalizeUserCode uppercases a code typed by a user and drops its separators, so "bcdf-ghjk" matches
+func NormalizeUserCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(strings.TrimSpace(code)))
+}
+
+// FormatUserCode splits a normalized code in two halves, as displayed to the user
+func FormatUserCode(code string) string {
+	if len(code) != userCodeLength {
+		return code
+	}
+	return code[:userCodeLength/2] + "-" + code[userCodeLength/2:]
+}
@@ -0,0 +1,49 @@
+package device
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewUserCode(t *testing.T) {
+
+	code, err := NewUserCode()
+	if err != nil {
+		t.Fatal("error should be nil")
+	}
+	if len(code) != 8 || strings.Trim(code, userCodeAlphabet) != "" {
+		t.Errorf("Unexpected user code %q", code)
+	}
+
+	other, _ := NewUserCode()
+	if code == other {
+		t.Errorf("User codes should be random, received %q twice", code)
+	}
+}
+
+func TestUserCodeFormat(t *testing.T) {
+
+	if formatted := FormatUserCode("BCDFGHJK"); formatted != "BCDF-GHJK" {
+		t.Errorf("Unexpected format %q", formatted)
+	}
+
+	for _, typed := range []string{"BCDF-GHJK", " bcdf ghjk ", "bcdfghjk"} {
+		if normalized := NormalizeUserCode(typed); normalized != "BCDFGHJK" {
+			t.Errorf("Expected BCDFGHJK for %q, received %q", typed, normalized)
+		}
+	}
+}
+
+func TestApprovalRequestValidate(t *testing.T) {
+
+	request := &ApprovalRequest{UserCode: "bcdf-ghjk"}
+	if err := request.Validate(); err != nil || request.UserCode != "BCDFGHJK" {
+		t.Errorf("Unexpected result %q, %v", request.UserCode, err)
+	}
+
+	for _, code := range []string{"", "BCDF-GHJ", "BCDF-GHJKL"} {
+		if err := (&ApprovalRequest{UserCode: code}).Validate(); err == nil {
+			t.Errorf("error should not be nil for %q", code)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package mfa
+
+import (
+	"github.com/danielgom/bookstore_oauthapi/src/clock"
+	"github.com/danielgom/bookstore_utils-go/errors"
+	"strings"
+	"time"
+)
+
+const (
+	ChallengeExpirationTime = 5 * time.Minute
+	// MaxChallengeAttempts is the number of otp codes a challenge accepts before it is discarded
+	MaxChallengeAttempts = 5
+)
+
+type Secret struct {
+	UserId    int64  `json:"userId"`
+	Secret    string `json:"-"`
+	Confirmed bool   `json:"confirmed"`
+	// LastTimeStep is the TOTP time-step of the last accepted code, codes of that step or before are rejected
+	LastTimeStep int64 `json:"-"`
+}
+
+type Enrollment struct {
+	Secret     string `json:"secret"`
+	OtpAuthUri string `json:"otpAuthUri"`
+}
+
+type ConfirmRequest struct {
+	OtpCode string `json:"otpCode"`
+}
+
+func (r *ConfirmRequest) Validate() errors.RestErr {
+	r.OtpCode = strings.TrimSpace(r.OtpCode)
+	if r.OtpCode == "" {
+		return errors.NewBadRequestError("Invalid otpCode parameter")
+	}
+	return nil
+}
+
+// Challenge is issued by the password grant when the user has MFA enabled and must be exchanged
+// together with a TOTP code for an access token
+type Challenge struct {
+	MfaToken string `json:"mfaToken"`
+	UserId   int64  `json:"-"`
+	ClientId int64  `json:"-"`
+	Scope    string `json:"-"`
+	Expires  int64  `json:"expires"`
+	Attempts int    `json:"-"`
+}
+
+// IsExpired reports whether the time of clk is past Expires
+func (c *Challenge) IsExpired(clk clock.Clock) bool {
+	return time.Unix(c.Expires, 0).Before(clk.Now())
+}
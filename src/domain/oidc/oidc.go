@@ -0,0 +1,103 @@
+package oidc
+
+import (
+	"github.com/danielgom/bookstore_oauthapi/src/domain/users"
+	"github.com/danielgom/bookstore_oauthapi/src/utils/cryptoutils"
+	"strconv"
+	"strings"
+)
+
+const (
+	// ScopeOpenId asks for an id token along with the access token, and grants the userinfo endpoint
+	ScopeOpenId  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+
+	SubjectTypePublic = "public"
+
+	// Route names of the endpoints advertised by discovery, given to the routes serving them
+	RouteToken               = "oauth.token"
+	RouteDeviceAuthorization = "oauth.device_authorization"
+	RouteUserInfo            = "oidc.userinfo"
+	RouteKeys                = "oidc.keys"
+)
+
+// UserInfo holds the standard claims of a user, the profile and email claims only released to their scope
+type UserInfo struct {
+	Subject    string `json:"sub"`
+	Name       string `json:"name,omitempty"`
+	GivenName  string `json:"given_name,omitempty"`
+	FamilyName string `json:"family_name,omitempty"`
+	Email      string `json:"email,omitempty"`
+}
+
+// NewUserInfo returns the claims of user released to a token of scopes
+func NewUserInfo(user *users.User, scopes []string) UserInfo {
+	info := UserInfo{Subject: strconv.FormatInt(user.Id, 10)}
+	for _, scope := range scopes {
+		switch scope {
+		case ScopeProfile:
+			info.GivenName = user.FirstName
+			info.FamilyName = user.LastName
+			info.Name = strings.TrimSpace(user.FirstName + " " + user.LastName)
+		case ScopeEmail:
+			info.Email = user.Email
+		}
+	}
+	return info
+}
+
+// IdToken holds the claims of an OpenID Connect id token, issued to the client of Audience
+type IdToken struct {
+	Issuer   string `json:"iss"`
+	Audience string `json:"aud"`
+	Expires  int64  `json:"exp"`
+	IssuedAt int64  `json:"iat"`
+	UserInfo
+}
+
+// KeySet is the JWK set verifying the id tokens
+type KeySet struct {
+	Keys []cryptoutils.JWK `json:"keys"`
+}
+
+// Configuration is the OpenID Connect discovery metadata. There is no authorization endpoint, users log in
+// through the token and device authorization endpoints only
+type Configuration struct {
+	Issuer                           string   `json:"issuer"`
+	TokenEndpoint                    string   `json:"token_endpoint,omitempty"`
+	UserInfoEndpoint                 string   `json:"userinfo_endpoint,omitempty"`
+	JwksUri                          string   `json:"jwks_uri,omitempty"`
+	DeviceAuthorizationEndpoint      string   `json:"device_authorization_endpoint,omitempty"`
+	ScopesSupported                  []string `json:"scopes_supported"`
+	GrantTypesSupported              []string `json:"grant_types_supported"`
+	SubjectTypesSupported            []string `json:"subject_types_supported"`
+	IdTokenSigningAlgValuesSupported []string `json:"id_token_signing_alg_values_supported"`
+	ClaimsSupported                  []string `json:"claims_supported"`
+}
+
+// NewConfiguration returns the metadata of issuer. path returns the path of a named route, empty when it is not
+// registered, its endpoint is then left out
+func NewConfiguration(issuer string, path func(name string) string, grantTypes []string) Configuration {
+
+	issuer = strings.TrimSuffix(issuer, "/")
+	endpoint := func(name string) string {
+		if p := path(name); p != "" {
+			return issuer + p
+		}
+		return ""
+	}
+
+	return Configuration{
+		Issuer:                           issuer,
+		TokenEndpoint:                    endpoint(RouteToken),
+		UserInfoEndpoint:                 endpoint(RouteUserInfo),
+		JwksUri:                          endpoint(RouteKeys),
+		DeviceAuthorizationEndpoint:      endpoint(RouteDeviceAuthorization),
+		ScopesSupported:                  []string{ScopeOpenId, ScopeProfile, ScopeEmail},
+		GrantTypesSupported:              grantTypes,
+		SubjectTypesSupported:            []string{SubjectTypePublic},
+		IdTokenSigningAlgValuesSupported: []string{cryptoutils.AlgRS256},
+		ClaimsSupported:                  []string{"iss", "sub", "aud", "exp", "iat", "name", "given_name", "family_name", "email"},
+	}
+}
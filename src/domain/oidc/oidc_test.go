@@ -0,0 +1,61 @@
+package oidc
+
+import (
+	"encoding/json"
+	"github.com/danielgom/bookstore_oauthapi/src/domain/users"
+	"reflect"
+	"testing"
+)
+
+func TestNewUserInfo(t *testing.T) {
+
+	user := &users.User{Id: 7, FirstName: "Daniel", LastName: "Gomez", Email: "daniel@gmail.com"}
+
+	cases := map[string]struct {
+		scopes   []string
+		expected UserInfo
+	}{
+		"openid":  {[]string{"openid"}, UserInfo{Subject: "7"}},
+		"profile": {[]string{"openid", "profile"}, UserInfo{Subject: "7", Name: "Daniel Gomez", GivenName: "Daniel", FamilyName: "Gomez"}},
+		"email":   {[]string{"openid", "email"}, UserInfo{Subject: "7", Email: "daniel@gmail.com"}},
+	}
+
+	for name, c := range cases {
+		if info := NewUserInfo(user, c.scopes); info != c.expected {
+			t.Errorf("%s: Expected: %+v, Received: %+v", name, c.expected, info)
+		}
+	}
+}
+
+func TestIdTokenClaims(t *testing.T) {
+
+	token := IdToken{Issuer: "http://localhost:8080", Audience: "2", Expires: 1600003600, IssuedAt: 1600000000,
+		UserInfo: UserInfo{Subject: "7", Email: "daniel@gmail.com"}}
+
+	body, _ := json.Marshal(token)
+	expected := `{"iss":"http://localhost:8080","aud":"2","exp":1600003600,"iat":1600000000,"sub":"7","email":"daniel@gmail.com"}`
+	if string(body) != expected {
+		t.Errorf("Expected: %s, Received: %s", expected, body)
+	}
+}
+
+func TestNewConfiguration(t *testing.T) {
+
+	routes := map[string]string{RouteToken: "/oauth/accessToken", RouteKeys: "/.well-known/jwks.json"}
+	path := func(name string) string { return routes[name] }
+
+	c := NewConfiguration("https://auth.bookstore.com/", path, []string{"password"})
+
+	if c.Issuer != "https://auth.bookstore.com" {
+		t.Errorf("The issuer should be without trailing slash, received %s", c.Issuer)
+	}
+	if c.TokenEndpoint != "https://auth.bookstore.com/oauth/accessToken" || c.JwksUri != "https://auth.bookstore.com/.well-known/jwks.json" {
+		t.Errorf("Unexpected endpoints %+v", c)
+	}
+	if c.UserInfoEndpoint != "" || c.DeviceAuthorizationEndpoint != "" {
+		t.Errorf("Routes which are not registered should not be advertised, received %+v", c)
+	}
+	if !reflect.DeepEqual(c.GrantTypesSupported, []string{"password"}) {
+		t.Errorf("Unexpected grant types %v", c.GrantTypesSupported)
+	}
+}
@@ -1,15 +1,28 @@
 package http
 
 import (
+	"github.com/danielgom/bookstore_oauthapi/src/clock"
 	atDomain "github.com/danielgom/bookstore_oauthapi/src/domain/accesstoken"
+	"github.com/danielgom/bookstore_oauthapi/src/logger"
+	"github.com/danielgom/bookstore_oauthapi/src/metrics"
 	"github.com/danielgom/bookstore_oauthapi/src/services/accesstoken"
 	"github.com/danielgom/bookstore_utils-go/errors"
 	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
 	"net/http"
+	"time"
 )
 
-func NewHandler(service accesstoken.Service) AccessTokenHandler {
-	return &accessTokenHandler{service}
+const (
+	// headers of the responses which must not be cached, echo has no constants for them
+	headerCacheControl = "Cache-Control"
+	headerPragma       = "Pragma"
+)
+
+// NewHandler expects GetById to be behind ClientAuthMiddleware. Lookups answer after lookupLatency at the
+// earliest, so that hits and misses cannot be told apart by their response time
+func NewHandler(service accesstoken.Service, lookupLatency time.Duration) AccessTokenHandler {
+	return &accessTokenHandler{service: service, lookupLatency: lookupLatency, clock: clock.System}
 }
 
 type AccessTokenHandler interface {
@@ -19,7 +32,9 @@ type AccessTokenHandler interface {
 }
 
 type accessTokenHandler struct {
-	service accesstoken.Service
+	service       accesstoken.Service
+	lookupLatency time.Duration
+	clock         clock.Clock
 }
 
 func (h *accessTokenHandler) Health(c echo.Context) error {
@@ -28,7 +43,21 @@ func (h *accessTokenHandler) Health(c echo.Context) error {
 
 func (h *accessTokenHandler) GetById(c echo.Context) error {
 
-	aT, err := h.service.GetByID(c.Param("atId"))
+	start := time.Now()
+	ctx := c.Request().Context()
+
+	aT, err := h.service.GetByID(ctx, c.Param("atId"))
+	latency := time.Since(start)
+
+	var clientId int64
+	if client, ok := echoClient(c); ok {
+		clientId = client.Id
+	}
+	logger.FromContext(ctx).Info("access token looked up", zap.Int64("clientId", clientId),
+		zap.String("outcome", h.lookupOutcome(aT, err)), zap.Duration("latency", latency))
+
+	h.waitLookupLatency(c, start)
+
 	if err != nil {
 		return echo.NewHTTPError(err.Status(), err)
 	}
@@ -36,6 +65,31 @@ func (h *accessTokenHandler) GetById(c echo.Context) error {
 	return c.JSON(http.StatusOK, aT)
 }
 
+// waitLookupLatency blocks until lookupLatency elapsed since start or the request is cancelled
+func (h *accessTokenHandler) waitLookupLatency(c echo.Context, start time.Time) {
+	timer := time.NewTimer(h.lookupLatency - time.Since(start))
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-c.Request().Context().Done():
+	}
+}
+
+// lookupOutcome tells whether a lookup found the token, expired at the time of the clock of h
+func (h *accessTokenHandler) lookupOutcome(at *atDomain.AccessToken, err errors.RestErr) string {
+	switch {
+	case err == nil && at.IsExpired(h.clock):
+		return metrics.LookupExpired
+	case err == nil:
+		return metrics.LookupHit
+	case err.Status() == http.StatusNotFound || err.Status() == http.StatusBadRequest:
+		return metrics.LookupMiss
+	default:
+		return "error"
+	}
+}
+
 func (h *accessTokenHandler) Create(c echo.Context) error {
 	request := new(atDomain.AtRequest)
 
@@ -44,10 +98,20 @@ func (h *accessTokenHandler) Create(c echo.Context) error {
 		return echo.NewHTTPError(restErr.Status(), restErr)
 	}
 
-	at, err := h.service.Create(request)
+	at, err := h.service.Create(c.Request().Context(), request)
 	if err != nil {
+		if mfaErr, ok := err.(*atDomain.MfaRequiredError); ok {
+			return c.JSON(mfaErr.Status(), map[string]interface{}{
+				"error":    mfaErr.Message(),
+				"mfaToken": mfaErr.MfaToken,
+				"expires":  mfaErr.Expires,
+			})
+		}
 		return echo.NewHTTPError(err.Status(), err)
 	}
 
-	return c.JSON(http.StatusCreated, at)
+	// RFC 6749 section 5.1, responses holding tokens must not be cached
+	c.Response().Header().Set(headerCacheControl, "no-store")
+	c.Response().Header().Set(headerPragma, "no-cache")
+	return c.JSON(http.StatusCreated, at.Response())
 }
@@ -0,0 +1,110 @@
+package http
+
+import (
+	"github.com/danielgom/bookstore_oauthapi/src/services/accesstoken"
+	"github.com/danielgom/bookstore_oauthapi/src/services/clients"
+	"github.com/danielgom/bookstore_utils-go/errors"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"strconv"
+)
+
+// NewAdminHandler expects its routes to be behind oauth.EchoMiddleware requiring the admin scope
+func NewAdminHandler(service accesstoken.Service, clientsService clients.Service) AdminHandler {
+	return &adminHandler{service, clientsService}
+}
+
+type AdminHandler interface {
+	ListUserTokens(echo.Context) error
+	RevokeUserTokens(echo.Context) error
+	RevokeClientTokens(echo.Context) error
+	RotateClientSecret(echo.Context) error
+}
+
+type adminHandler struct {
+	service        accesstoken.Service
+	clientsService clients.Service
+}
+
+// tokenView describes a token without its value, which would let the caller use it
+type tokenView struct {
+	UserId   int64  `json:"userId"`
+	ClientId int64  `json:"clientId,omitempty"`
+	Expires  int64  `json:"expires"`
+	Scope    string `json:"scope,omitempty"`
+}
+
+func (h *adminHandler) ListUserTokens(c echo.Context) error {
+
+	userId, restErr := idParam(c, "userId")
+	if restErr != nil {
+		return echo.NewHTTPError(restErr.Status(), restErr)
+	}
+
+	tokens, err := h.service.ListByUser(c.Request().Context(), userId)
+	if err != nil {
+		return echo.NewHTTPError(err.Status(), err)
+	}
+
+	views := make([]tokenView, len(tokens))
+	for i, at := range tokens {
+		views[i] = tokenView{UserId: at.UserId, ClientId: at.ClientId, Expires: at.Expires, Scope: at.Scope}
+	}
+
+	return c.JSON(http.StatusOK, views)
+}
+
+func (h *adminHandler) RevokeUserTokens(c echo.Context) error {
+
+	userId, restErr := idParam(c, "userId")
+	if restErr != nil {
+		return echo.NewHTTPError(restErr.Status(), restErr)
+	}
+
+	revoked, err := h.service.RevokeAllForUser(c.Request().Context(), userId, c.QueryParam("reason"))
+	if err != nil {
+		return echo.NewHTTPError(err.Status(), err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]int{"revoked": revoked})
+}
+
+func (h *adminHandler) RevokeClientTokens(c echo.Context) error {
+
+	clientId, restErr := idParam(c, "clientId")
+	if restErr != nil {
+		return echo.NewHTTPError(restErr.Status(), restErr)
+	}
+
+	revoked, err := h.service.RevokeAllForClient(c.Request().Context(), clientId, c.QueryParam("reason"))
+	if err != nil {
+		return echo.NewHTTPError(err.Status(), err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]int{"revoked": revoked})
+}
+
+// RotateClientSecret answers the new secret of the client, which is not retrievable afterwards
+func (h *adminHandler) RotateClientSecret(c echo.Context) error {
+
+	clientId, restErr := idParam(c, "clientId")
+	if restErr != nil {
+		return echo.NewHTTPError(restErr.Status(), restErr)
+	}
+
+	secret, err := h.clientsService.RotateSecret(c.Request().Context(), clientId)
+	if err != nil {
+		return echo.NewHTTPError(err.Status(), err)
+	}
+
+	c.Response().Header().Set(headerCacheControl, "no-store")
+	return c.JSON(http.StatusOK, map[string]string{"clientSecret": secret})
+}
+
+func idParam(c echo.Context, name string) (int64, errors.RestErr) {
+	id, err := strconv.ParseInt(c.Param(name), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, errors.NewBadRequestError("Invalid " + name + " parameter")
+	}
+	return id, nil
+}
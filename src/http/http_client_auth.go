@@ -0,0 +1,61 @@
+package http
+
+import (
+	"github.com/danielgom/bookstore_oauthapi/src/domain/clients"
+	"github.com/danielgom/bookstore_oauthapi/src/logger"
+	clientsService "github.com/danielgom/bookstore_oauthapi/src/services/clients"
+	"github.com/danielgom/bookstore_utils-go/errors"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+const (
+	// clientContextKey is the echo.Context key holding the authenticated *clients.Client
+	clientContextKey = "oauth.client"
+)
+
+// ClientAuthMiddleware authenticates the calling client with HTTP Basic credentials or, on requests served over
+// TLS, with a verified client certificate, and rejects clients lacking role
+func ClientAuthMiddleware(service clientsService.Service, role string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			r := c.Request()
+			ctx := r.Context()
+
+			var client *clients.Client
+			var err errors.RestErr
+			method := "basic"
+
+			if clientId, secret, ok := r.BasicAuth(); ok {
+				client, err = service.Authenticate(ctx, clientId, secret)
+			} else if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+				method = "certificate"
+				client, err = service.AuthenticateCertificate(ctx, r.TLS.VerifiedChains[0][0])
+			} else {
+				err = errors.NewUnauthorizedError("Missing client credentials")
+			}
+
+			if err != nil {
+				logger.FromContext(ctx).Warn("client authentication failed", zap.String("method", method),
+					zap.String("error", err.Message()))
+				c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Basic realm="bookstore"`)
+				return echo.NewHTTPError(err.Status(), err)
+			}
+
+			if !client.HasRole(role) {
+				logger.FromContext(ctx).Warn("client not allowed", zap.Int64("clientId", client.Id),
+					zap.String("role", role))
+				return echo.NewHTTPError(http.StatusForbidden, http.StatusText(http.StatusForbidden))
+			}
+
+			c.Set(clientContextKey, client)
+			return next(c)
+		}
+	}
+}
+
+func echoClient(c echo.Context) (*clients.Client, bool) {
+	client, ok := c.Get(clientContextKey).(*clients.Client)
+	return client, ok && client != nil
+}
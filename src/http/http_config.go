@@ -0,0 +1,89 @@
+package http
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/danielgom/bookstore_oauthapi/src/config"
+	"github.com/danielgom/bookstore_oauthapi/src/services/accesstoken"
+	"github.com/labstack/echo/v4"
+	"io/ioutil"
+	"net"
+	"time"
+)
+
+const (
+	envTokenLookupLatency = "TOKEN_LOOKUP_LATENCY"
+	envTrustedProxies     = "TRUSTED_PROXIES"
+	envTLSCert            = "TLS_CERT"
+	envTLSKey             = "TLS_KEY"
+	envTLSClientCa        = "TLS_CLIENT_CA"
+	envTLSClientRequired  = "TLS_CLIENT_CERT_REQUIRED"
+
+	// defaultLookupLatency covers a Cassandra lookup, cached and missing tokens are answered as late
+	defaultLookupLatency = 50 * time.Millisecond
+)
+
+// NewHandlerFromConfig builds the access token handler with the TOKEN_LOOKUP_LATENCY response time floor
+func NewHandlerFromConfig(service accesstoken.Service) AccessTokenHandler {
+	return NewHandler(service, config.GetDuration(envTokenLookupLatency, defaultLookupLatency))
+}
+
+// NewIPExtractorFromConfig reads the client address from X-Forwarded-For when the request came through one of the
+// TRUSTED_PROXIES, comma separated CIDRs. Without them the address of the connection is used, the header is ignored
+func NewIPExtractorFromConfig() (echo.IPExtractor, error) {
+
+	proxies := config.GetStrings(envTrustedProxies, nil)
+	if len(proxies) == 0 {
+		return echo.ExtractIPDirect(), nil
+	}
+
+	// echo trusts the loopback, link-local and private addresses by default
+	options := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, proxy := range proxies {
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s entry %q, expected a CIDR", envTrustedProxies, proxy)
+		}
+		options = append(options, echo.TrustIPRange(ipNet))
+	}
+	return echo.ExtractIPFromXFFHeader(options...), nil
+}
+
+// NewTLSConfigFromConfig returns the TLS configuration of the TLS_CERT and TLS_KEY files, nil when they are not set
+// and the server listens in plain HTTP. Client certificates are verified against the TLS_CLIENT_CA bundle and
+// required unless TLS_CLIENT_CERT_REQUIRED is false, which lets users and clients authenticating with their secret
+// connect to the same listener
+func NewTLSConfigFromConfig() (*tls.Config, error) {
+
+	certFile, keyFile := config.GetString(envTLSCert, ""), config.GetString(envTLSKey, "")
+	if certFile == "" && keyFile == "" {
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("error loading %s and %s: %w", envTLSCert, envTLSKey, err)
+	}
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+
+	caFile := config.GetString(envTLSClientCa, "")
+	if caFile == "" {
+		return tlsConfig, nil
+	}
+
+	pem, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", envTLSClientCa, err)
+	}
+	tlsConfig.ClientCAs = x509.NewCertPool()
+	if !tlsConfig.ClientCAs.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificate found in %s", envTLSClientCa)
+	}
+
+	tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	if !config.GetBool(envTLSClientRequired, true) {
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,81 @@
+package http
+
+import (
+	"context"
+	"github.com/danielgom/bookstore_oauthapi/src/domain/device"
+	"github.com/danielgom/bookstore_oauthapi/src/oauth"
+	deviceService "github.com/danielgom/bookstore_oauthapi/src/services/device"
+	"github.com/danielgom/bookstore_utils-go/errors"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+// NewDeviceHandler expects Approve and Deny to be behind oauth.EchoMiddleware, the caller decides for themselves
+// with a token they obtained without a client
+func NewDeviceHandler(service deviceService.Service) DeviceHandler {
+	return &deviceHandler{service}
+}
+
+type DeviceHandler interface {
+	Authorize(echo.Context) error
+	Approve(echo.Context) error
+	Deny(echo.Context) error
+}
+
+type deviceHandler struct {
+	service deviceService.Service
+}
+
+func (h *deviceHandler) Authorize(c echo.Context) error {
+	request := new(device.AuthorizationRequest)
+
+	if err := c.Bind(request); err != nil {
+		restErr := errors.NewBadRequestError("Invalid json body")
+		return echo.NewHTTPError(restErr.Status(), restErr)
+	}
+
+	response, err := h.service.Authorize(c.Request().Context(), request)
+	if err != nil {
+		return echo.NewHTTPError(err.Status(), err)
+	}
+
+	c.Response().Header().Set(headerCacheControl, "no-store")
+	return c.JSON(http.StatusOK, response)
+}
+
+func (h *deviceHandler) Approve(c echo.Context) error {
+	return h.decide(c, h.service.Approve)
+}
+
+func (h *deviceHandler) Deny(c echo.Context) error {
+	return h.decide(c, h.service.Deny)
+}
+
+func (h *deviceHandler) decide(c echo.Context, decide func(context.Context, string, int64) (*device.Approval, errors.RestErr)) error {
+
+	principal, ok := oauth.EchoPrincipal(c)
+	if !ok {
+		restErr := errors.NewUnauthorizedError("Missing bearer token")
+		return echo.NewHTTPError(restErr.Status(), restErr)
+	}
+	// a token held by a client, a device one included, must not approve devices on behalf of the user
+	if !principal.IsFirstParty() {
+		return echo.NewHTTPError(http.StatusForbidden, http.StatusText(http.StatusForbidden))
+	}
+
+	request := new(device.ApprovalRequest)
+	if err := c.Bind(request); err != nil {
+		restErr := errors.NewBadRequestError("Invalid json body")
+		return echo.NewHTTPError(restErr.Status(), restErr)
+	}
+	if err := request.Validate(); err != nil {
+		return echo.NewHTTPError(err.Status(), err)
+	}
+
+	approval, err := decide(c.Request().Context(), request.UserCode, principal.UserId)
+	if err != nil {
+		return echo.NewHTTPError(err.Status(), err)
+	}
+
+	return c.JSON(http.StatusOK, approval)
+}
@@ -0,0 +1,95 @@
+package http
+
+import (
+	mfaDomain "github.com/danielgom/bookstore_oauthapi/src/domain/mfa"
+	"github.com/danielgom/bookstore_oauthapi/src/oauth"
+	"github.com/danielgom/bookstore_oauthapi/src/services/mfa"
+	"github.com/danielgom/bookstore_utils-go/errors"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+// NewMfaHandler expects its routes to be behind oauth.EchoMiddleware
+func NewMfaHandler(mfaService mfa.Service) MfaHandler {
+	return &mfaHandler{mfaService}
+}
+
+type MfaHandler interface {
+	Enroll(echo.Context) error
+	Confirm(echo.Context) error
+	Disable(echo.Context) error
+}
+
+type mfaHandler struct {
+	mfaService mfa.Service
+}
+
+func (h *mfaHandler) Enroll(c echo.Context) error {
+
+	principal, httpErr := firstPartyPrincipal(c)
+	if httpErr != nil {
+		return httpErr
+	}
+
+	enrollment, err := h.mfaService.Enroll(c.Request().Context(), principal.UserId, c.QueryParam("account"))
+	if err != nil {
+		return echo.NewHTTPError(err.Status(), err)
+	}
+
+	return c.JSON(http.StatusCreated, enrollment)
+}
+
+func (h *mfaHandler) Confirm(c echo.Context) error {
+
+	principal, httpErr := firstPartyPrincipal(c)
+	if httpErr != nil {
+		return httpErr
+	}
+
+	request := new(mfaDomain.ConfirmRequest)
+	if err := c.Bind(request); err != nil {
+		restErr := errors.NewBadRequestError("Invalid json body")
+		return echo.NewHTTPError(restErr.Status(), restErr)
+	}
+
+	if err := request.Validate(); err != nil {
+		return echo.NewHTTPError(err.Status(), err)
+	}
+
+	if err := h.mfaService.Confirm(c.Request().Context(), principal.UserId, request.OtpCode); err != nil {
+		return echo.NewHTTPError(err.Status(), err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h *mfaHandler) Disable(c echo.Context) error {
+
+	principal, httpErr := firstPartyPrincipal(c)
+	if httpErr != nil {
+		return httpErr
+	}
+
+	if err := h.mfaService.Disable(c.Request().Context(), principal.UserId, c.QueryParam("otpCode")); err != nil {
+		return echo.NewHTTPError(err.Status(), err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// firstPartyPrincipal returns the caller of the MFA routes. A token held by a client must not change the second
+// factor of the user
+func firstPartyPrincipal(c echo.Context) (*oauth.Principal, error) {
+
+	principal, ok := oauth.EchoPrincipal(c)
+	if !ok {
+		restErr := errors.NewUnauthorizedError("Missing bearer token")
+		return nil, echo.NewHTTPError(restErr.Status(), restErr)
+	}
+
+	if !principal.IsFirstParty() {
+		return nil, echo.NewHTTPError(http.StatusForbidden, http.StatusText(http.StatusForbidden))
+	}
+
+	return principal, nil
+}
@@ -0,0 +1,56 @@
+package http
+
+import (
+	"github.com/danielgom/bookstore_oauthapi/src/domain/oidc"
+	"github.com/danielgom/bookstore_oauthapi/src/oauth"
+	"github.com/danielgom/bookstore_oauthapi/src/services/accesstoken"
+	oidcService "github.com/danielgom/bookstore_oauthapi/src/services/oidc"
+	"github.com/danielgom/bookstore_utils-go/errors"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+// NewOidcHandler expects UserInfo to be behind oauth.EchoMiddleware requiring the openid scope. Configuration
+// advertises the endpoints of the routes named after the oidc.Route* constants, and the grants of atService
+func NewOidcHandler(service oidcService.Service, atService accesstoken.Service) OidcHandler {
+	return &oidcHandler{service: service, atService: atService}
+}
+
+type OidcHandler interface {
+	Configuration(echo.Context) error
+	Keys(echo.Context) error
+	UserInfo(echo.Context) error
+}
+
+type oidcHandler struct {
+	service   oidcService.Service
+	atService accesstoken.Service
+}
+
+func (h *oidcHandler) Configuration(c echo.Context) error {
+	path := func(name string) string {
+		return c.Echo().Reverse(name)
+	}
+	return c.JSON(http.StatusOK, oidc.NewConfiguration(h.service.Issuer(), path, h.atService.GrantTypes()))
+}
+
+func (h *oidcHandler) Keys(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.service.KeySet())
+}
+
+func (h *oidcHandler) UserInfo(c echo.Context) error {
+
+	principal, ok := oauth.EchoPrincipal(c)
+	if !ok {
+		restErr := errors.NewUnauthorizedError("Missing bearer token")
+		return echo.NewHTTPError(restErr.Status(), restErr)
+	}
+
+	info, err := h.service.UserInfo(c.Request().Context(), principal.UserId, principal.Scopes)
+	if err != nil {
+		return echo.NewHTTPError(err.Status(), err)
+	}
+
+	c.Response().Header().Set(headerCacheControl, "no-store")
+	return c.JSON(http.StatusOK, info)
+}
@@ -0,0 +1,54 @@
+package http
+
+import (
+	"github.com/danielgom/bookstore_oauthapi/src/oauth"
+	"github.com/danielgom/bookstore_oauthapi/src/services/accesstoken"
+	"github.com/danielgom/bookstore_utils-go/errors"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+// NewSessionsHandler expects its routes to be behind oauth.EchoMiddleware, the caller only sees its own sessions
+func NewSessionsHandler(service accesstoken.Service) SessionsHandler {
+	return &sessionsHandler{service}
+}
+
+type SessionsHandler interface {
+	List(echo.Context) error
+	Revoke(echo.Context) error
+}
+
+type sessionsHandler struct {
+	service accesstoken.Service
+}
+
+func (h *sessionsHandler) List(c echo.Context) error {
+
+	principal, ok := oauth.EchoPrincipal(c)
+	if !ok {
+		restErr := errors.NewUnauthorizedError("Missing bearer token")
+		return echo.NewHTTPError(restErr.Status(), restErr)
+	}
+
+	sessions, err := h.service.ListSessions(c.Request().Context(), principal.UserId, principal.AccessToken)
+	if err != nil {
+		return echo.NewHTTPError(err.Status(), err)
+	}
+
+	return c.JSON(http.StatusOK, sessions)
+}
+
+func (h *sessionsHandler) Revoke(c echo.Context) error {
+
+	principal, ok := oauth.EchoPrincipal(c)
+	if !ok {
+		restErr := errors.NewUnauthorizedError("Missing bearer token")
+		return echo.NewHTTPError(restErr.Status(), restErr)
+	}
+
+	if err := h.service.RevokeSession(c.Request().Context(), principal.UserId, c.Param("id")); err != nil {
+		return echo.NewHTTPError(err.Status(), err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,70 @@
+package logger
+
+import (
+	"github.com/danielgom/bookstore_oauthapi/src/utils/cryptoutils"
+	"github.com/danielgom/bookstore_utils-go/errors"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+	"net/http"
+	"time"
+)
+
+const (
+	maxRequestIDLength = 64
+)
+
+// EchoMiddleware assigns every request an id, taken from X-Request-ID when the caller sent one, stores a logger
+// carrying it in the request context and writes an access log line once the request is served.
+// The causes of server errors are logged as well since they are not sent to the caller
+func EchoMiddleware(log *zap.Logger) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			r := c.Request()
+
+			requestID := r.Header.Get(echo.HeaderXRequestID)
+			if requestID == "" || len(requestID) > maxRequestIDLength {
+				requestID, _ = cryptoutils.GetRandomString(16)
+			}
+			c.Response().Header().Set(echo.HeaderXRequestID, requestID)
+
+			requestLog := log.With(zap.String("requestId", requestID))
+			ctx := WithContext(WithRequestID(r.Context(), requestID), requestLog)
+			c.SetRequest(r.WithContext(ctx))
+
+			err := next(c)
+			if err != nil {
+				c.Error(err)
+			}
+
+			status := c.Response().Status
+			fields := []zap.Field{
+				zap.String("method", r.Method),
+				// the route rather than the path, which may hold an access token id
+				zap.String("route", c.Path()),
+				zap.Int("status", status),
+				zap.Duration("latency", time.Since(start)),
+				zap.String("remoteIp", c.RealIP()),
+			}
+
+			if status < http.StatusInternalServerError {
+				requestLog.Info("request served", fields...)
+				return err
+			}
+
+			if httpErr, ok := err.(*echo.HTTPError); ok {
+				if restErr, ok := httpErr.Message.(errors.RestErr); ok {
+					fields = append(fields, zap.String("error", restErr.Message()), zap.Any("causes", restErr.Causes()))
+				}
+				if httpErr.Internal != nil {
+					fields = append(fields, zap.NamedError("internal", httpErr.Internal))
+				}
+			} else if err != nil {
+				fields = append(fields, zap.Error(err))
+			}
+			requestLog.Error("request failed", fields...)
+
+			return err
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package logger
+
+import (
+	"context"
+	"github.com/danielgom/bookstore_oauthapi/src/config"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	envLogLevel = "LOG_LEVEL"
+)
+
+type contextKey int
+
+const (
+	loggerKey contextKey = iota
+	requestIDKey
+)
+
+// NewFromConfig builds the JSON logger at the level set by LOG_LEVEL: debug, info, warn or error
+func NewFromConfig() (*zap.Logger, error) {
+	return New(config.GetString(envLogLevel, "info"))
+}
+
+func New(level string) (*zap.Logger, error) {
+	c := zap.NewProductionConfig()
+	if err := c.Level.UnmarshalText([]byte(level)); err != nil {
+		return nil, err
+	}
+	c.EncoderConfig.TimeKey = "time"
+	c.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	c.InitialFields = map[string]interface{}{"service": "bookstore_oauthapi"}
+	return c.Build()
+}
+
+// WithContext stores log in ctx, every layer below logs with the fields it carries
+func WithContext(ctx context.Context, log *zap.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey, log)
+}
+
+// FromContext returns the request logger stored in ctx, or the global zap logger outside of a request
+func FromContext(ctx context.Context) *zap.Logger {
+	if log, ok := ctx.Value(loggerKey).(*zap.Logger); ok {
+		return log
+	}
+	return zap.L()
+}
+
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey, requestID)
+}
+
+// RequestID returns the id of the request being served, or an empty string
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey).(string)
+	return requestID
+}
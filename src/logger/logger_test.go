@@ -0,0 +1,48 @@
+package logger
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+
+	if _, err := New("debug"); err != nil {
+		t.Errorf("error should be nil, received %v", err)
+	}
+
+	if _, err := New("verbose"); err == nil {
+		t.Error("error should not be nil")
+	}
+}
+
+func TestFromContext(t *testing.T) {
+
+	if FromContext(context.Background()) != zap.L() {
+		t.Error("Global logger should be returned outside of a request")
+	}
+
+	core, logs := observer.New(zapcore.InfoLevel)
+	ctx := WithContext(context.Background(), zap.New(core).With(zap.String("requestId", "abc")))
+
+	FromContext(ctx).Info("access token issued")
+
+	entries := logs.All()
+	if len(entries) != 1 || entries[0].ContextMap()["requestId"] != "abc" {
+		t.Errorf("Request logger should be used, received %v", entries)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+
+	if id := RequestID(context.Background()); id != "" {
+		t.Errorf("Expected empty request id, received %s", id)
+	}
+
+	if id := RequestID(WithRequestID(context.Background(), "abc")); id != "abc" {
+		t.Errorf("Expected: %s, Received: %s", "abc", id)
+	}
+}
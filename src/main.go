@@ -1,7 +1,20 @@
 package main
 
-import "github.com/danielgom/bookstore_oauthapi/src/app"
+import (
+	"fmt"
+	"github.com/danielgom/bookstore_oauthapi/src/app"
+	"os"
+)
 
 func main() {
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := app.Migrate(os.Args[2:], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	app.StartApplication()
 }
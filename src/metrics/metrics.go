@@ -0,0 +1,161 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	namespace = "bookstore_oauth"
+
+	LookupHit     = "hit"
+	LookupMiss    = "miss"
+	LookupExpired = "expired"
+
+	LoginReasonInvalidCredentials = "invalid_credentials"
+	LoginReasonUserNotFound       = "user_not_found"
+	LoginReasonUpstreamError      = "upstream_error"
+	LoginReasonInvalidOtp         = "invalid_otp"
+
+	// ClientUnknown labels the tokens of clients which are not registered
+	ClientUnknown = "unknown"
+)
+
+var (
+	Registry = prometheus.NewRegistry()
+
+	TokensIssued = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tokens_issued_total",
+		Help:      "Access tokens issued by grant type and client.",
+	}, []string{"grant_type", "client_id"})
+
+	FailedLogins = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "failed_logins_total",
+		Help:      "Failed token requests by reason.",
+	}, []string{"reason"})
+
+	TokenLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "token_lookups_total",
+		Help:      "Access token lookups by result: hit, miss or expired.",
+	}, []string{"result"})
+
+	CassandraQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "cassandra_query_duration_seconds",
+		Help:      "Cassandra query latency by statement.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"statement", "status"})
+
+	PostgresQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "postgres_query_duration_seconds",
+		Help:      "PostgreSQL query latency by statement.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"statement", "status"})
+
+	RedisCommandDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "redis_command_duration_seconds",
+		Help:      "Redis command latency by command or script.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"command", "status"})
+
+	UsersAPIDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "users_api_request_duration_seconds",
+		Help:      "Users API request latency by response status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"code"})
+)
+
+func init() {
+	Registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		TokensIssued,
+		FailedLogins,
+		TokenLookups,
+		CassandraQueryDuration,
+		PostgresQueryDuration,
+		RedisCommandDuration,
+		UsersAPIDuration,
+	)
+}
+
+// RegisterCounterFunc exposes a counter maintained elsewhere, such as the token cache statistics
+func RegisterCounterFunc(name, help string, f func() float64) {
+	Registry.MustRegister(prometheus.NewCounterFunc(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      name,
+		Help:      help,
+	}, f))
+}
+
+// Handler serves the registry in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// registeredClient bounds the client_id label to the registered clients, none is registered until it is set
+var registeredClient = func(int64) bool { return false }
+
+// SetClientRegistry labels the tokens of the clients registered is true for with their id
+func SetClientRegistry(registered func(clientId int64) bool) {
+	registeredClient = registered
+}
+
+// IncTokensIssued counts a token of clientId, labelled 0 when issued to no client and unknown when the client is
+// not registered
+func IncTokensIssued(grantType string, clientId int64) {
+	client := ClientUnknown
+	if clientId == 0 || registeredClient(clientId) {
+		client = strconv.FormatInt(clientId, 10)
+	}
+	TokensIssued.WithLabelValues(grantType, client).Inc()
+}
+
+func IncFailedLogins(reason string) {
+	FailedLogins.WithLabelValues(reason).Inc()
+}
+
+func IncTokenLookups(result string) {
+	TokenLookups.WithLabelValues(result).Inc()
+}
+
+// ObserveQuery records the latency of statement since start and whether it failed
+func ObserveQuery(statement string, start time.Time, err error) {
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	CassandraQueryDuration.WithLabelValues(statement, status).Observe(time.Since(start).Seconds())
+}
+
+// ObservePostgresQuery records the latency of a PostgreSQL statement since start and whether it failed
+func ObservePostgresQuery(statement string, start time.Time, err error) {
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	PostgresQueryDuration.WithLabelValues(statement, status).Observe(time.Since(start).Seconds())
+}
+
+// ObserveRedisCommand records the latency of a Redis command or script since start and whether it failed
+func ObserveRedisCommand(command string, start time.Time, err error) {
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	RedisCommandDuration.WithLabelValues(command, status).Observe(time.Since(start).Seconds())
+}
+
+// ObserveUsersAPI records the latency of a users API request, code 0 means no response was received
+func ObserveUsersAPI(code int, start time.Time) {
+	UsersAPIDuration.WithLabelValues(strconv.Itoa(code)).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	errors2 "errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"testing"
+	"time"
+)
+
+func TestIncTokensIssued(t *testing.T) {
+
+	SetClientRegistry(func(clientId int64) bool { return clientId == 7 })
+	defer SetClientRegistry(func(int64) bool { return false })
+
+	before := testutil.ToFloat64(TokensIssued.WithLabelValues("password", "7"))
+	IncTokensIssued("password", 7)
+
+	if after := testutil.ToFloat64(TokensIssued.WithLabelValues("password", "7")); after != before+1 {
+		t.Errorf("Expected: %f, Received: %f", before+1, after)
+	}
+
+	before = testutil.ToFloat64(TokensIssued.WithLabelValues("password", ClientUnknown))
+	IncTokensIssued("password", 8)
+
+	if after := testutil.ToFloat64(TokensIssued.WithLabelValues("password", ClientUnknown)); after != before+1 {
+		t.Errorf("Unregistered clients should be labelled %s, Expected: %f, Received: %f", ClientUnknown, before+1, after)
+	}
+}
+
+func TestIncFailedLogins(t *testing.T) {
+
+	before := testutil.ToFloat64(FailedLogins.WithLabelValues(LoginReasonUserNotFound))
+	IncFailedLogins(LoginReasonUserNotFound)
+
+	if after := testutil.ToFloat64(FailedLogins.WithLabelValues(LoginReasonUserNotFound)); after != before+1 {
+		t.Errorf("Expected: %f, Received: %f", before+1, after)
+	}
+}
+
+func TestIncTokenLookups(t *testing.T) {
+
+	before := testutil.ToFloat64(TokenLookups.WithLabelValues(LookupExpired))
+	IncTokenLookups(LookupExpired)
+
+	if after := testutil.ToFloat64(TokenLookups.WithLabelValues(LookupExpired)); after != before+1 {
+		t.Errorf("Expected: %f, Received: %f", before+1, after)
+	}
+}
+
+func TestObserveQuery(t *testing.T) {
+
+	before := testutil.CollectAndCount(CassandraQueryDuration)
+
+	ObserveQuery("queryTestOk", time.Now(), nil)
+	ObserveQuery("queryTestError", time.Now(), errors2.New("timeout"))
+
+	if after := testutil.CollectAndCount(CassandraQueryDuration); after != before+2 {
+		t.Errorf("Expected %d series, received %d", before+2, after)
+	}
+}
+
+func TestObserveUsersAPI(t *testing.T) {
+
+	before := testutil.CollectAndCount(UsersAPIDuration)
+
+	ObserveUsersAPI(599, time.Now())
+
+	if after := testutil.CollectAndCount(UsersAPIDuration); after != before+1 {
+		t.Errorf("Expected %d series, received %d", before+1, after)
+	}
+}
@@ -0,0 +1,100 @@
+package oauth
+
+import (
+	"context"
+	"github.com/danielgom/bookstore_oauthapi/src/clock"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCacheSize = 10000
+	// maxCacheTTL bounds how long a token revoked on the oauth api is still accepted from the cache
+	maxCacheTTL = 30 * time.Second
+)
+
+// NewCachingValidator remembers successful validations for 30 seconds at most, or until the token expires when
+// sooner. A revoked token is accepted until its entry expires
+func NewCachingValidator(validator Validator, maxEntries int) Validator {
+	if maxEntries <= 0 {
+		maxEntries = defaultCacheSize
+	}
+	return &cachingValidator{
+		validator:  validator,
+		maxEntries: maxEntries,
+		entries:    make(map[string]*cacheEntry),
+		clock:      clock.System,
+	}
+}
+
+type cachingValidator struct {
+	validator  Validator
+	maxEntries int
+	clock      clock.Clock
+
+	mu      sync.RWMutex
+	entries map[string]*cacheEntry
+}
+
+type cacheEntry struct {
+	principal *Principal
+	// expires is the unix time the entry is dropped at, maxCacheTTL after it was cached at the latest
+	expires int64
+}
+
+func (c *cachingValidator) Validate(ctx context.Context, token string) (*Principal, error) {
+
+	now := c.clock.Now()
+
+	c.mu.RLock()
+	entry, ok := c.entries[token]
+	c.mu.RUnlock()
+
+	if ok {
+		if !time.Unix(entry.expires, 0).Before(now) {
+			return entry.principal, nil
+		}
+		c.mu.Lock()
+		delete(c.entries, token)
+		c.mu.Unlock()
+	}
+
+	principal, err := c.validator.Validate(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	expires := now.Add(maxCacheTTL).Unix()
+	if principal.Expires < expires {
+		expires = principal.Expires
+	}
+
+	c.mu.Lock()
+	if len(c.entries) >= c.maxEntries {
+		c.evict(now.Unix())
+	}
+	c.entries[token] = &cacheEntry{principal: principal, expires: expires}
+	c.mu.Unlock()
+
+	return principal, nil
+}
+
+// evict drops expired entries, or half of the cache when none expired. Must hold c.mu
+func (c *cachingValidator) evict(now int64) {
+	for token, entry := range c.entries {
+		if entry.expires < now {
+			delete(c.entries, token)
+		}
+	}
+
+	if len(c.entries) < c.maxEntries {
+		return
+	}
+
+	for token := range c.entries {
+		if len(c.entries) < c.maxEntries/2 {
+			break
+		}
+		delete(c.entries, token)
+	}
+}
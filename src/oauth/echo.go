@@ -0,0 +1,59 @@
+package oauth
+
+import (
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+const (
+	// EchoContextKey is the echo.Context key holding the *Principal
+	EchoContextKey = "oauth.principal"
+)
+
+// EchoMiddleware is the echo flavour of Middleware
+func EchoMiddleware(validator Validator, scopes ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			r := c.Request()
+
+			principal, err := Authenticate(r.Context(), validator, r, scopes...)
+			if err != nil {
+				status, code := statusFor(err)
+				if status != http.StatusServiceUnavailable {
+					c.Response().Header().Set(echo.HeaderWWWAuthenticate, challenge(code, scopes))
+				}
+				return echo.NewHTTPError(status, http.StatusText(status)).SetInternal(err)
+			}
+
+			c.SetRequest(r.WithContext(WithPrincipal(r.Context(), principal)))
+			c.Set(EchoContextKey, principal)
+
+			return next(c)
+		}
+	}
+}
+
+// EchoRequireScopes is the echo flavour of RequireScopes, for per-route scope requirements
+func EchoRequireScopes(scopes ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			principal, ok := EchoPrincipal(c)
+			if !ok {
+				c.Response().Header().Set(echo.HeaderWWWAuthenticate, challenge("", scopes))
+				return echo.NewHTTPError(http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+			}
+
+			if !principal.HasScopes(scopes...) {
+				c.Response().Header().Set(echo.HeaderWWWAuthenticate, challenge("insufficient_scope", scopes))
+				return echo.NewHTTPError(http.StatusForbidden, http.StatusText(http.StatusForbidden))
+			}
+
+			return next(c)
+		}
+	}
+}
+
+func EchoPrincipal(c echo.Context) (*Principal, bool) {
+	principal, ok := c.Get(EchoContextKey).(*Principal)
+	return principal, ok && principal != nil
+}
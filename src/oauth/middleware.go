@@ -0,0 +1,103 @@
+package oauth
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// BearerToken extracts the token of an "Authorization: Bearer <token>" header
+func BearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "Bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(header[7:])
+}
+
+// Authenticate validates the request bearer token and checks it holds scopes
+func Authenticate(ctx context.Context, validator Validator, r *http.Request, scopes ...string) (*Principal, error) {
+
+	token := BearerToken(r)
+	if token == "" {
+		return nil, ErrMissingToken
+	}
+
+	principal, err := validator.Validate(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if !principal.HasScopes(scopes...) {
+		return nil, ErrInsufficientScope
+	}
+
+	return principal, nil
+}
+
+// statusFor maps authentication errors to the RFC 6750 response status and error code
+func statusFor(err error) (int, string) {
+	switch err {
+	case ErrMissingToken:
+		return http.StatusUnauthorized, ""
+	case ErrInvalidToken:
+		return http.StatusUnauthorized, "invalid_token"
+	case ErrInsufficientScope:
+		return http.StatusForbidden, "insufficient_scope"
+	default:
+		return http.StatusServiceUnavailable, ""
+	}
+}
+
+func challenge(code string, scopes []string) string {
+	value := `Bearer realm="bookstore"`
+	if code != "" {
+		value += `, error="` + code + `"`
+	}
+	if code == "insufficient_scope" && len(scopes) > 0 {
+		value += `, scope="` + strings.Join(scopes, " ") + `"`
+	}
+	return value
+}
+
+// Middleware is the net/http authentication middleware. Requests without a valid token holding every
+// one of scopes are rejected, otherwise the principal is stored in the request context.
+func Middleware(validator Validator, scopes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, err := Authenticate(r.Context(), validator, r, scopes...)
+			if err != nil {
+				status, code := statusFor(err)
+				if status != http.StatusServiceUnavailable {
+					w.Header().Set("WWW-Authenticate", challenge(code, scopes))
+				}
+				http.Error(w, http.StatusText(status), status)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), principal)))
+		})
+	}
+}
+
+// RequireScopes rejects requests whose principal, set by Middleware, lacks any of scopes
+func RequireScopes(scopes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := FromContext(r.Context())
+			if !ok {
+				w.Header().Set("WWW-Authenticate", challenge("", scopes))
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+
+			if !principal.HasScopes(scopes...) {
+				w.Header().Set("WWW-Authenticate", challenge("insufficient_scope", scopes))
+				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
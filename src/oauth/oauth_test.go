@@ -0,0 +1,278 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/danielgom/bookstore_oauthapi/src/clock/clocktest"
+	"github.com/danielgom/bookstore_oauthapi/src/domain/accesstoken"
+	"github.com/danielgom/bookstore_utils-go/errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeService is the TokenGetter of the local validator
+type fakeService struct {
+	tokens map[string]*accesstoken.AccessToken
+	calls  int
+}
+
+func (f *fakeService) GetByID(_ context.Context, id string) (*accesstoken.AccessToken, errors.RestErr) {
+	f.calls++
+	at, ok := f.tokens[id]
+	if !ok {
+		return nil, errors.NewNotFoundError("No access token found with given id")
+	}
+	return at, nil
+}
+
+func newFakeService() *fakeService {
+	return &fakeService{tokens: map[string]*accesstoken.AccessToken{
+		"valid": {
+			AccessToken: "valid",
+			UserId:      1,
+			ClientId:    2,
+			Scope:       "books:read books:write",
+			Expires:     time.Now().Add(time.Hour).Unix(),
+		},
+		"exchanged": {
+			AccessToken: "exchanged",
+			UserId:      1,
+			ClientId:    5,
+			Scope:       "books:read",
+			Expires:     time.Now().Add(time.Hour).Unix(),
+			Act:         &accesstoken.Actor{ClientId: 5},
+		},
+		"expired": {
+			AccessToken: "expired",
+			UserId:      1,
+			ClientId:    2,
+			Expires:     time.Now().Add(-time.Hour).Unix(),
+		},
+	}}
+}
+
+func TestLocalValidator(t *testing.T) {
+
+	validator := NewLocalValidator(newFakeService())
+
+	principal, err := validator.Validate(context.Background(), "valid")
+	if err != nil {
+		t.Fatal("error should be nil")
+	}
+	if principal.UserId != 1 || principal.ClientId != 2 || !principal.HasScopes("books:read", "books:write") {
+		t.Errorf("Unexpected principal %+v", principal)
+	}
+
+	if principal.Act != nil {
+		t.Errorf("Tokens issued to the user should have no actor, received %+v", principal.Act)
+	}
+
+	if principal, err = validator.Validate(context.Background(), "exchanged"); err != nil || principal.Act == nil ||
+		principal.Act.ClientId != 5 {
+		t.Errorf("Unexpected principal %+v, %v", principal, err)
+	}
+
+	if _, err = validator.Validate(context.Background(), "expired"); err != ErrInvalidToken {
+		t.Errorf("Expected: %v, Received: %v", ErrInvalidToken, err)
+	}
+
+	if _, err = validator.Validate(context.Background(), "unknown"); err != ErrInvalidToken {
+		t.Errorf("Expected: %v, Received: %v", ErrInvalidToken, err)
+	}
+}
+
+func TestRemoteValidator(t *testing.T) {
+
+	service := newFakeService()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if clientId, secret, ok := r.BasicAuth(); !ok || clientId != "3" || secret != "the_secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		id := strings.TrimPrefix(r.URL.Path, "/oauth/accessToken/")
+		at, err := service.GetByID(r.Context(), id)
+		if err != nil {
+			w.WriteHeader(err.Status())
+			return
+		}
+		_ = json.NewEncoder(w).Encode(at)
+	}))
+	defer server.Close()
+
+	validator := NewRemoteValidator(RemoteConfig{BaseURL: server.URL + "/", ClientId: "3", ClientSecret: "the_secret"})
+
+	principal, err := validator.Validate(context.Background(), "valid")
+	if err != nil {
+		t.Fatalf("error should be nil, received %v", err)
+	}
+	if principal.UserId != 1 || !principal.HasScopes("books:read") {
+		t.Errorf("Unexpected principal %+v", principal)
+	}
+
+	if _, err = validator.Validate(context.Background(), "expired"); err != ErrInvalidToken {
+		t.Errorf("Expected: %v, Received: %v", ErrInvalidToken, err)
+	}
+
+	if _, err = validator.Validate(context.Background(), "unknown"); err != ErrInvalidToken {
+		t.Errorf("Expected: %v, Received: %v", ErrInvalidToken, err)
+	}
+
+	unauthenticated := NewRemoteValidator(RemoteConfig{BaseURL: server.URL})
+	if _, err = unauthenticated.Validate(context.Background(), "valid"); err == nil || err == ErrInvalidToken {
+		t.Errorf("Rejected client credentials should not be reported as an invalid token, received %v", err)
+	}
+
+	server.Close()
+	if _, err = validator.Validate(context.Background(), "valid"); err == nil || err == ErrInvalidToken {
+		t.Errorf("Unreachable oauth api should not be reported as an invalid token, received %v", err)
+	}
+}
+
+func TestCachingValidator(t *testing.T) {
+
+	service := newFakeService()
+	validator := NewCachingValidator(NewLocalValidator(service), 2)
+
+	for i := 0; i < 3; i++ {
+		if _, err := validator.Validate(context.Background(), "valid"); err != nil {
+			t.Fatal("error should be nil")
+		}
+	}
+	if service.calls != 1 {
+		t.Errorf("Valid token should be fetched once, fetched %d times", service.calls)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := validator.Validate(context.Background(), "unknown"); err != ErrInvalidToken {
+			t.Errorf("Expected: %v, Received: %v", ErrInvalidToken, err)
+		}
+	}
+	if service.calls != 3 {
+		t.Errorf("Invalid tokens should not be cached, fetched %d times", service.calls)
+	}
+}
+
+func TestCachingValidatorTTL(t *testing.T) {
+
+	service := newFakeService()
+	cache := NewCachingValidator(NewLocalValidator(service), 2).(*cachingValidator)
+	clk := clocktest.NewClock(time.Unix(1600000000, 0))
+	cache.clock = clk
+
+	validate := func() {
+		if _, err := cache.Validate(context.Background(), "valid"); err != nil {
+			t.Fatal("error should be nil")
+		}
+	}
+
+	validate()
+	clk.Advance(maxCacheTTL)
+	validate()
+	if service.calls != 1 {
+		t.Errorf("The token should be cached for %v, fetched %d times", maxCacheTTL, service.calls)
+	}
+
+	clk.Advance(time.Second)
+	validate()
+	if service.calls != 2 {
+		t.Errorf("The token should be fetched again after %v, fetched %d times", maxCacheTTL, service.calls)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+
+	validator := NewLocalValidator(newFakeService())
+
+	var received *Principal
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ = FromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	})
+
+	cases := []struct {
+		name          string
+		authorization string
+		scopes        []string
+		status        int
+		challenge     string
+	}{
+		{"Should accept a valid token", "Bearer valid", nil, http.StatusOK, ""},
+		{"Should accept a valid token with scopes", "bearer valid", []string{"books:read"}, http.StatusOK, ""},
+		{"Should reject a missing token", "", nil, http.StatusUnauthorized, `Bearer realm="bookstore"`},
+		{"Should reject a non bearer token", "Basic dXNlcjpwYXNz", nil, http.StatusUnauthorized, `Bearer realm="bookstore"`},
+		{"Should reject an expired token", "Bearer expired", nil, http.StatusUnauthorized, `Bearer realm="bookstore", error="invalid_token"`},
+		{"Should reject a token without scope", "Bearer valid", []string{"admin"}, http.StatusForbidden,
+			`Bearer realm="bookstore", error="insufficient_scope", scope="admin"`},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			received = nil
+			r := httptest.NewRequest(http.MethodGet, "/books", nil)
+			if tc.authorization != "" {
+				r.Header.Set("Authorization", tc.authorization)
+			}
+			w := httptest.NewRecorder()
+
+			Middleware(validator, tc.scopes...)(handler).ServeHTTP(w, r)
+
+			if w.Code != tc.status {
+				t.Errorf("Expected: %d, Received: %d", tc.status, w.Code)
+			}
+			if challenge := w.Header().Get("WWW-Authenticate"); challenge != tc.challenge {
+				t.Errorf("Expected: %s, Received: %s", tc.challenge, challenge)
+			}
+			if tc.status == http.StatusOK && (received == nil || received.UserId != 1) {
+				t.Errorf("Principal should be stored in the context, received %+v", received)
+			}
+		})
+	}
+}
+
+func TestRequireScopes(t *testing.T) {
+
+	validator := NewLocalValidator(newFakeService())
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	read := Middleware(validator)(RequireScopes("books:read")(ok))
+	admin := Middleware(validator)(RequireScopes("admin")(ok))
+
+	r := httptest.NewRequest(http.MethodGet, "/books", nil)
+	r.Header.Set("Authorization", "Bearer valid")
+
+	w := httptest.NewRecorder()
+	read.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected: %d, Received: %d", http.StatusOK, w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	admin.ServeHTTP(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected: %d, Received: %d", http.StatusForbidden, w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	RequireScopes("books:read")(ok).ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected: %d, Received: %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
+func TestPrincipalIsFirstParty(t *testing.T) {
+
+	if !(&Principal{UserId: 1}).IsFirstParty() {
+		t.Error("A token of the user should be first party")
+	}
+	if (&Principal{UserId: 1, ClientId: 7}).IsFirstParty() {
+		t.Error("A token issued to a client should not be first party")
+	}
+	if (&Principal{UserId: 1, Act: &accesstoken.Actor{ClientId: 3}}).IsFirstParty() {
+		t.Error("An exchanged token should not be first party")
+	}
+}
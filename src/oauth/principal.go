@@ -0,0 +1,86 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"github.com/danielgom/bookstore_oauthapi/src/clock"
+	"github.com/danielgom/bookstore_oauthapi/src/domain/accesstoken"
+	"time"
+)
+
+var (
+	ErrMissingToken      = errors.New("missing bearer token")
+	ErrInvalidToken      = errors.New("invalid or expired bearer token")
+	ErrInsufficientScope = errors.New("insufficient scope")
+)
+
+// Principal is the authenticated caller of a resource server request
+type Principal struct {
+	AccessToken string
+	UserId      int64
+	ClientId    int64
+	Scopes      []string
+	Expires     int64
+	// Act is the client acting on behalf of the user, set for tokens obtained by token exchange
+	Act *accesstoken.Actor
+}
+
+// IsExpired reports whether the time of c is past Expires
+func (p *Principal) IsExpired(c clock.Clock) bool {
+	return time.Unix(p.Expires, 0).Before(c.Now())
+}
+
+// HasScopes reports whether the principal was granted every one of scopes
+func (p *Principal) HasScopes(scopes ...string) bool {
+	for _, required := range scopes {
+		found := false
+		for _, granted := range p.Scopes {
+			if granted == required {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// IsFirstParty reports whether the user obtained the token themselves, not through a client nor by token exchange
+func (p *Principal) IsFirstParty() bool {
+	return p.ClientId == 0 && p.Act == nil
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// FromContext returns the principal stored by the authentication middleware
+func FromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(*Principal)
+	return principal, ok && principal != nil
+}
+
+func UserId(ctx context.Context) int64 {
+	if principal, ok := FromContext(ctx); ok {
+		return principal.UserId
+	}
+	return 0
+}
+
+func ClientId(ctx context.Context) int64 {
+	if principal, ok := FromContext(ctx); ok {
+		return principal.ClientId
+	}
+	return 0
+}
+
+func Scopes(ctx context.Context) []string {
+	if principal, ok := FromContext(ctx); ok {
+		return principal.Scopes
+	}
+	return nil
+}
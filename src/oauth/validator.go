@@ -0,0 +1,145 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/danielgom/bookstore_oauthapi/src/clock"
+	"github.com/danielgom/bookstore_oauthapi/src/domain/accesstoken"
+	"github.com/danielgom/bookstore_utils-go/errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Validator resolves a bearer token into the principal it was issued to
+type Validator interface {
+	Validate(context.Context, string) (*Principal, error)
+}
+
+type ValidatorFunc func(context.Context, string) (*Principal, error)
+
+func (f ValidatorFunc) Validate(ctx context.Context, token string) (*Principal, error) {
+	return f(ctx, token)
+}
+
+func newPrincipal(at *accesstoken.AccessToken) *Principal {
+	return &Principal{
+		AccessToken: at.AccessToken,
+		UserId:      at.UserId,
+		ClientId:    at.ClientId,
+		Scopes:      at.Scopes(),
+		Expires:     at.Expires,
+		Act:         at.Act,
+	}
+}
+
+// TokenGetter looks access tokens up by id, as the access token service does
+type TokenGetter interface {
+	GetByID(context.Context, string) (*accesstoken.AccessToken, errors.RestErr)
+}
+
+// NewLocalValidator validates tokens in process, for services embedding the oauth service
+func NewLocalValidator(tokens TokenGetter) Validator {
+	return &localValidator{tokens: tokens, clock: clock.System}
+}
+
+type localValidator struct {
+	tokens TokenGetter
+	clock  clock.Clock
+}
+
+func (v *localValidator) Validate(ctx context.Context, token string) (*Principal, error) {
+	at, err := v.tokens.GetByID(ctx, token)
+	if err != nil {
+		if err.Status() == http.StatusNotFound || err.Status() == http.StatusBadRequest {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+
+	if at.IsExpired(v.clock) {
+		return nil, ErrInvalidToken
+	}
+
+	return newPrincipal(at), nil
+}
+
+type HTTPClient interface {
+	Do(*http.Request) (*http.Response, error)
+}
+
+type RemoteConfig struct {
+	// BaseURL of the oauth api, e.g. http://localhost:8080
+	BaseURL string
+	// ClientId and ClientSecret of the resource server, sent with HTTP Basic authentication. They may be left
+	// empty when Client authenticates with a TLS client certificate
+	ClientId     string
+	ClientSecret string
+	Client       HTTPClient
+	Timeout      time.Duration
+}
+
+// NewRemoteValidator validates tokens against GET /oauth/accessToken/:atId of a remote oauth api, which only
+// answers clients registered as resource servers
+func NewRemoteValidator(config RemoteConfig) Validator {
+	if config.Client == nil {
+		config.Client = &http.Client{}
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = time.Second
+	}
+	config.BaseURL = strings.TrimRight(config.BaseURL, "/")
+
+	return &remoteValidator{config: config, clock: clock.System}
+}
+
+type remoteValidator struct {
+	config RemoteConfig
+	clock  clock.Clock
+}
+
+func (v *remoteValidator) Validate(ctx context.Context, token string) (*Principal, error) {
+	ctx, cancel := context.WithTimeout(ctx, v.config.Timeout)
+	defer cancel()
+
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		fmt.Sprintf("%s/oauth/accessToken/%s", v.config.BaseURL, url.PathEscape(token)), nil)
+	if err != nil {
+		return nil, err
+	}
+	if v.config.ClientId != "" {
+		r.SetBasicAuth(v.config.ClientId, v.config.ClientSecret)
+	}
+
+	resp, err := v.config.Client.Do(r)
+	if err != nil {
+		return nil, fmt.Errorf("oauth api request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("oauth api response could not be read: %w", err)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusBadRequest:
+		return nil, ErrInvalidToken
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("oauth api answered with status %d", resp.StatusCode)
+	}
+
+	at := new(accesstoken.AccessToken)
+	if err = json.Unmarshal(body, at); err != nil {
+		return nil, fmt.Errorf("oauth api response could not be decoded: %w", err)
+	}
+
+	if at.IsExpired(v.clock) {
+		return nil, ErrInvalidToken
+	}
+
+	return newPrincipal(at), nil
+}
@@ -0,0 +1,28 @@
+package clientsdb
+
+import (
+	"github.com/danielgom/bookstore_oauthapi/src/config"
+	"strings"
+)
+
+const (
+	StoreFile = "file"
+
+	envClientsFile  = "CLIENTS_FILE"
+	envClientsStore = "CLIENTS_STORE"
+)
+
+// StoreFromConfig returns the CLIENTS_STORE backend, file by default
+func StoreFromConfig() string {
+	return config.GetString(envClientsStore, StoreFile)
+}
+
+// NewRepositoryFromConfig loads the CLIENTS_FILE registry. Without it no client is registered, so routes
+// requiring client authentication reject every caller
+func NewRepositoryFromConfig() (ClientsRepository, error) {
+	path := config.GetString(envClientsFile, "")
+	if path == "" {
+		return newFileRepository(strings.NewReader(""))
+	}
+	return NewFileRepository(path)
+}
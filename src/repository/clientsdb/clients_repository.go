@@ -0,0 +1,108 @@
+package clientsdb
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/danielgom/bookstore_oauthapi/src/domain/clients"
+	"github.com/danielgom/bookstore_utils-go/errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type ClientsRepository interface {
+	GetByID(context.Context, int64) (*clients.Client, errors.RestErr)
+	// GetByName returns the client a certificate with the given common name was issued to
+	GetByName(context.Context, string) (*clients.Client, errors.RestErr)
+	// UpdateSecret replaces the secret hash of a client
+	UpdateSecret(context.Context, int64, string) errors.RestErr
+}
+
+// NewFileRepository loads the registered clients from a file, one client per line:
+//
+//	id:name:hash[:role,role]
+//
+// Blank lines and lines starting with # are ignored. Hashes must be bcrypt or argon2id, clients authenticating
+// with a certificate only may leave it empty.
+func NewFileRepository(path string) (ClientsRepository, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return newFileRepository(file)
+}
+
+func newFileRepository(r io.Reader) (ClientsRepository, error) {
+	repository := &fileRepository{byId: make(map[int64]clients.Client), byName: make(map[string]clients.Client)}
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Split(text, ":")
+		if len(fields) < 3 || len(fields) > 4 {
+			return nil, fmt.Errorf("clients line %d: expected id:name:hash[:role,role]", line)
+		}
+
+		id, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil || id <= 0 {
+			return nil, fmt.Errorf("clients line %d: invalid client id %q", line, fields[0])
+		}
+		if fields[1] == "" {
+			return nil, fmt.Errorf("clients line %d: missing client name", line)
+		}
+		if _, ok := repository.byName[fields[1]]; ok {
+			return nil, fmt.Errorf("clients line %d: duplicate client name %q", line, fields[1])
+		}
+
+		client := clients.Client{Id: id, Name: fields[1], SecretHash: fields[2]}
+		if len(fields) > 3 {
+			for _, role := range strings.Split(fields[3], ",") {
+				if role = strings.TrimSpace(role); role != "" {
+					client.Roles = append(client.Roles, role)
+				}
+			}
+		}
+		repository.byId[id] = client
+		repository.byName[client.Name] = client
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return repository, nil
+}
+
+type fileRepository struct {
+	byId   map[int64]clients.Client
+	byName map[string]clients.Client
+}
+
+func (f *fileRepository) GetByID(_ context.Context, id int64) (*clients.Client, errors.RestErr) {
+	client, ok := f.byId[id]
+	if !ok {
+		return nil, errors.NewNotFoundError(fmt.Sprintf("Client with id %d not found", id))
+	}
+	return &client, nil
+}
+
+func (f *fileRepository) GetByName(_ context.Context, name string) (*clients.Client, errors.RestErr) {
+	client, ok := f.byName[name]
+	if !ok {
+		return nil, errors.NewNotFoundError(fmt.Sprintf("Client with name %s not found", name))
+	}
+	return &client, nil
+}
+
+// UpdateSecret is not supported, the secrets of CLIENTS_FILE are changed by editing the file
+func (f *fileRepository) UpdateSecret(context.Context, int64, string) errors.RestErr {
+	return errors.NewBadRequestError("Client secrets of CLIENTS_FILE cannot be rotated, edit the file instead")
+}
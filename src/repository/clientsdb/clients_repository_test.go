@@ -0,0 +1,65 @@
+package clientsdb
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestFileRepository(t *testing.T) {
+
+	file := "# registered clients\n\n1:books-api:$2a$10$hash:resource_server,admin\n2:web::\n"
+
+	repository, err := newFileRepository(strings.NewReader(file))
+	if err != nil {
+		t.Fatalf("error should be nil, received %v", err)
+	}
+
+	t.Run("Should return the client by id", func(t *testing.T) {
+		client, err := repository.GetByID(context.Background(), 1)
+
+		if err != nil {
+			t.Fatal("error should be nil")
+		}
+		if client.Name != "books-api" || client.SecretHash != "$2a$10$hash" || !client.HasRole("resource_server") ||
+			!client.HasRole("admin") {
+			t.Errorf("Unexpected client %+v", client)
+		}
+	})
+
+	t.Run("Should return the client by name", func(t *testing.T) {
+		client, err := repository.GetByName(context.Background(), "web")
+
+		if err != nil {
+			t.Fatal("error should be nil")
+		}
+		if client.Id != 2 || client.SecretHash != "" || client.HasRole("resource_server") {
+			t.Errorf("Unexpected client %+v", client)
+		}
+	})
+
+	t.Run("Should return not found for unknown clients", func(t *testing.T) {
+		if _, err := repository.GetByID(context.Background(), 3); err == nil || err.Status() != http.StatusNotFound {
+			t.Errorf("Expected not found, received %v", err)
+		}
+		if _, err := repository.GetByName(context.Background(), "other"); err == nil || err.Status() != http.StatusNotFound {
+			t.Errorf("Expected not found, received %v", err)
+		}
+	})
+
+	t.Run("Should not rotate secrets", func(t *testing.T) {
+		if err := repository.UpdateSecret(context.Background(), 1, "$2a$10$other"); err == nil || err.Status() != http.StatusBadRequest {
+			t.Errorf("Expected bad request, received %v", err)
+		}
+	})
+
+	t.Run("Should reject malformed lines", func(t *testing.T) {
+		for _, file := range []string{"1:books-api", "a:books-api:hash", "0:books-api:hash", "1::hash",
+			"1:books-api:hash\n2:books-api:hash"} {
+			if _, err := newFileRepository(strings.NewReader(file)); err == nil {
+				t.Errorf("Expected an error for %q", file)
+			}
+		}
+	})
+}
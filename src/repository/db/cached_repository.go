@@ -0,0 +1,235 @@
+package db
+
+import (
+	"container/list"
+	"context"
+	"github.com/danielgom/bookstore_oauthapi/src/clock"
+	"github.com/danielgom/bookstore_oauthapi/src/domain/accesstoken"
+	"github.com/danielgom/bookstore_utils-go/errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type CacheConfig struct {
+	// MaxEntries bounds the LRU, the least recently used token is evicted first
+	MaxEntries int
+	// TTL is the longest a token is cached, it is further bounded by the token expiration
+	TTL time.Duration
+	// NegativeTTL is how long unknown ids are remembered, zero disables negative caching
+	NegativeTTL time.Duration
+}
+
+type CacheStats struct {
+	Hits         uint64 `json:"hits"`
+	NegativeHits uint64 `json:"negativeHits"`
+	Misses       uint64 `json:"misses"`
+	Evictions    uint64 `json:"evictions"`
+	Entries      int    `json:"entries"`
+}
+
+type CachedRepository interface {
+	DRepository
+	Stats() CacheStats
+}
+
+// NewCachedRepository decorates repository with an in-process LRU cache of GetByID results. The writes only
+// invalidate the cache of this process, other instances keep serving a revoked token until its entry expires
+func NewCachedRepository(repository DRepository, config CacheConfig) CachedRepository {
+	if config.MaxEntries <= 0 {
+		config.MaxEntries = 10000
+	}
+	return &cachedRepository{
+		repository: repository,
+		config:     config,
+		lru:        list.New(),
+		items:      make(map[string]*list.Element),
+		clock:      clock.System,
+	}
+}
+
+type cacheEntry struct {
+	id string
+	// at is nil for negative entries
+	at      *accesstoken.AccessToken
+	expires time.Time
+}
+
+type cachedRepository struct {
+	// counters first to keep them 64-bit aligned for atomic access
+	hits, negativeHits, misses, evictions uint64
+
+	repository DRepository
+	config     CacheConfig
+
+	mu    sync.Mutex
+	lru   *list.List
+	items map[string]*list.Element
+	// generation counts the invalidations, a lookup started before one is not cached
+	generation uint64
+	clock      clock.Clock
+}
+
+func (r *cachedRepository) GetByID(ctx context.Context, id string) (*accesstoken.AccessToken, errors.RestErr) {
+
+	if entry, ok := r.get(id); ok {
+		if entry.at == nil {
+			atomic.AddUint64(&r.negativeHits, 1)
+			return nil, errors.NewNotFoundError("No access token found with given id")
+		}
+		atomic.AddUint64(&r.hits, 1)
+		at := *entry.at
+		return &at, nil
+	}
+
+	atomic.AddUint64(&r.misses, 1)
+
+	generation := r.currentGeneration()
+	at, err := r.repository.GetByID(ctx, id)
+	if err != nil {
+		if err.Status() == http.StatusNotFound && r.config.NegativeTTL > 0 {
+			r.set(id, nil, r.clock.Now().Add(r.config.NegativeTTL), generation)
+		}
+		return nil, err
+	}
+
+	now := r.clock.Now()
+	expires := time.Unix(at.Expires, 0)
+	if ttl := now.Add(r.config.TTL); ttl.Before(expires) {
+		expires = ttl
+	}
+	if expires.After(now) {
+		cached := *at
+		r.set(id, &cached, expires, generation)
+	}
+
+	return at, nil
+}
+
+func (r *cachedRepository) Create(ctx context.Context, at *accesstoken.AccessToken) errors.RestErr {
+	defer r.invalidate(at.AccessToken)
+	return r.repository.Create(ctx, at)
+}
+
+func (r *cachedRepository) UpdateExpirationTime(ctx context.Context, at *accesstoken.AccessToken) errors.RestErr {
+	defer r.invalidate(at.AccessToken)
+	return r.repository.UpdateExpirationTime(ctx, at)
+}
+
+func (r *cachedRepository) UpdateLastUsed(ctx context.Context, at *accesstoken.AccessToken) errors.RestErr {
+	defer r.invalidate(at.AccessToken)
+	return r.repository.UpdateLastUsed(ctx, at)
+}
+
+func (r *cachedRepository) Delete(ctx context.Context, id string) errors.RestErr {
+	defer r.invalidate(id)
+	return r.repository.Delete(ctx, id)
+}
+
+func (r *cachedRepository) ListByUser(ctx context.Context, userId int64) ([]accesstoken.AccessToken, errors.RestErr) {
+	return r.repository.ListByUser(ctx, userId)
+}
+
+// DeleteByUser also drops the cached tokens of the user, even when the repository failed part way
+func (r *cachedRepository) DeleteByUser(ctx context.Context, userId int64) (int, errors.RestErr) {
+	defer r.invalidateWhere(func(at *accesstoken.AccessToken) bool { return at.UserId == userId })
+	return r.repository.DeleteByUser(ctx, userId)
+}
+
+// DeleteByClient also drops the cached tokens of the client, even when the repository failed part way
+func (r *cachedRepository) DeleteByClient(ctx context.Context, clientId int64) (int, errors.RestErr) {
+	defer r.invalidateWhere(func(at *accesstoken.AccessToken) bool { return at.ClientId == clientId })
+	return r.repository.DeleteByClient(ctx, clientId)
+}
+
+func (r *cachedRepository) Stats() CacheStats {
+	r.mu.Lock()
+	entries := r.lru.Len()
+	r.mu.Unlock()
+
+	return CacheStats{
+		Hits:         atomic.LoadUint64(&r.hits),
+		NegativeHits: atomic.LoadUint64(&r.negativeHits),
+		Misses:       atomic.LoadUint64(&r.misses),
+		Evictions:    atomic.LoadUint64(&r.evictions),
+		Entries:      entries,
+	}
+}
+
+func (r *cachedRepository) get(id string) (*cacheEntry, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	element, ok := r.items[id]
+	if !ok {
+		return nil, false
+	}
+
+	entry := element.Value.(*cacheEntry)
+	if !entry.expires.After(r.clock.Now()) {
+		r.lru.Remove(element)
+		delete(r.items, id)
+		return nil, false
+	}
+
+	r.lru.MoveToFront(element)
+	return entry, true
+}
+
+func (r *cachedRepository) currentGeneration() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.generation
+}
+
+// set caches at unless the cache was invalidated since generation, at may then be a token deleted meanwhile
+func (r *cachedRepository) set(id string, at *accesstoken.AccessToken, expires time.Time, generation uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if generation != r.generation {
+		return
+	}
+
+	if element, ok := r.items[id]; ok {
+		element.Value = &cacheEntry{id: id, at: at, expires: expires}
+		r.lru.MoveToFront(element)
+		return
+	}
+
+	r.items[id] = r.lru.PushFront(&cacheEntry{id: id, at: at, expires: expires})
+
+	for r.lru.Len() > r.config.MaxEntries {
+		oldest := r.lru.Back()
+		r.lru.Remove(oldest)
+		delete(r.items, oldest.Value.(*cacheEntry).id)
+		atomic.AddUint64(&r.evictions, 1)
+	}
+}
+
+func (r *cachedRepository) invalidate(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.generation++
+	if element, ok := r.items[id]; ok {
+		r.lru.Remove(element)
+		delete(r.items, id)
+	}
+}
+
+// invalidateWhere drops the cached tokens matching, negative entries are kept
+func (r *cachedRepository) invalidateWhere(matching func(*accesstoken.AccessToken) bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.generation++
+	for id, element := range r.items {
+		if at := element.Value.(*cacheEntry).at; at != nil && matching(at) {
+			r.lru.Remove(element)
+			delete(r.items, id)
+		}
+	}
+}
@@ -0,0 +1,320 @@
+package db
+
+import (
+	"context"
+	errors2 "errors"
+	"github.com/danielgom/bookstore_oauthapi/src/clock/clocktest"
+	"github.com/danielgom/bookstore_oauthapi/src/domain/accesstoken"
+	"github.com/danielgom/bookstore_utils-go/errors"
+	"testing"
+	"time"
+)
+
+type fakeRepository struct {
+	tokens  map[string]*accesstoken.AccessToken
+	gets    int
+	failing bool
+	// afterGet runs once a token was read, before it is returned
+	afterGet func()
+}
+
+func (f *fakeRepository) GetByID(_ context.Context, id string) (*accesstoken.AccessToken, errors.RestErr) {
+	f.gets++
+	if f.failing {
+		return nil, errors.NewInternalServerError("error retrieving access token", errors2.New("timeout"))
+	}
+	at, ok := f.tokens[id]
+	if !ok {
+		return nil, errors.NewNotFoundError("No access token found with given id")
+	}
+	copied := *at
+	if f.afterGet != nil {
+		f.afterGet()
+	}
+	return &copied, nil
+}
+
+func (f *fakeRepository) Create(_ context.Context, at *accesstoken.AccessToken) errors.RestErr {
+	copied := *at
+	f.tokens[at.AccessToken] = &copied
+	return nil
+}
+
+func (f *fakeRepository) UpdateExpirationTime(_ context.Context, at *accesstoken.AccessToken) errors.RestErr {
+	f.tokens[at.AccessToken].Expires = at.Expires
+	return nil
+}
+
+func (f *fakeRepository) UpdateLastUsed(_ context.Context, at *accesstoken.AccessToken) errors.RestErr {
+	f.tokens[at.AccessToken].LastUsed = at.LastUsed
+	return nil
+}
+
+func (f *fakeRepository) Delete(_ context.Context, id string) errors.RestErr {
+	if _, ok := f.tokens[id]; !ok {
+		return errors.NewNotFoundError("No access token found with given id")
+	}
+	delete(f.tokens, id)
+	return nil
+}
+
+func (f *fakeRepository) ListByUser(_ context.Context, userId int64) ([]accesstoken.AccessToken, errors.RestErr) {
+	var tokens []accesstoken.AccessToken
+	for _, at := range f.tokens {
+		if at.UserId == userId {
+			tokens = append(tokens, *at)
+		}
+	}
+	return tokens, nil
+}
+
+func (f *fakeRepository) DeleteByUser(_ context.Context, userId int64) (int, errors.RestErr) {
+	deleted := 0
+	for id, at := range f.tokens {
+		if at.UserId == userId {
+			delete(f.tokens, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (f *fakeRepository) DeleteByClient(_ context.Context, clientId int64) (int, errors.RestErr) {
+	if f.failing {
+		return 0, errors.NewInternalServerError("error deleting access tokens", errors2.New("timeout"))
+	}
+	deleted := 0
+	for id, at := range f.tokens {
+		if at.ClientId == clientId {
+			delete(f.tokens, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func newFakeRepository() *fakeRepository {
+	return &fakeRepository{tokens: map[string]*accesstoken.AccessToken{
+		"valid":   {AccessToken: "valid", UserId: 1, ClientId: 1, Expires: time.Now().Add(time.Hour).Unix()},
+		"other":   {AccessToken: "other", UserId: 2, ClientId: 1, Expires: time.Now().Add(time.Hour).Unix()},
+		"expired": {AccessToken: "expired", UserId: 3, ClientId: 1, Expires: time.Now().Add(-time.Hour).Unix()},
+	}}
+}
+
+func TestCachedRepositoryGetByID(t *testing.T) {
+
+	t.Run("Should serve repeated lookups from the cache", func(t *testing.T) {
+		fake := newFakeRepository()
+		repository := NewCachedRepository(fake, CacheConfig{TTL: time.Minute})
+
+		for i := 0; i < 3; i++ {
+			at, err := repository.GetByID(context.Background(), "valid")
+			if err != nil || at.UserId != 1 {
+				t.Fatalf("Unexpected result %+v, %v", at, err)
+			}
+		}
+
+		if fake.gets != 1 {
+			t.Errorf("Expected 1 repository lookup, received %d", fake.gets)
+		}
+
+		stats := repository.Stats()
+		if stats.Hits != 2 || stats.Misses != 1 || stats.Entries != 1 {
+			t.Errorf("Unexpected stats %+v", stats)
+		}
+	})
+
+	t.Run("Should return copies of the cached token", func(t *testing.T) {
+		repository := NewCachedRepository(newFakeRepository(), CacheConfig{TTL: time.Minute})
+
+		at, _ := repository.GetByID(context.Background(), "valid")
+		at.UserId = 99
+
+		if at, _ = repository.GetByID(context.Background(), "valid"); at.UserId != 1 {
+			t.Error("Cached token should not be modified by callers")
+		}
+	})
+
+	t.Run("Should not cache expired tokens", func(t *testing.T) {
+		fake := newFakeRepository()
+		repository := NewCachedRepository(fake, CacheConfig{TTL: time.Minute})
+
+		_, _ = repository.GetByID(context.Background(), "expired")
+		_, _ = repository.GetByID(context.Background(), "expired")
+
+		if fake.gets != 2 {
+			t.Errorf("Expected 2 repository lookups, received %d", fake.gets)
+		}
+	})
+
+	t.Run("Should cache unknown ids when negative caching is enabled", func(t *testing.T) {
+		fake := newFakeRepository()
+		repository := NewCachedRepository(fake, CacheConfig{TTL: time.Minute, NegativeTTL: time.Minute})
+
+		for i := 0; i < 2; i++ {
+			if _, err := repository.GetByID(context.Background(), "unknown"); err == nil || err.Status() != 404 {
+				t.Error("Status returned should be 404")
+			}
+		}
+
+		if fake.gets != 1 || repository.Stats().NegativeHits != 1 {
+			t.Errorf("Unexpected lookups %d, stats %+v", fake.gets, repository.Stats())
+		}
+	})
+
+	t.Run("Should not cache unknown ids when negative caching is disabled", func(t *testing.T) {
+		fake := newFakeRepository()
+		repository := NewCachedRepository(fake, CacheConfig{TTL: time.Minute})
+
+		_, _ = repository.GetByID(context.Background(), "unknown")
+		_, _ = repository.GetByID(context.Background(), "unknown")
+
+		if fake.gets != 2 {
+			t.Errorf("Expected 2 repository lookups, received %d", fake.gets)
+		}
+	})
+
+	t.Run("Should not cache repository errors", func(t *testing.T) {
+		fake := newFakeRepository()
+		fake.failing = true
+		repository := NewCachedRepository(fake, CacheConfig{TTL: time.Minute, NegativeTTL: time.Minute})
+
+		for i := 0; i < 2; i++ {
+			if _, err := repository.GetByID(context.Background(), "valid"); err == nil || err.Status() != 500 {
+				t.Error("Status returned should be 500")
+			}
+		}
+
+		if fake.gets != 2 {
+			t.Errorf("Expected 2 repository lookups, received %d", fake.gets)
+		}
+	})
+
+	t.Run("Should evict the least recently used token", func(t *testing.T) {
+		fake := newFakeRepository()
+		repository := NewCachedRepository(fake, CacheConfig{MaxEntries: 1, TTL: time.Minute})
+
+		_, _ = repository.GetByID(context.Background(), "valid")
+		_, _ = repository.GetByID(context.Background(), "other")
+		_, _ = repository.GetByID(context.Background(), "valid")
+
+		if fake.gets != 3 || repository.Stats().Evictions != 2 {
+			t.Errorf("Unexpected lookups %d, stats %+v", fake.gets, repository.Stats())
+		}
+	})
+
+	t.Run("Should expire entries after the ttl", func(t *testing.T) {
+		fake := newFakeRepository()
+		now := clocktest.NewClock(time.Now())
+		repository := NewCachedRepository(fake, CacheConfig{TTL: time.Minute})
+		repository.(*cachedRepository).clock = now
+
+		_, _ = repository.GetByID(context.Background(), "valid")
+		now.Advance(time.Minute - time.Nanosecond)
+		_, _ = repository.GetByID(context.Background(), "valid")
+		if fake.gets != 1 {
+			t.Errorf("Expected 1 repository lookup before the ttl, received %d", fake.gets)
+		}
+
+		now.Advance(time.Nanosecond)
+		_, _ = repository.GetByID(context.Background(), "valid")
+		if fake.gets != 2 {
+			t.Errorf("Expected 2 repository lookups, received %d", fake.gets)
+		}
+	})
+}
+
+func TestCachedRepositoryInvalidation(t *testing.T) {
+
+	t.Run("Should invalidate on UpdateExpirationTime", func(t *testing.T) {
+		fake := newFakeRepository()
+		repository := NewCachedRepository(fake, CacheConfig{TTL: time.Minute})
+
+		at, _ := repository.GetByID(context.Background(), "valid")
+		at.Expires = time.Now().Add(2 * time.Hour).Unix()
+
+		if err := repository.UpdateExpirationTime(context.Background(), at); err != nil {
+			t.Fatal("error should be nil")
+		}
+
+		updated, _ := repository.GetByID(context.Background(), "valid")
+		if updated.Expires != at.Expires || fake.gets != 2 {
+			t.Errorf("Updated token should be fetched again, lookups %d", fake.gets)
+		}
+	})
+
+	t.Run("Should invalidate negative entries on Create", func(t *testing.T) {
+		fake := newFakeRepository()
+		repository := NewCachedRepository(fake, CacheConfig{TTL: time.Minute, NegativeTTL: time.Minute})
+
+		_, _ = repository.GetByID(context.Background(), "new")
+
+		if err := repository.Create(context.Background(), &accesstoken.AccessToken{AccessToken: "new", UserId: 4, ClientId: 1,
+			Expires: time.Now().Add(time.Hour).Unix()}); err != nil {
+			t.Fatal("error should be nil")
+		}
+
+		at, err := repository.GetByID(context.Background(), "new")
+		if err != nil || at.UserId != 4 {
+			t.Errorf("Created token should be found, received %+v, %v", at, err)
+		}
+	})
+}
+
+func TestCachedRepositoryConcurrentDelete(t *testing.T) {
+
+	fake := newFakeRepository()
+	repository := NewCachedRepository(fake, CacheConfig{TTL: time.Minute})
+
+	// the token is deleted while its lookup is in flight
+	fake.afterGet = func() {
+		fake.afterGet = nil
+		if err := repository.Delete(context.Background(), "valid"); err != nil {
+			t.Fatal("error should be nil")
+		}
+	}
+	if _, err := repository.GetByID(context.Background(), "valid"); err != nil {
+		t.Fatal("error should be nil")
+	}
+
+	if _, err := repository.GetByID(context.Background(), "valid"); err == nil || err.Status() != 404 {
+		t.Errorf("The deleted token should not be cached, received %v", err)
+	}
+}
+
+func TestCachedRepositoryDeleteByOwner(t *testing.T) {
+
+	t.Run("Should drop the cached tokens of the user", func(t *testing.T) {
+		fake := newFakeRepository()
+		repository := NewCachedRepository(fake, CacheConfig{TTL: time.Minute})
+		_, _ = repository.GetByID(context.Background(), "valid")
+		_, _ = repository.GetByID(context.Background(), "other")
+
+		if deleted, err := repository.DeleteByUser(context.Background(), 1); err != nil || deleted != 1 {
+			t.Fatalf("Unexpected result %d, %v", deleted, err)
+		}
+
+		if _, err := repository.GetByID(context.Background(), "valid"); err == nil {
+			t.Error("Deleted token should not be served from the cache")
+		}
+		if stats := repository.Stats(); stats.Hits != 0 || stats.Entries != 1 {
+			t.Errorf("Unexpected stats %+v", stats)
+		}
+	})
+
+	t.Run("Should drop the cached tokens of the client when the repository fails", func(t *testing.T) {
+		fake := newFakeRepository()
+		repository := NewCachedRepository(fake, CacheConfig{TTL: time.Minute})
+		_, _ = repository.GetByID(context.Background(), "valid")
+		_, _ = repository.GetByID(context.Background(), "other")
+		fake.failing = true
+
+		if _, err := repository.DeleteByClient(context.Background(), 1); err == nil {
+			t.Fatal("error should not be nil")
+		}
+
+		if stats := repository.Stats(); stats.Entries != 0 {
+			t.Errorf("Expected no cached tokens, received %d", stats.Entries)
+		}
+	})
+}
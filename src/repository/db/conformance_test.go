@@ -0,0 +1,33 @@
+package db_test
+
+import (
+	"github.com/danielgom/bookstore_oauthapi/src/repository/db"
+	"github.com/danielgom/bookstore_oauthapi/src/repository/db/dbtest"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMemoryRepositoryConformance(t *testing.T) {
+	dbtest.RunConformance(t, func(t *testing.T) db.DRepository {
+		return db.NewMemoryRepository(time.Minute)
+	})
+}
+
+func TestFileRepositoryConformance(t *testing.T) {
+	dbtest.RunConformance(t, func(t *testing.T) db.DRepository {
+		repository, err := db.NewFileRepository(filepath.Join(t.TempDir(), "tokens.db"), time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = repository.(io.Closer).Close() })
+		return repository
+	})
+}
+
+func TestCachedRepositoryConformance(t *testing.T) {
+	dbtest.RunConformance(t, func(t *testing.T) db.DRepository {
+		return db.NewCachedRepository(db.NewMemoryRepository(time.Minute), db.CacheConfig{MaxEntries: 100, TTL: time.Minute})
+	})
+}
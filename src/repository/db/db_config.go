@@ -0,0 +1,105 @@
+package db
+
+import (
+	"fmt"
+	"github.com/danielgom/bookstore_oauthapi/src/config"
+	"github.com/gocql/gocql"
+	"strings"
+	"time"
+)
+
+const (
+	StoreCassandra = "cassandra"
+	StoreMemory    = "memory"
+	StoreFile      = "file"
+
+	envTokenStore                   = "TOKEN_STORE"
+	envTokenStoreFile               = "TOKEN_STORE_FILE"
+	envTokenStoreSweepInterval      = "TOKEN_STORE_SWEEP_INTERVAL"
+	envTokenCacheEnabled            = "TOKEN_CACHE_ENABLED"
+	envTokenCacheSize               = "TOKEN_CACHE_SIZE"
+	envTokenCacheTTL                = "TOKEN_CACHE_TTL"
+	envTokenCacheNegativeTTL        = "TOKEN_CACHE_NEGATIVE_TTL"
+	envTokenReadConsistency         = "TOKEN_READ_CONSISTENCY"
+	envTokenWriteConsistency        = "TOKEN_WRITE_CONSISTENCY"
+	envTokenReadFallbackConsistency = "TOKEN_READ_FALLBACK_CONSISTENCY"
+
+	consistencyNone = "NONE"
+)
+
+// StoreFromConfig returns the TOKEN_STORE backend: cassandra, memory, file, or postgres and redis which are
+// built by pgdb and redisdb
+func StoreFromConfig() string {
+	return config.GetString(envTokenStore, StoreCassandra)
+}
+
+// NewStoreFromConfig returns the cassandra, memory or file TOKEN_STORE repository
+func NewStoreFromConfig() (DRepository, error) {
+
+	sweepInterval := config.GetDuration(envTokenStoreSweepInterval, time.Minute)
+
+	switch store := StoreFromConfig(); store {
+	case StoreCassandra:
+		consistency, err := newConsistencyFromConfig()
+		if err != nil {
+			return nil, err
+		}
+		return NewRepositoryWithConsistency(consistency), nil
+	case StoreMemory:
+		return NewMemoryRepository(sweepInterval), nil
+	case StoreFile:
+		return NewFileRepository(config.GetString(envTokenStoreFile, "tokens.db"), sweepInterval)
+	default:
+		return nil, fmt.Errorf("unknown token store %q", store)
+	}
+}
+
+// NewCachedRepositoryFromConfig puts repository behind the token cache when TOKEN_CACHE_ENABLED is set
+func NewCachedRepositoryFromConfig(repository DRepository) DRepository {
+
+	if !config.GetBool(envTokenCacheEnabled, false) {
+		return repository
+	}
+
+	return NewCachedRepository(repository, CacheConfig{
+		MaxEntries:  config.GetInt(envTokenCacheSize, 10000),
+		TTL:         config.GetDuration(envTokenCacheTTL, 5*time.Minute),
+		NegativeTTL: config.GetDuration(envTokenCacheNegativeTTL, 5*time.Second),
+	})
+}
+
+func newConsistencyFromConfig() (Consistency, error) {
+
+	var c Consistency
+	var err error
+
+	if c.Read, err = parseConsistency(envTokenReadConsistency, "LOCAL_ONE"); err != nil {
+		return c, err
+	}
+	if c.Write, err = parseConsistency(envTokenWriteConsistency, "LOCAL_QUORUM"); err != nil {
+		return c, err
+	}
+	if c.ReadFallback, err = parseConsistency(envTokenReadFallbackConsistency, "LOCAL_QUORUM"); err != nil {
+		return c, err
+	}
+	return c, nil
+}
+
+// parseConsistency reads a gocql consistency level, NONE keeps the session one. ANY is rejected, its zero value
+// stands for NONE
+func parseConsistency(key, fallback string) (gocql.Consistency, error) {
+
+	value := config.GetString(key, fallback)
+	if strings.EqualFold(value, consistencyNone) {
+		return 0, nil
+	}
+
+	consistency, err := gocql.ParseConsistencyWrapper(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	if consistency == gocql.Any {
+		return 0, fmt.Errorf("invalid %s: %s is not supported", key, value)
+	}
+	return consistency, nil
+}
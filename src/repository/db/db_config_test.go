@@ -0,0 +1,53 @@
+package db
+
+import (
+	"github.com/gocql/gocql"
+	"os"
+	"testing"
+)
+
+func TestNewConsistencyFromConfig(t *testing.T) {
+
+	t.Run("Should read locally and fall back to quorum by default", func(t *testing.T) {
+		c, err := newConsistencyFromConfig()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.Read != gocql.LocalOne || c.Write != gocql.LocalQuorum || c.ReadFallback != gocql.LocalQuorum {
+			t.Errorf("Unexpected consistency %+v", c)
+		}
+	})
+
+	t.Run("Should keep the session consistency with NONE", func(t *testing.T) {
+		_ = os.Setenv(envTokenReadConsistency, "quorum")
+		_ = os.Setenv(envTokenReadFallbackConsistency, "none")
+		defer os.Unsetenv(envTokenReadConsistency)
+		defer os.Unsetenv(envTokenReadFallbackConsistency)
+
+		c, err := newConsistencyFromConfig()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.Read != gocql.Quorum || c.ReadFallback != 0 {
+			t.Errorf("Unexpected consistency %+v", c)
+		}
+	})
+
+	t.Run("Should reject unknown levels", func(t *testing.T) {
+		_ = os.Setenv(envTokenWriteConsistency, "SOME")
+		defer os.Unsetenv(envTokenWriteConsistency)
+
+		if _, err := newConsistencyFromConfig(); err == nil {
+			t.Error("error should not be nil")
+		}
+	})
+
+	t.Run("Should reject ANY, which would stand for NONE", func(t *testing.T) {
+		_ = os.Setenv(envTokenWriteConsistency, "ANY")
+		defer os.Unsetenv(envTokenWriteConsistency)
+
+		if _, err := newConsistencyFromConfig(); err == nil {
+			t.Error("error should not be nil")
+		}
+	})
+}
@@ -1,64 +1,364 @@
 package db
 
 import (
-	"fmt"
+	"context"
+	"github.com/danielgom/bookstore_oauthapi/src/clock"
+	"github.com/danielgom/bookstore_oauthapi/src/datasource/cql"
 	"github.com/danielgom/bookstore_oauthapi/src/domain/accesstoken"
+	"github.com/danielgom/bookstore_oauthapi/src/logger"
+	"github.com/danielgom/bookstore_oauthapi/src/metrics"
 	"github.com/danielgom/bookstore_utils-go/errors"
 	"github.com/gocql/gocql"
+	"go.uber.org/zap"
+	"strings"
+	"time"
 )
 
 const (
-	queryGetAccessToken    = `SELECT accesstoken, clientid, expires, userid FROM access_tokens WHERE accesstoken=?;`
-	queryCreateAccessToken = `INSERT INTO access_tokens(accesstoken, clientid, expires, userid) VALUES (?, ?, ?, ?);`
+	queryGetAccessToken    = `SELECT accesstoken, clientid, expires, userid, scope, maxexpires, created, lastused, useragent, remoteip, act FROM access_tokens WHERE accesstoken=?;`
+	queryCreateAccessToken = `INSERT INTO access_tokens(accesstoken, clientid, expires, userid, scope, maxexpires, created, lastused, useragent, remoteip, act) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`
 	queryUpdateExpires     = `UPDATE access_tokens SET expires=? WHERE accesstoken=?;`
+	// an update racing a delete leaves a row without user nor expiry, which is never served as a live token
+	queryUpdateLastUsed    = `UPDATE access_tokens SET lastused=? WHERE accesstoken=?;`
+	queryDeleteAccessToken = `DELETE FROM access_tokens WHERE accesstoken=?;`
+	queryGetAccessTokens   = `SELECT accesstoken, clientid, expires, userid, scope FROM access_tokens;`
+
+	// access_tokens_by_user and access_tokens_by_client are lookup tables written in the same batch as
+	// access_tokens, their rows expire with the token
+	queryInsertUserToken   = `INSERT INTO access_tokens_by_user(userid, accesstoken, clientid, expires, scope) VALUES (?, ?, ?, ?, ?) USING TTL ?;`
+	queryInsertClientToken = `INSERT INTO access_tokens_by_client(clientid, accesstoken, userid, expires) VALUES (?, ?, ?, ?) USING TTL ?;`
+	queryGetUserTokens     = `SELECT accesstoken, clientid, expires, scope FROM access_tokens_by_user WHERE userid=?;`
+	queryGetClientTokens   = `SELECT accesstoken, userid, expires FROM access_tokens_by_client WHERE clientid=?;`
+	queryDeleteUserToken   = `DELETE FROM access_tokens_by_user WHERE userid=? AND accesstoken=?;`
+	queryDeleteClientToken = `DELETE FROM access_tokens_by_client WHERE clientid=? AND accesstoken=?;`
 )
 
 type CQLSession interface {
-	Query(string, ...interface{}) *gocql.Query
+	Query(string, ...interface{}) cql.Query
 }
 
 var Session CQLSession
 
 func NewRepository() DRepository {
-	return &repository{}
+	return &repository{clock: clock.System}
+}
+
+// Consistency sets the consistency level of each operation, a zero level keeps the session one
+type Consistency struct {
+	// Read is used by GetByID
+	Read gocql.Consistency
+	// Write is used by Create and UpdateExpirationTime
+	Write gocql.Consistency
+	// ReadFallback retries a GetByID miss before answering not found, as a token issued a moment ago may not
+	// have reached the replica read at a weaker level yet
+	ReadFallback gocql.Consistency
+}
+
+// NewRepositoryWithConsistency returns the Cassandra repository using the c consistency levels
+func NewRepositoryWithConsistency(c Consistency) DRepository {
+	return &repository{consistency: c, clock: clock.System}
 }
 
 type DRepository interface {
-	GetByID(string) (*accesstoken.AccessToken, errors.RestErr)
-	Create(*accesstoken.AccessToken) errors.RestErr
-	UpdateExpirationTime(*accesstoken.AccessToken) errors.RestErr
+	GetByID(context.Context, string) (*accesstoken.AccessToken, errors.RestErr)
+	Create(context.Context, *accesstoken.AccessToken) errors.RestErr
+	UpdateExpirationTime(context.Context, *accesstoken.AccessToken) errors.RestErr
+	// UpdateLastUsed stores the LastUsed time of the token only
+	UpdateLastUsed(context.Context, *accesstoken.AccessToken) errors.RestErr
+	// Delete deletes a single token
+	Delete(context.Context, string) errors.RestErr
+	// ListByUser returns the tokens of a user which are not expired
+	ListByUser(context.Context, int64) ([]accesstoken.AccessToken, errors.RestErr)
+	// DeleteByUser deletes every token of a user and returns how many were deleted
+	DeleteByUser(context.Context, int64) (int, errors.RestErr)
+	// DeleteByClient deletes every token issued to a client and returns how many were deleted
+	DeleteByClient(context.Context, int64) (int, errors.RestErr)
 }
 
 type repository struct {
+	consistency Consistency
+	clock       clock.Clock
 }
 
-func (r *repository) GetByID(id string) (*accesstoken.AccessToken, errors.RestErr) {
+func (r *repository) GetByID(ctx context.Context, id string) (*accesstoken.AccessToken, errors.RestErr) {
 
-	tk := new(accesstoken.AccessToken)
-	if err := Session.Query(queryGetAccessToken, id).Scan(&tk.AccessToken, &tk.ClientId, &tk.Expires, &tk.UserId); err != nil {
+	tk, err := r.getByID(ctx, id, "queryGetAccessToken", r.consistency.Read)
+	if err == gocql.ErrNotFound && r.consistency.ReadFallback != 0 && r.consistency.ReadFallback != r.consistency.Read {
+		tk, err = r.getByID(ctx, id, "queryGetAccessTokenFallback", r.consistency.ReadFallback)
+	}
+
+	if err != nil {
 		if err == gocql.ErrNotFound {
 			return nil, errors.NewNotFoundError("No access token found with given id")
 		}
-		return nil, errors.NewInternalServerError(fmt.Sprintf("error retrieving user with id %s", id), err)
+		return nil, errors.NewInternalServerError("error retrieving access token", err)
 	}
 
 	return tk, nil
 }
 
-func (r *repository) Create(at *accesstoken.AccessToken) errors.RestErr {
+func (r *repository) getByID(ctx context.Context, id, statement string, consistency gocql.Consistency) (*accesstoken.AccessToken, error) {
+
+	tk := new(accesstoken.AccessToken)
+	var act string
+	start := time.Now()
+	q := withConsistency(Session.Query(queryGetAccessToken, id), consistency)
+	err := q.WithContext(ctx).Scan(&tk.AccessToken, &tk.ClientId, &tk.Expires, &tk.UserId, &tk.Scope, &tk.MaxExpires,
+		&tk.Created, &tk.LastUsed, &tk.UserAgent, &tk.RemoteIp, &act)
+	ObserveQuery(ctx, statement, start, err)
+	if err != nil {
+		return nil, err
+	}
+
+	tk.Act, err = accesstoken.DecodeActor(act)
+	return tk, err
+}
+
+func (r *repository) Create(ctx context.Context, at *accesstoken.AccessToken) errors.RestErr {
+
+	statement, values := r.withLookups(queryCreateAccessToken, []interface{}{at.AccessToken, at.ClientId, at.Expires, at.UserId, at.Scope,
+		at.MaxExpires, at.Created, at.LastUsed, at.UserAgent, at.RemoteIp, accesstoken.EncodeActor(at.Act)}, at)
 
-	if err := Session.Query(queryCreateAccessToken, at.AccessToken, at.ClientId, at.Expires, at.UserId).Exec(); err != nil {
+	start := time.Now()
+	err := withConsistency(Session.Query(statement, values...), r.consistency.Write).WithContext(ctx).Exec()
+	ObserveQuery(ctx, "queryCreateAccessToken", start, err)
+
+	if err != nil {
 		return errors.NewInternalServerError(" error creating access token", err)
 	}
 
 	return nil
 }
 
-func (r *repository) UpdateExpirationTime(at *accesstoken.AccessToken) errors.RestErr {
+func (r *repository) UpdateExpirationTime(ctx context.Context, at *accesstoken.AccessToken) errors.RestErr {
+
+	// the lookup rows are rewritten whole so none of their columns outlives the others
+	stored, err := r.getByID(ctx, at.AccessToken, "queryGetAccessTokenForUpdate", r.consistency.Write)
+	if err != nil {
+		if err == gocql.ErrNotFound {
+			return errors.NewNotFoundError("No access token found with given id")
+		}
+		return errors.NewInternalServerError("error updating access token", err)
+	}
+	stored.Expires = at.Expires
+
+	statement, values := r.withLookups(queryUpdateExpires, []interface{}{stored.Expires, stored.AccessToken}, stored)
+
+	start := time.Now()
+	err = withConsistency(Session.Query(statement, values...), r.consistency.Write).WithContext(ctx).Exec()
+	ObserveQuery(ctx, "queryUpdateExpires", start, err)
+
+	if err != nil {
+		return errors.NewInternalServerError("error updating access token", err)
+	}
+
+	return nil
+}
+
+func (r *repository) UpdateLastUsed(ctx context.Context, at *accesstoken.AccessToken) errors.RestErr {
 
-	if err := Session.Query(queryUpdateExpires, at.Expires, at.AccessToken).Exec(); err != nil {
+	start := time.Now()
+	err := withConsistency(Session.Query(queryUpdateLastUsed, at.LastUsed, at.AccessToken), r.consistency.Write).WithContext(ctx).Exec()
+	ObserveQuery(ctx, "queryUpdateLastUsed", start, err)
+
+	if err != nil {
 		return errors.NewInternalServerError("error updating access token", err)
 	}
 
 	return nil
 }
+
+func (r *repository) Delete(ctx context.Context, id string) errors.RestErr {
+
+	// the owner is needed to delete the lookup rows
+	stored, err := r.getByID(ctx, id, "queryGetAccessTokenForDelete", r.consistency.Write)
+	if err != nil {
+		if err == gocql.ErrNotFound {
+			return errors.NewNotFoundError("No access token found with given id")
+		}
+		return errors.NewInternalServerError("error deleting access token", err)
+	}
+
+	_, restErr := r.delete(ctx, []accesstoken.AccessToken{*stored})
+	return restErr
+}
+
+// ListByUser finds the tokens in the user lookup table and reads each from access_tokens, which holds the
+// session metadata
+func (r *repository) ListByUser(ctx context.Context, userId int64) ([]accesstoken.AccessToken, errors.RestErr) {
+
+	owned, err := r.userTokens(ctx, userId)
+	if err != nil {
+		return nil, errors.NewInternalServerError("error retrieving access tokens", err)
+	}
+
+	var tokens []accesstoken.AccessToken
+	for _, lookup := range owned {
+		// the lookup rows can outlive the token by less than a second
+		if lookup.IsExpired(r.clock) {
+			continue
+		}
+
+		tk, err := r.getByID(ctx, lookup.AccessToken, "queryGetAccessToken", r.consistency.Read)
+		if err == gocql.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, errors.NewInternalServerError("error retrieving access tokens", err)
+		}
+		if tk.UserId == userId && !tk.IsExpired(r.clock) {
+			tokens = append(tokens, *tk)
+		}
+	}
+	return tokens, nil
+}
+
+func (r *repository) DeleteByUser(ctx context.Context, userId int64) (int, errors.RestErr) {
+
+	tokens, err := r.userTokens(ctx, userId)
+	if err != nil {
+		return 0, errors.NewInternalServerError("error deleting access tokens", err)
+	}
+	return r.delete(ctx, tokens)
+}
+
+func (r *repository) DeleteByClient(ctx context.Context, clientId int64) (int, errors.RestErr) {
+
+	start := time.Now()
+	iter := withConsistency(Session.Query(queryGetClientTokens, clientId), r.consistency.Read).WithContext(ctx).Iter()
+	var tokens []accesstoken.AccessToken
+	at := accesstoken.AccessToken{ClientId: clientId}
+	for iter.Scan(&at.AccessToken, &at.UserId, &at.Expires) {
+		tokens = append(tokens, at)
+	}
+	err := iter.Close()
+	ObserveQuery(ctx, "queryGetClientTokens", start, err)
+
+	if err != nil {
+		return 0, errors.NewInternalServerError("error deleting access tokens", err)
+	}
+	return r.delete(ctx, tokens)
+}
+
+func (r *repository) userTokens(ctx context.Context, userId int64) ([]accesstoken.AccessToken, error) {
+
+	start := time.Now()
+	iter := withConsistency(Session.Query(queryGetUserTokens, userId), r.consistency.Read).WithContext(ctx).Iter()
+	var tokens []accesstoken.AccessToken
+	at := accesstoken.AccessToken{UserId: userId}
+	for iter.Scan(&at.AccessToken, &at.ClientId, &at.Expires, &at.Scope) {
+		tokens = append(tokens, at)
+	}
+	err := iter.Close()
+	ObserveQuery(ctx, "queryGetUserTokens", start, err)
+
+	return tokens, err
+}
+
+// delete removes each token with its lookup rows in one batch per token, a token created meanwhile for the
+// same owner is kept
+func (r *repository) delete(ctx context.Context, tokens []accesstoken.AccessToken) (int, errors.RestErr) {
+
+	for i, at := range tokens {
+		statements := []string{queryDeleteAccessToken, queryDeleteUserToken}
+		values := []interface{}{at.AccessToken, at.UserId, at.AccessToken}
+		if at.ClientId != 0 {
+			statements = append(statements, queryDeleteClientToken)
+			values = append(values, at.ClientId, at.AccessToken)
+		}
+
+		start := time.Now()
+		err := withConsistency(Session.Query(batch(statements...), values...), r.consistency.Write).WithContext(ctx).Exec()
+		ObserveQuery(ctx, "queryDeleteAccessToken", start, err)
+
+		if err != nil {
+			logger.FromContext(ctx).Error("access tokens partially deleted", zap.Int("deleted", i), zap.Int("total", len(tokens)))
+			return i, errors.NewInternalServerError("error deleting access tokens", err)
+		}
+	}
+
+	return len(tokens), nil
+}
+
+// withLookups batches statement with the upserts of the lookup rows of at, which expire with it. Tokens
+// without client have no client lookup row
+func (r *repository) withLookups(statement string, values []interface{}, at *accesstoken.AccessToken) (string, []interface{}) {
+	statements, lookupValues := r.lookups(at)
+	return batch(append([]string{statement}, statements...)...), append(values, lookupValues...)
+}
+
+// lookups returns the upserts of the lookup rows of at with their values
+func (r *repository) lookups(at *accesstoken.AccessToken) ([]string, []interface{}) {
+
+	// a zero TTL would never expire the rows
+	ttl := int(at.Expires - r.clock.Now().Unix())
+	if ttl < 1 {
+		ttl = 1
+	}
+
+	statements := []string{queryInsertUserToken}
+	values := []interface{}{at.UserId, at.AccessToken, at.ClientId, at.Expires, at.Scope, ttl}
+	if at.ClientId != 0 {
+		statements = append(statements, queryInsertClientToken)
+		values = append(values, at.ClientId, at.AccessToken, at.UserId, at.Expires, ttl)
+	}
+	return statements, values
+}
+
+// BackfillLookups writes the lookup rows of the live tokens of access_tokens, which the tokens issued before
+// migration 5 lack, and returns how many tokens were written. It reads the whole table and upserts the rows, so it
+// can be run again after a failure
+func BackfillLookups(ctx context.Context) (int, error) {
+	return (&repository{clock: clock.System}).backfillLookups(ctx)
+}
+
+func (r *repository) backfillLookups(ctx context.Context) (int, error) {
+
+	iter := Session.Query(queryGetAccessTokens).WithContext(ctx).Iter()
+
+	written := 0
+	var at accesstoken.AccessToken
+	for iter.Scan(&at.AccessToken, &at.ClientId, &at.Expires, &at.UserId, &at.Scope) {
+		// rows without user are left by an update racing a delete
+		if at.UserId == 0 || at.IsExpired(r.clock) {
+			continue
+		}
+
+		statements, values := r.lookups(&at)
+		start := time.Now()
+		err := Session.Query(batch(statements...), values...).WithContext(ctx).Exec()
+		ObserveQuery(ctx, "queryBackfillLookups", start, err)
+		if err != nil {
+			_ = iter.Close()
+			return written, err
+		}
+		written++
+	}
+
+	return written, iter.Close()
+}
+
+// batch returns the logged batch of statements, applied atomically across partitions
+func batch(statements ...string) string {
+	return "BEGIN BATCH\n" + strings.Join(statements, "\n") + "\nAPPLY BATCH;"
+}
+
+func withConsistency(q cql.Query, consistency gocql.Consistency) cql.Query {
+	if consistency == 0 {
+		return q
+	}
+	return q.Consistency(consistency)
+}
+
+// ObserveQuery records the statement latency and logs failed statements, a not found result is not a failure
+func ObserveQuery(ctx context.Context, statement string, start time.Time, err error) {
+	if err == gocql.ErrNotFound {
+		err = nil
+	}
+	metrics.ObserveQuery(statement, start, err)
+
+	if err != nil {
+		logger.FromContext(ctx).Error("cassandra query failed",
+			zap.String("statement", statement), zap.Duration("latency", time.Since(start)), zap.Error(err))
+	}
+}
@@ -1,21 +1,371 @@
 package db
 
 import (
+	"context"
+	errors2 "errors"
+	"github.com/danielgom/bookstore_oauthapi/src/clock/clocktest"
+	"github.com/danielgom/bookstore_oauthapi/src/datasource/cql/cqltest"
+	"github.com/danielgom/bookstore_oauthapi/src/domain/accesstoken"
 	"github.com/gocql/gocql"
 	"testing"
+	"time"
 )
 
-// MAYBE A TODO MOCKING QUERIES
-type MockQuery func(stmt string, values ...interface{}) *gocql.Query
+func withFakeSession(t *testing.T) *cqltest.Session {
+	session := cqltest.NewSession()
+	previous := Session
+	Session = session
+	t.Cleanup(func() { Session = previous })
+	return session
+}
+
+func TestRepositoryGetByID(t *testing.T) {
+
+	t.Run("Should return the access token", func(t *testing.T) {
+		session := withFakeSession(t)
+		session.On(queryGetAccessToken).Row("abc123", int64(2), int64(365), int64(1), "read", int64(0), int64(300), int64(0), "curl/7.79", "127.0.0.1",
+			`{"clientId":3}`)
+
+		at, err := NewRepository().GetByID(context.Background(), "abc123")
+		if err != nil {
+			t.Fatal("error should be nil")
+		}
+		if at.AccessToken != "abc123" || at.ClientId != 2 || at.Expires != 365 || at.UserId != 1 || at.Scope != "read" ||
+			at.Created != 300 || at.UserAgent != "curl/7.79" || at.RemoteIp != "127.0.0.1" || at.Act == nil || at.Act.ClientId != 3 {
+			t.Errorf("Unexpected access token %+v", at)
+		}
+
+		executed := session.Executed()
+		if len(executed) != 1 || executed[0].Values[0] != "abc123" {
+			t.Errorf("Unexpected queries %+v", executed)
+		}
+	})
+
+	t.Run("Should return not found", func(t *testing.T) {
+		session := withFakeSession(t)
+		session.On(queryGetAccessToken)
+
+		_, err := NewRepository().GetByID(context.Background(), "abc123")
+		if err == nil || err.Status() != 404 {
+			t.Fatalf("Status returned should be 404, received %v", err)
+		}
+	})
+
+	t.Run("Should map query errors", func(t *testing.T) {
+		session := withFakeSession(t)
+		session.On(queryGetAccessToken).Error(errors2.New("timeout"))
 
-type MockSession struct {
-	MockQuery MockQuery
+		_, err := NewRepository().GetByID(context.Background(), "abc123")
+		if err == nil || err.Status() != 500 || err.Message() != "error retrieving access token" {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	})
+
+	t.Run("Should retry a miss at the fallback consistency", func(t *testing.T) {
+		session := withFakeSession(t)
+		session.On(queryGetAccessToken)
+		session.On(queryGetAccessToken).Row("abc123", int64(2), int64(365), int64(1), "", int64(0), int64(0), int64(0), "", "", "")
+
+		repository := NewRepositoryWithConsistency(Consistency{Read: gocql.LocalOne, ReadFallback: gocql.LocalQuorum})
+		at, err := repository.GetByID(context.Background(), "abc123")
+		if err != nil || at.UserId != 1 {
+			t.Fatalf("Unexpected result %+v, %v", at, err)
+		}
+
+		executed := session.Executed()
+		if len(executed) != 2 || executed[0].Consistency != gocql.LocalOne || executed[1].Consistency != gocql.LocalQuorum {
+			t.Errorf("Unexpected queries %+v", executed)
+		}
+	})
+
+	t.Run("Should not retry errors other than not found", func(t *testing.T) {
+		session := withFakeSession(t)
+		session.On(queryGetAccessToken).Error(errors2.New("timeout"))
+
+		repository := NewRepositoryWithConsistency(Consistency{Read: gocql.LocalOne, ReadFallback: gocql.LocalQuorum})
+		if _, err := repository.GetByID(context.Background(), "abc123"); err == nil || err.Status() != 500 {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if executed := session.Executed(); len(executed) != 1 {
+			t.Errorf("Expected 1 query, received %d", len(executed))
+		}
+	})
 }
 
-func (m *MockSession) Query(stmt string, values ...interface{}) *gocql.Query {
-	return m.MockQuery(stmt, values)
+func TestRepositoryCreate(t *testing.T) {
+
+	expires := time.Now().Add(time.Hour).Unix()
+	at := &accesstoken.AccessToken{AccessToken: "abc123", UserId: 1, ClientId: 2, Expires: expires, Scope: "read", MaxExpires: expires + 60,
+		Created: 300, UserAgent: "curl/7.79", RemoteIp: "127.0.0.1", Act: &accesstoken.Actor{ClientId: 3}}
+
+	t.Run("Should insert the access token with its lookup rows", func(t *testing.T) {
+		session := withFakeSession(t)
+		session.On(batch(queryCreateAccessToken, queryInsertUserToken, queryInsertClientToken))
+
+		cassandra := NewRepositoryWithConsistency(Consistency{Write: gocql.LocalQuorum}).(*repository)
+		cassandra.clock = clocktest.NewClock(time.Unix(expires-3600, 0))
+		if err := cassandra.Create(context.Background(), at); err != nil {
+			t.Fatal("error should be nil")
+		}
+
+		executed := session.Executed()
+		if len(executed) != 1 || executed[0].Consistency != gocql.LocalQuorum {
+			t.Fatalf("Unexpected queries %+v", executed)
+		}
+		values := executed[0].Values
+		if values[0] != "abc123" || values[1] != int64(2) || values[2] != expires || values[3] != int64(1) || values[4] != "read" ||
+			values[5] != expires+60 || values[6] != int64(300) || values[8] != "curl/7.79" || values[9] != "127.0.0.1" ||
+			values[10] != `{"clientId":3}` {
+			t.Errorf("Unexpected values %v", values)
+		}
+		if values[16] != 3600 || values[11] != int64(1) || values[17] != int64(2) {
+			t.Errorf("Unexpected lookup values %v", values[11:])
+		}
+	})
+
+	t.Run("Should not write a client lookup row for tokens without client", func(t *testing.T) {
+		session := withFakeSession(t)
+		session.On(batch(queryCreateAccessToken, queryInsertUserToken))
+
+		if err := NewRepository().Create(context.Background(), &accesstoken.AccessToken{AccessToken: "abc123", UserId: 1, Expires: expires}); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	})
+
+	t.Run("Should expire the lookup rows of expired tokens at once", func(t *testing.T) {
+		session := withFakeSession(t)
+		session.On(batch(queryCreateAccessToken, queryInsertUserToken))
+
+		_ = NewRepository().Create(context.Background(), &accesstoken.AccessToken{AccessToken: "abc123", UserId: 1, Expires: 365})
+
+		if executed := session.Executed(); executed[0].Values[16] != 1 {
+			t.Errorf("Expected a TTL of 1, received %v", executed[0].Values[16])
+		}
+	})
+
+	t.Run("Should map query errors", func(t *testing.T) {
+		session := withFakeSession(t)
+		session.On(batch(queryCreateAccessToken, queryInsertUserToken, queryInsertClientToken)).Error(errors2.New("timeout"))
+
+		if err := NewRepository().Create(context.Background(), at); err == nil || err.Status() != 500 {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	})
 }
 
-func TestRepositoryGetByID(t *testing.T) {
+func TestRepositoryUpdateExpirationTime(t *testing.T) {
+
+	expires := time.Now().Add(2 * time.Hour).Unix()
+	at := &accesstoken.AccessToken{AccessToken: "abc123", Expires: expires}
+
+	t.Run("Should update the expiration and rewrite the lookup rows", func(t *testing.T) {
+		session := withFakeSession(t)
+		session.On(queryGetAccessToken).Row("abc123", int64(2), int64(365), int64(1), "read", int64(0), int64(300), int64(0), "curl/7.79", "127.0.0.1", "")
+		session.On(batch(queryUpdateExpires, queryInsertUserToken, queryInsertClientToken))
+
+		if err := NewRepository().UpdateExpirationTime(context.Background(), at); err != nil {
+			t.Fatal("error should be nil")
+		}
+
+		executed := session.Executed()
+		if len(executed) != 2 {
+			t.Fatalf("Unexpected queries %+v", executed)
+		}
+		values := executed[1].Values
+		if values[0] != expires || values[1] != "abc123" || values[2] != int64(1) || values[5] != expires || values[6] != "read" {
+			t.Errorf("Unexpected values %v", values)
+		}
+	})
+
+	t.Run("Should return not found for unknown ids", func(t *testing.T) {
+		session := withFakeSession(t)
+		session.On(queryGetAccessToken)
+
+		if err := NewRepository().UpdateExpirationTime(context.Background(), at); err == nil || err.Status() != 404 {
+			t.Fatalf("Status returned should be 404, received %v", err)
+		}
+	})
+
+	t.Run("Should map query errors", func(t *testing.T) {
+		session := withFakeSession(t)
+		session.On(queryGetAccessToken).Row("abc123", int64(0), int64(365), int64(1), "", int64(0), int64(0), int64(0), "", "", "")
+		session.On(batch(queryUpdateExpires, queryInsertUserToken)).Error(errors2.New("timeout"))
+
+		if err := NewRepository().UpdateExpirationTime(context.Background(), at); err == nil || err.Status() != 500 {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	})
+
+	t.Run("Should honour the context", func(t *testing.T) {
+		session := withFakeSession(t)
+		session.On(queryGetAccessToken).Row("abc123", int64(0), int64(365), int64(1), "", int64(0), int64(0), int64(0), "", "", "")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		if err := NewRepository().UpdateExpirationTime(ctx, at); err == nil {
+			t.Fatal("error should not be nil")
+		}
+	})
+}
+
+func TestRepositoryListByUser(t *testing.T) {
+
+	expires := time.Now().Add(time.Hour).Unix()
+	session := withFakeSession(t)
+	session.On(queryGetUserTokens).
+		Row("abc123", int64(2), expires, "read").
+		Row("expired", int64(2), time.Now().Add(-time.Second).Unix(), "").
+		Row("deleted", int64(2), expires, "").
+		Row("replaced", int64(2), expires, "")
+	session.On(queryGetAccessToken).Row("abc123", int64(2), expires, int64(1), "read", int64(0), int64(300), int64(360), "curl/7.79", "127.0.0.1", "")
+	session.On(queryGetAccessToken)
+	session.On(queryGetAccessToken).Row("replaced", int64(2), expires, int64(5), "", int64(0), int64(0), int64(0), "", "", "")
+
+	tokens, err := NewRepository().ListByUser(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(tokens) != 1 || tokens[0].AccessToken != "abc123" || tokens[0].UserId != 1 || tokens[0].ClientId != 2 || tokens[0].Scope != "read" ||
+		tokens[0].LastUsed != 360 || tokens[0].UserAgent != "curl/7.79" {
+		t.Errorf("Unexpected tokens %+v", tokens)
+	}
+	if executed := session.Executed(); len(executed) != 4 {
+		t.Errorf("Expected 4 queries, received %d", len(executed))
+	}
+}
+
+func TestBackfillLookups(t *testing.T) {
+
+	const now = 1600000000
+	t.Run("Should write the lookup rows of the live tokens", func(t *testing.T) {
+		session := withFakeSession(t)
+		session.On(queryGetAccessTokens).
+			Row("abc123", int64(2), int64(now+3600), int64(1), "read").
+			Row("noclient", int64(0), int64(now+60), int64(1), "").
+			Row("expired", int64(2), int64(now-1), int64(1), "").
+			Row("orphan", int64(0), int64(0), int64(0), "")
+		session.On(batch(queryInsertUserToken, queryInsertClientToken))
+		session.On(batch(queryInsertUserToken))
+
+		cassandra := &repository{clock: clocktest.NewClock(time.Unix(now, 0))}
+		written, err := cassandra.backfillLookups(context.Background())
+		if err != nil || written != 2 {
+			t.Fatalf("Unexpected result %d, %v", written, err)
+		}
+
+		executed := session.Executed()
+		if len(executed) != 3 {
+			t.Fatalf("Expected 3 queries, received %d", len(executed))
+		}
+		if values := executed[1].Values; values[0] != int64(1) || values[1] != "abc123" || values[4] != "read" || values[5] != 3600 ||
+			values[6] != int64(2) || values[10] != 3600 {
+			t.Errorf("Unexpected lookup values %v", values)
+		}
+		if values := executed[2].Values; len(values) != 6 || values[1] != "noclient" || values[5] != 60 {
+			t.Errorf("Unexpected lookup values %v", values)
+		}
+	})
+
+	t.Run("Should stop at the first failed write", func(t *testing.T) {
+		session := withFakeSession(t)
+		session.On(queryGetAccessTokens).
+			Row("abc123", int64(2), int64(now+3600), int64(1), "read").
+			Row("def456", int64(2), int64(now+3600), int64(1), "read")
+		session.On(batch(queryInsertUserToken, queryInsertClientToken)).Error(errors2.New("timeout"))
+
+		cassandra := &repository{clock: clocktest.NewClock(time.Unix(now, 0))}
+		if written, err := cassandra.backfillLookups(context.Background()); err == nil || written != 0 {
+			t.Fatalf("Unexpected result %d, %v", written, err)
+		}
+		if executed := session.Executed(); len(executed) != 2 {
+			t.Errorf("Expected 2 queries, received %d", len(executed))
+		}
+	})
+}
+
+func TestRepositoryUpdateLastUsed(t *testing.T) {
+
+	session := withFakeSession(t)
+	session.On(queryUpdateLastUsed)
+
+	if err := NewRepository().UpdateLastUsed(context.Background(), &accesstoken.AccessToken{AccessToken: "abc123", LastUsed: 360}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if values := session.Executed()[0].Values; values[0] != int64(360) || values[1] != "abc123" {
+		t.Errorf("Unexpected values %v", values)
+	}
+}
+
+func TestRepositoryDelete(t *testing.T) {
+
+	t.Run("Should delete the token with its lookup rows", func(t *testing.T) {
+		session := withFakeSession(t)
+		session.On(queryGetAccessToken).Row("abc123", int64(2), int64(365), int64(1), "", int64(0), int64(0), int64(0), "", "", "")
+		session.On(batch(queryDeleteAccessToken, queryDeleteUserToken, queryDeleteClientToken))
+
+		if err := NewRepository().Delete(context.Background(), "abc123"); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if values := session.Executed()[1].Values; values[0] != "abc123" || values[1] != int64(1) || values[3] != int64(2) {
+			t.Errorf("Unexpected values %v", values)
+		}
+	})
+
+	t.Run("Should return not found for unknown ids", func(t *testing.T) {
+		session := withFakeSession(t)
+		session.On(queryGetAccessToken)
+
+		if err := NewRepository().Delete(context.Background(), "abc123"); err == nil || err.Status() != 404 {
+			t.Fatalf("Status returned should be 404, received %v", err)
+		}
+	})
+}
+
+func TestRepositoryDeleteByOwner(t *testing.T) {
+
+	t.Run("Should delete the tokens of the user with their lookup rows", func(t *testing.T) {
+		session := withFakeSession(t)
+		session.On(queryGetUserTokens).Row("abc123", int64(2), int64(365), "").Row("def456", int64(0), int64(365), "")
+		session.On(batch(queryDeleteAccessToken, queryDeleteUserToken, queryDeleteClientToken))
+		session.On(batch(queryDeleteAccessToken, queryDeleteUserToken))
+
+		deleted, err := NewRepository().DeleteByUser(context.Background(), 1)
+		if err != nil || deleted != 2 {
+			t.Fatalf("Unexpected result %d, %v", deleted, err)
+		}
+
+		executed := session.Executed()
+		if len(executed) != 3 {
+			t.Fatalf("Unexpected queries %+v", executed)
+		}
+		if values := executed[1].Values; values[0] != "abc123" || values[1] != int64(1) || values[3] != int64(2) {
+			t.Errorf("Unexpected values %v", values)
+		}
+	})
+
+	t.Run("Should delete the tokens of the client", func(t *testing.T) {
+		session := withFakeSession(t)
+		session.On(queryGetClientTokens).Row("abc123", int64(1), int64(365))
+		session.On(batch(queryDeleteAccessToken, queryDeleteUserToken, queryDeleteClientToken))
+
+		deleted, err := NewRepository().DeleteByClient(context.Background(), 2)
+		if err != nil || deleted != 1 {
+			t.Fatalf("Unexpected result %d, %v", deleted, err)
+		}
+
+		if values := session.Executed()[1].Values; values[0] != "abc123" || values[1] != int64(1) || values[3] != int64(2) {
+			t.Errorf("Unexpected values %v", values)
+		}
+	})
+
+	t.Run("Should map query errors", func(t *testing.T) {
+		session := withFakeSession(t)
+		session.On(queryGetUserTokens).Row("abc123", int64(0), int64(365), "")
+		session.On(batch(queryDeleteAccessToken, queryDeleteUserToken)).Error(errors2.New("timeout"))
 
+		if _, err := NewRepository().DeleteByUser(context.Background(), 1); err == nil || err.Status() != 500 {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	})
 }
@@ -0,0 +1,255 @@
+package dbtest
+
+import (
+	"context"
+	"fmt"
+	"github.com/danielgom/bookstore_oauthapi/src/domain/accesstoken"
+	"github.com/danielgom/bookstore_oauthapi/src/repository/db"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// RunConformance checks the behaviour every db.DRepository backend must share. newRepository returns an
+// empty repository for each test
+func RunConformance(t *testing.T, newRepository func(t *testing.T) db.DRepository) {
+
+	ctx := context.Background()
+	expires := time.Now().Add(time.Hour).Unix()
+
+	t.Run("Should return not found for unknown ids", func(t *testing.T) {
+		_, err := newRepository(t).GetByID(ctx, "unknown")
+		if err == nil || err.Status() != http.StatusNotFound {
+			t.Fatalf("Status returned should be 404, received %v", err)
+		}
+	})
+
+	t.Run("Should return the created token", func(t *testing.T) {
+		repository := newRepository(t)
+		created := &accesstoken.AccessToken{AccessToken: "abc123", UserId: 1, ClientId: 2, Expires: expires, Scope: "read write",
+			MaxExpires: expires + 60, Created: 300, LastUsed: 360, UserAgent: "curl/7.79", RemoteIp: "127.0.0.1"}
+
+		if err := repository.Create(ctx, created); err != nil {
+			t.Fatalf("error should be nil, received %v", err)
+		}
+
+		at, err := repository.GetByID(ctx, "abc123")
+		if err != nil {
+			t.Fatalf("error should be nil, received %v", err)
+		}
+		if *at != *created {
+			t.Errorf("Expected: %+v, Received: %+v", created, at)
+		}
+	})
+
+	t.Run("Should return the actor of an exchanged token", func(t *testing.T) {
+		repository := newRepository(t)
+		created := &accesstoken.AccessToken{AccessToken: "abc123", UserId: 1, ClientId: 5, Expires: expires,
+			Act: &accesstoken.Actor{ClientId: 5, Act: &accesstoken.Actor{ClientId: 2}}}
+
+		if err := repository.Create(ctx, created); err != nil {
+			t.Fatalf("error should be nil, received %v", err)
+		}
+
+		at, err := repository.GetByID(ctx, "abc123")
+		if err != nil {
+			t.Fatalf("error should be nil, received %v", err)
+		}
+		if at.Act == nil || at.Act.ClientId != 5 || at.Act.Act == nil || at.Act.Act.ClientId != 2 || at.Act.Act.Act != nil {
+			t.Errorf("Unexpected actor %+v", at.Act)
+		}
+	})
+
+	t.Run("Should replace a token created twice", func(t *testing.T) {
+		repository := newRepository(t)
+		_ = repository.Create(ctx, &accesstoken.AccessToken{AccessToken: "abc123", UserId: 1, ClientId: 2, Expires: expires})
+		_ = repository.Create(ctx, &accesstoken.AccessToken{AccessToken: "abc123", UserId: 3, ClientId: 2, Expires: expires})
+
+		if at, err := repository.GetByID(ctx, "abc123"); err != nil || at.UserId != 3 {
+			t.Errorf("Unexpected token %+v, %v", at, err)
+		}
+	})
+
+	t.Run("Should not share returned tokens", func(t *testing.T) {
+		repository := newRepository(t)
+		created := &accesstoken.AccessToken{AccessToken: "abc123", UserId: 1, ClientId: 2, Expires: expires}
+		_ = repository.Create(ctx, created)
+		created.UserId = 5
+
+		at, _ := repository.GetByID(ctx, "abc123")
+		at.Scope = "admin"
+
+		if at, _ = repository.GetByID(ctx, "abc123"); at.UserId != 1 || at.Scope != "" {
+			t.Errorf("Stored token should not change, received %+v", at)
+		}
+	})
+
+	t.Run("Should update the expiration time only", func(t *testing.T) {
+		repository := newRepository(t)
+		_ = repository.Create(ctx, &accesstoken.AccessToken{AccessToken: "abc123", UserId: 1, ClientId: 2, Expires: expires, Scope: "read",
+			MaxExpires: expires + 120})
+
+		err := repository.UpdateExpirationTime(ctx, &accesstoken.AccessToken{AccessToken: "abc123", UserId: 9, ClientId: 9, Expires: expires + 60})
+		if err != nil {
+			t.Fatalf("error should be nil, received %v", err)
+		}
+
+		at, err := repository.GetByID(ctx, "abc123")
+		if err != nil || at.Expires != expires+60 || at.UserId != 1 || at.Scope != "read" || at.MaxExpires != expires+120 {
+			t.Errorf("Unexpected token %+v, %v", at, err)
+		}
+	})
+
+	t.Run("Should return not found updating unknown ids", func(t *testing.T) {
+		err := newRepository(t).UpdateExpirationTime(ctx, &accesstoken.AccessToken{AccessToken: "unknown", UserId: 1, ClientId: 2, Expires: expires})
+		if err == nil || err.Status() != http.StatusNotFound {
+			t.Errorf("Status returned should be 404, received %v", err)
+		}
+	})
+
+	t.Run("Should update the last use time only", func(t *testing.T) {
+		repository := newRepository(t)
+		_ = repository.Create(ctx, &accesstoken.AccessToken{AccessToken: "abc123", UserId: 1, ClientId: 2, Expires: expires, Created: 300, UserAgent: "curl/7.79"})
+
+		err := repository.UpdateLastUsed(ctx, &accesstoken.AccessToken{AccessToken: "abc123", UserId: 9, Expires: expires + 60, LastUsed: 360})
+		if err != nil {
+			t.Fatalf("error should be nil, received %v", err)
+		}
+
+		at, err := repository.GetByID(ctx, "abc123")
+		if err != nil || at.LastUsed != 360 || at.Created != 300 || at.UserAgent != "curl/7.79" || at.UserId != 1 || at.Expires != expires {
+			t.Errorf("Unexpected token %+v, %v", at, err)
+		}
+	})
+
+	t.Run("Should delete a single token", func(t *testing.T) {
+		repository := newRepository(t)
+		_ = repository.Create(ctx, &accesstoken.AccessToken{AccessToken: "abc123", UserId: 1, ClientId: 2, Expires: expires})
+		_ = repository.Create(ctx, &accesstoken.AccessToken{AccessToken: "def456", UserId: 1, ClientId: 2, Expires: expires})
+
+		if err := repository.Delete(ctx, "abc123"); err != nil {
+			t.Fatalf("error should be nil, received %v", err)
+		}
+
+		if _, err := repository.GetByID(ctx, "abc123"); err == nil || err.Status() != http.StatusNotFound {
+			t.Errorf("Token abc123 should be deleted, received %v", err)
+		}
+		if tokens, err := repository.ListByUser(ctx, 1); err != nil || len(tokens) != 1 || tokens[0].AccessToken != "def456" {
+			t.Errorf("Only def456 should be listed, received %+v, %v", tokens, err)
+		}
+	})
+
+	t.Run("Should return not found deleting unknown ids", func(t *testing.T) {
+		if err := newRepository(t).Delete(ctx, "unknown"); err == nil || err.Status() != http.StatusNotFound {
+			t.Errorf("Status returned should be 404, received %v", err)
+		}
+	})
+
+	t.Run("Should be safe for concurrent use", func(t *testing.T) {
+		repository := newRepository(t)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for j := 0; j < 50; j++ {
+					id := fmt.Sprintf("token-%d-%d", i, j)
+					_ = repository.Create(ctx, &accesstoken.AccessToken{AccessToken: id, UserId: int64(i + 1), ClientId: 1, Expires: expires})
+					_, _ = repository.GetByID(ctx, id)
+					_ = repository.UpdateExpirationTime(ctx, &accesstoken.AccessToken{AccessToken: id, Expires: expires + 1})
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		if at, err := repository.GetByID(ctx, "token-7-49"); err != nil || at.UserId != 8 || at.Expires != expires+1 {
+			t.Errorf("Unexpected token %+v, %v", at, err)
+		}
+	})
+
+	t.Run("Should list the live tokens of a user", func(t *testing.T) {
+		repository := newRepository(t)
+		_ = repository.Create(ctx, &accesstoken.AccessToken{AccessToken: "abc123", UserId: 1, ClientId: 2, Expires: expires, Scope: "read"})
+		_ = repository.Create(ctx, &accesstoken.AccessToken{AccessToken: "def456", UserId: 1, Expires: expires})
+		_ = repository.Create(ctx, &accesstoken.AccessToken{AccessToken: "expired", UserId: 1, ClientId: 2, Expires: time.Now().Add(-time.Hour).Unix()})
+		_ = repository.Create(ctx, &accesstoken.AccessToken{AccessToken: "other", UserId: 3, ClientId: 2, Expires: expires})
+
+		tokens, err := repository.ListByUser(ctx, 1)
+		if err != nil {
+			t.Fatalf("error should be nil, received %v", err)
+		}
+
+		byId := make(map[string]accesstoken.AccessToken)
+		for _, at := range tokens {
+			byId[at.AccessToken] = at
+		}
+		if len(tokens) != 2 || byId["abc123"].Scope != "read" || byId["abc123"].ClientId != 2 || byId["def456"].UserId != 1 {
+			t.Errorf("Unexpected tokens %+v", tokens)
+		}
+
+		if tokens, err = repository.ListByUser(ctx, 9); err != nil || len(tokens) != 0 {
+			t.Errorf("Unexpected tokens %+v, %v", tokens, err)
+		}
+	})
+
+	t.Run("Should list a replaced token under its new user only", func(t *testing.T) {
+		repository := newRepository(t)
+		_ = repository.Create(ctx, &accesstoken.AccessToken{AccessToken: "abc123", UserId: 1, Expires: expires})
+		_ = repository.Create(ctx, &accesstoken.AccessToken{AccessToken: "abc123", UserId: 3, Expires: expires})
+
+		if tokens, err := repository.ListByUser(ctx, 1); err != nil || len(tokens) != 0 {
+			t.Errorf("Unexpected tokens %+v, %v", tokens, err)
+		}
+		if tokens, err := repository.ListByUser(ctx, 3); err != nil || len(tokens) != 1 {
+			t.Errorf("Unexpected tokens %+v, %v", tokens, err)
+		}
+	})
+
+	t.Run("Should delete the tokens of a user only", func(t *testing.T) {
+		repository := newRepository(t)
+		_ = repository.Create(ctx, &accesstoken.AccessToken{AccessToken: "abc123", UserId: 1, ClientId: 2, Expires: expires})
+		_ = repository.Create(ctx, &accesstoken.AccessToken{AccessToken: "def456", UserId: 1, Expires: expires})
+		_ = repository.Create(ctx, &accesstoken.AccessToken{AccessToken: "other", UserId: 3, ClientId: 2, Expires: expires})
+
+		if deleted, err := repository.DeleteByUser(ctx, 1); err != nil || deleted != 2 {
+			t.Fatalf("Expected 2 deleted tokens, received %d, %v", deleted, err)
+		}
+
+		for _, id := range []string{"abc123", "def456"} {
+			if _, err := repository.GetByID(ctx, id); err == nil || err.Status() != http.StatusNotFound {
+				t.Errorf("Token %s should be deleted, received %v", id, err)
+			}
+		}
+		if _, err := repository.GetByID(ctx, "other"); err != nil {
+			t.Errorf("Token of another user should be kept, received %v", err)
+		}
+		if tokens, err := repository.ListByUser(ctx, 1); err != nil || len(tokens) != 0 {
+			t.Errorf("Unexpected tokens %+v, %v", tokens, err)
+		}
+
+		if deleted, err := repository.DeleteByUser(ctx, 1); err != nil || deleted != 0 {
+			t.Errorf("Expected no deleted tokens, received %d, %v", deleted, err)
+		}
+	})
+
+	t.Run("Should delete the tokens of a client only", func(t *testing.T) {
+		repository := newRepository(t)
+		_ = repository.Create(ctx, &accesstoken.AccessToken{AccessToken: "abc123", UserId: 1, ClientId: 2, Expires: expires})
+		_ = repository.Create(ctx, &accesstoken.AccessToken{AccessToken: "def456", UserId: 3, ClientId: 2, Expires: expires})
+		_ = repository.Create(ctx, &accesstoken.AccessToken{AccessToken: "other", UserId: 1, ClientId: 4, Expires: expires})
+		_ = repository.Create(ctx, &accesstoken.AccessToken{AccessToken: "noclient", UserId: 1, Expires: expires})
+
+		if deleted, err := repository.DeleteByClient(ctx, 2); err != nil || deleted != 2 {
+			t.Fatalf("Expected 2 deleted tokens, received %d, %v", deleted, err)
+		}
+
+		if _, err := repository.GetByID(ctx, "def456"); err == nil || err.Status() != http.StatusNotFound {
+			t.Errorf("Token def456 should be deleted, received %v", err)
+		}
+		if tokens, err := repository.ListByUser(ctx, 1); err != nil || len(tokens) != 2 {
+			t.Errorf("Tokens of other clients should be kept, received %+v, %v", tokens, err)
+		}
+	})
+}
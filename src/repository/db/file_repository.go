@@ -0,0 +1,289 @@
+package db
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/danielgom/bookstore_oauthapi/src/domain/accesstoken"
+	"github.com/danielgom/bookstore_oauthapi/src/logger"
+	"github.com/danielgom/bookstore_utils-go/errors"
+	"go.uber.org/zap"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// compactMinRecords avoids rewriting small logs on every write
+	compactMinRecords = 1000
+)
+
+// record is a line of the log, a deleted record removes the token with its id
+type record struct {
+	accesstoken.AccessToken
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+// NewFileRepository serves the tokens from memory and persists every write to an append-only log at path,
+// replayed on start, for single node deployments. The log is compacted to the live tokens on start and when
+// it grows past twice their number
+func NewFileRepository(path string, sweepInterval time.Duration) (DRepository, error) {
+
+	r := &fileRepository{memory: newMemoryRepository(sweepInterval), path: path}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	if err := r.compact(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+type fileRepository struct {
+	memory *memoryRepository
+
+	// mu serializes the writes so the log order matches the memory one
+	mu      sync.Mutex
+	path    string
+	file    *os.File
+	records int
+}
+
+func (r *fileRepository) GetByID(ctx context.Context, id string) (*accesstoken.AccessToken, errors.RestErr) {
+	return r.memory.GetByID(ctx, id)
+}
+
+func (r *fileRepository) Create(ctx context.Context, at *accesstoken.AccessToken) errors.RestErr {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.append(at); err != nil {
+		return errors.NewInternalServerError(" error creating access token", err)
+	}
+	if err := r.memory.Create(ctx, at); err != nil {
+		return err
+	}
+
+	r.compactIfNeeded(ctx)
+	return nil
+}
+
+func (r *fileRepository) UpdateExpirationTime(ctx context.Context, at *accesstoken.AccessToken) errors.RestErr {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, err := r.memory.GetByID(ctx, at.AccessToken)
+	if err != nil {
+		return err
+	}
+
+	stored.Expires = at.Expires
+	if err := r.append(stored); err != nil {
+		return errors.NewInternalServerError("error updating access token", err)
+	}
+	if err := r.memory.UpdateExpirationTime(ctx, at); err != nil {
+		return err
+	}
+
+	r.compactIfNeeded(ctx)
+	return nil
+}
+
+func (r *fileRepository) UpdateLastUsed(ctx context.Context, at *accesstoken.AccessToken) errors.RestErr {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, err := r.memory.GetByID(ctx, at.AccessToken)
+	if err != nil {
+		return err
+	}
+
+	stored.LastUsed = at.LastUsed
+	if err := r.append(stored); err != nil {
+		return errors.NewInternalServerError("error updating access token", err)
+	}
+	if err := r.memory.UpdateLastUsed(ctx, at); err != nil {
+		return err
+	}
+
+	r.compactIfNeeded(ctx)
+	return nil
+}
+
+func (r *fileRepository) Delete(ctx context.Context, id string) errors.RestErr {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, err := r.memory.GetByID(ctx, id); err != nil {
+		return err
+	}
+
+	if err := r.write(&record{AccessToken: accesstoken.AccessToken{AccessToken: id}, Deleted: true}); err != nil {
+		return errors.NewInternalServerError("error deleting access token", err)
+	}
+	r.memory.remove([]string{id})
+
+	r.compactIfNeeded(ctx)
+	return nil
+}
+
+func (r *fileRepository) ListByUser(ctx context.Context, userId int64) ([]accesstoken.AccessToken, errors.RestErr) {
+	return r.memory.ListByUser(ctx, userId)
+}
+
+func (r *fileRepository) DeleteByUser(ctx context.Context, userId int64) (int, errors.RestErr) {
+	return r.deleteWhere(ctx, func(at *accesstoken.AccessToken) bool { return at.UserId == userId })
+}
+
+func (r *fileRepository) DeleteByClient(ctx context.Context, clientId int64) (int, errors.RestErr) {
+	return r.deleteWhere(ctx, func(at *accesstoken.AccessToken) bool { return at.ClientId == clientId })
+}
+
+// deleteWhere logs a deleted record for each token matching before removing them from memory
+func (r *fileRepository) deleteWhere(ctx context.Context, matching func(*accesstoken.AccessToken) bool) (int, errors.RestErr) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ids := r.memory.find(matching)
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	records := make([]*record, len(ids))
+	for i, id := range ids {
+		records[i] = &record{AccessToken: accesstoken.AccessToken{AccessToken: id}, Deleted: true}
+	}
+	if err := r.write(records...); err != nil {
+		return 0, errors.NewInternalServerError("error deleting access tokens", err)
+	}
+	r.memory.remove(ids)
+
+	r.compactIfNeeded(ctx)
+	return len(ids), nil
+}
+
+// Close releases the log file
+func (r *fileRepository) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.file.Close()
+}
+
+// append writes at to the log and syncs it, r.mu must be held
+func (r *fileRepository) append(at *accesstoken.AccessToken) error {
+	return r.write(&record{AccessToken: *at})
+}
+
+// write appends records to the log with a single sync, r.mu must be held
+func (r *fileRepository) write(records ...*record) error {
+
+	var lines []byte
+	for _, rec := range records {
+		line, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		lines = append(append(lines, line...), '\n')
+	}
+	if _, err := r.file.Write(lines); err != nil {
+		return err
+	}
+	if err := r.file.Sync(); err != nil {
+		return err
+	}
+
+	r.records += len(records)
+	return nil
+}
+
+// compactIfNeeded compacts the log once most of its records are stale. The write is already durable, so
+// a failure is only logged. r.mu must be held
+func (r *fileRepository) compactIfNeeded(ctx context.Context) {
+
+	if r.records <= compactMinRecords || r.records <= 2*r.memory.len() {
+		return
+	}
+
+	if err := r.compact(); err != nil {
+		logger.FromContext(ctx).Error("token store compaction failed", zap.String("path", r.path), zap.Error(err))
+	}
+}
+
+// load replays the log into memory, later records replacing or deleting earlier ones. A torn last line, left by a crash
+// while writing, is ignored
+func (r *fileRepository) load() error {
+
+	f, err := os.Open(r.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("opening token store: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	var pending error
+	for line := 1; scanner.Scan(); line++ {
+		if pending != nil {
+			return pending
+		}
+
+		var rec record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			pending = fmt.Errorf("token store %s is corrupted at line %d: %w", r.path, line, err)
+			continue
+		}
+		if rec.Deleted {
+			delete(r.memory.tokens, rec.AccessToken.AccessToken)
+			continue
+		}
+		r.memory.tokens[rec.AccessToken.AccessToken] = rec.AccessToken
+	}
+	return scanner.Err()
+}
+
+// compact rewrites the log with the live tokens and reopens it for appending
+func (r *fileRepository) compact() error {
+
+	tmp := r.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("compacting token store: %w", err)
+	}
+
+	live := r.memory.live()
+	w := bufio.NewWriter(f)
+	encoder := json.NewEncoder(w)
+	for i := range live {
+		if err = encoder.Encode(&live[i]); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, r.path)
+	}
+	if err != nil {
+		return fmt.Errorf("compacting token store: %w", err)
+	}
+
+	if r.file != nil {
+		_ = r.file.Close()
+	}
+	if r.file, err = os.OpenFile(r.path, os.O_WRONLY|os.O_APPEND, 0600); err != nil {
+		return fmt.Errorf("opening token store: %w", err)
+	}
+	r.records = len(live)
+	return nil
+}
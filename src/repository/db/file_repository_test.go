@@ -0,0 +1,91 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"github.com/danielgom/bookstore_oauthapi/src/domain/accesstoken"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileRepositoryReopen(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "tokens.db")
+	ctx := context.Background()
+	expires := time.Now().Add(time.Hour).Unix()
+
+	repository, err := NewFileRepository(path, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = repository.Create(ctx, &accesstoken.AccessToken{AccessToken: "abc123", UserId: 1, ClientId: 2, Expires: expires})
+	_ = repository.Create(ctx, &accesstoken.AccessToken{AccessToken: "expired", UserId: 1, ClientId: 2, Expires: time.Now().Add(-time.Hour).Unix()})
+	_ = repository.UpdateExpirationTime(ctx, &accesstoken.AccessToken{AccessToken: "abc123", Expires: expires + 60})
+	_ = repository.Create(ctx, &accesstoken.AccessToken{AccessToken: "revoked", UserId: 3, ClientId: 2, Expires: expires})
+	_, _ = repository.DeleteByUser(ctx, 3)
+	_ = repository.(*fileRepository).Close()
+
+	// a crash while writing leaves a torn last line
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	_, _ = f.WriteString(`{"accessToken":"torn","us`)
+	_ = f.Close()
+
+	repository, err = NewFileRepository(path, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repository.(*fileRepository).Close()
+
+	at, restErr := repository.GetByID(ctx, "abc123")
+	if restErr != nil || at.UserId != 1 || at.Expires != expires+60 {
+		t.Errorf("Unexpected token %+v, %v", at, restErr)
+	}
+
+	if _, restErr = repository.GetByID(ctx, "revoked"); restErr == nil {
+		t.Error("Deleted token should stay deleted after a restart")
+	}
+
+	content, _ := os.ReadFile(path)
+	if lines := bytes.Count(content, []byte("\n")); lines != 1 {
+		t.Errorf("Log should be compacted to the live tokens on start, received %d lines", lines)
+	}
+}
+
+func TestFileRepositoryCorrupted(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "tokens.db")
+	_ = os.WriteFile(path, []byte("not json\n{\"accessToken\":\"abc123\"}\n"), 0600)
+
+	if _, err := NewFileRepository(path, time.Minute); err == nil {
+		t.Error("error should not be nil")
+	}
+}
+
+func TestFileRepositoryCompaction(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "tokens.db")
+	ctx := context.Background()
+	expires := time.Now().Add(time.Hour).Unix()
+
+	repository, err := NewFileRepository(path, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repository.(*fileRepository).Close()
+
+	_ = repository.Create(ctx, &accesstoken.AccessToken{AccessToken: "abc123", UserId: 1, ClientId: 2, Expires: expires})
+	for i := 0; i < compactMinRecords+1; i++ {
+		_ = repository.UpdateExpirationTime(ctx, &accesstoken.AccessToken{AccessToken: "abc123", Expires: expires + int64(i)})
+	}
+
+	content, _ := os.ReadFile(path)
+	if lines := bytes.Count(content, []byte("\n")); lines > 2 {
+		t.Errorf("Log should be compacted, received %d lines", lines)
+	}
+
+	if at, restErr := repository.GetByID(ctx, "abc123"); restErr != nil || at.Expires != expires+compactMinRecords {
+		t.Errorf("Unexpected token %+v, %v", at, restErr)
+	}
+}
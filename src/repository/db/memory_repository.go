@@ -0,0 +1,185 @@
+package db
+
+import (
+	"context"
+	"github.com/danielgom/bookstore_oauthapi/src/clock"
+	"github.com/danielgom/bookstore_oauthapi/src/domain/accesstoken"
+	"github.com/danielgom/bookstore_utils-go/errors"
+	"sync"
+	"time"
+)
+
+// NewMemoryRepository keeps the tokens in process, for development and tests. Expired tokens are swept
+// by the writes at most once per sweepInterval, zero keeps them
+func NewMemoryRepository(sweepInterval time.Duration) DRepository {
+	return newMemoryRepository(sweepInterval)
+}
+
+func newMemoryRepository(sweepInterval time.Duration) *memoryRepository {
+	return &memoryRepository{
+		tokens:        make(map[string]accesstoken.AccessToken),
+		sweepInterval: sweepInterval,
+		clock:         clock.System,
+	}
+}
+
+type memoryRepository struct {
+	mu            sync.RWMutex
+	tokens        map[string]accesstoken.AccessToken
+	sweepInterval time.Duration
+	lastSweep     time.Time
+	clock         clock.Clock
+}
+
+func (r *memoryRepository) GetByID(_ context.Context, id string) (*accesstoken.AccessToken, errors.RestErr) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	at, ok := r.tokens[id]
+	if !ok {
+		return nil, errors.NewNotFoundError("No access token found with given id")
+	}
+	return &at, nil
+}
+
+func (r *memoryRepository) Create(_ context.Context, at *accesstoken.AccessToken) errors.RestErr {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.sweep()
+	r.tokens[at.AccessToken] = *at
+	return nil
+}
+
+func (r *memoryRepository) UpdateExpirationTime(_ context.Context, at *accesstoken.AccessToken) errors.RestErr {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.sweep()
+	stored, ok := r.tokens[at.AccessToken]
+	if !ok {
+		return errors.NewNotFoundError("No access token found with given id")
+	}
+	stored.Expires = at.Expires
+	r.tokens[at.AccessToken] = stored
+	return nil
+}
+
+func (r *memoryRepository) UpdateLastUsed(_ context.Context, at *accesstoken.AccessToken) errors.RestErr {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.tokens[at.AccessToken]
+	if !ok {
+		return errors.NewNotFoundError("No access token found with given id")
+	}
+	stored.LastUsed = at.LastUsed
+	r.tokens[at.AccessToken] = stored
+	return nil
+}
+
+func (r *memoryRepository) Delete(_ context.Context, id string) errors.RestErr {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.tokens[id]; !ok {
+		return errors.NewNotFoundError("No access token found with given id")
+	}
+	delete(r.tokens, id)
+	return nil
+}
+
+func (r *memoryRepository) ListByUser(_ context.Context, userId int64) ([]accesstoken.AccessToken, errors.RestErr) {
+
+	tokens := r.live()
+	owned := tokens[:0]
+	for _, at := range tokens {
+		if at.UserId == userId {
+			owned = append(owned, at)
+		}
+	}
+	return owned, nil
+}
+
+func (r *memoryRepository) DeleteByUser(_ context.Context, userId int64) (int, errors.RestErr) {
+	return len(r.deleteWhere(func(at *accesstoken.AccessToken) bool { return at.UserId == userId })), nil
+}
+
+func (r *memoryRepository) DeleteByClient(_ context.Context, clientId int64) (int, errors.RestErr) {
+	return len(r.deleteWhere(func(at *accesstoken.AccessToken) bool { return at.ClientId == clientId })), nil
+}
+
+// deleteWhere removes the tokens matching and returns their ids
+func (r *memoryRepository) deleteWhere(matching func(*accesstoken.AccessToken) bool) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var deleted []string
+	for id, at := range r.tokens {
+		if matching(&at) {
+			delete(r.tokens, id)
+			deleted = append(deleted, id)
+		}
+	}
+	return deleted
+}
+
+// find returns the ids of the tokens matching
+func (r *memoryRepository) find(matching func(*accesstoken.AccessToken) bool) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var ids []string
+	for id, at := range r.tokens {
+		if matching(&at) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func (r *memoryRepository) remove(ids []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, id := range ids {
+		delete(r.tokens, id)
+	}
+}
+
+// sweep removes the expired tokens when sweepInterval elapsed since the last sweep, r.mu must be held
+func (r *memoryRepository) sweep() {
+
+	now := r.clock.Now()
+	if r.sweepInterval <= 0 || now.Sub(r.lastSweep) < r.sweepInterval {
+		return
+	}
+	r.lastSweep = now
+
+	for id, at := range r.tokens {
+		if at.IsExpired(r.clock) {
+			delete(r.tokens, id)
+		}
+	}
+}
+
+// live returns the tokens not expired yet
+func (r *memoryRepository) live() []accesstoken.AccessToken {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tokens := make([]accesstoken.AccessToken, 0, len(r.tokens))
+	for _, at := range r.tokens {
+		if !at.IsExpired(r.clock) {
+			tokens = append(tokens, at)
+		}
+	}
+	return tokens
+}
+
+func (r *memoryRepository) len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return len(r.tokens)
+}
@@ -0,0 +1,35 @@
+package db
+
+import (
+	"context"
+	"github.com/danielgom/bookstore_oauthapi/src/clock/clocktest"
+	"github.com/danielgom/bookstore_oauthapi/src/domain/accesstoken"
+	"testing"
+	"time"
+)
+
+func TestMemoryRepositorySweep(t *testing.T) {
+
+	now := clocktest.NewClock(time.Unix(1600000000, 0))
+	repository := newMemoryRepository(time.Minute)
+	repository.clock = now
+
+	ctx := context.Background()
+	_ = repository.Create(ctx, &accesstoken.AccessToken{AccessToken: "expiring", UserId: 1, Expires: now.Now().Add(30 * time.Second).Unix()})
+	_ = repository.Create(ctx, &accesstoken.AccessToken{AccessToken: "valid", UserId: 1, Expires: now.Now().Add(time.Hour).Unix()})
+
+	now.Advance(45 * time.Second)
+	_ = repository.Create(ctx, &accesstoken.AccessToken{AccessToken: "other", UserId: 1, Expires: now.Now().Add(time.Hour).Unix()})
+	if _, err := repository.GetByID(ctx, "expiring"); err != nil {
+		t.Error("Tokens should not be swept before the sweep interval")
+	}
+
+	now.Advance(time.Minute)
+	_ = repository.Create(ctx, &accesstoken.AccessToken{AccessToken: "another", UserId: 1, Expires: now.Now().Add(time.Hour).Unix()})
+	if _, err := repository.GetByID(ctx, "expiring"); err == nil || err.Status() != 404 {
+		t.Errorf("Expired token should be swept, received %v", err)
+	}
+	if _, err := repository.GetByID(ctx, "valid"); err != nil {
+		t.Error("Valid token should be kept")
+	}
+}
@@ -0,0 +1,109 @@
+package devicedb
+
+import (
+	"context"
+	"github.com/danielgom/bookstore_oauthapi/src/clock"
+	"github.com/danielgom/bookstore_oauthapi/src/domain/device"
+	"github.com/danielgom/bookstore_utils-go/errors"
+	"sync"
+)
+
+// NewMemoryRepository keeps the authorizations in process, for deployments without Cassandra. A device must then
+// poll the instance the user approves its code on
+func NewMemoryRepository() DeviceRepository {
+	return &memoryRepository{byDeviceCode: make(map[string]device.Authorization), clock: clock.System}
+}
+
+type memoryRepository struct {
+	mu           sync.Mutex
+	byDeviceCode map[string]device.Authorization
+	clock        clock.Clock
+}
+
+func (m *memoryRepository) GetByDeviceCode(_ context.Context, deviceCode string) (*device.Authorization, errors.RestErr) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	auth, ok := m.byDeviceCode[deviceCode]
+	if !ok || auth.Expires <= m.clock.Now().Unix() {
+		return nil, errors.NewNotFoundError("No device authorization found with given code")
+	}
+	return &auth, nil
+}
+
+func (m *memoryRepository) GetByUserCode(_ context.Context, userCode string) (*device.Authorization, errors.RestErr) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, auth := range m.byDeviceCode {
+		if auth.UserCode == userCode && auth.Expires > m.clock.Now().Unix() {
+			return &auth, nil
+		}
+	}
+	return nil, errors.NewNotFoundError("No device authorization found with given code")
+}
+
+// Save drops the expired authorizations, so the map holds the authorizations of the last expiration time at most
+func (m *memoryRepository) Save(_ context.Context, auth *device.Authorization) errors.RestErr {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.clock.Now().Unix()
+	if auth.Expires <= now {
+		return errors.NewBadRequestError("Invalid expiration time")
+	}
+
+	for deviceCode, stored := range m.byDeviceCode {
+		if stored.Expires <= now {
+			delete(m.byDeviceCode, deviceCode)
+		}
+	}
+
+	m.byDeviceCode[auth.DeviceCode] = *auth
+	return nil
+}
+
+func (m *memoryRepository) Decide(_ context.Context, auth *device.Authorization) (bool, errors.RestErr) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.pending(auth.DeviceCode)
+	if !ok {
+		return false, nil
+	}
+	stored.Status = auth.Status
+	stored.UserId = auth.UserId
+	m.byDeviceCode[auth.DeviceCode] = stored
+	return true, nil
+}
+
+func (m *memoryRepository) UpdatePolling(_ context.Context, auth *device.Authorization) (bool, errors.RestErr) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.pending(auth.DeviceCode)
+	if !ok {
+		return false, nil
+	}
+	stored.Interval = auth.Interval
+	stored.LastPolled = auth.LastPolled
+	m.byDeviceCode[auth.DeviceCode] = stored
+	return true, nil
+}
+
+// pending returns the authorization of deviceCode unless it is expired or decided, m.mu must be held
+func (m *memoryRepository) pending(deviceCode string) (device.Authorization, bool) {
+	stored, ok := m.byDeviceCode[deviceCode]
+	return stored, ok && stored.Status == device.StatusPending && stored.Expires > m.clock.Now().Unix()
+}
+
+func (m *memoryRepository) Delete(_ context.Context, auth *device.Authorization) (bool, errors.RestErr) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.byDeviceCode[auth.DeviceCode]; !ok {
+		return false, nil
+	}
+	delete(m.byDeviceCode, auth.DeviceCode)
+	return true, nil
+}
@@ -0,0 +1,169 @@
+package devicedb
+
+import (
+	"context"
+	"github.com/danielgom/bookstore_oauthapi/src/clock"
+	"github.com/danielgom/bookstore_oauthapi/src/domain/device"
+	"github.com/danielgom/bookstore_oauthapi/src/logger"
+	"github.com/danielgom/bookstore_oauthapi/src/repository/db"
+	"github.com/danielgom/bookstore_utils-go/errors"
+	"github.com/gocql/gocql"
+	"go.uber.org/zap"
+	"time"
+)
+
+const (
+	queryGetAuthorization = `SELECT devicecode, usercode, clientid, scope, expires, interval, lastpolled, status, userid FROM device_authorizations WHERE devicecode=?;`
+	queryGetDeviceCode    = `SELECT devicecode FROM device_authorizations_by_user_code WHERE usercode=?;`
+	// both rows are rewritten whole on every save, with the TTL left until the authorization expires
+	querySaveAuthorization = `BEGIN BATCH
+INSERT INTO device_authorizations(devicecode, usercode, clientid, scope, expires, interval, lastpolled, status, userid) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?) USING TTL ?;
+INSERT INTO device_authorizations_by_user_code(usercode, devicecode) VALUES (?, ?) USING TTL ?;
+APPLY BATCH;`
+	// decisions and polls only apply to a pending authorization, so a poll cannot undo a decision nor two users
+	// decide the same code
+	queryDecideAuthorization = `UPDATE device_authorizations USING TTL ? SET status=?, userid=? WHERE devicecode=? IF status=?;`
+	queryUpdatePolling       = `UPDATE device_authorizations USING TTL ? SET interval=?, lastpolled=? WHERE devicecode=? IF status=?;`
+	// the user code row expires with the authorization, a conditional batch cannot span both partitions
+	queryDeleteAuthorization = `DELETE FROM device_authorizations WHERE devicecode=? IF EXISTS;`
+	queryDeleteUserCode      = `DELETE FROM device_authorizations_by_user_code WHERE usercode=?;`
+)
+
+// NewRepository returns the Cassandra repository, its rows expire with the authorizations
+func NewRepository() DeviceRepository {
+	return &repository{clock: clock.System}
+}
+
+type DeviceRepository interface {
+	GetByDeviceCode(context.Context, string) (*device.Authorization, errors.RestErr)
+	GetByUserCode(context.Context, string) (*device.Authorization, errors.RestErr)
+	// Save creates or replaces an authorization
+	Save(context.Context, *device.Authorization) errors.RestErr
+	// Decide stores the Status and UserId of an authorization still pending, reporting whether it was
+	Decide(context.Context, *device.Authorization) (bool, errors.RestErr)
+	// UpdatePolling stores the Interval and LastPolled of an authorization still pending, reporting whether it was
+	UpdatePolling(context.Context, *device.Authorization) (bool, errors.RestErr)
+	// Delete reports whether this call removed the authorization, false when it was already consumed
+	Delete(context.Context, *device.Authorization) (bool, errors.RestErr)
+}
+
+type repository struct {
+	clock clock.Clock
+}
+
+func (r *repository) GetByDeviceCode(ctx context.Context, deviceCode string) (*device.Authorization, errors.RestErr) {
+
+	auth := new(device.Authorization)
+	start := time.Now()
+	err := db.Session.Query(queryGetAuthorization, deviceCode).WithContext(ctx).Scan(&auth.DeviceCode, &auth.UserCode,
+		&auth.ClientId, &auth.Scope, &auth.Expires, &auth.Interval, &auth.LastPolled, &auth.Status, &auth.UserId)
+	db.ObserveQuery(ctx, "queryGetAuthorization", start, err)
+
+	if err != nil {
+		if err == gocql.ErrNotFound {
+			return nil, errors.NewNotFoundError("No device authorization found with given code")
+		}
+		return nil, errors.NewInternalServerError("error retrieving device authorization", err)
+	}
+
+	return auth, nil
+}
+
+func (r *repository) GetByUserCode(ctx context.Context, userCode string) (*device.Authorization, errors.RestErr) {
+
+	var deviceCode string
+	start := time.Now()
+	err := db.Session.Query(queryGetDeviceCode, userCode).WithContext(ctx).Scan(&deviceCode)
+	db.ObserveQuery(ctx, "queryGetDeviceCode", start, err)
+
+	if err != nil {
+		if err == gocql.ErrNotFound {
+			return nil, errors.NewNotFoundError("No device authorization found with given code")
+		}
+		return nil, errors.NewInternalServerError("error retrieving device authorization", err)
+	}
+
+	return r.GetByDeviceCode(ctx, deviceCode)
+}
+
+func (r *repository) Save(ctx context.Context, auth *device.Authorization) errors.RestErr {
+
+	ttl := int(auth.Expires - r.clock.Now().Unix())
+	if ttl <= 0 {
+		return errors.NewBadRequestError("Invalid expiration time")
+	}
+
+	start := time.Now()
+	err := db.Session.Query(querySaveAuthorization, auth.DeviceCode, auth.UserCode, auth.ClientId, auth.Scope, auth.Expires,
+		auth.Interval, auth.LastPolled, auth.Status, auth.UserId, ttl, auth.UserCode, auth.DeviceCode, ttl).WithContext(ctx).Exec()
+	db.ObserveQuery(ctx, "querySaveAuthorization", start, err)
+
+	if err != nil {
+		return errors.NewInternalServerError("error saving device authorization", err)
+	}
+
+	return nil
+}
+
+func (r *repository) Decide(ctx context.Context, auth *device.Authorization) (bool, errors.RestErr) {
+
+	ttl := int(auth.Expires - r.clock.Now().Unix())
+	if ttl <= 0 {
+		return false, nil
+	}
+
+	start := time.Now()
+	applied, err := db.Session.Query(queryDecideAuthorization, ttl, auth.Status, auth.UserId, auth.DeviceCode, device.StatusPending).
+		WithContext(ctx).MapScanCAS(map[string]interface{}{})
+	db.ObserveQuery(ctx, "queryDecideAuthorization", start, err)
+
+	if err != nil {
+		return false, errors.NewInternalServerError("error saving device authorization", err)
+	}
+
+	return applied, nil
+}
+
+func (r *repository) UpdatePolling(ctx context.Context, auth *device.Authorization) (bool, errors.RestErr) {
+
+	ttl := int(auth.Expires - r.clock.Now().Unix())
+	if ttl <= 0 {
+		return false, nil
+	}
+
+	start := time.Now()
+	applied, err := db.Session.Query(queryUpdatePolling, ttl, auth.Interval, auth.LastPolled, auth.DeviceCode, device.StatusPending).
+		WithContext(ctx).MapScanCAS(map[string]interface{}{})
+	db.ObserveQuery(ctx, "queryUpdatePolling", start, err)
+
+	if err != nil {
+		return false, errors.NewInternalServerError("error saving device authorization", err)
+	}
+
+	return applied, nil
+}
+
+func (r *repository) Delete(ctx context.Context, auth *device.Authorization) (bool, errors.RestErr) {
+
+	start := time.Now()
+	applied, err := db.Session.Query(queryDeleteAuthorization, auth.DeviceCode).WithContext(ctx).MapScanCAS(map[string]interface{}{})
+	db.ObserveQuery(ctx, "queryDeleteAuthorization", start, err)
+
+	if err != nil {
+		return false, errors.NewInternalServerError("error deleting device authorization", err)
+	}
+	if !applied {
+		return false, nil
+	}
+
+	start = time.Now()
+	err = db.Session.Query(queryDeleteUserCode, auth.UserCode).WithContext(ctx).Exec()
+	db.ObserveQuery(ctx, "queryDeleteUserCode", start, err)
+
+	// the authorization is consumed, its user code row only resolves to a missing authorization until it expires
+	if err != nil {
+		logger.FromContext(ctx).Warn("device user code not deleted", zap.Error(err))
+	}
+
+	return true, nil
+}
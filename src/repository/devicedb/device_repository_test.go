@@ -0,0 +1,194 @@
+package devicedb
+
+import (
+	"context"
+	errors2 "errors"
+	"github.com/danielgom/bookstore_oauthapi/src/clock/clocktest"
+	"github.com/danielgom/bookstore_oauthapi/src/datasource/cql/cqltest"
+	"github.com/danielgom/bookstore_oauthapi/src/domain/device"
+	"github.com/danielgom/bookstore_oauthapi/src/repository/db"
+	"testing"
+	"time"
+)
+
+func withFakeSession(t *testing.T) *cqltest.Session {
+	session := cqltest.NewSession()
+	previous := db.Session
+	db.Session = session
+	t.Cleanup(func() { db.Session = previous })
+	return session
+}
+
+func TestRepositoryAuthorizations(t *testing.T) {
+
+	now := int64(1600000000)
+	auth := &device.Authorization{DeviceCode: "device-code", UserCode: "BCDFGHJK", ClientId: 7, Scope: "books:read",
+		Expires: now + 600, Interval: 5, Status: device.StatusPending}
+
+	session := withFakeSession(t)
+	session.On(querySaveAuthorization)
+	session.On(queryGetDeviceCode).Row("device-code")
+	session.On(queryGetAuthorization).Row("device-code", "BCDFGHJK", int64(7), "books:read", now+600, int64(5), int64(0),
+		device.StatusPending, int64(0))
+	session.On(queryGetAuthorization)
+	session.On(queryDeleteAuthorization).Error(errors2.New("timeout"))
+
+	repository := NewRepository().(*repository)
+	repository.clock = clocktest.NewClock(time.Unix(now, 0))
+
+	if err := repository.Save(context.Background(), auth); err != nil {
+		t.Fatal("error should be nil")
+	}
+	values := session.Executed()[0].Values
+	if values[0] != "device-code" || values[1] != "BCDFGHJK" || values[7] != device.StatusPending || values[9] != 600 ||
+		values[10] != "BCDFGHJK" || values[11] != "device-code" || values[12] != 600 {
+		t.Errorf("Unexpected values %v", values)
+	}
+
+	stored, err := repository.GetByUserCode(context.Background(), "BCDFGHJK")
+	if err != nil || *stored != *auth {
+		t.Errorf("Unexpected authorization %+v, %v", stored, err)
+	}
+
+	if _, err = repository.GetByDeviceCode(context.Background(), "device-code"); err == nil || err.Status() != 404 {
+		t.Errorf("Status returned should be 404, received %v", err)
+	}
+
+	if _, err = repository.Delete(context.Background(), auth); err == nil || err.Status() != 500 {
+		t.Errorf("Status returned should be 500, received %v", err)
+	}
+
+	auth.Expires = now
+	if err = repository.Save(context.Background(), auth); err == nil || err.Status() != 400 {
+		t.Errorf("Expired authorization should be rejected, received %v", err)
+	}
+}
+
+func TestMemoryRepository(t *testing.T) {
+
+	now := time.Unix(1600000000, 0)
+	fakeClock := clocktest.NewClock(now)
+	repository := NewMemoryRepository().(*memoryRepository)
+	repository.clock = fakeClock
+
+	auth := &device.Authorization{DeviceCode: "device-code", UserCode: "BCDFGHJK", ClientId: 7, Expires: now.Unix() + 600}
+	if err := repository.Save(context.Background(), auth); err != nil {
+		t.Fatal("error should be nil")
+	}
+
+	if stored, err := repository.GetByUserCode(context.Background(), "BCDFGHJK"); err != nil || *stored != *auth {
+		t.Errorf("Unexpected authorization %+v, %v", stored, err)
+	}
+	if stored, err := repository.GetByDeviceCode(context.Background(), "device-code"); err != nil || *stored != *auth {
+		t.Errorf("Unexpected authorization %+v, %v", stored, err)
+	}
+
+	fakeClock.Advance(601 * time.Second)
+	if _, err := repository.GetByDeviceCode(context.Background(), "device-code"); err == nil || err.Status() != 404 {
+		t.Errorf("Expired authorizations should not be returned, received %v", err)
+	}
+
+	_ = repository.Save(context.Background(), &device.Authorization{DeviceCode: "other", Expires: fakeClock.Now().Unix() + 600})
+	if len(repository.byDeviceCode) != 1 {
+		t.Errorf("Expired authorizations should be dropped on save, %d left", len(repository.byDeviceCode))
+	}
+
+	if deleted, err := repository.Delete(context.Background(), &device.Authorization{DeviceCode: "other"}); err != nil || !deleted ||
+		len(repository.byDeviceCode) != 0 {
+		t.Errorf("Unexpected result %v, %v, %d left", deleted, err, len(repository.byDeviceCode))
+	}
+	if deleted, err := repository.Delete(context.Background(), &device.Authorization{DeviceCode: "other"}); err != nil || deleted {
+		t.Errorf("A consumed authorization should not be deleted twice, received %v, %v", deleted, err)
+	}
+}
+
+func TestRepositoryConditionalWrites(t *testing.T) {
+
+	now := int64(1600000000)
+	auth := &device.Authorization{DeviceCode: "device-code", UserCode: "BCDFGHJK", Expires: now + 600, Interval: 10,
+		LastPolled: now, Status: device.StatusApproved, UserId: 1}
+
+	session := withFakeSession(t)
+	session.On(queryDecideAuthorization).Row()
+	session.On(queryDecideAuthorization).NotApplied()
+	session.On(queryUpdatePolling).NotApplied()
+	session.On(queryDeleteAuthorization).Row()
+	session.On(queryDeleteUserCode)
+	session.On(queryDeleteAuthorization).NotApplied()
+
+	repository := NewRepository().(*repository)
+	repository.clock = clocktest.NewClock(time.Unix(now, 0))
+
+	if decided, err := repository.Decide(context.Background(), auth); err != nil || !decided {
+		t.Errorf("Unexpected result %v, %v", decided, err)
+	}
+	if decided, err := repository.Decide(context.Background(), auth); err != nil || decided {
+		t.Errorf("A decided authorization should not be decided again, received %v, %v", decided, err)
+	}
+	if updated, err := repository.UpdatePolling(context.Background(), auth); err != nil || updated {
+		t.Errorf("A decided authorization should not be polled, received %v, %v", updated, err)
+	}
+	if deleted, err := repository.Delete(context.Background(), auth); err != nil || !deleted {
+		t.Errorf("Unexpected result %v, %v", deleted, err)
+	}
+	if deleted, err := repository.Delete(context.Background(), auth); err != nil || deleted {
+		t.Errorf("A consumed authorization should not be deleted twice, received %v, %v", deleted, err)
+	}
+
+	executed := session.Executed()
+	if len(executed) != 6 {
+		t.Fatalf("Expected 6 queries, received %d", len(executed))
+	}
+	if values := executed[0].Values; values[0] != 600 || values[1] != device.StatusApproved || values[2] != int64(1) ||
+		values[3] != "device-code" || values[4] != device.StatusPending {
+		t.Errorf("Unexpected values %v", values)
+	}
+	if values := executed[2].Values; values[1] != int64(10) || values[2] != now || values[4] != device.StatusPending {
+		t.Errorf("Unexpected values %v", values)
+	}
+	if values := executed[4].Values; values[0] != "BCDFGHJK" {
+		t.Errorf("Unexpected values %v", values)
+	}
+
+	repository.clock = clocktest.NewClock(time.Unix(now+600, 0))
+	if decided, err := repository.Decide(context.Background(), auth); err != nil || decided {
+		t.Errorf("An expired authorization should not be decided, received %v, %v", decided, err)
+	}
+}
+
+func TestMemoryRepositoryConditionalWrites(t *testing.T) {
+
+	now := time.Unix(1600000000, 0)
+	repository := NewMemoryRepository().(*memoryRepository)
+	repository.clock = clocktest.NewClock(now)
+
+	auth := &device.Authorization{DeviceCode: "device-code", UserCode: "BCDFGHJK", Expires: now.Unix() + 600, Status: device.StatusPending}
+	if err := repository.Save(context.Background(), auth); err != nil {
+		t.Fatal("error should be nil")
+	}
+
+	polled := *auth
+	polled.Interval, polled.LastPolled = 10, now.Unix()
+	if updated, err := repository.UpdatePolling(context.Background(), &polled); err != nil || !updated {
+		t.Errorf("Unexpected result %v, %v", updated, err)
+	}
+
+	approved := *auth
+	approved.Status, approved.UserId = device.StatusApproved, 1
+	if decided, err := repository.Decide(context.Background(), &approved); err != nil || !decided {
+		t.Errorf("Unexpected result %v, %v", decided, err)
+	}
+	denied := *auth
+	denied.Status, denied.UserId = device.StatusDenied, 2
+	if decided, err := repository.Decide(context.Background(), &denied); err != nil || decided {
+		t.Errorf("A decided authorization should not be decided again, received %v, %v", decided, err)
+	}
+	if updated, err := repository.UpdatePolling(context.Background(), auth); err != nil || updated {
+		t.Errorf("A decided authorization should not be polled, received %v, %v", updated, err)
+	}
+
+	stored, _ := repository.GetByDeviceCode(context.Background(), "device-code")
+	if stored.Status != device.StatusApproved || stored.UserId != 1 || stored.Interval != 10 || stored.LastPolled != now.Unix() {
+		t.Errorf("Unexpected authorization %+v", stored)
+	}
+}
@@ -0,0 +1,178 @@
+package mfadb
+
+import (
+	"context"
+	"fmt"
+	"github.com/danielgom/bookstore_oauthapi/src/clock"
+	"github.com/danielgom/bookstore_oauthapi/src/domain/mfa"
+	"github.com/danielgom/bookstore_oauthapi/src/repository/db"
+	"github.com/danielgom/bookstore_utils-go/errors"
+	"github.com/gocql/gocql"
+	"time"
+)
+
+const (
+	queryGetSecret        = `SELECT userid, secret, confirmed, laststep FROM mfa_secrets WHERE userid=?;`
+	querySaveSecret       = `INSERT INTO mfa_secrets(userid, secret, confirmed) VALUES (?, ?, ?);`
+	queryDeleteSecret     = `DELETE FROM mfa_secrets WHERE userid=?;`
+	queryUseTimeStep      = `UPDATE mfa_secrets SET laststep=? WHERE userid=? IF laststep=?;`
+	queryUseFirstTimeStep = `UPDATE mfa_secrets SET laststep=? WHERE userid=? IF laststep=null;`
+	queryGetChallenge     = `SELECT mfatoken, userid, clientid, scope, expires, attempts FROM mfa_challenges WHERE mfatoken=?;`
+	queryCreateChallenge  = `INSERT INTO mfa_challenges(mfatoken, userid, clientid, scope, expires, attempts) VALUES (?, ?, ?, ?, ?, 0) USING TTL ?;`
+	queryAddAttempt       = `UPDATE mfa_challenges USING TTL ? SET attempts=? WHERE mfatoken=? IF attempts=?;`
+	queryDeleteChallenge  = `DELETE FROM mfa_challenges WHERE mfatoken=? IF EXISTS;`
+)
+
+func NewRepository() MfaRepository {
+	return &repository{clock: clock.System}
+}
+
+type MfaRepository interface {
+	GetSecret(context.Context, int64) (*mfa.Secret, errors.RestErr)
+	SaveSecret(context.Context, *mfa.Secret) errors.RestErr
+	DeleteSecret(context.Context, int64) errors.RestErr
+	UseTimeStep(context.Context, *mfa.Secret, int64) (bool, errors.RestErr)
+	GetChallenge(context.Context, string) (*mfa.Challenge, errors.RestErr)
+	CreateChallenge(context.Context, *mfa.Challenge) errors.RestErr
+	AddChallengeAttempt(context.Context, *mfa.Challenge) (bool, errors.RestErr)
+	DeleteChallenge(context.Context, string) (bool, errors.RestErr)
+}
+
+type repository struct {
+	clock clock.Clock
+}
+
+func (r *repository) GetSecret(ctx context.Context, userId int64) (*mfa.Secret, errors.RestErr) {
+
+	secret := new(mfa.Secret)
+	start := time.Now()
+	err := db.Session.Query(queryGetSecret, userId).WithContext(ctx).Scan(&secret.UserId, &secret.Secret, &secret.Confirmed, &secret.LastTimeStep)
+	db.ObserveQuery(ctx, "queryGetSecret", start, err)
+
+	if err != nil {
+		if err == gocql.ErrNotFound {
+			return nil, errors.NewNotFoundError("No mfa secret found for given user")
+		}
+		return nil, errors.NewInternalServerError(fmt.Sprintf("error retrieving mfa secret for user %d", userId), err)
+	}
+
+	return secret, nil
+}
+
+func (r *repository) SaveSecret(ctx context.Context, secret *mfa.Secret) errors.RestErr {
+
+	start := time.Now()
+	err := db.Session.Query(querySaveSecret, secret.UserId, secret.Secret, secret.Confirmed).WithContext(ctx).Exec()
+	db.ObserveQuery(ctx, "querySaveSecret", start, err)
+
+	if err != nil {
+		return errors.NewInternalServerError("error saving mfa secret", err)
+	}
+
+	return nil
+}
+
+func (r *repository) DeleteSecret(ctx context.Context, userId int64) errors.RestErr {
+
+	start := time.Now()
+	err := db.Session.Query(queryDeleteSecret, userId).WithContext(ctx).Exec()
+	db.ObserveQuery(ctx, "queryDeleteSecret", start, err)
+
+	if err != nil {
+		return errors.NewInternalServerError("error deleting mfa secret", err)
+	}
+
+	return nil
+}
+
+// UseTimeStep records step as the last accepted one of secret. It reports false when another code was accepted
+// since secret was read
+func (r *repository) UseTimeStep(ctx context.Context, secret *mfa.Secret, step int64) (bool, errors.RestErr) {
+
+	query := db.Session.Query(queryUseTimeStep, step, secret.UserId, secret.LastTimeStep)
+	if secret.LastTimeStep == 0 {
+		query = db.Session.Query(queryUseFirstTimeStep, step, secret.UserId)
+	}
+
+	start := time.Now()
+	applied, err := query.WithContext(ctx).MapScanCAS(map[string]interface{}{})
+	db.ObserveQuery(ctx, "queryUseTimeStep", start, err)
+
+	if err != nil {
+		return false, errors.NewInternalServerError("error saving mfa time step", err)
+	}
+
+	return applied, nil
+}
+
+func (r *repository) GetChallenge(ctx context.Context, mfaToken string) (*mfa.Challenge, errors.RestErr) {
+
+	challenge := new(mfa.Challenge)
+	start := time.Now()
+	err := db.Session.Query(queryGetChallenge, mfaToken).WithContext(ctx).
+		Scan(&challenge.MfaToken, &challenge.UserId, &challenge.ClientId, &challenge.Scope, &challenge.Expires, &challenge.Attempts)
+	db.ObserveQuery(ctx, "queryGetChallenge", start, err)
+
+	if err != nil {
+		if err == gocql.ErrNotFound {
+			return nil, errors.NewNotFoundError("No mfa challenge found with given token")
+		}
+		return nil, errors.NewInternalServerError("error retrieving mfa challenge", err)
+	}
+
+	return challenge, nil
+}
+
+func (r *repository) CreateChallenge(ctx context.Context, challenge *mfa.Challenge) errors.RestErr {
+
+	ttl := int(challenge.Expires - r.clock.Now().Unix())
+	if ttl <= 0 {
+		return errors.NewBadRequestError("Invalid expiration time")
+	}
+
+	start := time.Now()
+	err := db.Session.Query(queryCreateChallenge, challenge.MfaToken, challenge.UserId, challenge.ClientId,
+		challenge.Scope, challenge.Expires, ttl).WithContext(ctx).Exec()
+	db.ObserveQuery(ctx, "queryCreateChallenge", start, err)
+
+	if err != nil {
+		return errors.NewInternalServerError("error creating mfa challenge", err)
+	}
+
+	return nil
+}
+
+// AddChallengeAttempt counts one more attempt of challenge, keeping its TTL. It reports false when another
+// attempt was counted since challenge was read, or when it expired
+func (r *repository) AddChallengeAttempt(ctx context.Context, challenge *mfa.Challenge) (bool, errors.RestErr) {
+
+	ttl := int(challenge.Expires - r.clock.Now().Unix())
+	if ttl <= 0 {
+		return false, nil
+	}
+
+	start := time.Now()
+	applied, err := db.Session.Query(queryAddAttempt, ttl, challenge.Attempts+1, challenge.MfaToken, challenge.Attempts).
+		WithContext(ctx).MapScanCAS(map[string]interface{}{})
+	db.ObserveQuery(ctx, "queryAddAttempt", start, err)
+
+	if err != nil {
+		return false, errors.NewInternalServerError("error counting mfa challenge attempt", err)
+	}
+
+	return applied, nil
+}
+
+// DeleteChallenge reports whether this call removed the challenge, false when it was already consumed
+func (r *repository) DeleteChallenge(ctx context.Context, mfaToken string) (bool, errors.RestErr) {
+
+	start := time.Now()
+	applied, err := db.Session.Query(queryDeleteChallenge, mfaToken).WithContext(ctx).MapScanCAS(map[string]interface{}{})
+	db.ObserveQuery(ctx, "queryDeleteChallenge", start, err)
+
+	if err != nil {
+		return false, errors.NewInternalServerError("error deleting mfa challenge", err)
+	}
+
+	return applied, nil
+}
@@ -0,0 +1,119 @@
+package mfadb
+
+import (
+	"context"
+	errors2 "errors"
+	"github.com/danielgom/bookstore_oauthapi/src/clock/clocktest"
+	"github.com/danielgom/bookstore_oauthapi/src/datasource/cql/cqltest"
+	"github.com/danielgom/bookstore_oauthapi/src/domain/mfa"
+	"github.com/danielgom/bookstore_oauthapi/src/repository/db"
+	"testing"
+	"time"
+)
+
+func withFakeSession(t *testing.T) *cqltest.Session {
+	session := cqltest.NewSession()
+	previous := db.Session
+	db.Session = session
+	t.Cleanup(func() { db.Session = previous })
+	return session
+}
+
+func TestRepositoryGetSecret(t *testing.T) {
+
+	session := withFakeSession(t)
+	session.On(queryGetSecret).Row(int64(1), "JBSWY3DPEHPK3PXP", true, int64(53333333))
+	session.On(queryGetSecret)
+
+	secret, err := NewRepository().GetSecret(context.Background(), 1)
+	if err != nil {
+		t.Fatal("error should be nil")
+	}
+	if secret.UserId != 1 || secret.Secret != "JBSWY3DPEHPK3PXP" || !secret.Confirmed || secret.LastTimeStep != 53333333 {
+		t.Errorf("Unexpected secret %+v", secret)
+	}
+
+	if _, err = NewRepository().GetSecret(context.Background(), 1); err == nil || err.Status() != 404 {
+		t.Errorf("Status returned should be 404, received %v", err)
+	}
+}
+
+func TestRepositorySecretWrites(t *testing.T) {
+
+	session := withFakeSession(t)
+	session.On(querySaveSecret)
+	session.On(queryDeleteSecret).Error(errors2.New("timeout"))
+
+	if err := NewRepository().SaveSecret(context.Background(), &mfa.Secret{UserId: 1, Secret: "JBSWY3DPEHPK3PXP"}); err != nil {
+		t.Fatal("error should be nil")
+	}
+	if executed := session.Executed(); executed[0].Values[0] != int64(1) || executed[0].Values[2] != false {
+		t.Errorf("Unexpected values %v", executed[0].Values)
+	}
+
+	if err := NewRepository().DeleteSecret(context.Background(), 1); err == nil || err.Status() != 500 {
+		t.Errorf("Status returned should be 500, received %v", err)
+	}
+}
+
+func TestRepositoryChallenges(t *testing.T) {
+
+	now := time.Unix(1600000000, 0)
+	expires := now.Add(mfa.ChallengeExpirationTime).Unix()
+
+	session := withFakeSession(t)
+	session.On(queryCreateChallenge)
+	session.On(queryGetChallenge).Row("mfa-token", int64(1), int64(2), "read", expires, 0)
+	session.On(queryAddAttempt).Row().NotApplied()
+	session.On(queryDeleteChallenge).Row()
+
+	repository := &repository{clock: clocktest.NewClock(now)}
+	challenge := &mfa.Challenge{MfaToken: "mfa-token", UserId: 1, ClientId: 2, Scope: "read", Expires: expires}
+
+	if err := repository.CreateChallenge(context.Background(), challenge); err != nil {
+		t.Fatal("error should be nil")
+	}
+	if ttl := session.Executed()[0].Values[5].(int); ttl != int(mfa.ChallengeExpirationTime.Seconds()) {
+		t.Errorf("Unexpected ttl %d", ttl)
+	}
+
+	stored, err := repository.GetChallenge(context.Background(), "mfa-token")
+	if err != nil || *stored != *challenge {
+		t.Errorf("Unexpected challenge %+v, %v", stored, err)
+	}
+
+	if counted, err := repository.AddChallengeAttempt(context.Background(), stored); err != nil || counted {
+		t.Errorf("A concurrent attempt should not be counted, received %v, %v", counted, err)
+	}
+	if values := session.Executed()[2].Values; values[0] != 300 || values[1] != 1 || values[3] != 0 {
+		t.Errorf("Unexpected values %v", values)
+	}
+
+	if deleted, err := repository.DeleteChallenge(context.Background(), "mfa-token"); err != nil || !deleted {
+		t.Errorf("The challenge should be deleted, received %v, %v", deleted, err)
+	}
+
+	challenge.Expires = now.Unix()
+	if err = repository.CreateChallenge(context.Background(), challenge); err == nil || err.Status() != 400 {
+		t.Errorf("Expired challenge should be rejected, received %v", err)
+	}
+}
+
+func TestRepositoryUseTimeStep(t *testing.T) {
+
+	session := withFakeSession(t)
+	session.On(queryUseFirstTimeStep).Row()
+	session.On(queryUseTimeStep).Row().NotApplied()
+
+	if used, err := NewRepository().UseTimeStep(context.Background(), &mfa.Secret{UserId: 1}, 53333333); err != nil || !used {
+		t.Errorf("The first step should be recorded, received %v, %v", used, err)
+	}
+
+	secret := &mfa.Secret{UserId: 1, LastTimeStep: 53333333}
+	if used, err := NewRepository().UseTimeStep(context.Background(), secret, 53333334); err != nil || used {
+		t.Errorf("A step recorded concurrently should not be used, received %v, %v", used, err)
+	}
+	if values := session.Executed()[1].Values; values[0] != int64(53333334) || values[2] != int64(53333333) {
+		t.Errorf("Unexpected values %v", values)
+	}
+}
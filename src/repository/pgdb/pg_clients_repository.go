@@ -0,0 +1,78 @@
+package pgdb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/danielgom/bookstore_oauthapi/src/domain/clients"
+	"github.com/danielgom/bookstore_oauthapi/src/repository/clientsdb"
+	"github.com/danielgom/bookstore_utils-go/errors"
+	"github.com/lib/pq"
+	"time"
+)
+
+const (
+	queryGetClient       = `SELECT id, name, secret_hash, roles FROM clients WHERE id = $1;`
+	queryGetClientByName = `SELECT id, name, secret_hash, roles FROM clients WHERE name = $1;`
+	queryUpdateSecret    = `UPDATE clients SET secret_hash = $1 WHERE id = $2;`
+)
+
+// NewClientsRepository reads the registered clients from the clients table of database
+func NewClientsRepository(database *sql.DB) clientsdb.ClientsRepository {
+	return &clientsRepository{database}
+}
+
+// NewClientsRepositoryFromConfig connects with the POSTGRES_* configuration and returns the clients repository
+func NewClientsRepositoryFromConfig() (clientsdb.ClientsRepository, error) {
+
+	database, err := Open(NewConfigFromConfig())
+	if err != nil {
+		return nil, err
+	}
+	return NewClientsRepository(database), nil
+}
+
+type clientsRepository struct {
+	database *sql.DB
+}
+
+func (r *clientsRepository) GetByID(ctx context.Context, id int64) (*clients.Client, errors.RestErr) {
+	return r.get(ctx, "queryGetClient", queryGetClient, id, fmt.Sprintf("Client with id %d not found", id))
+}
+
+func (r *clientsRepository) GetByName(ctx context.Context, name string) (*clients.Client, errors.RestErr) {
+	return r.get(ctx, "queryGetClientByName", queryGetClientByName, name, fmt.Sprintf("Client with name %s not found", name))
+}
+
+func (r *clientsRepository) UpdateSecret(ctx context.Context, id int64, hash string) errors.RestErr {
+
+	start := time.Now()
+	result, err := r.database.ExecContext(ctx, queryUpdateSecret, hash, id)
+	observeQuery(ctx, "queryUpdateSecret", start, err)
+
+	if err != nil {
+		return errors.NewInternalServerError("error updating client secret", err)
+	}
+	if updated, err := result.RowsAffected(); err == nil && updated == 0 {
+		return errors.NewNotFoundError(fmt.Sprintf("Client with id %d not found", id))
+	}
+
+	return nil
+}
+
+func (r *clientsRepository) get(ctx context.Context, name, query string, arg interface{}, notFound string) (*clients.Client, errors.RestErr) {
+
+	client := new(clients.Client)
+	start := time.Now()
+	err := r.database.QueryRowContext(ctx, query, arg).Scan(&client.Id, &client.Name, &client.SecretHash, pq.Array(&client.Roles))
+	observeQuery(ctx, name, start, err)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.NewNotFoundError(notFound)
+		}
+		return nil, errors.NewInternalServerError("error retrieving client", err)
+	}
+
+	return client, nil
+}
@@ -0,0 +1,71 @@
+package pgdb
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"github.com/danielgom/bookstore_oauthapi/src/datasource/migrations"
+	"io/fs"
+	"time"
+)
+
+const (
+	queryCreateHistory = `CREATE TABLE IF NOT EXISTS schema_migrations(version integer PRIMARY KEY, name text NOT NULL, applied_at timestamptz NOT NULL);`
+	queryGetHistory    = `SELECT version, applied_at FROM schema_migrations;`
+	queryInsertHistory = `INSERT INTO schema_migrations(version, name, applied_at) VALUES ($1, $2, $3);`
+)
+
+//go:embed sql/*.sql
+var embedded embed.FS
+
+// Migrations returns the PostgreSQL migrations embedded in the binary, sorted by version
+func Migrations() ([]*migrations.Migration, error) {
+	sub, err := fs.Sub(embedded, "sql")
+	if err != nil {
+		return nil, err
+	}
+	return migrations.Load(sub)
+}
+
+// NewMigrationStore runs the migrations against database, keeping the history in schema_migrations
+func NewMigrationStore(database *sql.DB) migrations.Store {
+	return &migrationStore{database}
+}
+
+type migrationStore struct {
+	database *sql.DB
+}
+
+func (s *migrationStore) Init(ctx context.Context) error {
+	return s.Exec(ctx, queryCreateHistory)
+}
+
+func (s *migrationStore) Exec(ctx context.Context, statement string) error {
+	_, err := s.database.ExecContext(ctx, statement)
+	return err
+}
+
+func (s *migrationStore) Applied(ctx context.Context) (map[int]time.Time, error) {
+
+	rows, err := s.database.QueryContext(ctx, queryGetHistory)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err = rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+func (s *migrationStore) Record(ctx context.Context, m *migrations.Migration, appliedAt time.Time) error {
+	_, err := s.database.ExecContext(ctx, queryInsertHistory, m.Version, m.Name, appliedAt)
+	return err
+}
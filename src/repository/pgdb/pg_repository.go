@@ -0,0 +1,228 @@
+package pgdb
+
+import (
+	"context"
+	"database/sql"
+	"github.com/danielgom/bookstore_oauthapi/src/clock"
+	"github.com/danielgom/bookstore_oauthapi/src/domain/accesstoken"
+	"github.com/danielgom/bookstore_oauthapi/src/logger"
+	"github.com/danielgom/bookstore_oauthapi/src/metrics"
+	"github.com/danielgom/bookstore_oauthapi/src/repository/db"
+	"github.com/danielgom/bookstore_utils-go/errors"
+	"go.uber.org/zap"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	queryGetAccessToken    = `SELECT access_token, client_id, expires, user_id, scope, max_expires, created, last_used, user_agent, remote_ip, act FROM access_tokens WHERE access_token = $1;`
+	queryCreateAccessToken = `INSERT INTO access_tokens(access_token, client_id, expires, user_id, scope, max_expires, created, last_used, user_agent, remote_ip, act) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+ON CONFLICT (access_token) DO UPDATE SET client_id = EXCLUDED.client_id, expires = EXCLUDED.expires, user_id = EXCLUDED.user_id, scope = EXCLUDED.scope,
+max_expires = EXCLUDED.max_expires, created = EXCLUDED.created, last_used = EXCLUDED.last_used, user_agent = EXCLUDED.user_agent, remote_ip = EXCLUDED.remote_ip,
+act = EXCLUDED.act;`
+	queryUpdateExpires     = `UPDATE access_tokens SET expires = $1 WHERE access_token = $2;`
+	queryUpdateLastUsed    = `UPDATE access_tokens SET last_used = $1 WHERE access_token = $2;`
+	queryDeleteAccessToken = `DELETE FROM access_tokens WHERE access_token = $1;`
+	queryDeleteExpired     = `DELETE FROM access_tokens WHERE expires < $1;`
+	queryGetUserTokens     = `SELECT access_token, client_id, expires, user_id, scope, max_expires, created, last_used, user_agent, remote_ip, act FROM access_tokens WHERE user_id = $1 AND expires >= $2;`
+	queryDeleteByUser      = `DELETE FROM access_tokens WHERE user_id = $1;`
+	// client_id <> 0 matches the partial index
+	queryDeleteByClient = `DELETE FROM access_tokens WHERE client_id = $1 AND client_id <> 0;`
+)
+
+// NewRepository stores the tokens in the access_tokens table of database. Expired tokens are deleted in the
+// background by the writes at most once per sweepInterval, zero keeps them
+func NewRepository(database *sql.DB, sweepInterval time.Duration) db.DRepository {
+	return &repository{database: database, sweepInterval: sweepInterval, clock: clock.System}
+}
+
+type repository struct {
+	// lastSweep first to keep it 64-bit aligned for atomic access
+	lastSweep int64
+
+	database      *sql.DB
+	sweepInterval time.Duration
+	clock         clock.Clock
+}
+
+func (r *repository) GetByID(ctx context.Context, id string) (*accesstoken.AccessToken, errors.RestErr) {
+
+	tk := new(accesstoken.AccessToken)
+	var act string
+	start := time.Now()
+	err := r.database.QueryRowContext(ctx, queryGetAccessToken, id).Scan(scanDest(tk, &act)...)
+	observeQuery(ctx, "queryGetAccessToken", start, err)
+	if err == nil {
+		tk.Act, err = accesstoken.DecodeActor(act)
+	}
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.NewNotFoundError("No access token found with given id")
+		}
+		return nil, errors.NewInternalServerError("error retrieving access token", err)
+	}
+
+	return tk, nil
+}
+
+func (r *repository) Create(ctx context.Context, at *accesstoken.AccessToken) errors.RestErr {
+
+	start := time.Now()
+	_, err := r.database.ExecContext(ctx, queryCreateAccessToken, at.AccessToken, at.ClientId, at.Expires, at.UserId, at.Scope,
+		at.MaxExpires, at.Created, at.LastUsed, at.UserAgent, at.RemoteIp, accesstoken.EncodeActor(at.Act))
+	observeQuery(ctx, "queryCreateAccessToken", start, err)
+
+	if err != nil {
+		return errors.NewInternalServerError(" error creating access token", err)
+	}
+
+	r.sweep()
+	return nil
+}
+
+func (r *repository) UpdateExpirationTime(ctx context.Context, at *accesstoken.AccessToken) errors.RestErr {
+	return r.update(ctx, "queryUpdateExpires", queryUpdateExpires, at.Expires, at.AccessToken)
+}
+
+func (r *repository) UpdateLastUsed(ctx context.Context, at *accesstoken.AccessToken) errors.RestErr {
+	return r.update(ctx, "queryUpdateLastUsed", queryUpdateLastUsed, at.LastUsed, at.AccessToken)
+}
+
+// update runs a statement changing a single token, not found when no row matched
+func (r *repository) update(ctx context.Context, name, query string, args ...interface{}) errors.RestErr {
+
+	start := time.Now()
+	result, err := r.database.ExecContext(ctx, query, args...)
+	observeQuery(ctx, name, start, err)
+
+	if err != nil {
+		return errors.NewInternalServerError("error updating access token", err)
+	}
+
+	if updated, err := result.RowsAffected(); err == nil && updated == 0 {
+		return errors.NewNotFoundError("No access token found with given id")
+	}
+
+	return nil
+}
+
+func (r *repository) Delete(ctx context.Context, id string) errors.RestErr {
+
+	deleted, err := r.delete(ctx, "queryDeleteAccessToken", queryDeleteAccessToken, id)
+	if err != nil {
+		return err
+	}
+
+	if deleted == 0 {
+		return errors.NewNotFoundError("No access token found with given id")
+	}
+
+	return nil
+}
+
+func (r *repository) ListByUser(ctx context.Context, userId int64) ([]accesstoken.AccessToken, errors.RestErr) {
+
+	start := time.Now()
+	rows, err := r.database.QueryContext(ctx, queryGetUserTokens, userId, r.clock.Now().Unix())
+	if err != nil {
+		observeQuery(ctx, "queryGetUserTokens", start, err)
+		return nil, errors.NewInternalServerError("error retrieving access tokens", err)
+	}
+	defer rows.Close()
+
+	var tokens []accesstoken.AccessToken
+	for rows.Next() {
+		var tk accesstoken.AccessToken
+		var act string
+		if err = rows.Scan(scanDest(&tk, &act)...); err != nil {
+			break
+		}
+		if tk.Act, err = accesstoken.DecodeActor(act); err != nil {
+			break
+		}
+		tokens = append(tokens, tk)
+	}
+	if err == nil {
+		err = rows.Err()
+	}
+	observeQuery(ctx, "queryGetUserTokens", start, err)
+
+	if err != nil {
+		return nil, errors.NewInternalServerError("error retrieving access tokens", err)
+	}
+
+	return tokens, nil
+}
+
+func (r *repository) DeleteByUser(ctx context.Context, userId int64) (int, errors.RestErr) {
+	return r.delete(ctx, "queryDeleteByUser", queryDeleteByUser, userId)
+}
+
+func (r *repository) DeleteByClient(ctx context.Context, clientId int64) (int, errors.RestErr) {
+	return r.delete(ctx, "queryDeleteByClient", queryDeleteByClient, clientId)
+}
+
+func (r *repository) delete(ctx context.Context, name, query string, arg interface{}) (int, errors.RestErr) {
+
+	start := time.Now()
+	result, err := r.database.ExecContext(ctx, query, arg)
+	observeQuery(ctx, name, start, err)
+
+	if err != nil {
+		return 0, errors.NewInternalServerError("error deleting access tokens", err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, errors.NewInternalServerError("error deleting access tokens", err)
+	}
+
+	return int(deleted), nil
+}
+
+// scanDest returns the destinations of the columns selected by queryGetAccessToken, the stored actor is scanned
+// into act
+func scanDest(tk *accesstoken.AccessToken, act *string) []interface{} {
+	return []interface{}{&tk.AccessToken, &tk.ClientId, &tk.Expires, &tk.UserId, &tk.Scope, &tk.MaxExpires,
+		&tk.Created, &tk.LastUsed, &tk.UserAgent, &tk.RemoteIp, act}
+}
+
+// sweep deletes the expired tokens in the background when sweepInterval elapsed since the last sweep
+func (r *repository) sweep() {
+
+	if r.sweepInterval <= 0 {
+		return
+	}
+
+	now := r.clock.Now()
+	last := atomic.LoadInt64(&r.lastSweep)
+	if now.Sub(time.Unix(0, last)) < r.sweepInterval || !atomic.CompareAndSwapInt64(&r.lastSweep, last, now.UnixNano()) {
+		return
+	}
+
+	go func() {
+		ctx := context.Background()
+		start := time.Now()
+		result, err := r.database.ExecContext(ctx, queryDeleteExpired, now.Unix())
+		observeQuery(ctx, "queryDeleteExpired", start, err)
+
+		if err == nil {
+			deleted, _ := result.RowsAffected()
+			zap.L().Debug("expired access tokens deleted", zap.Int64("deleted", deleted))
+		}
+	}()
+}
+
+// observeQuery records the statement latency and logs failed statements, no rows is not a failure
+func observeQuery(ctx context.Context, statement string, start time.Time, err error) {
+	if err == sql.ErrNoRows {
+		err = nil
+	}
+	metrics.ObservePostgresQuery(statement, start, err)
+
+	if err != nil {
+		logger.FromContext(ctx).Error("postgres query failed",
+			zap.String("statement", statement), zap.Duration("latency", time.Since(start)), zap.Error(err))
+	}
+}
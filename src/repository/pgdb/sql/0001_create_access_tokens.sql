@@ -0,0 +1,11 @@
+-- Access tokens looked up by their value
+CREATE TABLE IF NOT EXISTS access_tokens(
+    access_token text PRIMARY KEY,
+    user_id bigint NOT NULL,
+    client_id bigint NOT NULL DEFAULT 0,
+    expires bigint NOT NULL,
+    scope text NOT NULL DEFAULT ''
+);
+
+-- Lets the repository sweep the expired tokens without a full scan
+CREATE INDEX IF NOT EXISTS access_tokens_expires_idx ON access_tokens(expires);
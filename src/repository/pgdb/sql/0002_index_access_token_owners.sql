@@ -0,0 +1,4 @@
+-- Lets the tokens of a user or client be listed and revoked without a full scan
+CREATE INDEX IF NOT EXISTS access_tokens_user_id_idx ON access_tokens(user_id);
+
+CREATE INDEX IF NOT EXISTS access_tokens_client_id_idx ON access_tokens(client_id) WHERE client_id <> 0;
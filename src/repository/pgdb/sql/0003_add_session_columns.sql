@@ -0,0 +1,6 @@
+-- Session metadata of the access tokens
+ALTER TABLE access_tokens
+    ADD COLUMN IF NOT EXISTS created bigint NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS last_used bigint NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS user_agent text NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS remote_ip text NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+-- Cap of the sliding expiration of the access tokens
+ALTER TABLE access_tokens ADD COLUMN IF NOT EXISTS max_expires bigint NOT NULL DEFAULT 0;
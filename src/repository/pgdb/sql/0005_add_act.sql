@@ -0,0 +1,2 @@
+-- Actor of the access tokens issued by the token exchange grant
+ALTER TABLE access_tokens ADD COLUMN IF NOT EXISTS act text NOT NULL DEFAULT '';
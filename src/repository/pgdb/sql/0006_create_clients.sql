@@ -0,0 +1,8 @@
+-- Registered clients of CLIENTS_STORE=postgres, the rows of CLIENTS_FILE. Hashes are bcrypt or argon2id, clients
+-- authenticating with a certificate only leave it empty
+CREATE TABLE IF NOT EXISTS clients(
+    id bigint PRIMARY KEY,
+    name text NOT NULL UNIQUE,
+    secret_hash text NOT NULL DEFAULT '',
+    roles text[] NOT NULL DEFAULT '{}'
+);
@@ -0,0 +1,80 @@
+package redisdb
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"github.com/danielgom/bookstore_oauthapi/src/config"
+	"github.com/danielgom/bookstore_oauthapi/src/repository/db"
+	"github.com/go-redis/redis/v8"
+	"time"
+)
+
+const (
+	StoreRedis = "redis"
+
+	envRedisAddr       = "REDIS_ADDR"
+	envRedisPassword   = "REDIS_PASSWORD"
+	envRedisDB         = "REDIS_DB"
+	envRedisPoolSize   = "REDIS_POOL_SIZE"
+	envRedisTLSEnabled = "REDIS_TLS_ENABLED"
+	envRedisKeyPrefix  = "REDIS_KEY_PREFIX"
+)
+
+type Config struct {
+	// Addr is the host:port of any server speaking the Redis protocol
+	Addr     string
+	Password string
+	DB       int
+	// PoolSize of zero keeps the go-redis default of ten connections per CPU
+	PoolSize   int
+	TLSEnabled bool
+	KeyPrefix  string
+}
+
+// NewConfigFromConfig reads the REDIS_* environment variables
+func NewConfigFromConfig() Config {
+	return Config{
+		Addr:       config.GetString(envRedisAddr, "localhost:6379"),
+		Password:   config.GetString(envRedisPassword, ""),
+		DB:         config.GetInt(envRedisDB, 0),
+		PoolSize:   config.GetInt(envRedisPoolSize, 0),
+		TLSEnabled: config.GetBool(envRedisTLSEnabled, false),
+		KeyPrefix:  config.GetString(envRedisKeyPrefix, "oauth:"),
+	}
+}
+
+// Open connects to the server described by c and checks it answers
+func Open(c Config) (*redis.Client, error) {
+
+	options := &redis.Options{
+		Addr:     c.Addr,
+		Password: c.Password,
+		DB:       c.DB,
+		PoolSize: c.PoolSize,
+	}
+	if c.TLSEnabled {
+		options.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	client := redis.NewClient(options)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := client.Ping(ctx).Err(); err != nil {
+		_ = client.Close()
+		return nil, fmt.Errorf("connecting to redis: %w", err)
+	}
+	return client, nil
+}
+
+// NewRepositoryFromConfig connects with the REDIS_* configuration and returns the token repository
+func NewRepositoryFromConfig() (db.DRepository, error) {
+
+	c := NewConfigFromConfig()
+	client, err := Open(c)
+	if err != nil {
+		return nil, err
+	}
+	return NewRepository(client, c.KeyPrefix), nil
+}
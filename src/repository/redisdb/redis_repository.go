@@ -0,0 +1,377 @@
+package redisdb
+
+import (
+	"context"
+	"github.com/danielgom/bookstore_oauthapi/src/clock"
+	"github.com/danielgom/bookstore_oauthapi/src/domain/accesstoken"
+	"github.com/danielgom/bookstore_oauthapi/src/logger"
+	"github.com/danielgom/bookstore_oauthapi/src/metrics"
+	"github.com/danielgom/bookstore_oauthapi/src/repository/db"
+	"github.com/danielgom/bookstore_utils-go/errors"
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+	"strconv"
+	"time"
+)
+
+// The token hash and its index entries are written by scripts so a reader never sees one without the other.
+// KEYS[1] is the token hash and the following keys the user and client indexes, sorted sets of token ids scored
+// by expiry. Entries expired before ARGV[now] are pruned on every write and each index expires with its
+// longest-lived token
+const (
+	// ARGV: token, userId, clientId, expires, scope, now, created, lastUsed, userAgent, remoteIp, maxExpires, act
+	scriptCreateAccessToken = `-- create access token
+redis.call('DEL', KEYS[1])
+redis.call('HSET', KEYS[1], 'userId', ARGV[2], 'clientId', ARGV[3], 'expires', ARGV[4], 'scope', ARGV[5],
+	'created', ARGV[7], 'lastUsed', ARGV[8], 'userAgent', ARGV[9], 'remoteIp', ARGV[10], 'maxExpires', ARGV[11],
+	'act', ARGV[12])
+redis.call('EXPIREAT', KEYS[1], ARGV[4])
+for i = 2, #KEYS do
+	redis.call('ZREMRANGEBYSCORE', KEYS[i], '-inf', '(' .. ARGV[6])
+	redis.call('ZADD', KEYS[i], ARGV[4], ARGV[1])
+	local last = redis.call('ZREVRANGE', KEYS[i], 0, 0, 'WITHSCORES')
+	redis.call('EXPIREAT', KEYS[i], last[2])
+end
+return 1`
+
+	// ARGV: token, expires, now. Returns 0 when the token does not exist
+	scriptUpdateExpires = `-- update access token expires
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+redis.call('HSET', KEYS[1], 'expires', ARGV[2])
+redis.call('EXPIREAT', KEYS[1], ARGV[2])
+for i = 2, #KEYS do
+	redis.call('ZREMRANGEBYSCORE', KEYS[i], '-inf', '(' .. ARGV[3])
+	redis.call('ZADD', KEYS[i], ARGV[2], ARGV[1])
+	local last = redis.call('ZREVRANGE', KEYS[i], 0, 0, 'WITHSCORES')
+	redis.call('EXPIREAT', KEYS[i], last[2])
+end
+return 1`
+
+	// KEYS[1] is the token hash, ARGV: lastUsed. Returns 0 when the token does not exist
+	scriptUpdateLastUsed = `-- update access token last used
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+redis.call('HSET', KEYS[1], 'lastUsed', ARGV[1])
+return 1`
+)
+
+var (
+	createAccessToken = redis.NewScript(scriptCreateAccessToken)
+	updateExpires     = redis.NewScript(scriptUpdateExpires)
+	updateLastUsed    = redis.NewScript(scriptUpdateLastUsed)
+)
+
+// NewRepository stores the tokens in client under keyPrefix. Each token expires natively at its Expires time,
+// so an expired token is not found instead of being returned as expired
+func NewRepository(client redis.UniversalClient, keyPrefix string) db.DRepository {
+	return &repository{client: client, keyPrefix: keyPrefix, clock: clock.System}
+}
+
+type repository struct {
+	client    redis.UniversalClient
+	keyPrefix string
+	clock     clock.Clock
+}
+
+func (r *repository) tokenKey(id string) string {
+	return r.keyPrefix + "at:" + id
+}
+
+func (r *repository) userIndexKey(userId int64) string {
+	return r.keyPrefix + "user:" + strconv.FormatInt(userId, 10) + ":at"
+}
+
+func (r *repository) clientIndexKey(clientId int64) string {
+	return r.keyPrefix + "client:" + strconv.FormatInt(clientId, 10) + ":at"
+}
+
+// keys returns the token key followed by its index keys, tokens without client are only indexed by user
+func (r *repository) keys(id string, userId, clientId int64) []string {
+	keys := []string{r.tokenKey(id), r.userIndexKey(userId)}
+	if clientId != 0 {
+		keys = append(keys, r.clientIndexKey(clientId))
+	}
+	return keys
+}
+
+func (r *repository) GetByID(ctx context.Context, id string) (*accesstoken.AccessToken, errors.RestErr) {
+
+	start := time.Now()
+	fields, err := r.client.HGetAll(ctx, r.tokenKey(id)).Result()
+	observeCommand(ctx, "HGETALL", start, err)
+
+	if err != nil {
+		return nil, errors.NewInternalServerError("error retrieving access token", err)
+	}
+
+	tk, err := parseToken(id, fields)
+	if err != nil {
+		return nil, errors.NewInternalServerError("error retrieving access token", err)
+	}
+	if tk == nil {
+		return nil, errors.NewNotFoundError("No access token found with given id")
+	}
+
+	return tk, nil
+}
+
+func (r *repository) Create(ctx context.Context, at *accesstoken.AccessToken) errors.RestErr {
+
+	start := time.Now()
+	err := createAccessToken.Run(ctx, r.client, r.keys(at.AccessToken, at.UserId, at.ClientId),
+		at.AccessToken, at.UserId, at.ClientId, at.Expires, at.Scope, r.clock.Now().Unix(),
+		at.Created, at.LastUsed, at.UserAgent, at.RemoteIp, at.MaxExpires, accesstoken.EncodeActor(at.Act)).Err()
+	observeCommand(ctx, "scriptCreateAccessToken", start, err)
+
+	if err != nil {
+		return errors.NewInternalServerError(" error creating access token", err)
+	}
+
+	return nil
+}
+
+func (r *repository) UpdateExpirationTime(ctx context.Context, at *accesstoken.AccessToken) errors.RestErr {
+
+	// the indexes are keyed by the stored owner, the one of at may be missing
+	start := time.Now()
+	owner, err := r.client.HMGet(ctx, r.tokenKey(at.AccessToken), "userId", "clientId").Result()
+	observeCommand(ctx, "HMGET", start, err)
+
+	if err != nil {
+		return errors.NewInternalServerError("error updating access token", err)
+	}
+
+	userId, userErr := strconv.ParseInt(stringValue(owner[0]), 10, 64)
+	clientId, clientErr := strconv.ParseInt(stringValue(owner[1]), 10, 64)
+	if userErr != nil || clientErr != nil {
+		return errors.NewNotFoundError("No access token found with given id")
+	}
+
+	start = time.Now()
+	updated, err := updateExpires.Run(ctx, r.client, r.keys(at.AccessToken, userId, clientId),
+		at.AccessToken, at.Expires, r.clock.Now().Unix()).Int64()
+	observeCommand(ctx, "scriptUpdateExpires", start, err)
+
+	if err != nil {
+		return errors.NewInternalServerError("error updating access token", err)
+	}
+
+	if updated == 0 {
+		return errors.NewNotFoundError("No access token found with given id")
+	}
+
+	return nil
+}
+
+func (r *repository) UpdateLastUsed(ctx context.Context, at *accesstoken.AccessToken) errors.RestErr {
+
+	start := time.Now()
+	updated, err := updateLastUsed.Run(ctx, r.client, []string{r.tokenKey(at.AccessToken)}, at.LastUsed).Int64()
+	observeCommand(ctx, "scriptUpdateLastUsed", start, err)
+
+	if err != nil {
+		return errors.NewInternalServerError("error updating access token", err)
+	}
+
+	if updated == 0 {
+		return errors.NewNotFoundError("No access token found with given id")
+	}
+
+	return nil
+}
+
+// Delete leaves the index entries of the token to expire, readers skip entries without token
+func (r *repository) Delete(ctx context.Context, id string) errors.RestErr {
+
+	start := time.Now()
+	deleted, err := r.client.Del(ctx, r.tokenKey(id)).Result()
+	observeCommand(ctx, "DEL", start, err)
+
+	if err != nil {
+		return errors.NewInternalServerError("error deleting access token", err)
+	}
+
+	if deleted == 0 {
+		return errors.NewNotFoundError("No access token found with given id")
+	}
+
+	return nil
+}
+
+func (r *repository) ListByUser(ctx context.Context, userId int64) ([]accesstoken.AccessToken, errors.RestErr) {
+
+	start := time.Now()
+	ids, err := r.client.ZRangeByScore(ctx, r.userIndexKey(userId),
+		&redis.ZRangeBy{Min: strconv.FormatInt(r.clock.Now().Unix(), 10), Max: "+inf"}).Result()
+	observeCommand(ctx, "ZRANGEBYSCORE", start, err)
+
+	if err != nil {
+		return nil, errors.NewInternalServerError("error retrieving access tokens", err)
+	}
+
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	start = time.Now()
+	cmds := make([]*redis.StringStringMapCmd, len(ids))
+	_, err = r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, id := range ids {
+			cmds[i] = pipe.HGetAll(ctx, r.tokenKey(id))
+		}
+		return nil
+	})
+	observeCommand(ctx, "HGETALL", start, err)
+
+	if err != nil {
+		return nil, errors.NewInternalServerError("error retrieving access tokens", err)
+	}
+
+	tokens := make([]accesstoken.AccessToken, 0, len(ids))
+	for i, cmd := range cmds {
+		tk, err := parseToken(ids[i], cmd.Val())
+		if err != nil {
+			return nil, errors.NewInternalServerError("error retrieving access tokens", err)
+		}
+		// the entry outlives a token deleted or replaced for another user
+		if tk != nil && tk.UserId == userId {
+			tokens = append(tokens, *tk)
+		}
+	}
+
+	return tokens, nil
+}
+
+func (r *repository) DeleteByUser(ctx context.Context, userId int64) (int, errors.RestErr) {
+	return r.deleteIndexed(ctx, r.userIndexKey(userId), func(ownerUserId, _ int64) bool { return ownerUserId == userId })
+}
+
+func (r *repository) DeleteByClient(ctx context.Context, clientId int64) (int, errors.RestErr) {
+	return r.deleteIndexed(ctx, r.clientIndexKey(clientId), func(_, ownerClientId int64) bool { return ownerClientId == clientId })
+}
+
+// deleteIndexed deletes the tokens of indexKey still owned as the index says and removes their entries. A token
+// created meanwhile keeps its entry. The entries of the deleted tokens in their other index are left to expire
+func (r *repository) deleteIndexed(ctx context.Context, indexKey string, owned func(userId, clientId int64) bool) (int, errors.RestErr) {
+
+	start := time.Now()
+	ids, err := r.client.ZRange(ctx, indexKey, 0, -1).Result()
+	observeCommand(ctx, "ZRANGE", start, err)
+
+	if err != nil {
+		return 0, errors.NewInternalServerError("error deleting access tokens", err)
+	}
+
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	start = time.Now()
+	owners := make([]*redis.SliceCmd, len(ids))
+	_, err = r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, id := range ids {
+			owners[i] = pipe.HMGet(ctx, r.tokenKey(id), "userId", "clientId")
+		}
+		return nil
+	})
+	observeCommand(ctx, "HMGET", start, err)
+
+	if err != nil {
+		return 0, errors.NewInternalServerError("error deleting access tokens", err)
+	}
+
+	start = time.Now()
+	var deletes []*redis.IntCmd
+	_, err = r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		members := make([]interface{}, len(ids))
+		for i, id := range ids {
+			members[i] = id
+			owner := owners[i].Val()
+			userId, userErr := strconv.ParseInt(stringValue(owner[0]), 10, 64)
+			clientId, clientErr := strconv.ParseInt(stringValue(owner[1]), 10, 64)
+			if userErr == nil && clientErr == nil && owned(userId, clientId) {
+				deletes = append(deletes, pipe.Del(ctx, r.tokenKey(id)))
+			}
+		}
+		pipe.ZRem(ctx, indexKey, members...)
+		return nil
+	})
+	observeCommand(ctx, "DEL", start, err)
+
+	if err != nil {
+		return 0, errors.NewInternalServerError("error deleting access tokens", err)
+	}
+
+	deleted := 0
+	for _, cmd := range deletes {
+		deleted += int(cmd.Val())
+	}
+
+	return deleted, nil
+}
+
+// parseToken reads the token id from the fields of its hash, it returns nil when there is none
+func parseToken(id string, fields map[string]string) (*accesstoken.AccessToken, error) {
+
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	var err error
+	tk := &accesstoken.AccessToken{AccessToken: id, Scope: fields["scope"],
+		UserAgent: fields["userAgent"], RemoteIp: fields["remoteIp"]}
+	if tk.UserId, err = strconv.ParseInt(fields["userId"], 10, 64); err != nil {
+		return nil, err
+	}
+	if tk.ClientId, err = strconv.ParseInt(fields["clientId"], 10, 64); err != nil {
+		return nil, err
+	}
+	if tk.Expires, err = strconv.ParseInt(fields["expires"], 10, 64); err != nil {
+		return nil, err
+	}
+	// tokens stored before these fields were recorded have none
+	if tk.Created, err = optionalInt(fields["created"]); err != nil {
+		return nil, err
+	}
+	if tk.LastUsed, err = optionalInt(fields["lastUsed"]); err != nil {
+		return nil, err
+	}
+	if tk.MaxExpires, err = optionalInt(fields["maxExpires"]); err != nil {
+		return nil, err
+	}
+	if tk.Act, err = accesstoken.DecodeActor(fields["act"]); err != nil {
+		return nil, err
+	}
+
+	return tk, nil
+}
+
+// optionalInt parses a numeric field, zero when the field is missing
+func optionalInt(field string) (int64, error) {
+	if field == "" {
+		return 0, nil
+	}
+	return strconv.ParseInt(field, 10, 64)
+}
+
+// stringValue returns the string of a HMGET field, empty when the field is missing
+func stringValue(field interface{}) string {
+	s, _ := field.(string)
+	return s
+}
+
+// observeCommand records the command latency and logs failed commands, a missing key is not a failure
+func observeCommand(ctx context.Context, command string, start time.Time, err error) {
+	if err == redis.Nil {
+		err = nil
+	}
+	metrics.ObserveRedisCommand(command, start, err)
+
+	if err != nil {
+		logger.FromContext(ctx).Error("redis command failed",
+			zap.String("command", command), zap.Duration("latency", time.Since(start)), zap.Error(err))
+	}
+}
@@ -0,0 +1,112 @@
+package redisdb
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/danielgom/bookstore_oauthapi/src/domain/accesstoken"
+	"github.com/danielgom/bookstore_oauthapi/src/repository/db"
+	"github.com/danielgom/bookstore_oauthapi/src/repository/db/dbtest"
+	"github.com/go-redis/redis/v8"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// newTestRepository returns a repository on an empty in-process server
+func newTestRepository(t *testing.T) (db.DRepository, *miniredis.Miniredis) {
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Close)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	return NewRepository(client, "oauth:"), server
+}
+
+func TestRepositoryConformance(t *testing.T) {
+	dbtest.RunConformance(t, func(t *testing.T) db.DRepository {
+		repository, _ := newTestRepository(t)
+		return repository
+	})
+}
+
+func assertTTL(t *testing.T, server *miniredis.Miniredis, key string, expected time.Duration) {
+	t.Helper()
+	if ttl := server.TTL(key); ttl < expected-5*time.Second || ttl > expected {
+		t.Errorf("TTL of %s expected: %v, received: %v", key, expected, ttl)
+	}
+}
+
+func TestCreateSetsTTLAndIndexes(t *testing.T) {
+
+	repository, server := newTestRepository(t)
+	ctx := context.Background()
+
+	_ = repository.Create(ctx, &accesstoken.AccessToken{AccessToken: "abc123", UserId: 1, ClientId: 2, Expires: time.Now().Add(time.Hour).Unix()})
+	_ = repository.Create(ctx, &accesstoken.AccessToken{AccessToken: "def456", UserId: 1, Expires: time.Now().Add(2 * time.Hour).Unix()})
+
+	assertTTL(t, server, "oauth:at:abc123", time.Hour)
+	assertTTL(t, server, "oauth:user:1:at", 2*time.Hour)
+	assertTTL(t, server, "oauth:client:2:at", time.Hour)
+
+	if members, _ := server.ZMembers("oauth:user:1:at"); len(members) != 2 {
+		t.Errorf("User index should hold both tokens, received %v", members)
+	}
+	if members, _ := server.ZMembers("oauth:client:2:at"); len(members) != 1 || members[0] != "abc123" {
+		t.Errorf("Client index should hold abc123, received %v", members)
+	}
+	if server.Exists("oauth:client:0:at") {
+		t.Error("Tokens without client should not be indexed by client")
+	}
+}
+
+func TestExpiredTokensAreNotFound(t *testing.T) {
+
+	repository, server := newTestRepository(t)
+	ctx := context.Background()
+
+	_ = repository.Create(ctx, &accesstoken.AccessToken{AccessToken: "abc123", UserId: 1, Expires: time.Now().Add(time.Hour).Unix()})
+	_ = repository.Create(ctx, &accesstoken.AccessToken{AccessToken: "def456", UserId: 1, Expires: time.Now().Add(-time.Minute).Unix()})
+
+	if _, err := repository.GetByID(ctx, "def456"); err == nil || err.Status() != http.StatusNotFound {
+		t.Errorf("Status returned should be 404, received %v", err)
+	}
+
+	server.FastForward(2 * time.Hour)
+
+	if _, err := repository.GetByID(ctx, "abc123"); err == nil || err.Status() != http.StatusNotFound {
+		t.Errorf("Status returned should be 404, received %v", err)
+	}
+	if server.Exists("oauth:user:1:at") {
+		t.Error("User index should expire with its last token")
+	}
+}
+
+func TestUpdateExpirationTimeExtendsTTL(t *testing.T) {
+
+	repository, server := newTestRepository(t)
+	ctx := context.Background()
+
+	_ = repository.Create(ctx, &accesstoken.AccessToken{AccessToken: "abc123", UserId: 1, ClientId: 2, Expires: time.Now().Add(time.Hour).Unix()})
+
+	// the stored owner is used when the request omits it
+	err := repository.UpdateExpirationTime(ctx, &accesstoken.AccessToken{AccessToken: "abc123", Expires: time.Now().Add(3 * time.Hour).Unix()})
+	if err != nil {
+		t.Fatalf("error should be nil, received %v", err)
+	}
+
+	assertTTL(t, server, "oauth:at:abc123", 3*time.Hour)
+	assertTTL(t, server, "oauth:user:1:at", 3*time.Hour)
+	assertTTL(t, server, "oauth:client:2:at", 3*time.Hour)
+}
+
+func TestRedisUnavailable(t *testing.T) {
+
+	repository, server := newTestRepository(t)
+	server.Close()
+
+	if _, err := repository.GetByID(context.Background(), "abc123"); err == nil || err.Status() != http.StatusInternalServerError {
+		t.Errorf("Status returned should be 500, received %v", err)
+	}
+}
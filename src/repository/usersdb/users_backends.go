@@ -0,0 +1,71 @@
+package usersdb
+
+import (
+	"errors"
+	"fmt"
+	"github.com/danielgom/bookstore_oauthapi/src/config"
+	"github.com/danielgom/bookstore_oauthapi/src/repository/db"
+)
+
+const (
+	BackendHTTP     = "http"
+	BackendLDAP     = "ldap"
+	BackendLocal    = "local"
+	BackendHtpasswd = "htpasswd"
+
+	envUsersBackends         = "USERS_BACKENDS"
+	envUsersLDAPURL          = "USERS_LDAP_URL"
+	envUsersLDAPBindDN       = "USERS_LDAP_BIND_DN"
+	envUsersLDAPBindPassword = "USERS_LDAP_BIND_PASSWORD"
+	envUsersLDAPBaseDN       = "USERS_LDAP_BASE_DN"
+	envUsersLDAPFilter       = "USERS_LDAP_FILTER"
+	envUsersLDAPIDAttribute  = "USERS_LDAP_ID_ATTRIBUTE"
+	envUsersHtpasswdFile     = "USERS_HTPASSWD_FILE"
+)
+
+// NewRepositoryFromConfig builds the users repository from USERS_BACKENDS, a comma separated
+// list of backends tried in order. It defaults to the bookstore users API.
+func NewRepositoryFromConfig() (UsersRepository, error) {
+
+	backends := config.GetStrings(envUsersBackends, []string{BackendHTTP})
+
+	repositories := make([]UsersRepository, 0, len(backends))
+	for _, backend := range backends {
+		repository, err := newBackend(backend)
+		if err != nil {
+			return nil, err
+		}
+		repositories = append(repositories, repository)
+	}
+
+	if len(repositories) == 1 {
+		return repositories[0], nil
+	}
+
+	return NewChainRepository(repositories...), nil
+}
+
+func newBackend(backend string) (UsersRepository, error) {
+	switch backend {
+	case BackendHTTP:
+		return NewRepository(), nil
+	case BackendLDAP:
+		return NewLDAPRepository(LDAPConfig{
+			URL:          config.GetString(envUsersLDAPURL, "ldap://localhost:389"),
+			BindDN:       config.GetString(envUsersLDAPBindDN, ""),
+			BindPassword: config.GetString(envUsersLDAPBindPassword, ""),
+			BaseDN:       config.GetString(envUsersLDAPBaseDN, ""),
+			Filter:       config.GetString(envUsersLDAPFilter, ""),
+			IDAttribute:  config.GetString(envUsersLDAPIDAttribute, ""),
+		}), nil
+	case BackendLocal:
+		if db.Session == nil {
+			return nil, errors.New("the local users backend needs TOKEN_STORE=cassandra")
+		}
+		return NewLocalRepository(), nil
+	case BackendHtpasswd:
+		return NewHtpasswdRepository(config.GetString(envUsersHtpasswdFile, "users.htpasswd"))
+	default:
+		return nil, fmt.Errorf("unknown users backend %q", backend)
+	}
+}
@@ -0,0 +1,36 @@
+package usersdb
+
+import (
+	"context"
+	"github.com/danielgom/bookstore_oauthapi/src/domain/users"
+	"github.com/danielgom/bookstore_utils-go/errors"
+	"net/http"
+)
+
+// NewChainRepository tries the repositories in order until one knows the user. Its answer is final, a wrong password
+// or an unavailable backend is returned without trying the next ones
+func NewChainRepository(repositories ...UsersRepository) UsersRepository {
+	return &chainUsersRepository{repositories}
+}
+
+type chainUsersRepository struct {
+	repositories []UsersRepository
+}
+
+func (c *chainUsersRepository) LoginUser(ctx context.Context, email, password string) (*users.User, errors.RestErr) {
+
+	if len(c.repositories) == 0 {
+		return nil, errors.NewInternalServerError("No users backend configured", nil)
+	}
+
+	var lastErr errors.RestErr
+	for _, repository := range c.repositories {
+		user, err := repository.LoginUser(ctx, email, password)
+		if err == nil || err.Status() != http.StatusNotFound {
+			return user, err
+		}
+		lastErr = err
+	}
+
+	return nil, lastErr
+}
@@ -0,0 +1,100 @@
+package usersdb
+
+import (
+	"context"
+	"github.com/danielgom/bookstore_oauthapi/src/domain/users"
+	"github.com/danielgom/bookstore_utils-go/errors"
+	"testing"
+)
+
+type MockLoginUser func(email, password string) (*users.User, errors.RestErr)
+
+type MockUsersRepository struct {
+	MockLoginUser MockLoginUser
+	calls         int
+}
+
+func (m *MockUsersRepository) LoginUser(_ context.Context, email, password string) (*users.User, errors.RestErr) {
+	m.calls++
+	return m.MockLoginUser(email, password)
+}
+
+func TestChainLoginUser(t *testing.T) {
+
+	notFound := func(string, string) (*users.User, errors.RestErr) {
+		return nil, errors.NewNotFoundError("Username with email test@gmail.com not found")
+	}
+	found := func(email, _ string) (*users.User, errors.RestErr) {
+		return &users.User{Id: 7, Email: email}, nil
+	}
+
+	t.Run("Should return the first successful login", func(t *testing.T) {
+		first := &MockUsersRepository{MockLoginUser: notFound}
+		second := &MockUsersRepository{MockLoginUser: found}
+		third := &MockUsersRepository{MockLoginUser: found}
+
+		user, err := NewChainRepository(first, second, third).LoginUser(context.Background(), "test@gmail.com", "the_password")
+
+		if err != nil {
+			t.Fatal("error should be nil")
+		}
+		if user.Id != 7 {
+			t.Errorf("Expected: %d, Received: %d", 7, user.Id)
+		}
+		if first.calls != 1 || second.calls != 1 || third.calls != 0 {
+			t.Errorf("Unexpected calls %d, %d, %d", first.calls, second.calls, third.calls)
+		}
+	})
+
+	t.Run("Should stop on invalid credentials", func(t *testing.T) {
+		first := &MockUsersRepository{MockLoginUser: func(string, string) (*users.User, errors.RestErr) {
+			return nil, errors.NewBadRequestError("Invalid email or password")
+		}}
+		second := &MockUsersRepository{MockLoginUser: notFound}
+
+		user, err := NewChainRepository(first, second).LoginUser(context.Background(), "test@gmail.com", "the_password")
+
+		if user != nil {
+			t.Error("User should be a nil value")
+		}
+		if err == nil || err.Status() != 400 {
+			t.Error("Status returned should be 400")
+		}
+		if second.calls != 0 {
+			t.Error("The next backend should not be tried once the user is known")
+		}
+	})
+
+	t.Run("Should report an unavailable backend", func(t *testing.T) {
+		first := &MockUsersRepository{MockLoginUser: func(string, string) (*users.User, errors.RestErr) {
+			return nil, errors.NewInternalServerError("Error when trying to connect to the LDAP server", nil)
+		}}
+		second := &MockUsersRepository{MockLoginUser: found}
+
+		_, err := NewChainRepository(first, second).LoginUser(context.Background(), "test@gmail.com", "the_password")
+
+		if err == nil || err.Status() != 500 {
+			t.Error("Status returned should be 500")
+		}
+		if second.calls != 0 {
+			t.Error("The next backend should not be tried when one is unavailable")
+		}
+	})
+
+	t.Run("Should return not found when no backend knows the user", func(t *testing.T) {
+		user, err := NewChainRepository(&MockUsersRepository{MockLoginUser: notFound}, &MockUsersRepository{MockLoginUser: notFound}).
+			LoginUser(context.Background(), "test@gmail.com", "the_password")
+
+		if user != nil || err == nil || err.Status() != 404 {
+			t.Errorf("Expected not found, received %v", err)
+		}
+	})
+
+	t.Run("Should throw error without backends", func(t *testing.T) {
+		_, err := NewChainRepository().LoginUser(context.Background(), "test@gmail.com", "the_password")
+
+		if err == nil || err.Status() != 500 {
+			t.Error("Status returned should be 500")
+		}
+	})
+}
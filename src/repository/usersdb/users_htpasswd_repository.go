@@ -0,0 +1,94 @@
+package usersdb
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/danielgom/bookstore_oauthapi/src/domain/users"
+	"github.com/danielgom/bookstore_oauthapi/src/utils/cryptoutils"
+	"github.com/danielgom/bookstore_utils-go/errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type htpasswdEntry struct {
+	hash string
+	user users.User
+}
+
+// NewHtpasswdRepository loads a development credentials file, one user per line:
+//
+//	email:hash:id[:firstName[:lastName]]
+//
+// Blank lines and lines starting with # are ignored. Hashes must be bcrypt or argon2id.
+func NewHtpasswdRepository(path string) (UsersRepository, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return newHtpasswdRepository(file)
+}
+
+func newHtpasswdRepository(r io.Reader) (UsersRepository, error) {
+	entries := make(map[string]htpasswdEntry)
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Split(text, ":")
+		if len(fields) < 3 || len(fields) > 5 {
+			return nil, fmt.Errorf("htpasswd line %d: expected email:hash:id[:firstName[:lastName]]", line)
+		}
+
+		id, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("htpasswd line %d: invalid user id %q", line, fields[2])
+		}
+
+		entry := htpasswdEntry{hash: fields[1], user: users.User{Id: id, Email: fields[0]}}
+		if len(fields) > 3 {
+			entry.user.FirstName = fields[3]
+		}
+		if len(fields) > 4 {
+			entry.user.LastName = fields[4]
+		}
+		entries[fields[0]] = entry
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return &htpasswdUsersRepository{entries}, nil
+}
+
+type htpasswdUsersRepository struct {
+	entries map[string]htpasswdEntry
+}
+
+func (h *htpasswdUsersRepository) LoginUser(ctx context.Context, email, password string) (*users.User, errors.RestErr) {
+
+	entry, ok := h.entries[email]
+	if !ok {
+		compareDummyHash(password)
+		return nil, userNotFound()
+	}
+
+	if err := cryptoutils.ComparePasswordHash(entry.hash, password); err != nil {
+		if err == cryptoutils.ErrPasswordMismatch {
+			return nil, errors.NewBadRequestError("Invalid email or password")
+		}
+		return nil, errors.NewInternalServerError("Error when trying to verify user credentials", err)
+	}
+
+	user := entry.user
+	return &user, nil
+}
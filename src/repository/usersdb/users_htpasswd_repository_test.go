@@ -0,0 +1,92 @@
+package usersdb
+
+import (
+	"context"
+	"fmt"
+	"github.com/danielgom/bookstore_oauthapi/src/utils/cryptoutils"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHtpasswdLoginUser(t *testing.T) {
+
+	bcryptHash, _ := cryptoutils.GetBcrypt("the_password")
+	argon2Hash, _ := cryptoutils.GetArgon2("other_password")
+
+	file := fmt.Sprintf("# dev users\n\ndaniel@gmail.com:%s:1:Daniel:Gomez\nadmin@gmail.com:%s:2\n", bcryptHash, argon2Hash)
+
+	repository, err := newHtpasswdRepository(strings.NewReader(file))
+	if err != nil {
+		t.Fatalf("error should be nil, received %v", err)
+	}
+
+	t.Run("Should return the user with a bcrypt hash", func(t *testing.T) {
+		user, err := repository.LoginUser(context.Background(), "daniel@gmail.com", "the_password")
+
+		if err != nil {
+			t.Fatal("error should be nil")
+		}
+		if user.Id != 1 || user.FirstName != "Daniel" || user.LastName != "Gomez" {
+			t.Errorf("Unexpected user %+v", user)
+		}
+	})
+
+	t.Run("Should return the user with an argon2 hash", func(t *testing.T) {
+		user, err := repository.LoginUser(context.Background(), "admin@gmail.com", "other_password")
+
+		if err != nil {
+			t.Fatal("error should be nil")
+		}
+		if user.Id != 2 || user.Email != "admin@gmail.com" {
+			t.Errorf("Unexpected user %+v", user)
+		}
+	})
+
+	t.Run("Should return bad request on invalid password", func(t *testing.T) {
+		_, err := repository.LoginUser(context.Background(), "daniel@gmail.com", "wrong_password")
+
+		if err == nil || err.Status() != 400 {
+			t.Error("Status returned should be 400")
+		}
+	})
+
+	t.Run("Should return not found on unknown email", func(t *testing.T) {
+		_, err := repository.LoginUser(context.Background(), "unknown@gmail.com", "the_password")
+
+		if err == nil || err.Status() != 404 {
+			t.Error("Status returned should be 404")
+		}
+	})
+}
+
+func TestNewHtpasswdRepository(t *testing.T) {
+
+	t.Run("Should throw error on malformed lines", func(t *testing.T) {
+		if _, err := newHtpasswdRepository(strings.NewReader("daniel@gmail.com:hash\n")); err == nil {
+			t.Error("error should not be nil")
+		}
+
+		if _, err := newHtpasswdRepository(strings.NewReader("daniel@gmail.com:hash:abc\n")); err == nil {
+			t.Error("error should not be nil")
+		}
+	})
+
+	t.Run("Should load the file from disk", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "users.htpasswd")
+		if err := os.WriteFile(path, []byte("daniel@gmail.com:$2a$10$hash:1\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := NewHtpasswdRepository(path); err != nil {
+			t.Errorf("error should be nil, received %v", err)
+		}
+	})
+
+	t.Run("Should throw error when the file does not exist", func(t *testing.T) {
+		if _, err := NewHtpasswdRepository(filepath.Join(t.TempDir(), "missing")); err == nil {
+			t.Error("error should not be nil")
+		}
+	})
+}
@@ -0,0 +1,110 @@
+package usersdb
+
+import (
+	"context"
+	"fmt"
+	"github.com/danielgom/bookstore_oauthapi/src/domain/users"
+	"github.com/danielgom/bookstore_utils-go/errors"
+	"github.com/go-ldap/ldap/v3"
+	"strconv"
+)
+
+const (
+	defaultLDAPFilter      = "(&(objectClass=person)(mail=%s))"
+	defaultLDAPIDAttribute = "uidNumber"
+)
+
+// LDAPConn is the subset of *ldap.Conn used by the LDAP repository
+type LDAPConn interface {
+	Bind(string, string) error
+	Search(*ldap.SearchRequest) (*ldap.SearchResult, error)
+	Close()
+}
+
+type LDAPDialer func(string) (LDAPConn, error)
+
+var (
+	DialLDAP LDAPDialer = func(url string) (LDAPConn, error) {
+		return ldap.DialURL(url)
+	}
+)
+
+type LDAPConfig struct {
+	URL          string
+	BindDN       string
+	BindPassword string
+	BaseDN       string
+	// Filter must contain a single %s which is replaced by the escaped email
+	Filter      string
+	IDAttribute string
+}
+
+func NewLDAPRepository(config LDAPConfig) UsersRepository {
+	if config.Filter == "" {
+		config.Filter = defaultLDAPFilter
+	}
+	if config.IDAttribute == "" {
+		config.IDAttribute = defaultLDAPIDAttribute
+	}
+	return &ldapUsersRepository{config}
+}
+
+type ldapUsersRepository struct {
+	config LDAPConfig
+}
+
+func (l *ldapUsersRepository) LoginUser(ctx context.Context, email, password string) (*users.User, errors.RestErr) {
+
+	if email == "" || password == "" {
+		return nil, errors.NewBadRequestError("Invalid email or password")
+	}
+
+	conn, err := DialLDAP(l.config.URL)
+	if err != nil {
+		return nil, errors.NewInternalServerError("Error when trying to connect to the LDAP server", err)
+	}
+	defer conn.Close()
+
+	if l.config.BindDN != "" {
+		if err = conn.Bind(l.config.BindDN, l.config.BindPassword); err != nil {
+			return nil, errors.NewInternalServerError("Error when trying to bind the LDAP service account", err)
+		}
+	}
+
+	result, err := conn.Search(ldap.NewSearchRequest(l.config.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		2, 0, false, fmt.Sprintf(l.config.Filter, ldap.EscapeFilter(email)),
+		[]string{"dn", "mail", "givenName", "sn", l.config.IDAttribute}, nil))
+	if err != nil {
+		return nil, errors.NewInternalServerError("Error when trying to search the user in LDAP", err)
+	}
+
+	if len(result.Entries) == 0 {
+		return nil, userNotFound()
+	}
+
+	if len(result.Entries) > 1 {
+		return nil, errors.NewInternalServerError("Error when trying to search the user in LDAP",
+			fmt.Errorf("%d entries found for email %s", len(result.Entries), email))
+	}
+
+	entry := result.Entries[0]
+
+	if err = conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, errors.NewBadRequestError("Invalid email or password")
+		}
+		return nil, errors.NewInternalServerError("Error when trying to bind the user in LDAP", err)
+	}
+
+	id, err := strconv.ParseInt(entry.GetAttributeValue(l.config.IDAttribute), 10, 64)
+	if err != nil {
+		return nil, errors.NewInternalServerError("Invalid user id attribute in LDAP entry", err)
+	}
+
+	return &users.User{
+		Id:        id,
+		FirstName: entry.GetAttributeValue("givenName"),
+		LastName:  entry.GetAttributeValue("sn"),
+		Email:     email,
+	}, nil
+}
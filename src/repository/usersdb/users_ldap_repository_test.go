@@ -0,0 +1,164 @@
+package usersdb
+
+import (
+	"context"
+	errors2 "errors"
+	"fmt"
+	"github.com/go-ldap/ldap/v3"
+	"strings"
+	"testing"
+)
+
+// stubDirectory is an in-process LDAP directory keyed by DN
+type stubDirectory struct {
+	passwords map[string]string
+	entries   []*ldap.Entry
+	dialErr   error
+}
+
+type stubLDAPConn struct {
+	directory *stubDirectory
+}
+
+func (s *stubLDAPConn) Bind(dn, password string) error {
+	if p, ok := s.directory.passwords[dn]; ok && p == password {
+		return nil
+	}
+	return ldap.NewError(ldap.LDAPResultInvalidCredentials, errors2.New("invalid credentials"))
+}
+
+func (s *stubLDAPConn) Search(request *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	result := new(ldap.SearchResult)
+	for _, entry := range s.directory.entries {
+		if strings.Contains(request.Filter, fmt.Sprintf("(mail=%s)", entry.GetAttributeValue("mail"))) {
+			result.Entries = append(result.Entries, entry)
+		}
+	}
+	return result, nil
+}
+
+func (s *stubLDAPConn) Close() {
+}
+
+func newStubDirectory() *stubDirectory {
+	return &stubDirectory{
+		passwords: map[string]string{
+			"cn=oauth,dc=bookstore":             "service-password",
+			"uid=daniel,ou=people,dc=bookstore": "the_password",
+			"uid=broken,ou=people,dc=bookstore": "the_password",
+		},
+		entries: []*ldap.Entry{
+			ldap.NewEntry("uid=daniel,ou=people,dc=bookstore", map[string][]string{
+				"mail":      {"daniel@gmail.com"},
+				"givenName": {"Daniel"},
+				"sn":        {"Gomez"},
+				"uidNumber": {"1"},
+			}),
+			ldap.NewEntry("uid=broken,ou=people,dc=bookstore", map[string][]string{
+				"mail":      {"broken@gmail.com"},
+				"uidNumber": {"not-a-number"},
+			}),
+		},
+	}
+}
+
+func withStubDirectory(t *testing.T, directory *stubDirectory) {
+	dial := DialLDAP
+	DialLDAP = func(string) (LDAPConn, error) {
+		if directory.dialErr != nil {
+			return nil, directory.dialErr
+		}
+		return &stubLDAPConn{directory}, nil
+	}
+	t.Cleanup(func() { DialLDAP = dial })
+}
+
+func TestLDAPLoginUser(t *testing.T) {
+
+	repository := NewLDAPRepository(LDAPConfig{
+		BindDN:       "cn=oauth,dc=bookstore",
+		BindPassword: "service-password",
+		BaseDN:       "ou=people,dc=bookstore",
+	})
+
+	t.Run("Should return the user on successful bind", func(t *testing.T) {
+		withStubDirectory(t, newStubDirectory())
+
+		user, err := repository.LoginUser(context.Background(), "daniel@gmail.com", "the_password")
+
+		if err != nil {
+			t.Fatal("error should be nil")
+		}
+		if user.Id != 1 || user.FirstName != "Daniel" || user.LastName != "Gomez" || user.Email != "daniel@gmail.com" {
+			t.Errorf("Unexpected user %+v", user)
+		}
+	})
+
+	t.Run("Should return bad request on invalid password", func(t *testing.T) {
+		withStubDirectory(t, newStubDirectory())
+
+		user, err := repository.LoginUser(context.Background(), "daniel@gmail.com", "wrong_password")
+
+		if user != nil {
+			t.Error("User should be a nil value")
+		}
+		if err == nil || err.Status() != 400 {
+			t.Error("Status returned should be 400")
+		}
+	})
+
+	t.Run("Should return not found on unknown email", func(t *testing.T) {
+		withStubDirectory(t, newStubDirectory())
+
+		_, err := repository.LoginUser(context.Background(), "unknown@gmail.com", "the_password")
+
+		if err == nil || err.Status() != 404 {
+			t.Error("Status returned should be 404")
+		}
+	})
+
+	t.Run("Should return internal server error on invalid id attribute", func(t *testing.T) {
+		withStubDirectory(t, newStubDirectory())
+
+		_, err := repository.LoginUser(context.Background(), "broken@gmail.com", "the_password")
+
+		if err == nil || err.Status() != 500 {
+			t.Error("Status returned should be 500")
+		}
+	})
+
+	t.Run("Should return internal server error when service bind fails", func(t *testing.T) {
+		directory := newStubDirectory()
+		delete(directory.passwords, "cn=oauth,dc=bookstore")
+		withStubDirectory(t, directory)
+
+		_, err := repository.LoginUser(context.Background(), "daniel@gmail.com", "the_password")
+
+		if err == nil || err.Status() != 500 {
+			t.Error("Status returned should be 500")
+		}
+	})
+
+	t.Run("Should return internal server error when server is unreachable", func(t *testing.T) {
+		directory := newStubDirectory()
+		directory.dialErr = errors2.New("connection refused")
+		withStubDirectory(t, directory)
+
+		_, err := repository.LoginUser(context.Background(), "daniel@gmail.com", "the_password")
+
+		expectedString := "Error when trying to connect to the LDAP server"
+		if err == nil || err.Message() != expectedString {
+			t.Errorf("\n Expected: %s, \n Received: %v", expectedString, err)
+		}
+	})
+
+	t.Run("Should not try to bind with an empty password", func(t *testing.T) {
+		withStubDirectory(t, newStubDirectory())
+
+		_, err := repository.LoginUser(context.Background(), "daniel@gmail.com", "")
+
+		if err == nil || err.Status() != 400 {
+			t.Error("Status returned should be 400")
+		}
+	})
+}
@@ -0,0 +1,71 @@
+package usersdb
+
+import (
+	"context"
+	"github.com/danielgom/bookstore_oauthapi/src/domain/users"
+	"github.com/danielgom/bookstore_oauthapi/src/repository/db"
+	"github.com/danielgom/bookstore_oauthapi/src/utils/cryptoutils"
+	"github.com/danielgom/bookstore_utils-go/errors"
+	"github.com/gocql/gocql"
+	"sync"
+	"time"
+)
+
+const (
+	queryGetUserCredentials = `SELECT userid, firstname, lastname, passwordhash FROM user_credentials WHERE email=?;`
+)
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
+
+// NewLocalRepository authenticates users against bcrypt/argon2 hashes stored in the user_credentials table
+func NewLocalRepository() UsersRepository {
+	return &localUsersRepository{}
+}
+
+type localUsersRepository struct {
+}
+
+func (l *localUsersRepository) LoginUser(ctx context.Context, email, password string) (*users.User, errors.RestErr) {
+
+	user := &users.User{Email: email}
+	var hash string
+
+	start := time.Now()
+	err := db.Session.Query(queryGetUserCredentials, email).WithContext(ctx).
+		Scan(&user.Id, &user.FirstName, &user.LastName, &hash)
+	db.ObserveQuery(ctx, "queryGetUserCredentials", start, err)
+
+	if err != nil {
+		if err == gocql.ErrNotFound {
+			compareDummyHash(password)
+			return nil, userNotFound()
+		}
+		return nil, errors.NewInternalServerError("Error when trying to retrieve user credentials", err)
+	}
+
+	if err := cryptoutils.ComparePasswordHash(hash, password); err != nil {
+		if err == cryptoutils.ErrPasswordMismatch {
+			return nil, errors.NewBadRequestError("Invalid email or password")
+		}
+		return nil, errors.NewInternalServerError("Error when trying to verify user credentials", err)
+	}
+
+	return user, nil
+}
+
+// compareDummyHash spends the time of a password check on an unknown email, so that the response time does not tell
+// which emails are registered
+func compareDummyHash(password string) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = cryptoutils.GetBcrypt("dummy-password")
+	})
+	_ = cryptoutils.ComparePasswordHash(dummyHash, password)
+}
+
+// userNotFound lets the chain try the next backend without echoing the email
+func userNotFound() errors.RestErr {
+	return errors.NewNotFoundError("User not found")
+}
@@ -0,0 +1,80 @@
+package usersdb
+
+import (
+	"context"
+	errors2 "errors"
+	"github.com/danielgom/bookstore_oauthapi/src/datasource/cql/cqltest"
+	"github.com/danielgom/bookstore_oauthapi/src/repository/db"
+	"github.com/danielgom/bookstore_oauthapi/src/utils/cryptoutils"
+	"strings"
+	"testing"
+)
+
+func withFakeSession(t *testing.T) *cqltest.Session {
+	session := cqltest.NewSession()
+	previous := db.Session
+	db.Session = session
+	t.Cleanup(func() { db.Session = previous })
+	return session
+}
+
+func TestLocalLoginUser(t *testing.T) {
+
+	hash, err := cryptoutils.GetBcrypt("the_password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Should return the user", func(t *testing.T) {
+		withFakeSession(t).On(queryGetUserCredentials).Row(int64(1), "Daniel", "Gomez", hash)
+
+		user, err := NewLocalRepository().LoginUser(context.Background(), "daniel@gmail.com", "the_password")
+		if err != nil {
+			t.Fatal("error should be nil")
+		}
+		if user.Id != 1 || user.FirstName != "Daniel" || user.Email != "daniel@gmail.com" {
+			t.Errorf("Unexpected user %+v", user)
+		}
+	})
+
+	t.Run("Should reject a wrong password", func(t *testing.T) {
+		withFakeSession(t).On(queryGetUserCredentials).Row(int64(1), "Daniel", "Gomez", hash)
+
+		_, err := NewLocalRepository().LoginUser(context.Background(), "daniel@gmail.com", "wrong_password")
+		if err == nil || err.Status() != 400 {
+			t.Errorf("Status returned should be 400, received %v", err)
+		}
+	})
+
+	t.Run("Should return not found", func(t *testing.T) {
+		withFakeSession(t).On(queryGetUserCredentials)
+
+		_, err := NewLocalRepository().LoginUser(context.Background(), "daniel@gmail.com", "the_password")
+		if err == nil || err.Status() != 404 {
+			t.Fatalf("Status returned should be 404, received %v", err)
+		}
+		if strings.Contains(err.Message(), "daniel@gmail.com") {
+			t.Errorf("The email should not be echoed, received %s", err.Message())
+		}
+	})
+
+	t.Run("Should map query errors", func(t *testing.T) {
+		withFakeSession(t).On(queryGetUserCredentials).Error(errors2.New("timeout"))
+
+		_, err := NewLocalRepository().LoginUser(context.Background(), "daniel@gmail.com", "the_password")
+		if err == nil || err.Status() != 500 {
+			t.Errorf("Status returned should be 500, received %v", err)
+		}
+	})
+}
+
+func TestNewLocalBackend(t *testing.T) {
+
+	previous := db.Session
+	db.Session = nil
+	defer func() { db.Session = previous }()
+
+	if _, err := newBackend(BackendLocal); err == nil {
+		t.Error("The local backend should not start without cassandra")
+	}
+}
@@ -4,13 +4,26 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"github.com/danielgom/bookstore_oauthapi/src/domain/users"
+	"github.com/danielgom/bookstore_oauthapi/src/logger"
+	"github.com/danielgom/bookstore_oauthapi/src/metrics"
+	"github.com/danielgom/bookstore_oauthapi/src/tracing"
 	"github.com/danielgom/bookstore_utils-go/errors"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
 	"io"
 	"net/http"
 	"time"
 )
 
+const (
+	usersLoginURL    = "http://localhost:8081/users/login"
+	usersURL         = "http://localhost:8081/users/%d"
+	headerXRequestID = "X-Request-Id"
+)
+
 type HTTPClient interface {
 	Do(*http.Request) (*http.Response, error)
 }
@@ -27,14 +40,24 @@ func NewRepository() UsersRepository {
 	return &usersRepository{}
 }
 
+// NewProfilesRepository reads the profiles of the users API, the other backends only authenticate users
+func NewProfilesRepository() ProfilesRepository {
+	return &usersRepository{}
+}
+
 type UsersRepository interface {
-	LoginUser(string, string) (*users.User, errors.RestErr)
+	LoginUser(context.Context, string, string) (*users.User, errors.RestErr)
+}
+
+// ProfilesRepository returns the user of an id
+type ProfilesRepository interface {
+	GetUser(context.Context, int64) (*users.User, errors.RestErr)
 }
 
 type usersRepository struct {
 }
 
-func (u *usersRepository) LoginUser(email, password string) (*users.User, errors.RestErr) {
+func (u *usersRepository) LoginUser(ctx context.Context, email, password string) (*users.User, errors.RestErr) {
 
 	request := users.LoginRequest{
 		Email:    email,
@@ -44,17 +67,63 @@ func (u *usersRepository) LoginUser(email, password string) (*users.User, errors
 	b, _ := json.Marshal(request)
 	postBody := bytes.NewBuffer(b)
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*1000)
+	ctx, span := tracing.Tracer().Start(ctx, "POST /users/login",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPMethodKey.String(http.MethodPost),
+			semconv.HTTPURLKey.String(usersLoginURL),
+		))
+	defer span.End()
+
+	return u.do(ctx, http.MethodPost, usersLoginURL, postBody, "login")
+}
+
+func (u *usersRepository) GetUser(ctx context.Context, userId int64) (*users.User, errors.RestErr) {
+
+	url := fmt.Sprintf(usersURL, userId)
+
+	ctx, span := tracing.Tracer().Start(ctx, "GET /users/:userId",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPMethodKey.String(http.MethodGet),
+			semconv.HTTPURLKey.String(url),
+		))
+	defer span.End()
+
+	return u.do(ctx, http.MethodGet, url, nil, "get")
+}
+
+// do sends a request to the users API within the span of ctx and decodes the user it answers, action names the
+// request in the error messages
+func (u *usersRepository) do(ctx context.Context, method, url string, body io.Reader, action string) (*users.User, errors.RestErr) {
+
+	span := trace.SpanFromContext(ctx)
+
+	ctx, cancel := context.WithTimeout(ctx, time.Millisecond*1000)
 	defer cancel()
 
-	r, _ := http.NewRequestWithContext(ctx, http.MethodPost, "http://localhost:8081/users/login", postBody)
+	r, _ := http.NewRequestWithContext(ctx, method, url, body)
+	tracing.InjectHeaders(ctx, r.Header)
+	if requestID := logger.RequestID(ctx); requestID != "" {
+		r.Header.Set(headerXRequestID, requestID)
+	}
 
+	log := logger.FromContext(ctx)
+
+	start := time.Now()
 	resp, err := Client.Do(r)
 
 	if err != nil {
-		return nil, errors.NewInternalServerError("Invalid response from user API while trying to login", err)
+		metrics.ObserveUsersAPI(0, start)
+		tracing.SetError(span, err)
+		log.Error("users api request failed", zap.Duration("latency", time.Since(start)), zap.Error(err))
+		return nil, errors.NewInternalServerError("Invalid response from user API while trying to "+action, err)
 	}
 
+	metrics.ObserveUsersAPI(resp.StatusCode, start)
+	log.Debug("users api responded", zap.Int("status", resp.StatusCode), zap.Duration("latency", time.Since(start)))
+	span.SetAttributes(semconv.HTTPStatusCodeKey.Int(resp.StatusCode))
+
 	defer func() {
 		err := resp.Body.Close()
 		if err != nil {
@@ -69,13 +138,15 @@ func (u *usersRepository) LoginUser(email, password string) (*users.User, errors
 
 		apiErr, err := errors.NewRestErrorFromBytes(respBody)
 		if err != nil {
-			return nil, errors.NewInternalServerError("Invalid error interface when trying to login the user", err)
+			log.Error("invalid users api error response", zap.Int("status", resp.StatusCode), zap.Error(err))
+			return nil, errors.NewInternalServerError("Invalid error interface when trying to "+action+" the user", err)
 		}
 		return nil, apiErr
 	}
 
 	user := new(users.User)
 	if err = json.Unmarshal(respBody, user); err != nil {
+		log.Error("invalid users api response", zap.Error(err))
 		return nil, errors.NewInternalServerError("Error when trying to unmarshal user response", err)
 	}
 
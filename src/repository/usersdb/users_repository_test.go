@@ -2,11 +2,17 @@ package usersdb
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"github.com/danielgom/bookstore_oauthapi/src/domain/users"
+	"github.com/danielgom/bookstore_oauthapi/src/logger"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 	"io"
 	"net/http"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -23,7 +29,7 @@ func (m *MockClient) Do(req *http.Request) (*http.Response, error) {
 func TestLoginUserTimeout(t *testing.T) {
 
 	repository := usersRepository{}
-	user, restErr := repository.LoginUser("test@gmail.com", "the-password")
+	user, restErr := repository.LoginUser(context.Background(), "test@gmail.com", "the-password")
 
 	expectedString := "Invalid response from user API while trying to login"
 
@@ -54,7 +60,7 @@ func TestLoginUserInvalidErrorInterface(t *testing.T) {
 	}
 
 	repository := usersRepository{}
-	user, restErr := repository.LoginUser("test@gmail.com", "the_password")
+	user, restErr := repository.LoginUser(context.Background(), "test@gmail.com", "the_password")
 
 	expectedString := "Invalid error interface when trying to login the user"
 
@@ -88,7 +94,7 @@ func TestLoginUserInvalidCredentials(t *testing.T) {
 	}
 
 	repository := usersRepository{}
-	user, restErr := repository.LoginUser("test@gmail.com", "the_password")
+	user, restErr := repository.LoginUser(context.Background(), "test@gmail.com", "the_password")
 
 	expectedString := "Invalid email or password"
 
@@ -122,7 +128,7 @@ func TestLoginUserEmailNotFound(t *testing.T) {
 	}
 
 	repository := usersRepository{}
-	user, restErr := repository.LoginUser("test@gmail.com", "the_password")
+	user, restErr := repository.LoginUser(context.Background(), "test@gmail.com", "the_password")
 
 	expectedString := "Username with email test@gmail.com not found"
 
@@ -156,7 +162,7 @@ func TestLoginUserInvalidJsonResponse(t *testing.T) {
 	}
 
 	repository := usersRepository{}
-	user, restErr := repository.LoginUser("test@gmail.com", "the_password")
+	user, restErr := repository.LoginUser(context.Background(), "test@gmail.com", "the_password")
 
 	expectedString := "Error when trying to unmarshal user response"
 
@@ -197,7 +203,7 @@ func TestLoginUserNoError(t *testing.T) {
 	}
 
 	repository := usersRepository{}
-	actualUser, restErr := repository.LoginUser("daniel@gmail.com", "the_password")
+	actualUser, restErr := repository.LoginUser(context.Background(), "daniel@gmail.com", "the_password")
 
 	if actualUser == nil {
 		t.Error("User should not be a nil value")
@@ -229,3 +235,87 @@ func TestNewRepository(t *testing.T) {
 
 
 }
+
+func TestLoginUserPropagatesRequestContext(t *testing.T) {
+
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var traceparent, requestID string
+	Client = &MockClient{
+		MockDo: func(req *http.Request) (*http.Response, error) {
+			traceparent = req.Header.Get("traceparent")
+			requestID = req.Header.Get("X-Request-Id")
+			return &http.Response{
+				StatusCode: 200,
+				Body:       io.NopCloser(bytes.NewReader([]byte(`{"id": 1}`))),
+			}, nil
+		},
+	}
+
+	traceId := trace.TraceID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	ctx := trace.ContextWithRemoteSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceId,
+		SpanID:     trace.SpanID{1, 2, 3, 4, 5, 6, 7, 8},
+		TraceFlags: trace.FlagsSampled,
+	}))
+	ctx = logger.WithRequestID(ctx, "request-1")
+
+	repository := usersRepository{}
+	if _, restErr := repository.LoginUser(ctx, "test@gmail.com", "the_password"); restErr != nil {
+		t.Fatal("error should be nil")
+	}
+
+	if !strings.Contains(traceparent, traceId.String()) {
+		t.Errorf("traceparent should carry the trace id %s, received %q", traceId, traceparent)
+	}
+	if requestID != "request-1" {
+		t.Errorf("Expected: %s, Received: %s", "request-1", requestID)
+	}
+}
+
+func TestGetUser(t *testing.T) {
+
+	var method, url string
+	Client = &MockClient{
+		MockDo: func(req *http.Request) (*http.Response, error) {
+			method, url = req.Method, req.URL.String()
+			return &http.Response{
+				StatusCode: 200,
+				Body:       io.NopCloser(bytes.NewReader([]byte(`{"id": 7, "firstName": "Daniel", "email": "daniel@gmail.com"}`))),
+			}, nil
+		},
+	}
+
+	user, restErr := NewProfilesRepository().GetUser(context.Background(), 7)
+
+	if restErr != nil {
+		t.Fatalf("error should be nil, received %v", restErr)
+	}
+	if method != http.MethodGet || url != "http://localhost:8081/users/7" {
+		t.Errorf("Unexpected request %s %s", method, url)
+	}
+	if user.Id != 7 || user.FirstName != "Daniel" || user.Email != "daniel@gmail.com" {
+		t.Errorf("Unexpected user %+v", user)
+	}
+}
+
+func TestGetUserNotFound(t *testing.T) {
+
+	Client = &MockClient{
+		MockDo: func(*http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: 404,
+				Body:       io.NopCloser(bytes.NewReader([]byte(`{"message": "User 7 not found", "status": 404, "error": "not_found"}`))),
+			}, nil
+		},
+	}
+
+	user, restErr := NewProfilesRepository().GetUser(context.Background(), 7)
+
+	if user != nil {
+		t.Error("User should be a nil value")
+	}
+	if restErr == nil || restErr.Status() != 404 {
+		t.Errorf("Expected the not found error of the users API, received %v", restErr)
+	}
+}
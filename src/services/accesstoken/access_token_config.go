@@ -0,0 +1,118 @@
+package accesstoken
+
+import (
+	"fmt"
+	"github.com/danielgom/bookstore_oauthapi/src/config"
+	"github.com/danielgom/bookstore_oauthapi/src/domain/accesstoken"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	envTokenLifetime        = "TOKEN_LIFETIME"
+	envTokenLifetimeClients = "TOKEN_LIFETIME_CLIENTS"
+	envTokenLifetimeGrants  = "TOKEN_LIFETIME_GRANTS"
+	envTokenLifetimeScopes  = "TOKEN_LIFETIME_SCOPES"
+
+	envTokenScopeUsers = "TOKEN_SCOPE_USERS"
+
+	envSlidingIdleTimeout  = "TOKEN_SLIDING_IDLE_TIMEOUT"
+	envSlidingMaxLifetime  = "TOKEN_SLIDING_MAX_LIFETIME"
+	envSlidingMinExtension = "TOKEN_SLIDING_MIN_EXTENSION"
+)
+
+// SlidingExpiration keeps tokens alive while they are used. A token issued in this mode expires IdleTimeout
+// after its last lookup and at most MaxLifetime after its creation
+type SlidingExpiration struct {
+	// IdleTimeout of zero disables the mode
+	IdleTimeout time.Duration
+	MaxLifetime time.Duration
+	// MinExtension throttles the writes, a lookup extending the token by less is not written
+	MinExtension time.Duration
+}
+
+// NewSlidingExpirationFromConfig reads the TOKEN_SLIDING_* environment variables, the mode is disabled by default
+func NewSlidingExpirationFromConfig() SlidingExpiration {
+	return SlidingExpiration{
+		IdleTimeout:  config.GetDuration(envSlidingIdleTimeout, 0),
+		MaxLifetime:  config.GetDuration(envSlidingMaxLifetime, 24*time.Hour),
+		MinExtension: config.GetDuration(envSlidingMinExtension, time.Minute),
+	}
+}
+
+// Enabled reports whether tokens are issued with a sliding expiration
+func (c SlidingExpiration) Enabled() bool {
+	return c.IdleTimeout > 0 && c.MaxLifetime > 0
+}
+
+// NewLifetimePolicyFromConfig reads the TOKEN_LIFETIME* environment variables. The rules are comma separated
+// name:duration entries, e.g. TOKEN_LIFETIME_SCOPES=admin:15m,books:write:1h
+func NewLifetimePolicyFromConfig() (accesstoken.LifetimePolicy, error) {
+
+	policy := accesstoken.LifetimePolicy{
+		Default: config.GetDuration(envTokenLifetime, accesstoken.DefaultLifetime),
+		Clients: make(map[int64]time.Duration),
+	}
+
+	clients, err := parseLifetimes(envTokenLifetimeClients)
+	if err != nil {
+		return accesstoken.LifetimePolicy{}, err
+	}
+	for name, lifetime := range clients {
+		clientId, err := strconv.ParseInt(name, 10, 64)
+		if err != nil || clientId <= 0 {
+			return accesstoken.LifetimePolicy{}, fmt.Errorf("invalid %s client id %q", envTokenLifetimeClients, name)
+		}
+		policy.Clients[clientId] = lifetime
+	}
+
+	if policy.Grants, err = parseLifetimes(envTokenLifetimeGrants); err != nil {
+		return accesstoken.LifetimePolicy{}, err
+	}
+	if policy.Scopes, err = parseLifetimes(envTokenLifetimeScopes); err != nil {
+		return accesstoken.LifetimePolicy{}, err
+	}
+
+	return policy, nil
+}
+
+// NewScopePolicyFromConfig reads TOKEN_SCOPE_USERS, comma separated scope:userId entries granting a restricted
+// scope to a user, e.g. TOKEN_SCOPE_USERS=admin:1,admin:7,payments:write:12
+func NewScopePolicyFromConfig() (accesstoken.ScopePolicy, error) {
+
+	policy := accesstoken.ScopePolicy{Users: make(map[string][]int64)}
+	for _, entry := range config.GetStrings(envTokenScopeUsers, nil) {
+		i := strings.LastIndex(entry, ":")
+		if i <= 0 {
+			return accesstoken.ScopePolicy{}, fmt.Errorf("invalid %s entry %q, expected scope:userId", envTokenScopeUsers, entry)
+		}
+
+		userId, err := strconv.ParseInt(strings.TrimSpace(entry[i+1:]), 10, 64)
+		if err != nil || userId <= 0 {
+			return accesstoken.ScopePolicy{}, fmt.Errorf("invalid %s entry %q, expected scope:userId", envTokenScopeUsers, entry)
+		}
+		scope := strings.TrimSpace(entry[:i])
+		policy.Users[scope] = append(policy.Users[scope], userId)
+	}
+	return policy, nil
+}
+
+// parseLifetimes reads the name:duration entries of key, names may contain colons
+func parseLifetimes(key string) (map[string]time.Duration, error) {
+
+	lifetimes := make(map[string]time.Duration)
+	for _, entry := range config.GetStrings(key, nil) {
+		i := strings.LastIndex(entry, ":")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid %s entry %q, expected name:duration", key, entry)
+		}
+
+		lifetime, err := time.ParseDuration(strings.TrimSpace(entry[i+1:]))
+		if err != nil || lifetime <= 0 {
+			return nil, fmt.Errorf("invalid %s entry %q, expected name:duration", key, entry)
+		}
+		lifetimes[strings.TrimSpace(entry[:i])] = lifetime
+	}
+	return lifetimes, nil
+}
@@ -1,29 +1,152 @@
 package accesstoken
 
 import (
+	"context"
+	"github.com/danielgom/bookstore_oauthapi/src/audit"
+	"github.com/danielgom/bookstore_oauthapi/src/clock"
 	"github.com/danielgom/bookstore_oauthapi/src/domain/accesstoken"
+	clientDomain "github.com/danielgom/bookstore_oauthapi/src/domain/clients"
+	oidcDomain "github.com/danielgom/bookstore_oauthapi/src/domain/oidc"
+	"github.com/danielgom/bookstore_oauthapi/src/domain/users"
+	"github.com/danielgom/bookstore_oauthapi/src/logger"
+	"github.com/danielgom/bookstore_oauthapi/src/metrics"
 	"github.com/danielgom/bookstore_oauthapi/src/repository/db"
 	"github.com/danielgom/bookstore_oauthapi/src/repository/usersdb"
+	"github.com/danielgom/bookstore_oauthapi/src/services/clients"
+	"github.com/danielgom/bookstore_oauthapi/src/services/device"
+	"github.com/danielgom/bookstore_oauthapi/src/services/mfa"
+	"github.com/danielgom/bookstore_oauthapi/src/services/oidc"
+	"github.com/danielgom/bookstore_oauthapi/src/tracing"
 	"github.com/danielgom/bookstore_utils-go/errors"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
 	"strings"
+	"time"
 )
 
-func NewService(dbRepo db.DRepository, usersRepo usersdb.UsersRepository) Service {
-	return &service{dbRepo, usersRepo}
+// defaultLastUsedInterval bounds the writes recording the use of a token to one per minute
+const defaultLastUsedInterval = time.Minute
+
+// sessionRevokedReason is the audit reason of a token revoked by its own user
+const sessionRevokedReason = "session_revoked"
+
+type Option func(*service)
+
+// WithMfa enables the TOTP second factor on the password grant for users who enrolled
+func WithMfa(mfaService mfa.Service) Option {
+	return func(s *service) {
+		s.mfaService = mfaService
+	}
+}
+
+// WithClients enables the token exchange grant, its callers are authenticated by clientsService
+func WithClients(clientsService clients.Service) Option {
+	return func(s *service) {
+		s.clientsService = clientsService
+	}
+}
+
+// WithDevice enables the device code grant, polling the authorizations of deviceService
+func WithDevice(deviceService device.Service) Option {
+	return func(s *service) {
+		s.deviceService = deviceService
+	}
+}
+
+// WithOidc issues id tokens signed by oidcService to the password, mfaOtp and device code grants asking for the
+// openid scope
+func WithOidc(oidcService oidc.Service) Option {
+	return func(s *service) {
+		s.oidcService = oidcService
+	}
+}
+
+// WithAudit records the authentication events of the service in sink
+func WithAudit(sink audit.Sink) Option {
+	return func(s *service) {
+		s.auditSink = sink
+	}
+}
+
+// WithLastUsedInterval sets how stale the last use time of a token may get before GetByID records it again
+func WithLastUsedInterval(interval time.Duration) Option {
+	return func(s *service) {
+		s.lastUsedInterval = interval
+	}
+}
+
+// WithSlidingExpiration issues tokens extended on each GetByID as configured by c, tokens issued before keep
+// their fixed expiration
+func WithSlidingExpiration(c SlidingExpiration) Option {
+	return func(s *service) {
+		s.sliding = c
+	}
+}
+
+// WithLifetimePolicy resolves the lifetime of the issued tokens with policy instead of the 24h default
+func WithLifetimePolicy(policy accesstoken.LifetimePolicy) Option {
+	return func(s *service) {
+		s.lifetimes = policy
+	}
+}
+
+// WithScopePolicy grants the restricted scopes to the users of policy, nobody is granted them by default
+func WithScopePolicy(policy accesstoken.ScopePolicy) Option {
+	return func(s *service) {
+		s.scopes = policy
+	}
+}
+
+// WithClock replaces the wall clock the service issues, expires and extends tokens with
+func WithClock(c clock.Clock) Option {
+	return func(s *service) {
+		s.clock = c
+	}
+}
+
+func NewService(dbRepo db.DRepository, usersRepo usersdb.UsersRepository, opts ...Option) Service {
+	s := &service{DbRepository: dbRepo, usersRepository: usersRepo, lastUsedInterval: defaultLastUsedInterval, clock: clock.System}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 type Service interface {
-	GetByID(string) (*accesstoken.AccessToken, errors.RestErr)
-	Create(*accesstoken.AtRequest) (*accesstoken.AccessToken, errors.RestErr)
-	UpdateExpirationTime(*accesstoken.AccessToken) errors.RestErr
+	GetByID(context.Context, string) (*accesstoken.AccessToken, errors.RestErr)
+	Create(context.Context, *accesstoken.AtRequest) (*accesstoken.AccessToken, errors.RestErr)
+	UpdateExpirationTime(context.Context, *accesstoken.AccessToken) errors.RestErr
+	ListByUser(context.Context, int64) ([]accesstoken.AccessToken, errors.RestErr)
+	RevokeAllForUser(context.Context, int64, string) (int, errors.RestErr)
+	RevokeAllForClient(context.Context, int64, string) (int, errors.RestErr)
+	ListSessions(context.Context, int64, string) ([]accesstoken.Session, errors.RestErr)
+	RevokeSession(context.Context, int64, string) errors.RestErr
+	GrantTypes() []string
 }
 
 type service struct {
-	DbRepository    db.DRepository
-	usersRepository usersdb.UsersRepository
+	DbRepository     db.DRepository
+	usersRepository  usersdb.UsersRepository
+	mfaService       mfa.Service
+	clientsService   clients.Service
+	deviceService    device.Service
+	oidcService      oidc.Service
+	auditSink        audit.Sink
+	lastUsedInterval time.Duration
+	sliding          SlidingExpiration
+	lifetimes        accesstoken.LifetimePolicy
+	scopes           accesstoken.ScopePolicy
+	clock            clock.Clock
 }
 
-func (s *service) GetByID(id string) (*accesstoken.AccessToken, errors.RestErr) {
+func (s *service) GetByID(ctx context.Context, id string) (*accesstoken.AccessToken, errors.RestErr) {
+
+	ctx, span := tracing.Tracer().Start(ctx, "accesstoken.Service/GetByID")
+	defer span.End()
 
 	atId := strings.TrimSpace(id)
 
@@ -31,39 +154,556 @@ func (s *service) GetByID(id string) (*accesstoken.AccessToken, errors.RestErr)
 		return nil, errors.NewBadRequestError("Invalid access token id")
 	}
 
-	at, err := s.DbRepository.GetByID(atId)
+	at, err := s.DbRepository.GetByID(ctx, atId)
 	if err != nil {
+		if err.Status() == http.StatusNotFound {
+			metrics.IncTokenLookups(metrics.LookupMiss)
+		}
 		return nil, err
 	}
 
+	if at.IsExpired(s.clock) {
+		metrics.IncTokenLookups(metrics.LookupExpired)
+	} else {
+		metrics.IncTokenLookups(metrics.LookupHit)
+		s.touch(ctx, at)
+		s.slide(ctx, at)
+	}
+
 	return at, nil
 }
 
-func (s *service) Create(request *accesstoken.AtRequest) (*accesstoken.AccessToken, errors.RestErr) {
+// touch records the use of at unless it was recorded less than lastUsedInterval ago. A failed write only
+// leaves the last use time stale, so it never fails the lookup
+func (s *service) touch(ctx context.Context, at *accesstoken.AccessToken) {
+
+	now := s.clock.Now().Unix()
+	if now-at.LastUsed < int64(s.lastUsedInterval/time.Second) {
+		return
+	}
+
+	at.LastUsed = now
+	if err := s.DbRepository.UpdateLastUsed(ctx, at); err != nil {
+		logger.FromContext(ctx).Warn("last use of access token not recorded", zap.String("error", err.Message()),
+			zap.Any("causes", err.Causes()))
+	}
+}
+
+func (s *service) Create(ctx context.Context, request *accesstoken.AtRequest) (*accesstoken.AccessToken, errors.RestErr) {
+
+	ctx, span := tracing.Tracer().Start(ctx, "accesstoken.Service/Create",
+		trace.WithAttributes(attribute.String("oauth.grant_type", request.GrantType)))
+	defer span.End()
 
 	if err := request.Validate(); err != nil {
 		return nil, err
 	}
 
+	if request.GrantType == accesstoken.GrantTypeMfaOtp {
+		return s.createFromMfaChallenge(ctx, request)
+	}
+
+	if request.GrantType == accesstoken.GrantTypeTokenExchange {
+		return s.createFromTokenExchange(ctx, request)
+	}
+
+	if request.GrantType == accesstoken.GrantTypeDeviceCode {
+		return s.createFromDeviceCode(ctx, request)
+	}
+
 	//TODO: support both grant types
 
-	user, err := s.usersRepository.LoginUser(request.Username, request.Password)
+	clientId, err := s.passwordClient(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.usersRepository.LoginUser(ctx, request.Username, request.Password)
+	if err != nil {
+		reason := loginFailureReason(err)
+		metrics.IncFailedLogins(reason)
+		tracing.SetError(span, err)
+		logger.FromContext(ctx).Warn("login failed", zap.Object("request", request), zap.String("reason", reason),
+			zap.String("error", err.Message()), zap.Any("causes", err.Causes()))
+		event := audit.NewEvent(ctx, s.clock, audit.LoginFailed)
+		event.Username = request.Username
+		event.GrantType = request.GrantType
+		event.Reason = reason
+		s.audit(ctx, event)
+		return nil, err
+	}
+
+	if err = s.scopes.Check(user.Id, request.Scope); err != nil {
+		return nil, err
+	}
+
+	if s.mfaService != nil {
+		enabled, err := s.mfaService.IsEnabled(ctx, user.Id)
+		if err != nil {
+			return nil, err
+		}
+
+		if enabled {
+			challenge, err := s.mfaService.CreateChallenge(ctx, user.Id, clientId, request.Scope)
+			if err != nil {
+				return nil, err
+			}
+			logger.FromContext(ctx).Info("mfa challenge issued", zap.Int64("userId", user.Id))
+			return nil, accesstoken.NewMfaRequiredError(challenge.MfaToken, challenge.Expires)
+		}
+	}
+
+	at, err := s.newAccessToken(ctx, user.Id, clientId, request.GrantType, request.Scope)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.setIdToken(ctx, at, user); err != nil {
+		return nil, err
+	}
+
+	if err = s.DbRepository.Create(ctx, at); err != nil {
+		return nil, err
+	}
+
+	metrics.IncTokensIssued(request.GrantType, at.ClientId)
+	logger.FromContext(ctx).Info("access token issued", zap.String("grantType", request.GrantType), zap.Object("accessToken", at))
+	s.auditTokenIssued(ctx, request.GrantType, at)
+
+	return at, nil
+}
+
+func (s *service) createFromMfaChallenge(ctx context.Context, request *accesstoken.AtRequest) (*accesstoken.AccessToken, errors.RestErr) {
+
+	if s.mfaService == nil {
+		return nil, errors.NewBadRequestError("Invalid grantType parameter")
+	}
+
+	challenge, err := s.mfaService.VerifyChallenge(ctx, request.MfaToken, request.OtpCode)
+	if err != nil {
+		metrics.IncFailedLogins(metrics.LoginReasonInvalidOtp)
+		tracing.SetError(trace.SpanFromContext(ctx), err)
+		logger.FromContext(ctx).Warn("mfa challenge failed", zap.Object("request", request), zap.String("error", err.Message()))
+		event := audit.NewEvent(ctx, s.clock, audit.LoginFailed)
+		event.GrantType = request.GrantType
+		event.Reason = metrics.LoginReasonInvalidOtp
+		s.audit(ctx, event)
+		return nil, err
+	}
+
+	// the challenge completes a password grant, which sets the lifetime
+	at, err := s.newAccessToken(ctx, challenge.UserId, challenge.ClientId, accesstoken.GrantTypePassword, challenge.Scope)
 	if err != nil {
 		return nil, err
 	}
 
-	at := accesstoken.GetNewAccessToken(user.Id)
+	if err = s.setIdToken(ctx, at, nil); err != nil {
+		return nil, err
+	}
 
-	if err = s.DbRepository.Create(at); err != nil {
+	if err = s.DbRepository.Create(ctx, at); err != nil {
 		return nil, err
 	}
 
+	metrics.IncTokensIssued(request.GrantType, at.ClientId)
+	logger.FromContext(ctx).Info("access token issued", zap.String("grantType", request.GrantType), zap.Object("accessToken", at))
+	s.auditTokenIssued(ctx, request.GrantType, at)
+
 	return at, nil
 }
 
-func (s *service) UpdateExpirationTime(at *accesstoken.AccessToken) errors.RestErr {
+// createFromTokenExchange issues the calling client a token of the user of the subject token, acting on their
+// behalf. The token is limited to the requested scopes of the subject token and never outlives it
+func (s *service) createFromTokenExchange(ctx context.Context, request *accesstoken.AtRequest) (*accesstoken.AccessToken, errors.RestErr) {
+
+	if s.clientsService == nil {
+		return nil, errors.NewBadRequestError("Invalid grantType parameter")
+	}
+
+	client, err := s.clientsService.Authenticate(ctx, request.ClientId, request.ClientSecret)
+	if err != nil {
+		tracing.SetError(trace.SpanFromContext(ctx), err)
+		logger.FromContext(ctx).Warn("token exchange failed", zap.Object("request", request), zap.String("error", err.Message()))
+		return nil, err
+	}
+	if !client.HasRole(clientDomain.RoleTokenExchange) {
+		logger.FromContext(ctx).Warn("token exchange failed", zap.Int64("clientId", client.Id),
+			zap.String("reason", "client not allowed"))
+		return nil, errors.NewBadRequestError("Client is not allowed to exchange tokens")
+	}
+
+	subject, err := s.DbRepository.GetByID(ctx, request.SubjectToken)
+	if err != nil && err.Status() != http.StatusNotFound {
+		return nil, err
+	}
+	if subject == nil || subject.IsExpired(s.clock) {
+		logger.FromContext(ctx).Warn("token exchange failed", zap.Int64("clientId", client.Id),
+			zap.String("reason", "invalid subject token"))
+		return nil, errors.NewBadRequestError("Invalid subject token")
+	}
+
+	scope, err := subject.ExchangeScope(request.Scope)
+	if err != nil {
+		return nil, err
+	}
+
+	at, err := s.newAccessToken(ctx, subject.UserId, client.Id, request.GrantType, scope)
+	if err != nil {
+		return nil, err
+	}
+	at.Act = &accesstoken.Actor{ClientId: client.Id, Act: subject.Act}
+	if at.Expires > subject.Expires {
+		at.Expires = subject.Expires
+	}
+	if at.MaxExpires > subject.Expires {
+		at.MaxExpires = subject.Expires
+	}
+
+	if err = s.DbRepository.Create(ctx, at); err != nil {
+		return nil, err
+	}
+
+	metrics.IncTokensIssued(request.GrantType, at.ClientId)
+	logger.FromContext(ctx).Info("access token issued", zap.String("grantType", request.GrantType), zap.Object("accessToken", at),
+		zap.Int64("subjectClientId", subject.ClientId))
+	s.auditTokenIssued(ctx, request.GrantType, at)
+
+	return at, nil
+}
+
+// createFromDeviceCode issues the device the token approved by its user. Until then the poll errors of the device
+// service are returned as is
+func (s *service) createFromDeviceCode(ctx context.Context, request *accesstoken.AtRequest) (*accesstoken.AccessToken, errors.RestErr) {
+
+	if s.deviceService == nil {
+		return nil, errors.NewBadRequestError("Invalid grantType parameter")
+	}
+
+	auth, err := s.deviceService.Poll(ctx, request.DeviceCode, request.ClientId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.scopes.Check(auth.UserId, auth.Scope); err != nil {
+		return nil, err
+	}
+
+	at, err := s.newAccessToken(ctx, auth.UserId, auth.ClientId, request.GrantType, auth.Scope)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.setIdToken(ctx, at, nil); err != nil {
+		return nil, err
+	}
+
+	if err = s.DbRepository.Create(ctx, at); err != nil {
+		return nil, err
+	}
+
+	metrics.IncTokensIssued(request.GrantType, at.ClientId)
+	logger.FromContext(ctx).Info("access token issued", zap.String("grantType", request.GrantType), zap.Object("accessToken", at))
+	s.auditTokenIssued(ctx, request.GrantType, at)
+
+	return at, nil
+}
+
+// passwordClient returns the id of the client a password grant is issued to, identified by the clientId of the
+// request. It is zero for anonymous grants, which cannot ask for an id token as the client is its audience
+func (s *service) passwordClient(ctx context.Context, request *accesstoken.AtRequest) (int64, errors.RestErr) {
+
+	clientId := strings.TrimSpace(request.ClientId)
+	if s.clientsService == nil || clientId == "" {
+		if s.oidcService != nil && request.HasScope(oidcDomain.ScopeOpenId) {
+			return 0, errors.NewBadRequestError("Invalid clientId parameter")
+		}
+		return 0, nil
+	}
+
+	client, err := s.clientsService.Identify(ctx, clientId)
+	if err != nil {
+		return 0, err
+	}
+	return client.Id, nil
+}
+
+// setIdToken signs the id token of at when it was granted the openid scope. The claims are read from user, fetched
+// by the oidc service when nil
+func (s *service) setIdToken(ctx context.Context, at *accesstoken.AccessToken, user *users.User) errors.RestErr {
+
+	if s.oidcService == nil || !at.HasScopes(oidcDomain.ScopeOpenId) {
+		return nil
+	}
+
+	idToken, err := s.oidcService.IdToken(ctx, at, user)
+	if err != nil {
+		return err
+	}
+	at.IdToken = idToken
+	return nil
+}
+
+// GrantTypes returns the grant types the service issues tokens for, as enabled by its options
+func (s *service) GrantTypes() []string {
+	grantTypes := []string{accesstoken.GrantTypePassword}
+	if s.mfaService != nil {
+		grantTypes = append(grantTypes, accesstoken.GrantTypeMfaOtp)
+	}
+	if s.clientsService != nil {
+		grantTypes = append(grantTypes, accesstoken.GrantTypeTokenExchange)
+	}
+	if s.deviceService != nil {
+		grantTypes = append(grantTypes, accesstoken.GrantTypeDeviceCode)
+	}
+	return grantTypes
+}
+
+// newAccessToken returns the token to issue with the lifetime resolved by the policy of the service
+func (s *service) newAccessToken(ctx context.Context, userId, clientId int64, grantType, scope string) (*accesstoken.AccessToken, errors.RestErr) {
+
+	at, err := accesstoken.GetNewAccessToken(s.clock, userId, s.lifetimes.Lifetime(clientId, grantType, strings.Fields(scope)))
+	if err != nil {
+		return nil, err
+	}
+	at.ClientId = clientId
+	at.Scope = scope
+	setClient(ctx, at)
+	s.setSliding(at)
+	return at, nil
+}
+
+// slide extends a sliding token to IdleTimeout from now, up to its MaxExpires. Extensions shorter than
+// MinExtension are skipped so a token used on every request is written at most once per MinExtension. Each
+// extension is audited like UpdateExpirationTime. A failed write is only logged, the token then expires earlier
+// than it would have
+func (s *service) slide(ctx context.Context, at *accesstoken.AccessToken) {
+
+	if at.MaxExpires == 0 || !s.sliding.Enabled() {
+		return
+	}
+
+	expires := s.clock.Now().Add(s.sliding.IdleTimeout).Unix()
+	if expires > at.MaxExpires {
+		expires = at.MaxExpires
+	}
+	if extension := expires - at.Expires; extension <= 0 || extension < int64(s.sliding.MinExtension/time.Second) {
+		return
+	}
+
+	if err := s.DbRepository.UpdateExpirationTime(ctx, &accesstoken.AccessToken{AccessToken: at.AccessToken, Expires: expires}); err != nil {
+		logger.FromContext(ctx).Warn("sliding expiration not extended", zap.String("error", err.Message()),
+			zap.Any("causes", err.Causes()))
+		return
+	}
+	at.Expires = expires
+
+	event := audit.NewEvent(ctx, s.clock, audit.TokenExtended)
+	event.UserId = at.UserId
+	event.ClientId = at.ClientId
+	event.Expires = at.Expires
+	s.audit(ctx, event)
+}
+
+// setSliding gives a new token its sliding expiration when the mode is enabled, its resolved lifetime capping
+// MaxLifetime
+func (s *service) setSliding(at *accesstoken.AccessToken) {
+
+	if !s.sliding.Enabled() {
+		return
+	}
+
+	at.MaxExpires = at.Created + int64(s.sliding.MaxLifetime/time.Second)
+	if at.MaxExpires > at.Expires {
+		at.MaxExpires = at.Expires
+	}
+	at.Expires = at.Created + int64(s.sliding.IdleTimeout/time.Second)
+	if at.Expires > at.MaxExpires {
+		at.Expires = at.MaxExpires
+	}
+}
+
+// setClient records the user agent and address the token is issued to, listed with the sessions of the user
+func setClient(ctx context.Context, at *accesstoken.AccessToken) {
+	at.UserAgent = audit.UserAgent(ctx)
+	at.RemoteIp = audit.RemoteIp(ctx)
+}
+
+func (s *service) auditTokenIssued(ctx context.Context, grantType string, at *accesstoken.AccessToken) {
+	event := audit.NewEvent(ctx, s.clock, audit.TokenIssued)
+	event.UserId = at.UserId
+	event.ClientId = at.ClientId
+	event.GrantType = grantType
+	event.Scope = at.Scope
+	event.Expires = at.Expires
+	s.audit(ctx, event)
+}
+
+// audit hands event to the audit sink, a failing sink is logged but never fails the request
+func (s *service) audit(ctx context.Context, event *audit.Event) {
+	if s.auditSink == nil {
+		return
+	}
+
+	if err := s.auditSink.Record(ctx, event); err != nil {
+		logger.FromContext(ctx).Error("audit event could not be recorded", zap.String("type", string(event.Type)), zap.Error(err))
+	}
+}
+
+func loginFailureReason(err errors.RestErr) string {
+	switch err.Status() {
+	case http.StatusBadRequest, http.StatusUnauthorized:
+		return metrics.LoginReasonInvalidCredentials
+	case http.StatusNotFound:
+		return metrics.LoginReasonUserNotFound
+	default:
+		return metrics.LoginReasonUpstreamError
+	}
+}
+
+func (s *service) UpdateExpirationTime(ctx context.Context, at *accesstoken.AccessToken) errors.RestErr {
+
+	ctx, span := tracing.Tracer().Start(ctx, "accesstoken.Service/UpdateExpirationTime")
+	defer span.End()
+
 	if err := at.Validate(); err != nil {
 		return err
 	}
-	return s.DbRepository.UpdateExpirationTime(at)
+
+	if err := s.DbRepository.UpdateExpirationTime(ctx, at); err != nil {
+		return err
+	}
+
+	event := audit.NewEvent(ctx, s.clock, audit.TokenExtended)
+	event.UserId = at.UserId
+	event.ClientId = at.ClientId
+	event.Expires = at.Expires
+	s.audit(ctx, event)
+
+	return nil
+}
+
+// ListByUser returns the tokens of the user which are not expired
+func (s *service) ListByUser(ctx context.Context, userId int64) ([]accesstoken.AccessToken, errors.RestErr) {
+
+	ctx, span := tracing.Tracer().Start(ctx, "accesstoken.Service/ListByUser",
+		trace.WithAttributes(semconv.EnduserIDKey.String(strconv.FormatInt(userId, 10))))
+	defer span.End()
+
+	if userId <= 0 {
+		return nil, errors.NewBadRequestError("Invalid user id")
+	}
+
+	return s.DbRepository.ListByUser(ctx, userId)
+}
+
+// RevokeAllForUser deletes every token of the user, e.g. after a password change, and returns how many
+// were revoked
+func (s *service) RevokeAllForUser(ctx context.Context, userId int64, reason string) (int, errors.RestErr) {
+
+	ctx, span := tracing.Tracer().Start(ctx, "accesstoken.Service/RevokeAllForUser",
+		trace.WithAttributes(semconv.EnduserIDKey.String(strconv.FormatInt(userId, 10))))
+	defer span.End()
+
+	if userId <= 0 {
+		return 0, errors.NewBadRequestError("Invalid user id")
+	}
+
+	revoked, err := s.DbRepository.DeleteByUser(ctx, userId)
+	if err != nil {
+		tracing.SetError(span, err)
+		return 0, err
+	}
+
+	logger.FromContext(ctx).Info("access tokens revoked", zap.Int64("userId", userId), zap.Int("revoked", revoked),
+		zap.String("reason", reason))
+	event := audit.NewEvent(ctx, s.clock, audit.TokenRevoked)
+	event.UserId = userId
+	event.Reason = reason
+	s.audit(ctx, event)
+
+	return revoked, nil
+}
+
+// RevokeAllForClient deletes every token issued to the client, e.g. once it is compromised, and returns how
+// many were revoked
+func (s *service) RevokeAllForClient(ctx context.Context, clientId int64, reason string) (int, errors.RestErr) {
+
+	ctx, span := tracing.Tracer().Start(ctx, "accesstoken.Service/RevokeAllForClient",
+		trace.WithAttributes(attribute.Int64("oauth.client_id", clientId)))
+	defer span.End()
+
+	if clientId <= 0 {
+		return 0, errors.NewBadRequestError("Invalid client id")
+	}
+
+	revoked, err := s.DbRepository.DeleteByClient(ctx, clientId)
+	if err != nil {
+		tracing.SetError(span, err)
+		return 0, err
+	}
+
+	logger.FromContext(ctx).Info("access tokens revoked", zap.Int64("clientId", clientId), zap.Int("revoked", revoked),
+		zap.String("reason", reason))
+	event := audit.NewEvent(ctx, s.clock, audit.TokenRevoked)
+	event.ClientId = clientId
+	event.Reason = reason
+	s.audit(ctx, event)
+
+	return revoked, nil
+}
+
+// ListSessions returns the live tokens of the user as sessions, the one of currentToken marked as current
+func (s *service) ListSessions(ctx context.Context, userId int64, currentToken string) ([]accesstoken.Session, errors.RestErr) {
+
+	ctx, span := tracing.Tracer().Start(ctx, "accesstoken.Service/ListSessions",
+		trace.WithAttributes(semconv.EnduserIDKey.String(strconv.FormatInt(userId, 10))))
+	defer span.End()
+
+	tokens, err := s.ListByUser(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]accesstoken.Session, 0, len(tokens))
+	for i := range tokens {
+		session := tokens[i].Session()
+		session.Current = tokens[i].AccessToken == currentToken
+		sessions = append(sessions, session)
+	}
+	return sessions, nil
+}
+
+// RevokeSession deletes the token of the user identified by sessionId, other users' sessions are not found
+func (s *service) RevokeSession(ctx context.Context, userId int64, sessionId string) errors.RestErr {
+
+	ctx, span := tracing.Tracer().Start(ctx, "accesstoken.Service/RevokeSession",
+		trace.WithAttributes(semconv.EnduserIDKey.String(strconv.FormatInt(userId, 10))))
+	defer span.End()
+
+	tokens, err := s.ListByUser(ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	for i := range tokens {
+		at := &tokens[i]
+		if at.SessionId() != sessionId {
+			continue
+		}
+
+		if err := s.DbRepository.Delete(ctx, at.AccessToken); err != nil {
+			tracing.SetError(span, err)
+			return err
+		}
+
+		logger.FromContext(ctx).Info("session revoked", zap.Int64("userId", userId), zap.String("sessionId", sessionId))
+		event := audit.NewEvent(ctx, s.clock, audit.TokenRevoked)
+		event.UserId = userId
+		event.ClientId = at.ClientId
+		event.Reason = sessionRevokedReason
+		s.audit(ctx, event)
+		return nil
+	}
+
+	return errors.NewNotFoundError("No session found with given id")
 }
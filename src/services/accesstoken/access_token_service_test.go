@@ -1,11 +1,32 @@
 package accesstoken
 
 import (
+	"context"
+	"fmt"
+	"github.com/danielgom/bookstore_oauthapi/src/audit"
+	"github.com/danielgom/bookstore_oauthapi/src/clock"
+	"github.com/danielgom/bookstore_oauthapi/src/clock/clocktest"
 	"github.com/danielgom/bookstore_oauthapi/src/domain/accesstoken"
+	clientDomain "github.com/danielgom/bookstore_oauthapi/src/domain/clients"
+	deviceDomain "github.com/danielgom/bookstore_oauthapi/src/domain/device"
+	"github.com/danielgom/bookstore_oauthapi/src/domain/mfa"
+	"github.com/danielgom/bookstore_oauthapi/src/domain/users"
+	"github.com/danielgom/bookstore_oauthapi/src/logger"
+	"github.com/danielgom/bookstore_oauthapi/src/metrics"
+	"github.com/danielgom/bookstore_oauthapi/src/repository/db"
 	"github.com/danielgom/bookstore_oauthapi/src/services/accesstoken/mocks"
+	"github.com/danielgom/bookstore_oauthapi/src/services/clients"
+	"github.com/danielgom/bookstore_oauthapi/src/services/device"
+	"github.com/danielgom/bookstore_oauthapi/src/services/oidc"
 	"github.com/danielgom/bookstore_utils-go/errors"
 	"github.com/golang/mock/gomock"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"os"
 	"testing"
+	"time"
 )
 
 /*
@@ -296,7 +317,7 @@ func TestServiceGetByID(t *testing.T) {
 			usersRepository: nil,
 		}
 		atID := ""
-		at, err := mockService.GetByID(atID)
+		at, err := mockService.GetByID(context.Background(), atID)
 
 		if at != nil {
 			t.Error("access token should be nil")
@@ -314,14 +335,14 @@ func TestServiceGetByID(t *testing.T) {
 
 		mockDRepository := mocks.NewMockDRepository(mockCtrl)
 
-		mockDRepository.EXPECT().GetByID("22").
+		mockDRepository.EXPECT().GetByID(gomock.Any(), "22").
 			Return(nil, errors.NewNotFoundError("No access token found with given id"))
 
 		MockService := service{
 			DbRepository: mockDRepository,
 		}
 		atString := "22"
-		aT, err := MockService.GetByID(atString)
+		aT, err := MockService.GetByID(context.Background(), atString)
 
 		if aT != nil {
 			t.Error("access token should be nil")
@@ -337,7 +358,7 @@ func TestServiceGetByID(t *testing.T) {
 
 		mockDRepository := mocks.NewMockDRepository(mockCtrl)
 
-		mockDRepository.EXPECT().GetByID("123456").Return(&accesstoken.AccessToken{
+		mockDRepository.EXPECT().GetByID(gomock.Any(), "123456").Return(&accesstoken.AccessToken{
 			AccessToken: "123456",
 			UserId:      123,
 			ClientId:    456,
@@ -346,11 +367,12 @@ func TestServiceGetByID(t *testing.T) {
 
 		mockService := &service{
 			DbRepository:    mockDRepository,
+			clock:           clock.System,
 		}
 
 		tString := "123456"
 
-		aT, err := mockService.GetByID(tString)
+		aT, err := mockService.GetByID(context.Background(), tString)
 
 		if err != nil {
 			t.Error("error should be nil")
@@ -362,3 +384,1065 @@ func TestServiceGetByID(t *testing.T) {
 	})
 
 }
+
+func TestServiceCreateWithMfa(t *testing.T) {
+
+	t.Run("Should return mfa challenge when the user enrolled", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockUsersRepository := mocks.NewMockUsersRepository(mockCtrl)
+		mockUsersRepository.EXPECT().LoginUser(gomock.Any(), "daniel@gmail.com", "the_password").Return(&users.User{Id: 1}, nil)
+
+		mockMfaService := mocks.NewMockService(mockCtrl)
+		mockMfaService.EXPECT().IsEnabled(gomock.Any(), int64(1)).Return(true, nil)
+		mockMfaService.EXPECT().CreateChallenge(gomock.Any(), int64(1), int64(0), "").
+			Return(&mfa.Challenge{MfaToken: "mfa-token", UserId: 1, Expires: 365}, nil)
+
+		mockService := NewService(mocks.NewMockDRepository(mockCtrl), mockUsersRepository, WithMfa(mockMfaService))
+
+		at, err := mockService.Create(context.Background(), &accesstoken.AtRequest{
+			GrantType: accesstoken.GrantTypePassword,
+			Username:  "daniel@gmail.com",
+			Password:  "the_password",
+		})
+
+		if at != nil {
+			t.Error("access token should be nil")
+		}
+
+		mfaErr, ok := err.(*accesstoken.MfaRequiredError)
+		if !ok {
+			t.Fatalf("error should be a mfa required error, received %v", err)
+		}
+		if mfaErr.MfaToken != "mfa-token" || mfaErr.Status() != 401 {
+			t.Errorf("Unexpected mfa error %+v", mfaErr)
+		}
+	})
+
+	t.Run("Should return access token when the user did not enroll", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockUsersRepository := mocks.NewMockUsersRepository(mockCtrl)
+		mockUsersRepository.EXPECT().LoginUser(gomock.Any(), "daniel@gmail.com", "the_password").Return(&users.User{Id: 1}, nil)
+
+		mockMfaService := mocks.NewMockService(mockCtrl)
+		mockMfaService.EXPECT().IsEnabled(gomock.Any(), int64(1)).Return(false, nil)
+
+		mockDRepository := mocks.NewMockDRepository(mockCtrl)
+		mockDRepository.EXPECT().Create(gomock.Any(), gomock.Any()).Return(nil)
+
+		mockService := NewService(mockDRepository, mockUsersRepository, WithMfa(mockMfaService))
+
+		issued := testutil.ToFloat64(metrics.TokensIssued.WithLabelValues("password", "0"))
+
+		at, err := mockService.Create(context.Background(), &accesstoken.AtRequest{
+			GrantType: accesstoken.GrantTypePassword,
+			Username:  "daniel@gmail.com",
+			Password:  "the_password",
+		})
+
+		if err != nil {
+			t.Fatal("error should be nil")
+		}
+		if at == nil || at.UserId != 1 {
+			t.Errorf("Unexpected access token %+v", at)
+		}
+		if testutil.ToFloat64(metrics.TokensIssued.WithLabelValues("password", "0")) != issued+1 {
+			t.Error("Issued token should be counted")
+		}
+	})
+
+	t.Run("Should exchange a verified challenge for an access token", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockMfaService := mocks.NewMockService(mockCtrl)
+		mockMfaService.EXPECT().VerifyChallenge(gomock.Any(), "mfa-token", "123456").
+			Return(&mfa.Challenge{MfaToken: "mfa-token", UserId: 1, ClientId: 2}, nil)
+
+		mockDRepository := mocks.NewMockDRepository(mockCtrl)
+		mockDRepository.EXPECT().Create(gomock.Any(), gomock.Any()).Return(nil)
+
+		mockService := NewService(mockDRepository, nil, WithMfa(mockMfaService))
+
+		at, err := mockService.Create(context.Background(), &accesstoken.AtRequest{
+			GrantType: accesstoken.GrantTypeMfaOtp,
+			MfaToken:  "mfa-token",
+			OtpCode:   "123456",
+		})
+
+		if err != nil {
+			t.Fatal("error should be nil")
+		}
+		if at == nil || at.UserId != 1 || at.ClientId != 2 {
+			t.Errorf("Unexpected access token %+v", at)
+		}
+	})
+
+	t.Run("Should reject the mfa grant when mfa is disabled", func(t *testing.T) {
+		mockService := NewService(nil, nil)
+
+		_, err := mockService.Create(context.Background(), &accesstoken.AtRequest{
+			GrantType: accesstoken.GrantTypeMfaOtp,
+			MfaToken:  "mfa-token",
+			OtpCode:   "123456",
+		})
+
+		if err == nil || err.Status() != 400 {
+			t.Error("Status returned should be 400")
+		}
+	})
+}
+
+func TestServiceCreateLogsRedactedRequest(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockUsersRepository := mocks.NewMockUsersRepository(mockCtrl)
+	mockUsersRepository.EXPECT().LoginUser(gomock.Any(), "daniel@gmail.com", "the_password").
+		Return(nil, errors.NewBadRequestError("Invalid email or password"))
+
+	core, logs := observer.New(zapcore.InfoLevel)
+	ctx := logger.WithContext(context.Background(), zap.New(core))
+
+	_, err := NewService(nil, mockUsersRepository).Create(ctx, &accesstoken.AtRequest{
+		GrantType: accesstoken.GrantTypePassword,
+		Username:  "daniel@gmail.com",
+		Password:  "the_password",
+	})
+	if err == nil {
+		t.Fatal("error should not be nil")
+	}
+
+	entries := logs.FilterMessage("login failed").All()
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 log entry, received %d", len(entries))
+	}
+
+	fields := entries[0].ContextMap()
+	request, ok := fields["request"].(map[string]interface{})
+	if !ok || request["username"] != "daniel@gmail.com" || request["password"] == "the_password" {
+		t.Errorf("Password should be redacted, received %v", fields)
+	}
+	if fields["reason"] != metrics.LoginReasonInvalidCredentials {
+		t.Errorf("Expected: %s, Received: %v", metrics.LoginReasonInvalidCredentials, fields["reason"])
+	}
+}
+
+func TestServiceAuditEvents(t *testing.T) {
+
+	var events []*audit.Event
+	sink := audit.SinkFunc(func(_ context.Context, event *audit.Event) error {
+		events = append(events, event)
+		return nil
+	})
+
+	ctx := audit.WithRemoteIp(logger.WithRequestID(context.Background(), "request-1"), "10.0.0.1")
+
+	t.Run("Should record failed logins", func(t *testing.T) {
+		events = nil
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockUsersRepository := mocks.NewMockUsersRepository(mockCtrl)
+		mockUsersRepository.EXPECT().LoginUser(gomock.Any(), "daniel@gmail.com", "the_password").
+			Return(nil, errors.NewNotFoundError("User not found"))
+
+		_, err := NewService(nil, mockUsersRepository, WithAudit(sink), WithClock(clocktest.NewClock(time.Unix(1600000000, 0)))).Create(ctx, &accesstoken.AtRequest{
+			GrantType: accesstoken.GrantTypePassword,
+			Username:  "daniel@gmail.com",
+			Password:  "the_password",
+		})
+		if err == nil {
+			t.Fatal("error should not be nil")
+		}
+
+		if len(events) != 1 {
+			t.Fatalf("Expected 1 event, received %d", len(events))
+		}
+		event := events[0]
+		if event.Type != audit.LoginFailed || event.Username != "daniel@gmail.com" || event.Reason != metrics.LoginReasonUserNotFound {
+			t.Errorf("Unexpected event %+v", event)
+		}
+		if event.RemoteIp != "10.0.0.1" || event.RequestId != "request-1" || event.Time.Unix() != 1600000000 {
+			t.Errorf("Event should carry the request details %+v", event)
+		}
+	})
+
+	t.Run("Should record issued tokens", func(t *testing.T) {
+		events = nil
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockUsersRepository := mocks.NewMockUsersRepository(mockCtrl)
+		mockUsersRepository.EXPECT().LoginUser(gomock.Any(), "daniel@gmail.com", "the_password").Return(&users.User{Id: 1}, nil)
+
+		mockDRepository := mocks.NewMockDRepository(mockCtrl)
+		mockDRepository.EXPECT().Create(gomock.Any(), gomock.Any()).Return(nil)
+
+		at, err := NewService(mockDRepository, mockUsersRepository, WithAudit(sink)).Create(ctx, &accesstoken.AtRequest{
+			GrantType: accesstoken.GrantTypePassword,
+			Username:  "daniel@gmail.com",
+			Password:  "the_password",
+			Scope:     "read",
+		})
+		if err != nil {
+			t.Fatal("error should be nil")
+		}
+
+		if len(events) != 1 {
+			t.Fatalf("Expected 1 event, received %d", len(events))
+		}
+		event := events[0]
+		if event.Type != audit.TokenIssued || event.UserId != 1 || event.GrantType != accesstoken.GrantTypePassword ||
+			event.Scope != "read" || event.Expires != at.Expires {
+			t.Errorf("Unexpected event %+v", event)
+		}
+	})
+
+	t.Run("Should record extended tokens", func(t *testing.T) {
+		events = nil
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockDRepository := mocks.NewMockDRepository(mockCtrl)
+		mockDRepository.EXPECT().UpdateExpirationTime(gomock.Any(), gomock.Any()).Return(nil)
+
+		err := NewService(mockDRepository, nil, WithAudit(sink)).UpdateExpirationTime(ctx, &accesstoken.AccessToken{
+			AccessToken: "1234",
+			UserId:      1,
+			ClientId:    2,
+			Expires:     365,
+		})
+		if err != nil {
+			t.Fatal("error should be nil")
+		}
+
+		if len(events) != 1 || events[0].Type != audit.TokenExtended || events[0].ClientId != 2 || events[0].Expires != 365 {
+			t.Errorf("Unexpected events %+v", events)
+		}
+	})
+
+	t.Run("Should not fail the request when the sink fails", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockDRepository := mocks.NewMockDRepository(mockCtrl)
+		mockDRepository.EXPECT().UpdateExpirationTime(gomock.Any(), gomock.Any()).Return(nil)
+
+		failing := audit.SinkFunc(func(context.Context, *audit.Event) error {
+			return fmt.Errorf("sink unavailable")
+		})
+
+		err := NewService(mockDRepository, nil, WithAudit(failing)).UpdateExpirationTime(ctx, &accesstoken.AccessToken{
+			AccessToken: "1234",
+			UserId:      1,
+			ClientId:    2,
+			Expires:     365,
+		})
+		if err != nil {
+			t.Error("error should be nil")
+		}
+	})
+}
+
+func TestServiceRevokeAll(t *testing.T) {
+
+	var events []*audit.Event
+	sink := audit.SinkFunc(func(_ context.Context, event *audit.Event) error {
+		events = append(events, event)
+		return nil
+	})
+
+	t.Run("Should revoke the tokens of the user", func(t *testing.T) {
+		events = nil
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockDRepository := mocks.NewMockDRepository(mockCtrl)
+		mockDRepository.EXPECT().DeleteByUser(gomock.Any(), int64(1)).Return(3, nil)
+
+		revoked, err := NewService(mockDRepository, nil, WithAudit(sink)).RevokeAllForUser(context.Background(), 1, "password_changed")
+		if err != nil || revoked != 3 {
+			t.Fatalf("Unexpected result %d, %v", revoked, err)
+		}
+
+		if len(events) != 1 || events[0].Type != audit.TokenRevoked || events[0].UserId != 1 || events[0].Reason != "password_changed" {
+			t.Errorf("Unexpected events %+v", events)
+		}
+	})
+
+	t.Run("Should revoke the tokens of the client", func(t *testing.T) {
+		events = nil
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockDRepository := mocks.NewMockDRepository(mockCtrl)
+		mockDRepository.EXPECT().DeleteByClient(gomock.Any(), int64(2)).Return(5, nil)
+
+		revoked, err := NewService(mockDRepository, nil, WithAudit(sink)).RevokeAllForClient(context.Background(), 2, "")
+		if err != nil || revoked != 5 {
+			t.Fatalf("Unexpected result %d, %v", revoked, err)
+		}
+
+		if len(events) != 1 || events[0].Type != audit.TokenRevoked || events[0].ClientId != 2 || events[0].UserId != 0 {
+			t.Errorf("Unexpected events %+v", events)
+		}
+	})
+
+	t.Run("Should revoke the password grants of the client", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockUsersRepository := mocks.NewMockUsersRepository(mockCtrl)
+		mockUsersRepository.EXPECT().LoginUser(gomock.Any(), "daniel@gmail.com", "the_password").Return(&users.User{Id: 1}, nil)
+		clientsService := WithClients(&fakeClientsService{clients: map[string]*clientDomain.Client{"7": {Id: 7}}})
+		service := NewService(db.NewMemoryRepository(0), mockUsersRepository, clientsService)
+
+		at, err := service.Create(context.Background(), &accesstoken.AtRequest{GrantType: accesstoken.GrantTypePassword,
+			Username: "daniel@gmail.com", Password: "the_password", ClientId: "7"})
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+
+		if revoked, err := service.RevokeAllForClient(context.Background(), 7, ""); err != nil || revoked != 1 {
+			t.Fatalf("Unexpected result %d, %v", revoked, err)
+		}
+		if _, err = service.GetByID(context.Background(), at.AccessToken); err == nil || err.Status() != 404 {
+			t.Errorf("The token should be revoked, received %v", err)
+		}
+	})
+
+	t.Run("Should not record failed revocations", func(t *testing.T) {
+		events = nil
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockDRepository := mocks.NewMockDRepository(mockCtrl)
+		mockDRepository.EXPECT().DeleteByUser(gomock.Any(), int64(1)).
+			Return(0, errors.NewInternalServerError("error deleting access tokens", fmt.Errorf("timeout")))
+
+		if _, err := NewService(mockDRepository, nil, WithAudit(sink)).RevokeAllForUser(context.Background(), 1, ""); err == nil || err.Status() != 500 {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if len(events) != 0 {
+			t.Errorf("Unexpected events %+v", events)
+		}
+	})
+
+	t.Run("Should reject invalid ids", func(t *testing.T) {
+		service := NewService(nil, nil)
+
+		if _, err := service.RevokeAllForUser(context.Background(), 0, ""); err == nil || err.Status() != 400 {
+			t.Errorf("Status returned should be 400, received %v", err)
+		}
+		if _, err := service.RevokeAllForClient(context.Background(), -1, ""); err == nil || err.Status() != 400 {
+			t.Errorf("Status returned should be 400, received %v", err)
+		}
+		if _, err := service.ListByUser(context.Background(), 0); err == nil || err.Status() != 400 {
+			t.Errorf("Status returned should be 400, received %v", err)
+		}
+	})
+}
+
+func TestServiceGetByIDRecordsLastUse(t *testing.T) {
+
+	const now = 1600000000
+	frozen := WithClock(clocktest.NewClock(time.Unix(now, 0)))
+	expires := int64(now + 3600)
+
+	t.Run("Should record the use of a token not used lately", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockDRepository := mocks.NewMockDRepository(mockCtrl)
+		mockDRepository.EXPECT().GetByID(gomock.Any(), "abc123").
+			Return(&accesstoken.AccessToken{AccessToken: "abc123", UserId: 1, Expires: expires}, nil)
+		mockDRepository.EXPECT().UpdateLastUsed(gomock.Any(), gomock.Any()).
+			Return(errors.NewInternalServerError("error updating access token", fmt.Errorf("timeout")))
+
+		at, err := NewService(mockDRepository, nil, frozen).GetByID(context.Background(), "abc123")
+		if err != nil {
+			t.Fatalf("A failed write should not fail the lookup, received %v", err)
+		}
+		if at.LastUsed != now {
+			t.Errorf("Last use should be now, received %d", at.LastUsed)
+		}
+	})
+
+	t.Run("Should not record the use of a token used lately", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockDRepository := mocks.NewMockDRepository(mockCtrl)
+		mockDRepository.EXPECT().GetByID(gomock.Any(), "abc123").
+			Return(&accesstoken.AccessToken{AccessToken: "abc123", UserId: 1, Expires: expires, LastUsed: now - 59}, nil)
+
+		if _, err := NewService(mockDRepository, nil, frozen).GetByID(context.Background(), "abc123"); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	})
+
+	t.Run("Should record every use with a zero interval", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockDRepository := mocks.NewMockDRepository(mockCtrl)
+		mockDRepository.EXPECT().GetByID(gomock.Any(), "abc123").
+			Return(&accesstoken.AccessToken{AccessToken: "abc123", UserId: 1, Expires: expires, LastUsed: now}, nil)
+		mockDRepository.EXPECT().UpdateLastUsed(gomock.Any(), gomock.Any()).Return(nil)
+
+		if _, err := NewService(mockDRepository, nil, frozen, WithLastUsedInterval(0)).GetByID(context.Background(), "abc123"); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	})
+}
+
+func TestServiceSessions(t *testing.T) {
+
+	var events []*audit.Event
+	sink := audit.SinkFunc(func(_ context.Context, event *audit.Event) error {
+		events = append(events, event)
+		return nil
+	})
+
+	tokens := []accesstoken.AccessToken{
+		{AccessToken: "abc123", UserId: 1, ClientId: 2, Created: 300, UserAgent: "curl/7.79"},
+		{AccessToken: "def456", UserId: 1},
+	}
+
+	t.Run("Should list the sessions of the user", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockDRepository := mocks.NewMockDRepository(mockCtrl)
+		mockDRepository.EXPECT().ListByUser(gomock.Any(), int64(1)).Return(tokens, nil)
+
+		sessions, err := NewService(mockDRepository, nil).ListSessions(context.Background(), 1, "def456")
+		if err != nil || len(sessions) != 2 {
+			t.Fatalf("Unexpected result %+v, %v", sessions, err)
+		}
+		if sessions[0].Id != tokens[0].SessionId() || sessions[0].UserAgent != "curl/7.79" || sessions[0].Current || !sessions[1].Current {
+			t.Errorf("Unexpected sessions %+v", sessions)
+		}
+	})
+
+	t.Run("Should list the client of a password grant", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockUsersRepository := mocks.NewMockUsersRepository(mockCtrl)
+		mockUsersRepository.EXPECT().LoginUser(gomock.Any(), "daniel@gmail.com", "the_password").Return(&users.User{Id: 1}, nil)
+		clientsService := WithClients(&fakeClientsService{clients: map[string]*clientDomain.Client{"7": {Id: 7}}})
+		service := NewService(db.NewMemoryRepository(0), mockUsersRepository, clientsService)
+
+		at, err := service.Create(context.Background(), &accesstoken.AtRequest{GrantType: accesstoken.GrantTypePassword,
+			Username: "daniel@gmail.com", Password: "the_password", ClientId: "7"})
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+
+		sessions, err := service.ListSessions(context.Background(), 1, at.AccessToken)
+		if err != nil || len(sessions) != 1 || sessions[0].ClientId != 7 || !sessions[0].Current {
+			t.Errorf("Unexpected result %+v, %v", sessions, err)
+		}
+	})
+
+	t.Run("Should revoke a session of the user", func(t *testing.T) {
+		events = nil
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockDRepository := mocks.NewMockDRepository(mockCtrl)
+		mockDRepository.EXPECT().ListByUser(gomock.Any(), int64(1)).Return(tokens, nil)
+		mockDRepository.EXPECT().Delete(gomock.Any(), "abc123").Return(nil)
+
+		if err := NewService(mockDRepository, nil, WithAudit(sink)).RevokeSession(context.Background(), 1, tokens[0].SessionId()); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if len(events) != 1 || events[0].Type != audit.TokenRevoked || events[0].UserId != 1 || events[0].ClientId != 2 ||
+			events[0].Reason != "session_revoked" {
+			t.Errorf("Unexpected events %+v", events)
+		}
+	})
+
+	t.Run("Should not find sessions of other users", func(t *testing.T) {
+		events = nil
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockDRepository := mocks.NewMockDRepository(mockCtrl)
+		mockDRepository.EXPECT().ListByUser(gomock.Any(), int64(3)).Return(nil, nil)
+
+		err := NewService(mockDRepository, nil, WithAudit(sink)).RevokeSession(context.Background(), 3, tokens[0].SessionId())
+		if err == nil || err.Status() != 404 {
+			t.Fatalf("Status returned should be 404, received %v", err)
+		}
+		if len(events) != 0 {
+			t.Errorf("Unexpected events %+v", events)
+		}
+	})
+}
+
+func TestServiceSlidingExpiration(t *testing.T) {
+
+	const now = 1600000000
+	frozen := WithClock(clocktest.NewClock(time.Unix(now, 0)))
+	sliding := WithSlidingExpiration(SlidingExpiration{IdleTimeout: time.Hour, MaxLifetime: 8 * time.Hour, MinExtension: time.Minute})
+	recent := WithLastUsedInterval(time.Hour)
+
+	t.Run("Should issue tokens expiring after the idle timeout", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockUsersRepository := mocks.NewMockUsersRepository(mockCtrl)
+		mockUsersRepository.EXPECT().LoginUser(gomock.Any(), "daniel@gmail.com", "the_password").Return(&users.User{Id: 1}, nil)
+		mockDRepository := mocks.NewMockDRepository(mockCtrl)
+		mockDRepository.EXPECT().Create(gomock.Any(), gomock.Any()).Return(nil)
+
+		at, err := NewService(mockDRepository, mockUsersRepository, frozen, sliding).Create(context.Background(), &accesstoken.AtRequest{
+			GrantType: accesstoken.GrantTypePassword,
+			Username:  "daniel@gmail.com",
+			Password:  "the_password",
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if at.Created != now || at.Expires != now+3600 || at.MaxExpires != now+8*3600 {
+			t.Errorf("Unexpected expiration %+v", at)
+		}
+	})
+
+	t.Run("Should extend a sliding token on use", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockDRepository := mocks.NewMockDRepository(mockCtrl)
+		mockDRepository.EXPECT().GetByID(gomock.Any(), "abc123").
+			Return(&accesstoken.AccessToken{AccessToken: "abc123", UserId: 1, ClientId: 2, Expires: now + 600, MaxExpires: now + 7200, LastUsed: now}, nil)
+		mockDRepository.EXPECT().UpdateExpirationTime(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, at *accesstoken.AccessToken) errors.RestErr {
+				if at.AccessToken != "abc123" || at.Expires != now+3600 {
+					t.Errorf("Unexpected extension %+v", at)
+				}
+				return nil
+			})
+
+		var events []*audit.Event
+		sink := audit.SinkFunc(func(_ context.Context, event *audit.Event) error {
+			events = append(events, event)
+			return nil
+		})
+
+		at, err := NewService(mockDRepository, nil, frozen, sliding, recent, WithAudit(sink)).GetByID(context.Background(), "abc123")
+		if err != nil || at.Expires != now+3600 {
+			t.Fatalf("Unexpected result %+v, %v", at, err)
+		}
+		if len(events) != 1 || events[0].Type != audit.TokenExtended || events[0].UserId != 1 || events[0].ClientId != 2 ||
+			events[0].Expires != now+3600 {
+			t.Errorf("Unexpected events %+v", events)
+		}
+	})
+
+	t.Run("Should not extend a sliding token past its cap", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockDRepository := mocks.NewMockDRepository(mockCtrl)
+		mockDRepository.EXPECT().GetByID(gomock.Any(), "abc123").
+			Return(&accesstoken.AccessToken{AccessToken: "abc123", Expires: now + 600, MaxExpires: now + 600, LastUsed: now}, nil)
+
+		if at, err := NewService(mockDRepository, nil, frozen, sliding, recent).GetByID(context.Background(), "abc123"); err != nil || at.Expires != now+600 {
+			t.Fatalf("Unexpected result %+v, %v", at, err)
+		}
+	})
+
+	t.Run("Should throttle the extensions", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockDRepository := mocks.NewMockDRepository(mockCtrl)
+		mockDRepository.EXPECT().GetByID(gomock.Any(), "abc123").
+			Return(&accesstoken.AccessToken{AccessToken: "abc123", Expires: now + 3541, MaxExpires: now + 7200, LastUsed: now}, nil)
+
+		if _, err := NewService(mockDRepository, nil, frozen, sliding, recent).GetByID(context.Background(), "abc123"); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	})
+
+	t.Run("Should not extend tokens with a fixed expiration", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockDRepository := mocks.NewMockDRepository(mockCtrl)
+		mockDRepository.EXPECT().GetByID(gomock.Any(), "abc123").
+			Return(&accesstoken.AccessToken{AccessToken: "abc123", Expires: now + 600, LastUsed: now}, nil)
+
+		if _, err := NewService(mockDRepository, nil, frozen, sliding, recent).GetByID(context.Background(), "abc123"); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	})
+}
+
+func TestServiceLifetimePolicy(t *testing.T) {
+
+	policy := WithLifetimePolicy(accesstoken.LifetimePolicy{
+		Default: 8 * time.Hour,
+		Clients: map[int64]time.Duration{7: time.Hour},
+		Scopes:  map[string]time.Duration{"admin": 15 * time.Minute},
+	})
+	admins := WithScopePolicy(accesstoken.ScopePolicy{Users: map[string][]int64{accesstoken.ScopeAdmin: {1}}})
+
+	create := func(t *testing.T, clientId, scope string, opts ...Option) *accesstoken.AccessToken {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockUsersRepository := mocks.NewMockUsersRepository(mockCtrl)
+		mockUsersRepository.EXPECT().LoginUser(gomock.Any(), "daniel@gmail.com", "the_password").Return(&users.User{Id: 1}, nil)
+		mockDRepository := mocks.NewMockDRepository(mockCtrl)
+		mockDRepository.EXPECT().Create(gomock.Any(), gomock.Any()).Return(nil)
+
+		at, err := NewService(mockDRepository, mockUsersRepository, opts...).Create(context.Background(), &accesstoken.AtRequest{
+			GrantType: accesstoken.GrantTypePassword,
+			Username:  "daniel@gmail.com",
+			Password:  "the_password",
+			ClientId:  clientId,
+			Scope:     scope,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		return at
+	}
+
+	t.Run("Should issue tokens for the default lifetime", func(t *testing.T) {
+		if at := create(t, "", "books:read"); at.Lifetime() != 24*3600 {
+			t.Errorf("Expected a 24h lifetime, received %ds", at.Lifetime())
+		}
+		if at := create(t, "", "books:read", policy); at.Lifetime() != 8*3600 {
+			t.Errorf("Expected a 8h lifetime, received %ds", at.Lifetime())
+		}
+	})
+
+	t.Run("Should issue the tokens of a client for its lifetime", func(t *testing.T) {
+		clientsService := WithClients(&fakeClientsService{clients: map[string]*clientDomain.Client{"7": {Id: 7}}})
+		at := create(t, "7", "books:read", policy, clientsService)
+		if at.ClientId != 7 || at.Response().ExpiresIn != 3600 {
+			t.Errorf("Expected a 1h lifetime for client 7, received %+v", at.Response())
+		}
+	})
+
+	t.Run("Should shorten the tokens of sensitive scopes", func(t *testing.T) {
+		if at := create(t, "", "books:read admin", policy, admins); at.Lifetime() != 15*60 {
+			t.Errorf("Expected a 15m lifetime, received %ds", at.Lifetime())
+		}
+	})
+
+	t.Run("Should cap the sliding expiration with the lifetime", func(t *testing.T) {
+		sliding := WithSlidingExpiration(SlidingExpiration{IdleTimeout: time.Hour, MaxLifetime: 24 * time.Hour})
+		if at := create(t, "", "admin", policy, admins, sliding); at.MaxExpires != at.Created+15*60 || at.Expires != at.MaxExpires {
+			t.Errorf("Unexpected expiration %+v", at)
+		}
+	})
+}
+
+func TestNewLifetimePolicyFromConfig(t *testing.T) {
+
+	_ = os.Setenv("TOKEN_LIFETIME_CLIENTS", "12:1h")
+	_ = os.Setenv("TOKEN_LIFETIME_SCOPES", "admin:15m, books:write:2h")
+	defer os.Unsetenv("TOKEN_LIFETIME_CLIENTS")
+	defer os.Unsetenv("TOKEN_LIFETIME_SCOPES")
+
+	policy, err := NewLifetimePolicyFromConfig()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if policy.Default != accesstoken.DefaultLifetime || policy.Clients[12] != time.Hour ||
+		policy.Scopes["admin"] != 15*time.Minute || policy.Scopes["books:write"] != 2*time.Hour {
+		t.Errorf("Unexpected policy %+v", policy)
+	}
+
+	for _, invalid := range []string{"admin", "admin:forever", ":1h", "admin:-1h"} {
+		_ = os.Setenv("TOKEN_LIFETIME_SCOPES", invalid)
+		if _, err = NewLifetimePolicyFromConfig(); err == nil {
+			t.Errorf("%q should be rejected", invalid)
+		}
+	}
+
+	_ = os.Setenv("TOKEN_LIFETIME_SCOPES", "")
+	_ = os.Setenv("TOKEN_LIFETIME_CLIENTS", "storefront:24h")
+	if _, err = NewLifetimePolicyFromConfig(); err == nil {
+		t.Error("Client ids should be numeric")
+	}
+}
+
+func TestServiceScopePolicy(t *testing.T) {
+
+	create := func(t *testing.T, scope string, opts ...Option) errors.RestErr {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockUsersRepository := mocks.NewMockUsersRepository(mockCtrl)
+		mockUsersRepository.EXPECT().LoginUser(gomock.Any(), "daniel@gmail.com", "the_password").Return(&users.User{Id: 1}, nil)
+		mockDRepository := mocks.NewMockDRepository(mockCtrl)
+		mockDRepository.EXPECT().Create(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+
+		_, err := NewService(mockDRepository, mockUsersRepository, opts...).Create(context.Background(), &accesstoken.AtRequest{
+			GrantType: accesstoken.GrantTypePassword,
+			Username:  "daniel@gmail.com",
+			Password:  "the_password",
+			Scope:     scope,
+		})
+		return err
+	}
+
+	t.Run("Should reject the admin scope by default", func(t *testing.T) {
+		if err := create(t, "books:read admin"); err == nil || err.Status() != 400 {
+			t.Errorf("Status returned should be 400, received %v", err)
+		}
+	})
+
+	t.Run("Should grant restricted scopes to the listed users only", func(t *testing.T) {
+		policy := accesstoken.ScopePolicy{Users: map[string][]int64{accesstoken.ScopeAdmin: {1}, "payments:write": {2}}}
+		if err := create(t, "admin", WithScopePolicy(policy)); err != nil {
+			t.Errorf("error should be nil, received %v", err)
+		}
+		if err := create(t, "payments:write", WithScopePolicy(policy)); err == nil || err.Status() != 400 {
+			t.Errorf("Status returned should be 400, received %v", err)
+		}
+	})
+}
+
+func TestNewScopePolicyFromConfig(t *testing.T) {
+
+	_ = os.Setenv("TOKEN_SCOPE_USERS", "admin:1, admin:7,payments:write:12")
+	defer os.Unsetenv("TOKEN_SCOPE_USERS")
+
+	policy, err := NewScopePolicyFromConfig()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(policy.Users["admin"]) != 2 || policy.Users["admin"][1] != 7 || policy.Users["payments:write"][0] != 12 {
+		t.Errorf("Unexpected policy %+v", policy)
+	}
+
+	for _, invalid := range []string{"admin", "admin:daniel", ":1", "admin:-1"} {
+		_ = os.Setenv("TOKEN_SCOPE_USERS", invalid)
+		if _, err = NewScopePolicyFromConfig(); err == nil {
+			t.Errorf("%q should be rejected", invalid)
+		}
+	}
+}
+
+// fakeClientsService authenticates the clients it holds with the "the_secret" secret
+type fakeClientsService struct {
+	clients.Service
+	clients map[string]*clientDomain.Client
+}
+
+func (f *fakeClientsService) Authenticate(_ context.Context, clientId, secret string) (*clientDomain.Client, errors.RestErr) {
+	client, ok := f.clients[clientId]
+	if !ok || secret != "the_secret" {
+		return nil, errors.NewUnauthorizedError("Invalid client credentials")
+	}
+	return client, nil
+}
+
+func (f *fakeClientsService) Identify(_ context.Context, clientId string) (*clientDomain.Client, errors.RestErr) {
+	client, ok := f.clients[clientId]
+	if !ok {
+		return nil, errors.NewUnauthorizedError("Invalid client credentials")
+	}
+	return client, nil
+}
+
+func TestServiceTokenExchange(t *testing.T) {
+
+	now := int64(1600000000)
+	clientsService := WithClients(&fakeClientsService{clients: map[string]*clientDomain.Client{
+		"5": {Id: 5, Roles: []string{clientDomain.RoleTokenExchange}},
+		"6": {Id: 6},
+	}})
+	subject := &accesstoken.AccessToken{AccessToken: "subject", UserId: 1, ClientId: 2, Scope: "orders:read payments:write",
+		Created: now, Expires: now + 3600}
+	request := func(clientId, scope string) *accesstoken.AtRequest {
+		return &accesstoken.AtRequest{GrantType: accesstoken.GrantTypeTokenExchange, SubjectToken: "subject",
+			SubjectTokenType: accesstoken.TokenTypeAccessToken, ClientId: clientId, ClientSecret: "the_secret", Scope: scope}
+	}
+
+	t.Run("Should issue a narrower token acting for the client", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockDRepository := mocks.NewMockDRepository(mockCtrl)
+		mockDRepository.EXPECT().GetByID(gomock.Any(), "subject").Return(subject, nil)
+		mockDRepository.EXPECT().Create(gomock.Any(), gomock.Any()).Return(nil)
+
+		service := NewService(mockDRepository, nil, clientsService, WithClock(clocktest.NewClock(time.Unix(now, 0))))
+		at, err := service.Create(context.Background(), request("5", "payments:write"))
+
+		if err != nil {
+			t.Fatalf("error should be nil, received %v", err)
+		}
+		if at.UserId != 1 || at.ClientId != 5 || at.Scope != "payments:write" || at.Act == nil || at.Act.ClientId != 5 ||
+			at.Act.Act != nil {
+			t.Errorf("Unexpected access token %+v, act %+v", at, at.Act)
+		}
+		if at.Expires != now+3600 {
+			t.Errorf("The token should not outlive its subject, expires %d", at.Expires)
+		}
+		if at.AccessToken == "subject" || len(at.AccessToken) != 32 {
+			t.Errorf("Unexpected token value %q", at.AccessToken)
+		}
+	})
+
+	t.Run("Should keep the actor chain of an exchanged subject token", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		exchanged := *subject
+		exchanged.Act = &accesstoken.Actor{ClientId: 2}
+		mockDRepository := mocks.NewMockDRepository(mockCtrl)
+		mockDRepository.EXPECT().GetByID(gomock.Any(), "subject").Return(&exchanged, nil)
+		mockDRepository.EXPECT().Create(gomock.Any(), gomock.Any()).Return(nil)
+
+		service := NewService(mockDRepository, nil, clientsService, WithClock(clocktest.NewClock(time.Unix(now, 0))))
+		at, err := service.Create(context.Background(), request("5", ""))
+
+		if err != nil {
+			t.Fatalf("error should be nil, received %v", err)
+		}
+		if at.Scope != subject.Scope || at.Act.ClientId != 5 || at.Act.Act == nil || at.Act.Act.ClientId != 2 {
+			t.Errorf("Unexpected access token %+v, act %+v", at, at.Act)
+		}
+	})
+
+	t.Run("Should reject invalid exchanges", func(t *testing.T) {
+		expired := *subject
+		expired.Expires = now - 1
+		notFound := errors.NewNotFoundError("No access token found with given id")
+
+		for _, tc := range []struct {
+			name      string
+			request   *accesstoken.AtRequest
+			subject   *accesstoken.AccessToken
+			lookupErr errors.RestErr
+			status    int
+			message   string
+		}{
+			{"unknown client", request("7", ""), nil, nil, 401, "Invalid client credentials"},
+			{"client without the token exchange role", request("6", ""), nil, nil, 400, "Client is not allowed to exchange tokens"},
+			{"unknown subject token", request("5", ""), nil, notFound, 400, "Invalid subject token"},
+			{"expired subject token", request("5", ""), &expired, nil, 400, "Invalid subject token"},
+			{"scope not granted to the subject", request("5", "payments:write admin"), subject, nil, 400,
+				"Requested scope exceeds the scope of the subject token"},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				mockCtrl := gomock.NewController(t)
+				defer mockCtrl.Finish()
+
+				mockDRepository := mocks.NewMockDRepository(mockCtrl)
+				if tc.subject != nil || tc.lookupErr != nil {
+					mockDRepository.EXPECT().GetByID(gomock.Any(), "subject").Return(tc.subject, tc.lookupErr)
+				}
+
+				service := NewService(mockDRepository, nil, clientsService, WithClock(clocktest.NewClock(time.Unix(now, 0))))
+				at, err := service.Create(context.Background(), tc.request)
+
+				if at != nil || err == nil || err.Status() != tc.status || err.Message() != tc.message {
+					t.Errorf("Unexpected result %+v, %v", at, err)
+				}
+			})
+		}
+	})
+
+	t.Run("Should not support the grant without a clients service", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		_, err := NewService(mocks.NewMockDRepository(mockCtrl), nil).Create(context.Background(), request("5", ""))
+
+		if err == nil || err.Status() != 400 || err.Message() != "Invalid grantType parameter" {
+			t.Errorf("Unexpected error %v", err)
+		}
+	})
+}
+
+// fakeDeviceService answers polls of "device-code" with auth, or err while it is set
+type fakeDeviceService struct {
+	device.Service
+	auth *deviceDomain.Authorization
+	err  errors.RestErr
+}
+
+func (f *fakeDeviceService) Poll(_ context.Context, deviceCode, clientId string) (*deviceDomain.Authorization, errors.RestErr) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	if deviceCode != "device-code" || clientId != "7" {
+		return nil, errors.NewBadRequestError(deviceDomain.ErrInvalidGrant)
+	}
+	return f.auth, nil
+}
+
+func TestServiceDeviceCode(t *testing.T) {
+
+	request := &accesstoken.AtRequest{GrantType: accesstoken.GrantTypeDeviceCode, DeviceCode: "device-code", ClientId: "7"}
+
+	t.Run("Should issue the token approved for the device", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockDRepository := mocks.NewMockDRepository(mockCtrl)
+		mockDRepository.EXPECT().Create(gomock.Any(), gomock.Any()).Return(nil)
+
+		deviceService := WithDevice(&fakeDeviceService{auth: &deviceDomain.Authorization{ClientId: 7, UserId: 1, Scope: "books:read"}})
+		at, err := NewService(mockDRepository, nil, deviceService).Create(context.Background(), request)
+
+		if err != nil {
+			t.Fatalf("error should be nil, received %v", err)
+		}
+		if at.UserId != 1 || at.ClientId != 7 || at.Scope != "books:read" {
+			t.Errorf("Unexpected access token %+v", at)
+		}
+	})
+
+	t.Run("Should return the poll errors", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		deviceService := WithDevice(&fakeDeviceService{err: errors.NewBadRequestError(deviceDomain.ErrSlowDown)})
+		_, err := NewService(mocks.NewMockDRepository(mockCtrl), nil, deviceService).Create(context.Background(), request)
+
+		if err == nil || err.Status() != 400 || err.Message() != deviceDomain.ErrSlowDown {
+			t.Errorf("Expected %s, received %v", deviceDomain.ErrSlowDown, err)
+		}
+	})
+
+	t.Run("Should not support the grant without a device service", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		_, err := NewService(mocks.NewMockDRepository(mockCtrl), nil).Create(context.Background(), request)
+
+		if err == nil || err.Status() != 400 || err.Message() != "Invalid grantType parameter" {
+			t.Errorf("Unexpected error %v", err)
+		}
+	})
+}
+
+// fakeOidcService signs id tokens as "id-token-<client>", recording the user it was given
+type fakeOidcService struct {
+	oidc.Service
+	user *users.User
+}
+
+func (f *fakeOidcService) IdToken(_ context.Context, at *accesstoken.AccessToken, user *users.User) (string, errors.RestErr) {
+	f.user = user
+	return fmt.Sprintf("id-token-%d", at.ClientId), nil
+}
+
+func TestServiceOpenId(t *testing.T) {
+
+	clientsService := WithClients(&fakeClientsService{clients: map[string]*clientDomain.Client{"7": {Id: 7}}})
+	request := func(clientId string) *accesstoken.AtRequest {
+		return &accesstoken.AtRequest{GrantType: accesstoken.GrantTypePassword, Username: "daniel@gmail.com",
+			Password: "the_password", ClientId: clientId, Scope: "openid email"}
+	}
+
+	t.Run("Should issue an id token to the client of the password grant", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		user := &users.User{Id: 1, Email: "daniel@gmail.com"}
+		mockUsersRepository := mocks.NewMockUsersRepository(mockCtrl)
+		mockUsersRepository.EXPECT().LoginUser(gomock.Any(), "daniel@gmail.com", "the_password").Return(user, nil)
+		mockDRepository := mocks.NewMockDRepository(mockCtrl)
+		mockDRepository.EXPECT().Create(gomock.Any(), gomock.Any()).Return(nil)
+
+		oidcService := &fakeOidcService{}
+		at, err := NewService(mockDRepository, mockUsersRepository, clientsService, WithOidc(oidcService)).
+			Create(context.Background(), request("7"))
+
+		if err != nil {
+			t.Fatalf("error should be nil, received %v", err)
+		}
+		if at.ClientId != 7 || at.IdToken != "id-token-7" {
+			t.Errorf("Unexpected access token %+v, id token %s", at, at.IdToken)
+		}
+		if oidcService.user != user {
+			t.Error("The id token should be signed with the logged in user")
+		}
+	})
+
+	t.Run("Should require a registered client", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		service := NewService(mocks.NewMockDRepository(mockCtrl), mocks.NewMockUsersRepository(mockCtrl), clientsService,
+			WithOidc(&fakeOidcService{}))
+
+		if _, err := service.Create(context.Background(), request("")); err == nil || err.Message() != "Invalid clientId parameter" {
+			t.Errorf("Expected Invalid clientId parameter, received %v", err)
+		}
+		if _, err := service.Create(context.Background(), request("8")); err == nil || err.Status() != 401 {
+			t.Errorf("Unknown clients should be rejected, received %v", err)
+		}
+	})
+
+	t.Run("Should ignore the openid scope without oidc service", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockUsersRepository := mocks.NewMockUsersRepository(mockCtrl)
+		mockUsersRepository.EXPECT().LoginUser(gomock.Any(), "daniel@gmail.com", "the_password").Return(&users.User{Id: 1}, nil)
+		mockDRepository := mocks.NewMockDRepository(mockCtrl)
+		mockDRepository.EXPECT().Create(gomock.Any(), gomock.Any()).Return(nil)
+
+		at, err := NewService(mockDRepository, mockUsersRepository).Create(context.Background(), request(""))
+
+		if err != nil {
+			t.Fatalf("error should be nil, received %v", err)
+		}
+		if at.ClientId != 0 || at.IdToken != "" {
+			t.Errorf("Unexpected access token %+v, id token %s", at, at.IdToken)
+		}
+	})
+
+	t.Run("Should issue an id token to the device", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockDRepository := mocks.NewMockDRepository(mockCtrl)
+		mockDRepository.EXPECT().Create(gomock.Any(), gomock.Any()).Return(nil)
+
+		oidcService := &fakeOidcService{}
+		deviceService := WithDevice(&fakeDeviceService{auth: &deviceDomain.Authorization{ClientId: 7, UserId: 1, Scope: "openid"}})
+		at, err := NewService(mockDRepository, nil, deviceService, WithOidc(oidcService)).Create(context.Background(),
+			&accesstoken.AtRequest{GrantType: accesstoken.GrantTypeDeviceCode, DeviceCode: "device-code", ClientId: "7"})
+
+		if err != nil {
+			t.Fatalf("error should be nil, received %v", err)
+		}
+		if at.IdToken != "id-token-7" || oidcService.user != nil {
+			t.Errorf("The id token should be signed with the user fetched by the oidc service, received %s", at.IdToken)
+		}
+	})
+}
+
+func TestServiceGrantTypes(t *testing.T) {
+
+	grantTypes := NewService(nil, nil).GrantTypes()
+	if len(grantTypes) != 1 || grantTypes[0] != accesstoken.GrantTypePassword {
+		t.Errorf("Only the password grant should be enabled by default, received %v", grantTypes)
+	}
+
+	grantTypes = NewService(nil, nil, WithClients(&fakeClientsService{}), WithDevice(&fakeDeviceService{})).GrantTypes()
+	expected := []string{accesstoken.GrantTypePassword, accesstoken.GrantTypeTokenExchange, accesstoken.GrantTypeDeviceCode}
+	if fmt.Sprint(grantTypes) != fmt.Sprint(expected) {
+		t.Errorf("Expected: %v, Received: %v", expected, grantTypes)
+	}
+}
@@ -5,11 +5,12 @@
 package mocks
 
 import (
+	context "context"
 	reflect "reflect"
 
+	cql "github.com/danielgom/bookstore_oauthapi/src/datasource/cql"
 	accesstoken "github.com/danielgom/bookstore_oauthapi/src/domain/accesstoken"
 	errors "github.com/danielgom/bookstore_utils-go/errors"
-	gocql "github.com/gocql/gocql"
 	gomock "github.com/golang/mock/gomock"
 )
 
@@ -37,14 +38,14 @@ func (m *MockCQLSession) EXPECT() *MockCQLSessionMockRecorder {
 }
 
 // Query mocks base method.
-func (m *MockCQLSession) Query(arg0 string, arg1 ...interface{}) *gocql.Query {
+func (m *MockCQLSession) Query(arg0 string, arg1 ...interface{}) cql.Query {
 	m.ctrl.T.Helper()
 	varargs := []interface{}{arg0}
 	for _, a := range arg1 {
 		varargs = append(varargs, a)
 	}
 	ret := m.ctrl.Call(m, "Query", varargs...)
-	ret0, _ := ret[0].(*gocql.Query)
+	ret0, _ := ret[0].(cql.Query)
 	return ret0
 }
 
@@ -79,44 +80,117 @@ func (m *MockDRepository) EXPECT() *MockDRepositoryMockRecorder {
 }
 
 // Create mocks base method.
-func (m *MockDRepository) Create(arg0 *accesstoken.AccessToken) errors.RestErr {
+func (m *MockDRepository) Create(arg0 context.Context, arg1 *accesstoken.AccessToken) errors.RestErr {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Create", arg0)
+	ret := m.ctrl.Call(m, "Create", arg0, arg1)
 	ret0, _ := ret[0].(errors.RestErr)
 	return ret0
 }
 
 // Create indicates an expected call of Create.
-func (mr *MockDRepositoryMockRecorder) Create(arg0 interface{}) *gomock.Call {
+func (mr *MockDRepositoryMockRecorder) Create(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockDRepository)(nil).Create), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockDRepository)(nil).Create), arg0, arg1)
+}
+
+// Delete mocks base method.
+func (m *MockDRepository) Delete(arg0 context.Context, arg1 string) errors.RestErr {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", arg0, arg1)
+	ret0, _ := ret[0].(errors.RestErr)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockDRepositoryMockRecorder) Delete(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockDRepository)(nil).Delete), arg0, arg1)
+}
+
+// DeleteByClient mocks base method.
+func (m *MockDRepository) DeleteByClient(arg0 context.Context, arg1 int64) (int, errors.RestErr) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteByClient", arg0, arg1)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(errors.RestErr)
+	return ret0, ret1
+}
+
+// DeleteByClient indicates an expected call of DeleteByClient.
+func (mr *MockDRepositoryMockRecorder) DeleteByClient(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteByClient", reflect.TypeOf((*MockDRepository)(nil).DeleteByClient), arg0, arg1)
+}
+
+// DeleteByUser mocks base method.
+func (m *MockDRepository) DeleteByUser(arg0 context.Context, arg1 int64) (int, errors.RestErr) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteByUser", arg0, arg1)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(errors.RestErr)
+	return ret0, ret1
+}
+
+// DeleteByUser indicates an expected call of DeleteByUser.
+func (mr *MockDRepositoryMockRecorder) DeleteByUser(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteByUser", reflect.TypeOf((*MockDRepository)(nil).DeleteByUser), arg0, arg1)
 }
 
 // GetByID mocks base method.
-func (m *MockDRepository) GetByID(arg0 string) (*accesstoken.AccessToken, errors.RestErr) {
+func (m *MockDRepository) GetByID(arg0 context.Context, arg1 string) (*accesstoken.AccessToken, errors.RestErr) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetByID", arg0)
+	ret := m.ctrl.Call(m, "GetByID", arg0, arg1)
 	ret0, _ := ret[0].(*accesstoken.AccessToken)
 	ret1, _ := ret[1].(errors.RestErr)
 	return ret0, ret1
 }
 
 // GetByID indicates an expected call of GetByID.
-func (mr *MockDRepositoryMockRecorder) GetByID(arg0 interface{}) *gomock.Call {
+func (mr *MockDRepositoryMockRecorder) GetByID(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByID", reflect.TypeOf((*MockDRepository)(nil).GetByID), arg0, arg1)
+}
+
+// ListByUser mocks base method.
+func (m *MockDRepository) ListByUser(arg0 context.Context, arg1 int64) ([]accesstoken.AccessToken, errors.RestErr) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListByUser", arg0, arg1)
+	ret0, _ := ret[0].([]accesstoken.AccessToken)
+	ret1, _ := ret[1].(errors.RestErr)
+	return ret0, ret1
+}
+
+// ListByUser indicates an expected call of ListByUser.
+func (mr *MockDRepositoryMockRecorder) ListByUser(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByID", reflect.TypeOf((*MockDRepository)(nil).GetByID), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListByUser", reflect.TypeOf((*MockDRepository)(nil).ListByUser), arg0, arg1)
 }
 
 // UpdateExpirationTime mocks base method.
-func (m *MockDRepository) UpdateExpirationTime(arg0 *accesstoken.AccessToken) errors.RestErr {
+func (m *MockDRepository) UpdateExpirationTime(arg0 context.Context, arg1 *accesstoken.AccessToken) errors.RestErr {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UpdateExpirationTime", arg0)
+	ret := m.ctrl.Call(m, "UpdateExpirationTime", arg0, arg1)
 	ret0, _ := ret[0].(errors.RestErr)
 	return ret0
 }
 
 // UpdateExpirationTime indicates an expected call of UpdateExpirationTime.
-func (mr *MockDRepositoryMockRecorder) UpdateExpirationTime(arg0 interface{}) *gomock.Call {
+func (mr *MockDRepositoryMockRecorder) UpdateExpirationTime(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateExpirationTime", reflect.TypeOf((*MockDRepository)(nil).UpdateExpirationTime), arg0, arg1)
+}
+
+// UpdateLastUsed mocks base method.
+func (m *MockDRepository) UpdateLastUsed(arg0 context.Context, arg1 *accesstoken.AccessToken) errors.RestErr {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateLastUsed", arg0, arg1)
+	ret0, _ := ret[0].(errors.RestErr)
+	return ret0
+}
+
+// UpdateLastUsed indicates an expected call of UpdateLastUsed.
+func (mr *MockDRepositoryMockRecorder) UpdateLastUsed(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateExpirationTime", reflect.TypeOf((*MockDRepository)(nil).UpdateExpirationTime), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateLastUsed", reflect.TypeOf((*MockDRepository)(nil).UpdateLastUsed), arg0, arg1)
 }
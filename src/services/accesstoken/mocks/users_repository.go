@@ -5,6 +5,7 @@
 package mocks
 
 import (
+	context "context"
 	http "net/http"
 	reflect "reflect"
 
@@ -75,16 +76,54 @@ func (m *MockUsersRepository) EXPECT() *MockUsersRepositoryMockRecorder {
 }
 
 // LoginUser mocks base method.
-func (m *MockUsersRepository) LoginUser(arg0, arg1 string) (*users.User, errors.RestErr) {
+func (m *MockUsersRepository) LoginUser(arg0 context.Context, arg1, arg2 string) (*users.User, errors.RestErr) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "LoginUser", arg0, arg1)
+	ret := m.ctrl.Call(m, "LoginUser", arg0, arg1, arg2)
 	ret0, _ := ret[0].(*users.User)
 	ret1, _ := ret[1].(errors.RestErr)
 	return ret0, ret1
 }
 
 // LoginUser indicates an expected call of LoginUser.
-func (mr *MockUsersRepositoryMockRecorder) LoginUser(arg0, arg1 interface{}) *gomock.Call {
+func (mr *MockUsersRepositoryMockRecorder) LoginUser(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LoginUser", reflect.TypeOf((*MockUsersRepository)(nil).LoginUser), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LoginUser", reflect.TypeOf((*MockUsersRepository)(nil).LoginUser), arg0, arg1, arg2)
+}
+
+// MockProfilesRepository is a mock of ProfilesRepository interface.
+type MockProfilesRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockProfilesRepositoryMockRecorder
+}
+
+// MockProfilesRepositoryMockRecorder is the mock recorder for MockProfilesRepository.
+type MockProfilesRepositoryMockRecorder struct {
+	mock *MockProfilesRepository
+}
+
+// NewMockProfilesRepository creates a new mock instance.
+func NewMockProfilesRepository(ctrl *gomock.Controller) *MockProfilesRepository {
+	mock := &MockProfilesRepository{ctrl: ctrl}
+	mock.recorder = &MockProfilesRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockProfilesRepository) EXPECT() *MockProfilesRepositoryMockRecorder {
+	return m.recorder
+}
+
+// GetUser mocks base method.
+func (m *MockProfilesRepository) GetUser(arg0 context.Context, arg1 int64) (*users.User, errors.RestErr) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUser", arg0, arg1)
+	ret0, _ := ret[0].(*users.User)
+	ret1, _ := ret[1].(errors.RestErr)
+	return ret0, ret1
+}
+
+// GetUser indicates an expected call of GetUser.
+func (mr *MockProfilesRepositoryMockRecorder) GetUser(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUser", reflect.TypeOf((*MockProfilesRepository)(nil).GetUser), arg0, arg1)
 }
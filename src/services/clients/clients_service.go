@@ -0,0 +1,187 @@
+package clients
+
+import (
+	"context"
+	"crypto/x509"
+	"github.com/danielgom/bookstore_oauthapi/src/audit"
+	"github.com/danielgom/bookstore_oauthapi/src/clock"
+	"github.com/danielgom/bookstore_oauthapi/src/domain/clients"
+	"github.com/danielgom/bookstore_oauthapi/src/logger"
+	"github.com/danielgom/bookstore_oauthapi/src/repository/clientsdb"
+	"github.com/danielgom/bookstore_oauthapi/src/tracing"
+	"github.com/danielgom/bookstore_oauthapi/src/utils/cryptoutils"
+	"github.com/danielgom/bookstore_utils-go/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+)
+
+const (
+	invalidCredentials = "Invalid client credentials"
+	// secretLength is the number of random bytes of a rotated secret
+	secretLength = 32
+)
+
+type Option func(*service)
+
+// WithAudit records the secret rotations of the service in sink
+func WithAudit(sink audit.Sink) Option {
+	return func(s *service) {
+		s.auditSink = sink
+	}
+}
+
+// NewService returns a service authenticating clients of clientsRepo. It hashes a random secret on creation,
+// compared against when the client is unknown so that unknown and known clients take as long to reject
+func NewService(clientsRepo clientsdb.ClientsRepository, opts ...Option) (Service, error) {
+	secret, err := cryptoutils.GetRandomString(16)
+	if err != nil {
+		return nil, err
+	}
+	dummyHash, err := cryptoutils.GetBcrypt(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &service{clientsRepository: clientsRepo, dummyHash: dummyHash, clock: clock.System}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s, nil
+}
+
+type Service interface {
+	Authenticate(context.Context, string, string) (*clients.Client, errors.RestErr)
+	AuthenticateCertificate(context.Context, *x509.Certificate) (*clients.Client, errors.RestErr)
+	Identify(context.Context, string) (*clients.Client, errors.RestErr)
+	RotateSecret(context.Context, int64) (string, errors.RestErr)
+}
+
+type service struct {
+	clientsRepository clientsdb.ClientsRepository
+	dummyHash         string
+	auditSink         audit.Sink
+	clock             clock.Clock
+}
+
+// Authenticate checks the id and secret of a client, as sent with HTTP Basic authentication
+func (s *service) Authenticate(ctx context.Context, clientId, secret string) (*clients.Client, errors.RestErr) {
+
+	ctx, span := tracing.Tracer().Start(ctx, "clients.Service/Authenticate")
+	defer span.End()
+
+	var client *clients.Client
+	if id, parseErr := strconv.ParseInt(clientId, 10, 64); parseErr == nil {
+		var err errors.RestErr
+		client, err = s.clientsRepository.GetByID(ctx, id)
+		if err != nil && err.Status() != http.StatusNotFound {
+			tracing.SetError(span, err)
+			return nil, err
+		}
+	}
+
+	// unknown clients and clients without a secret are still compared, against the dummy hash
+	hash, known := s.dummyHash, false
+	if client != nil && client.SecretHash != "" {
+		hash, known = client.SecretHash, true
+	}
+
+	compareErr := cryptoutils.ComparePasswordHash(hash, secret)
+	if compareErr != nil && compareErr != cryptoutils.ErrPasswordMismatch {
+		return nil, errors.NewInternalServerError("Error when trying to verify client credentials", compareErr)
+	}
+	if compareErr != nil || !known {
+		return nil, errors.NewUnauthorizedError(invalidCredentials)
+	}
+
+	return client, nil
+}
+
+// AuthenticateCertificate returns the client named by the common name of a verified client certificate
+func (s *service) AuthenticateCertificate(ctx context.Context, cert *x509.Certificate) (*clients.Client, errors.RestErr) {
+
+	ctx, span := tracing.Tracer().Start(ctx, "clients.Service/AuthenticateCertificate")
+	defer span.End()
+
+	client, err := s.clientsRepository.GetByName(ctx, cert.Subject.CommonName)
+	if err != nil {
+		if err.Status() == http.StatusNotFound {
+			return nil, errors.NewUnauthorizedError(invalidCredentials)
+		}
+		tracing.SetError(span, err)
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// Identify returns the client of a client id sent without secret, for public clients such as devices which cannot
+// keep one. The caller must check the client holds the role of the grant it asks for
+func (s *service) Identify(ctx context.Context, clientId string) (*clients.Client, errors.RestErr) {
+
+	ctx, span := tracing.Tracer().Start(ctx, "clients.Service/Identify")
+	defer span.End()
+
+	id, parseErr := strconv.ParseInt(clientId, 10, 64)
+	if parseErr != nil {
+		return nil, errors.NewUnauthorizedError(invalidCredentials)
+	}
+
+	client, err := s.clientsRepository.GetByID(ctx, id)
+	if err != nil {
+		if err.Status() == http.StatusNotFound {
+			return nil, errors.NewUnauthorizedError(invalidCredentials)
+		}
+		tracing.SetError(span, err)
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// RotateSecret replaces the secret of a client with a random one, returned once as only its hash is stored. The
+// previous secret stops authenticating the client at once
+func (s *service) RotateSecret(ctx context.Context, clientId int64) (string, errors.RestErr) {
+
+	ctx, span := tracing.Tracer().Start(ctx, "clients.Service/RotateSecret",
+		trace.WithAttributes(attribute.Int64("oauth.client_id", clientId)))
+	defer span.End()
+
+	if _, err := s.clientsRepository.GetByID(ctx, clientId); err != nil {
+		tracing.SetError(span, err)
+		return "", err
+	}
+
+	secret, genErr := cryptoutils.GetRandomString(secretLength)
+	if genErr != nil {
+		return "", errors.NewInternalServerError("error generating client secret", genErr)
+	}
+	hash, hashErr := cryptoutils.GetBcrypt(secret)
+	if hashErr != nil {
+		return "", errors.NewInternalServerError("error hashing client secret", hashErr)
+	}
+
+	if err := s.clientsRepository.UpdateSecret(ctx, clientId, hash); err != nil {
+		tracing.SetError(span, err)
+		return "", err
+	}
+
+	event := audit.NewEvent(ctx, s.clock, audit.ClientSecretRotated)
+	event.ClientId = clientId
+	s.audit(ctx, event)
+
+	return secret, nil
+}
+
+// audit hands event to the audit sink, a failing sink is logged but never fails the request
+func (s *service) audit(ctx context.Context, event *audit.Event) {
+	if s.auditSink == nil {
+		return
+	}
+
+	if err := s.auditSink.Record(ctx, event); err != nil {
+		logger.FromContext(ctx).Error("audit event could not be recorded", zap.String("type", string(event.Type)), zap.Error(err))
+	}
+}
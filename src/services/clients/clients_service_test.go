@@ -0,0 +1,184 @@
+package clients
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"github.com/danielgom/bookstore_oauthapi/src/audit"
+	"github.com/danielgom/bookstore_oauthapi/src/clock/clocktest"
+	"github.com/danielgom/bookstore_oauthapi/src/domain/clients"
+	"github.com/danielgom/bookstore_oauthapi/src/utils/cryptoutils"
+	"github.com/danielgom/bookstore_utils-go/errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// fakeRepository serves clients from memory, failing every lookup when err is set
+type fakeRepository struct {
+	clients []clients.Client
+	err     errors.RestErr
+}
+
+func (f *fakeRepository) GetByID(_ context.Context, id int64) (*clients.Client, errors.RestErr) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	for _, client := range f.clients {
+		if client.Id == id {
+			return &client, nil
+		}
+	}
+	return nil, errors.NewNotFoundError("Client not found")
+}
+
+func (f *fakeRepository) GetByName(_ context.Context, name string) (*clients.Client, errors.RestErr) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	for _, client := range f.clients {
+		if client.Name == name {
+			return &client, nil
+		}
+	}
+	return nil, errors.NewNotFoundError("Client not found")
+}
+
+func (f *fakeRepository) UpdateSecret(_ context.Context, id int64, hash string) errors.RestErr {
+	if f.err != nil {
+		return f.err
+	}
+	for i := range f.clients {
+		if f.clients[i].Id == id {
+			f.clients[i].SecretHash = hash
+			return nil
+		}
+	}
+	return errors.NewNotFoundError("Client not found")
+}
+
+func TestAuthenticate(t *testing.T) {
+
+	hash, _ := cryptoutils.GetBcrypt("the_secret")
+	repository := &fakeRepository{clients: []clients.Client{
+		{Id: 1, Name: "books-api", SecretHash: hash, Roles: []string{clients.RoleResourceServer}},
+		{Id: 2, Name: "web"},
+	}}
+	service, err := NewService(repository)
+	if err != nil {
+		t.Fatalf("error should be nil, received %v", err)
+	}
+
+	t.Run("Should return the client with a valid secret", func(t *testing.T) {
+		client, err := service.Authenticate(context.Background(), "1", "the_secret")
+
+		if err != nil {
+			t.Fatalf("error should be nil, received %v", err)
+		}
+		if client.Id != 1 || !client.HasRole(clients.RoleResourceServer) {
+			t.Errorf("Unexpected client %+v", client)
+		}
+	})
+
+	t.Run("Should reject invalid credentials alike", func(t *testing.T) {
+		for _, credentials := range [][2]string{{"1", "wrong"}, {"3", "the_secret"}, {"books-api", "the_secret"},
+			{"2", ""}} {
+			_, err := service.Authenticate(context.Background(), credentials[0], credentials[1])
+
+			if err == nil || err.Status() != http.StatusUnauthorized || err.Message() != invalidCredentials {
+				t.Errorf("Expected unauthorized for %v, received %v", credentials, err)
+			}
+		}
+	})
+
+	t.Run("Should return the client of a certificate", func(t *testing.T) {
+		client, err := service.AuthenticateCertificate(context.Background(),
+			&x509.Certificate{Subject: pkix.Name{CommonName: "books-api"}})
+
+		if err != nil {
+			t.Fatalf("error should be nil, received %v", err)
+		}
+		if client.Id != 1 {
+			t.Errorf("Unexpected client %+v", client)
+		}
+
+		_, err = service.AuthenticateCertificate(context.Background(),
+			&x509.Certificate{Subject: pkix.Name{CommonName: "other"}})
+		if err == nil || err.Status() != http.StatusUnauthorized {
+			t.Errorf("Expected unauthorized, received %v", err)
+		}
+	})
+
+	t.Run("Should identify public clients by id", func(t *testing.T) {
+		client, err := service.Identify(context.Background(), "2")
+
+		if err != nil {
+			t.Fatalf("error should be nil, received %v", err)
+		}
+		if client.Name != "web" {
+			t.Errorf("Unexpected client %+v", client)
+		}
+
+		for _, clientId := range []string{"3", "web"} {
+			if _, err = service.Identify(context.Background(), clientId); err == nil || err.Status() != http.StatusUnauthorized {
+				t.Errorf("Expected unauthorized for %s, received %v", clientId, err)
+			}
+		}
+	})
+
+	t.Run("Should return repository errors", func(t *testing.T) {
+		repository.err = errors.NewInternalServerError("database error", nil)
+		defer func() { repository.err = nil }()
+
+		if _, err := service.Authenticate(context.Background(), "1", "the_secret"); err == nil ||
+			err.Status() != http.StatusInternalServerError {
+			t.Errorf("Expected internal server error, received %v", err)
+		}
+	})
+}
+
+func TestRotateSecret(t *testing.T) {
+
+	hash, _ := cryptoutils.GetBcrypt("the_secret")
+	repository := &fakeRepository{clients: []clients.Client{{Id: 1, Name: "books-api", SecretHash: hash}}}
+
+	var events []*audit.Event
+	sink := audit.SinkFunc(func(_ context.Context, event *audit.Event) error {
+		events = append(events, event)
+		return nil
+	})
+	clientsService, err := NewService(repository, WithAudit(sink))
+	if err != nil {
+		t.Fatalf("error should be nil, received %v", err)
+	}
+	clientsService.(*service).clock = clocktest.NewClock(time.Unix(1600000000, 0))
+
+	t.Run("Should replace the secret of the client", func(t *testing.T) {
+		secret, err := clientsService.RotateSecret(context.Background(), 1)
+		if err != nil || len(secret) != 2*secretLength {
+			t.Fatalf("Unexpected secret %q, %v", secret, err)
+		}
+
+		if _, err = clientsService.Authenticate(context.Background(), "1", secret); err != nil {
+			t.Errorf("The new secret should authenticate the client, received %v", err)
+		}
+		if _, err = clientsService.Authenticate(context.Background(), "1", "the_secret"); err == nil {
+			t.Error("The previous secret should not authenticate the client")
+		}
+
+		if len(events) != 1 || events[0].Type != audit.ClientSecretRotated || events[0].ClientId != 1 ||
+			events[0].Time.Unix() != 1600000000 {
+			t.Errorf("Unexpected events %+v", events)
+		}
+	})
+
+	t.Run("Should not rotate the secret of unknown clients", func(t *testing.T) {
+		events = nil
+		if _, err := clientsService.RotateSecret(context.Background(), 2); err == nil || err.Status() != http.StatusNotFound {
+			t.Errorf("Expected not found, received %v", err)
+		}
+		if len(events) != 0 {
+			t.Errorf("Unexpected events %+v", events)
+		}
+	})
+}
@@ -0,0 +1,36 @@
+package device
+
+import (
+	"github.com/danielgom/bookstore_oauthapi/src/config"
+	"time"
+)
+
+const (
+	envDeviceCodeExpiration  = "DEVICE_CODE_EXPIRATION"
+	envDevicePollInterval    = "DEVICE_POLL_INTERVAL"
+	envDeviceVerificationUri = "DEVICE_VERIFICATION_URI"
+)
+
+// Config of the device authorization flow
+type Config struct {
+	// Expiration is the time the user has to approve a code
+	Expiration time.Duration
+	// Interval is the initial minimum time between two polls of a device
+	Interval time.Duration
+	// VerificationUri is the page where users enter their code, shown on the device. The flow is not served without
+	VerificationUri string
+}
+
+// Enabled reports whether the verification page is configured
+func (c Config) Enabled() bool {
+	return c.VerificationUri != ""
+}
+
+// NewConfigFromConfig reads the DEVICE_* environment variables
+func NewConfigFromConfig() Config {
+	return Config{
+		Expiration:      config.GetDuration(envDeviceCodeExpiration, 10*time.Minute),
+		Interval:        config.GetDuration(envDevicePollInterval, 5*time.Second),
+		VerificationUri: config.GetString(envDeviceVerificationUri, ""),
+	}
+}
@@ -0,0 +1,198 @@
+package device
+
+import (
+	"context"
+	"github.com/danielgom/bookstore_oauthapi/src/clock"
+	clientDomain "github.com/danielgom/bookstore_oauthapi/src/domain/clients"
+	"github.com/danielgom/bookstore_oauthapi/src/domain/device"
+	"github.com/danielgom/bookstore_oauthapi/src/logger"
+	"github.com/danielgom/bookstore_oauthapi/src/repository/devicedb"
+	"github.com/danielgom/bookstore_oauthapi/src/services/clients"
+	"github.com/danielgom/bookstore_oauthapi/src/tracing"
+	"github.com/danielgom/bookstore_oauthapi/src/utils/cryptoutils"
+	"github.com/danielgom/bookstore_utils-go/errors"
+	"go.uber.org/zap"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func NewService(deviceRepo devicedb.DeviceRepository, clientsService clients.Service, config Config) Service {
+	return &service{deviceRepository: deviceRepo, clientsService: clientsService, config: config, clock: clock.System}
+}
+
+type Service interface {
+	Authorize(context.Context, *device.AuthorizationRequest) (*device.AuthorizationResponse, errors.RestErr)
+	Approve(context.Context, string, int64) (*device.Approval, errors.RestErr)
+	Deny(context.Context, string, int64) (*device.Approval, errors.RestErr)
+	Poll(context.Context, string, string) (*device.Authorization, errors.RestErr)
+}
+
+type service struct {
+	deviceRepository devicedb.DeviceRepository
+	clientsService   clients.Service
+	config           Config
+	clock            clock.Clock
+}
+
+// Authorize starts the flow for a device client, returning the codes to poll with and to show to the user
+func (s *service) Authorize(ctx context.Context, request *device.AuthorizationRequest) (*device.AuthorizationResponse, errors.RestErr) {
+
+	ctx, span := tracing.Tracer().Start(ctx, "device.Service/Authorize")
+	defer span.End()
+
+	if err := request.Validate(); err != nil {
+		return nil, err
+	}
+
+	client, err := s.clientsService.Identify(ctx, request.ClientId)
+	if err != nil {
+		return nil, err
+	}
+	if !client.HasRole(clientDomain.RoleDevice) {
+		return nil, errors.NewBadRequestError("Client is not allowed to use the device flow")
+	}
+
+	deviceCode, genErr := cryptoutils.GetRandomString(32)
+	if genErr != nil {
+		return nil, errors.NewInternalServerError("error generating device code", genErr)
+	}
+	userCode, genErr := device.NewUserCode()
+	if genErr != nil {
+		return nil, errors.NewInternalServerError("error generating user code", genErr)
+	}
+
+	auth := &device.Authorization{
+		DeviceCode: deviceCode,
+		UserCode:   userCode,
+		ClientId:   client.Id,
+		Scope:      request.Scope,
+		Expires:    s.clock.Now().Add(s.config.Expiration).Unix(),
+		Interval:   int64(s.config.Interval / time.Second),
+		Status:     device.StatusPending,
+	}
+	if err = s.deviceRepository.Save(ctx, auth); err != nil {
+		tracing.SetError(span, err)
+		return nil, err
+	}
+
+	logger.FromContext(ctx).Info("device authorization started", zap.Int64("clientId", client.Id))
+
+	return &device.AuthorizationResponse{
+		DeviceCode:              deviceCode,
+		UserCode:                device.FormatUserCode(userCode),
+		VerificationUri:         s.config.VerificationUri,
+		VerificationUriComplete: s.config.VerificationUri + "?user_code=" + url.QueryEscape(device.FormatUserCode(userCode)),
+		ExpiresIn:               int64(s.config.Expiration / time.Second),
+		Interval:                auth.Interval,
+	}, nil
+}
+
+// Approve lets the device of userCode obtain a token of the user on its next poll
+func (s *service) Approve(ctx context.Context, userCode string, userId int64) (*device.Approval, errors.RestErr) {
+	return s.decide(ctx, userCode, userId, device.StatusApproved)
+}
+
+// Deny fails the next poll of the device of userCode with access_denied
+func (s *service) Deny(ctx context.Context, userCode string, userId int64) (*device.Approval, errors.RestErr) {
+	return s.decide(ctx, userCode, userId, device.StatusDenied)
+}
+
+func (s *service) decide(ctx context.Context, userCode string, userId int64, status string) (*device.Approval, errors.RestErr) {
+
+	ctx, span := tracing.Tracer().Start(ctx, "device.Service/Decide")
+	defer span.End()
+
+	auth, err := s.deviceRepository.GetByUserCode(ctx, device.NormalizeUserCode(userCode))
+	if err != nil {
+		return nil, err
+	}
+	// a code is decided once, by a single user
+	if auth.Status != device.StatusPending || auth.Expires <= s.clock.Now().Unix() {
+		return nil, errors.NewNotFoundError("No device authorization found with given code")
+	}
+
+	auth.Status = status
+	auth.UserId = userId
+	decided, err := s.deviceRepository.Decide(ctx, auth)
+	if err != nil {
+		tracing.SetError(span, err)
+		return nil, err
+	}
+	// another user decided the code since it was read
+	if !decided {
+		return nil, errors.NewNotFoundError("No device authorization found with given code")
+	}
+
+	logger.FromContext(ctx).Info("device authorization decided", zap.Int64("clientId", auth.ClientId),
+		zap.Int64("userId", userId), zap.String("status", status))
+
+	return &device.Approval{ClientId: auth.ClientId, Scope: auth.Scope, Status: status}, nil
+}
+
+// Poll returns the authorization of deviceCode once approved, consuming it. Until then it answers the RFC 8628
+// errors: authorization_pending, slow_down when the device polls faster than its interval, which grows by
+// SlowDownIncrement seconds each time, access_denied and expired_token
+func (s *service) Poll(ctx context.Context, deviceCode, clientId string) (*device.Authorization, errors.RestErr) {
+
+	ctx, span := tracing.Tracer().Start(ctx, "device.Service/Poll")
+	defer span.End()
+
+	auth, err := s.deviceRepository.GetByDeviceCode(ctx, deviceCode)
+	if err != nil {
+		// the expired authorizations are dropped by the repository
+		if err.Status() == http.StatusNotFound {
+			return nil, errors.NewBadRequestError(device.ErrExpiredToken)
+		}
+		return nil, err
+	}
+
+	if strconv.FormatInt(auth.ClientId, 10) != strings.TrimSpace(clientId) {
+		return nil, errors.NewBadRequestError(device.ErrInvalidGrant)
+	}
+
+	now := s.clock.Now().Unix()
+	switch {
+	case auth.Expires <= now:
+		return nil, s.consume(ctx, auth, device.ErrExpiredToken)
+	case auth.Status == device.StatusDenied:
+		return nil, s.consume(ctx, auth, device.ErrAccessDenied)
+	case auth.Status == device.StatusApproved:
+		if err = s.consume(ctx, auth, ""); err != nil {
+			return nil, err
+		}
+		return auth, nil
+	}
+
+	code := device.ErrAuthorizationPending
+	if auth.LastPolled != 0 && now-auth.LastPolled < auth.Interval {
+		auth.Interval += device.SlowDownIncrement
+		code = device.ErrSlowDown
+	}
+	auth.LastPolled = now
+	// a decision made since the read is answered to the next poll
+	if _, err = s.deviceRepository.UpdatePolling(ctx, auth); err != nil {
+		tracing.SetError(span, err)
+		return nil, err
+	}
+
+	return nil, errors.NewBadRequestError(code)
+}
+
+// consume deletes a decided or expired authorization and returns the bad request of code, nil without code. Of
+// two polls consuming the same authorization, the one which did not delete it answers expired_token
+func (s *service) consume(ctx context.Context, auth *device.Authorization, code string) errors.RestErr {
+	consumed, err := s.deviceRepository.Delete(ctx, auth)
+	if err != nil {
+		return err
+	}
+	if !consumed {
+		return errors.NewBadRequestError(device.ErrExpiredToken)
+	}
+	if code == "" {
+		return nil
+	}
+	return errors.NewBadRequestError(code)
+}
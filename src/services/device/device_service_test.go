@@ -0,0 +1,279 @@
+package device
+
+import (
+	"context"
+	"github.com/danielgom/bookstore_oauthapi/src/clock/clocktest"
+	clientDomain "github.com/danielgom/bookstore_oauthapi/src/domain/clients"
+	"github.com/danielgom/bookstore_oauthapi/src/domain/device"
+	"github.com/danielgom/bookstore_oauthapi/src/services/clients"
+	"github.com/danielgom/bookstore_oauthapi/src/services/device/mocks"
+	"github.com/danielgom/bookstore_utils-go/errors"
+	"github.com/golang/mock/gomock"
+	"testing"
+	"time"
+)
+
+const now = int64(1600000000)
+
+// fakeClientsService identifies client 7, allowed to use the device flow, and client 8
+type fakeClientsService struct {
+	clients.Service
+}
+
+func (f *fakeClientsService) Identify(_ context.Context, clientId string) (*clientDomain.Client, errors.RestErr) {
+	switch clientId {
+	case "7":
+		return &clientDomain.Client{Id: 7, Roles: []string{clientDomain.RoleDevice}}, nil
+	case "8":
+		return &clientDomain.Client{Id: 8}, nil
+	}
+	return nil, errors.NewUnauthorizedError("Invalid client credentials")
+}
+
+func newTestService(repository *mocks.MockDeviceRepository) *service {
+	s := NewService(repository, &fakeClientsService{}, Config{
+		Expiration:      10 * time.Minute,
+		Interval:        5 * time.Second,
+		VerificationUri: "https://bookstore.example/device",
+	}).(*service)
+	s.clock = clocktest.NewClock(time.Unix(now, 0))
+	return s
+}
+
+func TestServiceAuthorize(t *testing.T) {
+
+	t.Run("Should save a pending authorization and return its codes", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		var saved *device.Authorization
+		mockRepository := mocks.NewMockDeviceRepository(mockCtrl)
+		mockRepository.EXPECT().Save(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, auth *device.Authorization) errors.RestErr {
+			saved = auth
+			return nil
+		})
+
+		response, err := newTestService(mockRepository).Authorize(context.Background(),
+			&device.AuthorizationRequest{ClientId: "7", Scope: "books:read"})
+
+		if err != nil {
+			t.Fatalf("error should be nil, received %v", err)
+		}
+		if saved.ClientId != 7 || saved.Scope != "books:read" || saved.Status != device.StatusPending ||
+			saved.Expires != now+600 || saved.Interval != 5 {
+			t.Errorf("Unexpected authorization %+v", saved)
+		}
+		if response.DeviceCode != saved.DeviceCode || len(response.DeviceCode) != 64 ||
+			response.UserCode != device.FormatUserCode(saved.UserCode) || response.ExpiresIn != 600 || response.Interval != 5 ||
+			response.VerificationUri != "https://bookstore.example/device" ||
+			response.VerificationUriComplete != "https://bookstore.example/device?user_code="+response.UserCode {
+			t.Errorf("Unexpected response %+v", response)
+		}
+	})
+
+	t.Run("Should reject clients not allowed to use the flow", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		service := newTestService(mocks.NewMockDeviceRepository(mockCtrl))
+
+		if _, err := service.Authorize(context.Background(), &device.AuthorizationRequest{ClientId: "8"}); err == nil || err.Status() != 400 {
+			t.Errorf("Expected bad request, received %v", err)
+		}
+		if _, err := service.Authorize(context.Background(), &device.AuthorizationRequest{ClientId: "9"}); err == nil || err.Status() != 401 {
+			t.Errorf("Expected unauthorized, received %v", err)
+		}
+		if _, err := service.Authorize(context.Background(), &device.AuthorizationRequest{}); err == nil || err.Status() != 400 {
+			t.Errorf("Expected bad request, received %v", err)
+		}
+	})
+}
+
+func TestServiceDecide(t *testing.T) {
+
+	pending := func() *device.Authorization {
+		return &device.Authorization{DeviceCode: "device-code", UserCode: "BCDFGHJK", ClientId: 7, Scope: "books:read",
+			Expires: now + 600, Interval: 5, Status: device.StatusPending}
+	}
+
+	t.Run("Should approve the code for the user", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockRepository := mocks.NewMockDeviceRepository(mockCtrl)
+		mockRepository.EXPECT().GetByUserCode(gomock.Any(), "BCDFGHJK").Return(pending(), nil)
+		mockRepository.EXPECT().Decide(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, auth *device.Authorization) (bool, errors.RestErr) {
+			if auth.Status != device.StatusApproved || auth.UserId != 1 {
+				t.Errorf("Unexpected authorization %+v", auth)
+			}
+			return true, nil
+		})
+
+		approval, err := newTestService(mockRepository).Approve(context.Background(), "bcdf-ghjk", 1)
+
+		if err != nil || approval.ClientId != 7 || approval.Scope != "books:read" || approval.Status != device.StatusApproved {
+			t.Errorf("Unexpected approval %+v, %v", approval, err)
+		}
+	})
+
+	t.Run("Should not decide a code twice nor after it expired", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		denied := pending()
+		denied.Status = device.StatusDenied
+		expired := pending()
+		expired.Expires = now
+
+		mockRepository := mocks.NewMockDeviceRepository(mockCtrl)
+		mockRepository.EXPECT().GetByUserCode(gomock.Any(), "BCDFGHJK").Return(denied, nil)
+		mockRepository.EXPECT().GetByUserCode(gomock.Any(), "BCDFGHJK").Return(expired, nil)
+		service := newTestService(mockRepository)
+
+		if _, err := service.Approve(context.Background(), "BCDFGHJK", 1); err == nil || err.Status() != 404 {
+			t.Errorf("Expected not found, received %v", err)
+		}
+		if _, err := service.Deny(context.Background(), "BCDFGHJK", 1); err == nil || err.Status() != 404 {
+			t.Errorf("Expected not found, received %v", err)
+		}
+	})
+
+	t.Run("Should not decide a code another user decided meanwhile", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockRepository := mocks.NewMockDeviceRepository(mockCtrl)
+		mockRepository.EXPECT().GetByUserCode(gomock.Any(), "BCDFGHJK").Return(pending(), nil)
+		mockRepository.EXPECT().Decide(gomock.Any(), gomock.Any()).Return(false, nil)
+
+		if _, err := newTestService(mockRepository).Approve(context.Background(), "BCDFGHJK", 1); err == nil || err.Status() != 404 {
+			t.Errorf("Expected not found, received %v", err)
+		}
+	})
+}
+
+func TestServicePoll(t *testing.T) {
+
+	authorization := func(status string, lastPolled int64) *device.Authorization {
+		return &device.Authorization{DeviceCode: "device-code", UserCode: "BCDFGHJK", ClientId: 7, Scope: "books:read",
+			Expires: now + 600, Interval: 5, LastPolled: lastPolled, Status: status, UserId: 1}
+	}
+
+	t.Run("Should answer authorization_pending and record the poll", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockRepository := mocks.NewMockDeviceRepository(mockCtrl)
+		mockRepository.EXPECT().GetByDeviceCode(gomock.Any(), "device-code").Return(authorization(device.StatusPending, now-5), nil)
+		mockRepository.EXPECT().UpdatePolling(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, auth *device.Authorization) (bool, errors.RestErr) {
+			if auth.LastPolled != now || auth.Interval != 5 {
+				t.Errorf("Unexpected authorization %+v", auth)
+			}
+			return true, nil
+		})
+
+		_, err := newTestService(mockRepository).Poll(context.Background(), "device-code", "7")
+
+		if err == nil || err.Status() != 400 || err.Message() != device.ErrAuthorizationPending {
+			t.Errorf("Expected %s, received %v", device.ErrAuthorizationPending, err)
+		}
+	})
+
+	t.Run("Should answer slow_down and raise the interval when polled too fast", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockRepository := mocks.NewMockDeviceRepository(mockCtrl)
+		mockRepository.EXPECT().GetByDeviceCode(gomock.Any(), "device-code").Return(authorization(device.StatusPending, now-4), nil)
+		mockRepository.EXPECT().UpdatePolling(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, auth *device.Authorization) (bool, errors.RestErr) {
+			if auth.LastPolled != now || auth.Interval != 10 {
+				t.Errorf("Unexpected authorization %+v", auth)
+			}
+			return true, nil
+		})
+
+		_, err := newTestService(mockRepository).Poll(context.Background(), "device-code", "7")
+
+		if err == nil || err.Status() != 400 || err.Message() != device.ErrSlowDown {
+			t.Errorf("Expected %s, received %v", device.ErrSlowDown, err)
+		}
+	})
+
+	t.Run("Should return and consume an approved authorization", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockRepository := mocks.NewMockDeviceRepository(mockCtrl)
+		mockRepository.EXPECT().GetByDeviceCode(gomock.Any(), "device-code").Return(authorization(device.StatusApproved, now-1), nil)
+		mockRepository.EXPECT().Delete(gomock.Any(), gomock.Any()).Return(true, nil)
+
+		auth, err := newTestService(mockRepository).Poll(context.Background(), "device-code", "7")
+
+		if err != nil || auth.UserId != 1 || auth.Scope != "books:read" {
+			t.Errorf("Unexpected result %+v, %v", auth, err)
+		}
+	})
+
+	t.Run("Should ignore the spaces around the client id", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockRepository := mocks.NewMockDeviceRepository(mockCtrl)
+		mockRepository.EXPECT().GetByDeviceCode(gomock.Any(), "device-code").Return(authorization(device.StatusApproved, now-1), nil)
+		mockRepository.EXPECT().Delete(gomock.Any(), gomock.Any()).Return(true, nil)
+
+		if auth, err := newTestService(mockRepository).Poll(context.Background(), "device-code", " 7 "); err != nil || auth.UserId != 1 {
+			t.Errorf("Unexpected result %+v, %v", auth, err)
+		}
+	})
+
+	t.Run("Should not return an approved authorization another poll consumed", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockRepository := mocks.NewMockDeviceRepository(mockCtrl)
+		mockRepository.EXPECT().GetByDeviceCode(gomock.Any(), "device-code").Return(authorization(device.StatusApproved, now-1), nil)
+		mockRepository.EXPECT().Delete(gomock.Any(), gomock.Any()).Return(false, nil)
+
+		auth, err := newTestService(mockRepository).Poll(context.Background(), "device-code", "7")
+
+		if auth != nil || err == nil || err.Status() != 400 || err.Message() != device.ErrExpiredToken {
+			t.Errorf("Expected %s, received %+v, %v", device.ErrExpiredToken, auth, err)
+		}
+	})
+
+	t.Run("Should answer the final errors", func(t *testing.T) {
+		expired := authorization(device.StatusPending, 0)
+		expired.Expires = now
+
+		for _, tc := range []struct {
+			auth     *device.Authorization
+			lookup   errors.RestErr
+			clientId string
+			deleted  bool
+			code     string
+		}{
+			{authorization(device.StatusDenied, 0), nil, "7", true, device.ErrAccessDenied},
+			{expired, nil, "7", true, device.ErrExpiredToken},
+			{nil, errors.NewNotFoundError("No device authorization found with given code"), "7", false, device.ErrExpiredToken},
+			{authorization(device.StatusApproved, 0), nil, "8", false, device.ErrInvalidGrant},
+		} {
+			t.Run(tc.code, func(t *testing.T) {
+				mockCtrl := gomock.NewController(t)
+				defer mockCtrl.Finish()
+
+				mockRepository := mocks.NewMockDeviceRepository(mockCtrl)
+				mockRepository.EXPECT().GetByDeviceCode(gomock.Any(), "device-code").Return(tc.auth, tc.lookup)
+				if tc.deleted {
+					mockRepository.EXPECT().Delete(gomock.Any(), gomock.Any()).Return(true, nil)
+				}
+
+				auth, err := newTestService(mockRepository).Poll(context.Background(), "device-code", tc.clientId)
+
+				if auth != nil || err == nil || err.Status() != 400 || err.Message() != tc.code {
+					t.Errorf("Expected %s, received %+v, %v", tc.code, auth, err)
+				}
+			})
+		}
+	})
+}
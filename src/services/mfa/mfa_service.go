@@ -0,0 +1,240 @@
+package mfa
+
+import (
+	"context"
+	"fmt"
+	"github.com/danielgom/bookstore_oauthapi/src/clock"
+	"github.com/danielgom/bookstore_oauthapi/src/domain/mfa"
+	"github.com/danielgom/bookstore_oauthapi/src/repository/mfadb"
+	"github.com/danielgom/bookstore_oauthapi/src/tracing"
+	"github.com/danielgom/bookstore_oauthapi/src/utils/cryptoutils"
+	"github.com/danielgom/bookstore_utils-go/errors"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	issuer = "Bookstore"
+)
+
+func NewService(mfaRepo mfadb.MfaRepository) Service {
+	return &service{mfaRepository: mfaRepo, clock: clock.System}
+}
+
+type Service interface {
+	Enroll(context.Context, int64, string) (*mfa.Enrollment, errors.RestErr)
+	Confirm(context.Context, int64, string) errors.RestErr
+	Disable(context.Context, int64, string) errors.RestErr
+	IsEnabled(context.Context, int64) (bool, errors.RestErr)
+	CreateChallenge(context.Context, int64, int64, string) (*mfa.Challenge, errors.RestErr)
+	VerifyChallenge(context.Context, string, string) (*mfa.Challenge, errors.RestErr)
+}
+
+type service struct {
+	mfaRepository mfadb.MfaRepository
+	clock         clock.Clock
+}
+
+// Enroll generates a new unconfirmed secret for the user, replacing any pending one
+func (s *service) Enroll(ctx context.Context, userId int64, account string) (*mfa.Enrollment, errors.RestErr) {
+
+	ctx, span := tracing.Tracer().Start(ctx, "mfa.Service/Enroll",
+		trace.WithAttributes(semconv.EnduserIDKey.String(strconv.FormatInt(userId, 10))))
+	defer span.End()
+
+	current, err := s.mfaRepository.GetSecret(ctx, userId)
+	if err != nil && err.Status() != http.StatusNotFound {
+		return nil, err
+	}
+
+	if current != nil && current.Confirmed {
+		return nil, errors.NewBadRequestError("MFA is already enabled for this user")
+	}
+
+	secret, genErr := cryptoutils.GenerateTotpSecret()
+	if genErr != nil {
+		return nil, errors.NewInternalServerError("error generating mfa secret", genErr)
+	}
+
+	if err = s.mfaRepository.SaveSecret(ctx, &mfa.Secret{UserId: userId, Secret: secret}); err != nil {
+		return nil, err
+	}
+
+	if account == "" {
+		account = fmt.Sprintf("user-%d", userId)
+	}
+
+	return &mfa.Enrollment{
+		Secret:     secret,
+		OtpAuthUri: cryptoutils.GetTotpUri(issuer, account, secret),
+	}, nil
+}
+
+// Confirm enables MFA once the user proves the authenticator app was set up
+func (s *service) Confirm(ctx context.Context, userId int64, code string) errors.RestErr {
+
+	ctx, span := tracing.Tracer().Start(ctx, "mfa.Service/Confirm",
+		trace.WithAttributes(semconv.EnduserIDKey.String(strconv.FormatInt(userId, 10))))
+	defer span.End()
+
+	secret, err := s.mfaRepository.GetSecret(ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	if secret.Confirmed {
+		return errors.NewBadRequestError("MFA is already enabled for this user")
+	}
+
+	// the step of the code is consumed so that it cannot complete a login challenge afterwards
+	step, ok := cryptoutils.TotpTimeStep(secret.Secret, strings.TrimSpace(code), s.clock.Now())
+	if !ok || step <= secret.LastTimeStep {
+		return errors.NewBadRequestError("Invalid otp code")
+	}
+
+	used, err := s.mfaRepository.UseTimeStep(ctx, secret, step)
+	if err != nil {
+		return err
+	}
+	if !used {
+		return errors.NewBadRequestError("Invalid otp code")
+	}
+
+	secret.LastTimeStep = step
+	secret.Confirmed = true
+	return s.mfaRepository.SaveSecret(ctx, secret)
+}
+
+func (s *service) Disable(ctx context.Context, userId int64, code string) errors.RestErr {
+
+	ctx, span := tracing.Tracer().Start(ctx, "mfa.Service/Disable",
+		trace.WithAttributes(semconv.EnduserIDKey.String(strconv.FormatInt(userId, 10))))
+	defer span.End()
+
+	secret, err := s.mfaRepository.GetSecret(ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	if secret.Confirmed && !cryptoutils.ValidateTotpCode(secret.Secret, strings.TrimSpace(code), s.clock.Now()) {
+		return errors.NewBadRequestError("Invalid otp code")
+	}
+
+	return s.mfaRepository.DeleteSecret(ctx, userId)
+}
+
+func (s *service) IsEnabled(ctx context.Context, userId int64) (bool, errors.RestErr) {
+
+	ctx, span := tracing.Tracer().Start(ctx, "mfa.Service/IsEnabled",
+		trace.WithAttributes(semconv.EnduserIDKey.String(strconv.FormatInt(userId, 10))))
+	defer span.End()
+
+	secret, err := s.mfaRepository.GetSecret(ctx, userId)
+	if err != nil {
+		if err.Status() == http.StatusNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return secret.Confirmed, nil
+}
+
+func (s *service) CreateChallenge(ctx context.Context, userId, clientId int64, scope string) (*mfa.Challenge, errors.RestErr) {
+
+	ctx, span := tracing.Tracer().Start(ctx, "mfa.Service/CreateChallenge",
+		trace.WithAttributes(semconv.EnduserIDKey.String(strconv.FormatInt(userId, 10))))
+	defer span.End()
+
+	token, genErr := cryptoutils.GetRandomString(32)
+	if genErr != nil {
+		return nil, errors.NewInternalServerError("error generating mfa token", genErr)
+	}
+
+	challenge := &mfa.Challenge{
+		MfaToken: token,
+		UserId:   userId,
+		ClientId: clientId,
+		Scope:    scope,
+		Expires:  s.clock.Now().Add(mfa.ChallengeExpirationTime).Unix(),
+	}
+
+	if err := s.mfaRepository.CreateChallenge(ctx, challenge); err != nil {
+		return nil, err
+	}
+
+	return challenge, nil
+}
+
+// VerifyChallenge consumes the challenge when code is valid for the challenged user. Each code counts as an attempt,
+// the challenge being discarded after mfa.MaxChallengeAttempts, and a code is only accepted once
+func (s *service) VerifyChallenge(ctx context.Context, mfaToken, code string) (*mfa.Challenge, errors.RestErr) {
+
+	ctx, span := tracing.Tracer().Start(ctx, "mfa.Service/VerifyChallenge")
+	defer span.End()
+
+	challenge, err := s.mfaRepository.GetChallenge(ctx, strings.TrimSpace(mfaToken))
+	if err != nil {
+		if err.Status() == http.StatusNotFound {
+			return nil, errors.NewBadRequestError("Invalid or expired mfaToken")
+		}
+		return nil, err
+	}
+
+	if challenge.IsExpired(s.clock) {
+		return nil, errors.NewBadRequestError("Invalid or expired mfaToken")
+	}
+
+	if challenge.Attempts >= mfa.MaxChallengeAttempts {
+		if _, err = s.mfaRepository.DeleteChallenge(ctx, challenge.MfaToken); err != nil {
+			return nil, err
+		}
+		return nil, errors.NewBadRequestError("Invalid or expired mfaToken")
+	}
+
+	// the attempt is counted before the code is checked so concurrent guesses cannot share one
+	counted, err := s.mfaRepository.AddChallengeAttempt(ctx, challenge)
+	if err != nil {
+		return nil, err
+	}
+	if !counted {
+		return nil, errors.NewBadRequestError("Invalid otp code")
+	}
+	challenge.Attempts++
+
+	secret, err := s.mfaRepository.GetSecret(ctx, challenge.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	step, ok := cryptoutils.TotpTimeStep(secret.Secret, strings.TrimSpace(code), s.clock.Now())
+	if !ok || step <= secret.LastTimeStep {
+		if challenge.Attempts >= mfa.MaxChallengeAttempts {
+			if _, err = s.mfaRepository.DeleteChallenge(ctx, challenge.MfaToken); err != nil {
+				return nil, err
+			}
+		}
+		return nil, errors.NewBadRequestError("Invalid otp code")
+	}
+
+	used, err := s.mfaRepository.UseTimeStep(ctx, secret, step)
+	if err != nil {
+		return nil, err
+	}
+	if !used {
+		return nil, errors.NewBadRequestError("Invalid otp code")
+	}
+
+	deleted, err := s.mfaRepository.DeleteChallenge(ctx, challenge.MfaToken)
+	if err != nil {
+		return nil, err
+	}
+	if !deleted {
+		return nil, errors.NewBadRequestError("Invalid or expired mfaToken")
+	}
+
+	return challenge, nil
+}
@@ -0,0 +1,336 @@
+package mfa
+
+import (
+	"context"
+	"github.com/danielgom/bookstore_oauthapi/src/clock/clocktest"
+	"github.com/danielgom/bookstore_oauthapi/src/domain/mfa"
+	"github.com/danielgom/bookstore_oauthapi/src/services/mfa/mocks"
+	"github.com/danielgom/bookstore_oauthapi/src/utils/cryptoutils"
+	"github.com/danielgom/bookstore_utils-go/errors"
+	"github.com/golang/mock/gomock"
+	"testing"
+	"time"
+)
+
+// now is the time of the test services
+var now = time.Unix(1600000000, 0)
+
+func newTestService(repository *mocks.MockMfaRepository) *service {
+	s := NewService(repository).(*service)
+	s.clock = clocktest.NewClock(now)
+	return s
+}
+
+func currentCode(t *testing.T, secret string) string {
+	code, err := cryptoutils.GetTotpCode(secret, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func TestServiceEnroll(t *testing.T) {
+
+	t.Run("Should save an unconfirmed secret", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockRepository := mocks.NewMockMfaRepository(mockCtrl)
+		mockRepository.EXPECT().GetSecret(gomock.Any(), int64(1)).Return(nil, errors.NewNotFoundError("No mfa secret found for given user"))
+		mockRepository.EXPECT().SaveSecret(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, secret *mfa.Secret) errors.RestErr {
+			if secret.UserId != 1 || secret.Confirmed || secret.Secret == "" {
+				t.Errorf("Unexpected secret %+v", secret)
+			}
+			return nil
+		})
+
+		enrollment, err := newTestService(mockRepository).Enroll(context.Background(), 1, "daniel@gmail.com")
+
+		if err != nil {
+			t.Fatal("error should be nil")
+		}
+		if enrollment.Secret == "" || enrollment.OtpAuthUri == "" {
+			t.Errorf("Unexpected enrollment %+v", enrollment)
+		}
+	})
+
+	t.Run("Should throw error when already enabled", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockRepository := mocks.NewMockMfaRepository(mockCtrl)
+		mockRepository.EXPECT().GetSecret(gomock.Any(), int64(1)).Return(&mfa.Secret{UserId: 1, Secret: "ABC", Confirmed: true}, nil)
+
+		enrollment, err := newTestService(mockRepository).Enroll(context.Background(), 1, "")
+
+		if enrollment != nil {
+			t.Error("enrollment should be nil")
+		}
+		if err == nil || err.Status() != 400 {
+			t.Error("Status returned should be 400")
+		}
+	})
+}
+
+func TestServiceConfirm(t *testing.T) {
+
+	secret, _ := cryptoutils.GenerateTotpSecret()
+
+	t.Run("Should confirm the secret with a valid code", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockRepository := mocks.NewMockMfaRepository(mockCtrl)
+		mockRepository.EXPECT().GetSecret(gomock.Any(), int64(1)).Return(&mfa.Secret{UserId: 1, Secret: secret}, nil)
+		mockRepository.EXPECT().UseTimeStep(gomock.Any(), gomock.Any(), now.Unix()/30).Return(true, nil)
+		mockRepository.EXPECT().SaveSecret(gomock.Any(),
+			&mfa.Secret{UserId: 1, Secret: secret, Confirmed: true, LastTimeStep: now.Unix() / 30}).Return(nil)
+
+		if err := newTestService(mockRepository).Confirm(context.Background(), 1, currentCode(t, secret)); err != nil {
+			t.Error("error should be nil")
+		}
+	})
+
+	t.Run("Should throw error with an invalid code", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockRepository := mocks.NewMockMfaRepository(mockCtrl)
+		mockRepository.EXPECT().GetSecret(gomock.Any(), int64(1)).Return(&mfa.Secret{UserId: 1, Secret: secret}, nil)
+
+		if err := newTestService(mockRepository).Confirm(context.Background(), 1, "000000x"); err == nil || err.Status() != 400 {
+			t.Error("Status returned should be 400")
+		}
+	})
+
+	t.Run("Should reject a code whose step was already used", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockRepository := mocks.NewMockMfaRepository(mockCtrl)
+		mockRepository.EXPECT().GetSecret(gomock.Any(), int64(1)).Return(&mfa.Secret{UserId: 1, Secret: secret, LastTimeStep: now.Unix() / 30}, nil)
+
+		if err := newTestService(mockRepository).Confirm(context.Background(), 1, currentCode(t, secret)); err == nil || err.Status() != 400 {
+			t.Error("Status returned should be 400")
+		}
+	})
+
+	t.Run("Should reject a code used concurrently", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockRepository := mocks.NewMockMfaRepository(mockCtrl)
+		mockRepository.EXPECT().GetSecret(gomock.Any(), int64(1)).Return(&mfa.Secret{UserId: 1, Secret: secret}, nil)
+		mockRepository.EXPECT().UseTimeStep(gomock.Any(), gomock.Any(), now.Unix()/30).Return(false, nil)
+
+		if err := newTestService(mockRepository).Confirm(context.Background(), 1, currentCode(t, secret)); err == nil || err.Status() != 400 {
+			t.Error("Status returned should be 400")
+		}
+	})
+}
+
+func TestServiceIsEnabled(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockRepository := mocks.NewMockMfaRepository(mockCtrl)
+	mockRepository.EXPECT().GetSecret(gomock.Any(), int64(1)).Return(nil, errors.NewNotFoundError("No mfa secret found for given user"))
+	mockRepository.EXPECT().GetSecret(gomock.Any(), int64(2)).Return(&mfa.Secret{UserId: 2, Secret: "ABC"}, nil)
+	mockRepository.EXPECT().GetSecret(gomock.Any(), int64(3)).Return(&mfa.Secret{UserId: 3, Secret: "ABC", Confirmed: true}, nil)
+
+	service := newTestService(mockRepository)
+
+	for userId, expected := range map[int64]bool{1: false, 2: false, 3: true} {
+		enabled, err := service.IsEnabled(context.Background(), userId)
+		if err != nil {
+			t.Fatal("error should be nil")
+		}
+		if enabled != expected {
+			t.Errorf("User %d expected: %t, Received: %t", userId, expected, enabled)
+		}
+	}
+}
+
+func TestServiceVerifyChallenge(t *testing.T) {
+
+	secret, _ := cryptoutils.GenerateTotpSecret()
+	newChallenge := func() *mfa.Challenge {
+		return &mfa.Challenge{MfaToken: "mfa-token", UserId: 1, Expires: now.Add(time.Minute).Unix()}
+	}
+
+	t.Run("Should consume the challenge with a valid code", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockRepository := mocks.NewMockMfaRepository(mockCtrl)
+		mockRepository.EXPECT().GetChallenge(gomock.Any(), "mfa-token").Return(newChallenge(), nil)
+		mockRepository.EXPECT().AddChallengeAttempt(gomock.Any(), gomock.Any()).Return(true, nil)
+		mockRepository.EXPECT().GetSecret(gomock.Any(), int64(1)).Return(&mfa.Secret{UserId: 1, Secret: secret, Confirmed: true}, nil)
+		mockRepository.EXPECT().UseTimeStep(gomock.Any(), gomock.Any(), now.Unix()/30).Return(true, nil)
+		mockRepository.EXPECT().DeleteChallenge(gomock.Any(), "mfa-token").Return(true, nil)
+
+		verified, err := newTestService(mockRepository).VerifyChallenge(context.Background(), "mfa-token", currentCode(t, secret))
+
+		if err != nil {
+			t.Fatal("error should be nil")
+		}
+		if verified.UserId != 1 {
+			t.Errorf("Expected: %d, Received: %d", 1, verified.UserId)
+		}
+	})
+
+	t.Run("Should throw error on unknown challenge", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockRepository := mocks.NewMockMfaRepository(mockCtrl)
+		mockRepository.EXPECT().GetChallenge(gomock.Any(), "unknown").Return(nil, errors.NewNotFoundError("No mfa challenge found with given token"))
+
+		_, err := newTestService(mockRepository).VerifyChallenge(context.Background(), "unknown", "123456")
+
+		if err == nil || err.Status() != 400 {
+			t.Error("Status returned should be 400")
+		}
+	})
+
+	t.Run("Should throw error on expired challenge", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockRepository := mocks.NewMockMfaRepository(mockCtrl)
+		mockRepository.EXPECT().GetChallenge(gomock.Any(), "mfa-token").
+			Return(&mfa.Challenge{MfaToken: "mfa-token", UserId: 1, Expires: now.Add(-time.Minute).Unix()}, nil)
+
+		_, err := newTestService(mockRepository).VerifyChallenge(context.Background(), "mfa-token", "123456")
+
+		if err == nil || err.Status() != 400 {
+			t.Error("Status returned should be 400")
+		}
+	})
+
+	t.Run("Should accept the challenge until it expires", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockRepository := mocks.NewMockMfaRepository(mockCtrl)
+		mockRepository.EXPECT().GetChallenge(gomock.Any(), "mfa-token").DoAndReturn(func(context.Context, string) (*mfa.Challenge, errors.RestErr) {
+			return &mfa.Challenge{MfaToken: "mfa-token", UserId: 1, Expires: now.Unix()}, nil
+		}).Times(2)
+		mockRepository.EXPECT().AddChallengeAttempt(gomock.Any(), gomock.Any()).Return(true, nil)
+		mockRepository.EXPECT().GetSecret(gomock.Any(), int64(1)).Return(&mfa.Secret{UserId: 1, Secret: secret, Confirmed: true}, nil)
+		mockRepository.EXPECT().UseTimeStep(gomock.Any(), gomock.Any(), gomock.Any()).Return(true, nil)
+		mockRepository.EXPECT().DeleteChallenge(gomock.Any(), "mfa-token").Return(true, nil)
+
+		service := newTestService(mockRepository)
+		if _, err := service.VerifyChallenge(context.Background(), "mfa-token", currentCode(t, secret)); err != nil {
+			t.Fatalf("The challenge should be valid at its expiration time, received %v", err)
+		}
+
+		service.clock.(*clocktest.Clock).Advance(time.Second)
+		if _, err := service.VerifyChallenge(context.Background(), "mfa-token", currentCode(t, secret)); err == nil || err.Status() != 400 {
+			t.Errorf("The challenge should be expired after its expiration time, received %v", err)
+		}
+	})
+
+	t.Run("Should throw error on invalid code", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockRepository := mocks.NewMockMfaRepository(mockCtrl)
+		mockRepository.EXPECT().GetChallenge(gomock.Any(), "mfa-token").Return(newChallenge(), nil)
+		mockRepository.EXPECT().AddChallengeAttempt(gomock.Any(), gomock.Any()).Return(true, nil)
+		mockRepository.EXPECT().GetSecret(gomock.Any(), int64(1)).Return(&mfa.Secret{UserId: 1, Secret: secret, Confirmed: true}, nil)
+
+		_, err := newTestService(mockRepository).VerifyChallenge(context.Background(), "mfa-token", "abcdef")
+
+		if err == nil || err.Status() != 400 {
+			t.Error("Status returned should be 400")
+		}
+	})
+
+	t.Run("Should discard the challenge after the last attempt", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		challenge := newChallenge()
+		challenge.Attempts = mfa.MaxChallengeAttempts - 1
+		mockRepository := mocks.NewMockMfaRepository(mockCtrl)
+		mockRepository.EXPECT().GetChallenge(gomock.Any(), "mfa-token").Return(challenge, nil)
+		mockRepository.EXPECT().AddChallengeAttempt(gomock.Any(), challenge).Return(true, nil)
+		mockRepository.EXPECT().GetSecret(gomock.Any(), int64(1)).Return(&mfa.Secret{UserId: 1, Secret: secret, Confirmed: true}, nil)
+		mockRepository.EXPECT().DeleteChallenge(gomock.Any(), "mfa-token").Return(true, nil)
+
+		_, err := newTestService(mockRepository).VerifyChallenge(context.Background(), "mfa-token", "abcdef")
+
+		if err == nil || err.Status() != 400 {
+			t.Error("Status returned should be 400")
+		}
+	})
+
+	t.Run("Should reject a challenge without attempts left", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		challenge := newChallenge()
+		challenge.Attempts = mfa.MaxChallengeAttempts
+		mockRepository := mocks.NewMockMfaRepository(mockCtrl)
+		mockRepository.EXPECT().GetChallenge(gomock.Any(), "mfa-token").Return(challenge, nil)
+		mockRepository.EXPECT().DeleteChallenge(gomock.Any(), "mfa-token").Return(true, nil)
+
+		_, err := newTestService(mockRepository).VerifyChallenge(context.Background(), "mfa-token", currentCode(t, secret))
+
+		if err == nil || err.Status() != 400 {
+			t.Error("Status returned should be 400")
+		}
+	})
+
+	t.Run("Should reject a concurrent attempt", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockRepository := mocks.NewMockMfaRepository(mockCtrl)
+		mockRepository.EXPECT().GetChallenge(gomock.Any(), "mfa-token").Return(newChallenge(), nil)
+		mockRepository.EXPECT().AddChallengeAttempt(gomock.Any(), gomock.Any()).Return(false, nil)
+
+		_, err := newTestService(mockRepository).VerifyChallenge(context.Background(), "mfa-token", currentCode(t, secret))
+
+		if err == nil || err.Status() != 400 {
+			t.Error("Status returned should be 400")
+		}
+	})
+
+	t.Run("Should reject a code already used", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		used := &mfa.Secret{UserId: 1, Secret: secret, Confirmed: true, LastTimeStep: now.Unix() / 30}
+		mockRepository := mocks.NewMockMfaRepository(mockCtrl)
+		mockRepository.EXPECT().GetChallenge(gomock.Any(), "mfa-token").Return(newChallenge(), nil)
+		mockRepository.EXPECT().AddChallengeAttempt(gomock.Any(), gomock.Any()).Return(true, nil)
+		mockRepository.EXPECT().GetSecret(gomock.Any(), int64(1)).Return(used, nil)
+
+		_, err := newTestService(mockRepository).VerifyChallenge(context.Background(), "mfa-token", currentCode(t, secret))
+
+		if err == nil || err.Status() != 400 {
+			t.Error("Status returned should be 400")
+		}
+	})
+
+	t.Run("Should reject a code accepted concurrently", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockRepository := mocks.NewMockMfaRepository(mockCtrl)
+		mockRepository.EXPECT().GetChallenge(gomock.Any(), "mfa-token").Return(newChallenge(), nil)
+		mockRepository.EXPECT().AddChallengeAttempt(gomock.Any(), gomock.Any()).Return(true, nil)
+		mockRepository.EXPECT().GetSecret(gomock.Any(), int64(1)).Return(&mfa.Secret{UserId: 1, Secret: secret, Confirmed: true}, nil)
+		mockRepository.EXPECT().UseTimeStep(gomock.Any(), gomock.Any(), gomock.Any()).Return(false, nil)
+
+		_, err := newTestService(mockRepository).VerifyChallenge(context.Background(), "mfa-token", currentCode(t, secret))
+
+		if err == nil || err.Status() != 400 {
+			t.Error("Status returned should be 400")
+		}
+	})
+}
@@ -0,0 +1,53 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"github.com/danielgom/bookstore_oauthapi/src/config"
+	"github.com/danielgom/bookstore_oauthapi/src/utils/cryptoutils"
+	"os"
+)
+
+const (
+	envOidcIssuer         = "OIDC_ISSUER"
+	envOidcSigningKeyFile = "OIDC_SIGNING_KEY_FILE"
+
+	generatedKeyBits = 2048
+)
+
+// Config of the OpenID Connect layer
+type Config struct {
+	// Issuer is the public URL of the service, the iss claim of its id tokens
+	Issuer string
+	// SigningKey signs the id tokens with RS256
+	SigningKey *rsa.PrivateKey
+	// KeyGenerated reports SigningKey was generated on startup, id tokens then only verify against this instance
+	KeyGenerated bool
+}
+
+// NewConfigFromConfig reads the OIDC_* environment variables. Without OIDC_SIGNING_KEY_FILE, a PEM encoded RSA key,
+// a key is generated
+func NewConfigFromConfig() (Config, error) {
+
+	c := Config{Issuer: config.GetString(envOidcIssuer, "http://localhost:8080")}
+
+	path := config.GetString(envOidcSigningKeyFile, "")
+	if path == "" {
+		key, err := rsa.GenerateKey(rand.Reader, generatedKeyBits)
+		if err != nil {
+			return Config{}, err
+		}
+		c.SigningKey, c.KeyGenerated = key, true
+		return c, nil
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+	if c.SigningKey, err = cryptoutils.ParseRSAPrivateKey(b); err != nil {
+		return Config{}, fmt.Errorf("invalid %s %s: %w", envOidcSigningKeyFile, path, err)
+	}
+	return c, nil
+}
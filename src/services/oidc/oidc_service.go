@@ -0,0 +1,97 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rsa"
+	"github.com/danielgom/bookstore_oauthapi/src/domain/accesstoken"
+	oidcDomain "github.com/danielgom/bookstore_oauthapi/src/domain/oidc"
+	"github.com/danielgom/bookstore_oauthapi/src/domain/users"
+	"github.com/danielgom/bookstore_oauthapi/src/repository/usersdb"
+	"github.com/danielgom/bookstore_oauthapi/src/tracing"
+	"github.com/danielgom/bookstore_oauthapi/src/utils/cryptoutils"
+	"github.com/danielgom/bookstore_utils-go/errors"
+	"strconv"
+)
+
+// NewService returns a service signing id tokens with the key of config, the claims of users are read from
+// profilesRepo
+func NewService(profilesRepo usersdb.ProfilesRepository, config Config) Service {
+	return &service{
+		profilesRepository: profilesRepo,
+		issuer:             config.Issuer,
+		key:                config.SigningKey,
+		jwk:                cryptoutils.NewSigningJWK(&config.SigningKey.PublicKey),
+	}
+}
+
+type Service interface {
+	Issuer() string
+	KeySet() oidcDomain.KeySet
+	IdToken(context.Context, *accesstoken.AccessToken, *users.User) (string, errors.RestErr)
+	UserInfo(context.Context, int64, []string) (*oidcDomain.UserInfo, errors.RestErr)
+}
+
+type service struct {
+	profilesRepository usersdb.ProfilesRepository
+	issuer             string
+	key                *rsa.PrivateKey
+	jwk                cryptoutils.JWK
+}
+
+func (s *service) Issuer() string {
+	return s.issuer
+}
+
+// KeySet returns the public key of the id tokens
+func (s *service) KeySet() oidcDomain.KeySet {
+	return oidcDomain.KeySet{Keys: []cryptoutils.JWK{s.jwk}}
+}
+
+// IdToken signs the id token accompanying at, issued to its client and expiring with it. The claims are read from
+// user, fetched from the users API when nil
+func (s *service) IdToken(ctx context.Context, at *accesstoken.AccessToken, user *users.User) (string, errors.RestErr) {
+
+	ctx, span := tracing.Tracer().Start(ctx, "oidc.Service/IdToken")
+	defer span.End()
+
+	if user == nil {
+		var err errors.RestErr
+		if user, err = s.profilesRepository.GetUser(ctx, at.UserId); err != nil {
+			tracing.SetError(span, err)
+			return "", err
+		}
+	}
+
+	claims := oidcDomain.IdToken{
+		Issuer:   s.issuer,
+		Audience: strconv.FormatInt(at.ClientId, 10),
+		Expires:  at.Expires,
+		IssuedAt: at.Created,
+		UserInfo: oidcDomain.NewUserInfo(user, at.Scopes()),
+	}
+	// the subject is the user of the token, whatever the users API answered
+	claims.Subject = strconv.FormatInt(at.UserId, 10)
+
+	idToken, err := cryptoutils.SignRS256(s.key, s.jwk.Kid, claims)
+	if err != nil {
+		return "", errors.NewInternalServerError("error signing id token", err)
+	}
+	return idToken, nil
+}
+
+// UserInfo returns the claims of the user released to a token of scopes
+func (s *service) UserInfo(ctx context.Context, userId int64, scopes []string) (*oidcDomain.UserInfo, errors.RestErr) {
+
+	ctx, span := tracing.Tracer().Start(ctx, "oidc.Service/UserInfo")
+	defer span.End()
+
+	user, err := s.profilesRepository.GetUser(ctx, userId)
+	if err != nil {
+		tracing.SetError(span, err)
+		return nil, err
+	}
+
+	info := oidcDomain.NewUserInfo(user, scopes)
+	info.Subject = strconv.FormatInt(userId, 10)
+	return &info, nil
+}
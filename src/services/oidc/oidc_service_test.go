@@ -0,0 +1,142 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/danielgom/bookstore_oauthapi/src/domain/accesstoken"
+	oidcDomain "github.com/danielgom/bookstore_oauthapi/src/domain/oidc"
+	"github.com/danielgom/bookstore_oauthapi/src/domain/users"
+	"github.com/danielgom/bookstore_utils-go/errors"
+	"math/big"
+	"os"
+	"strings"
+	"testing"
+)
+
+// fakeProfilesRepository returns the users it holds, counting the lookups
+type fakeProfilesRepository struct {
+	users   map[int64]*users.User
+	lookups int
+}
+
+func (f *fakeProfilesRepository) GetUser(_ context.Context, userId int64) (*users.User, errors.RestErr) {
+	f.lookups++
+	user, ok := f.users[userId]
+	if !ok {
+		return nil, errors.NewNotFoundError("User not found")
+	}
+	return user, nil
+}
+
+func newTestService(t *testing.T) (Service, *fakeProfilesRepository) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repository := &fakeProfilesRepository{users: map[int64]*users.User{
+		1: {Id: 1, FirstName: "Daniel", LastName: "Gomez", Email: "daniel@gmail.com"},
+	}}
+	return NewService(repository, Config{Issuer: "http://localhost:8080", SigningKey: key}), repository
+}
+
+// verify checks the signature of idToken against the key set of s and returns its claims
+func verify(t *testing.T, s Service, idToken string) oidcDomain.IdToken {
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		t.Fatalf("Expected a compact JWS, received %s", idToken)
+	}
+
+	jwk := s.KeySet().Keys[0]
+	n, _ := base64.RawURLEncoding.DecodeString(jwk.N)
+	e, _ := base64.RawURLEncoding.DecodeString(jwk.E)
+	key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+
+	signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		t.Fatalf("id token should verify against the key set, received %v", err)
+	}
+
+	var claims oidcDomain.IdToken
+	payload, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		t.Fatal(err)
+	}
+	return claims
+}
+
+func TestServiceIdToken(t *testing.T) {
+
+	at := &accesstoken.AccessToken{UserId: 1, ClientId: 7, Created: 1600000000, Expires: 1600003600, Scope: "openid email"}
+
+	t.Run("Should sign the claims of the user for the client of the token", func(t *testing.T) {
+		s, repository := newTestService(t)
+
+		idToken, err := s.IdToken(context.Background(), at, &users.User{Id: 1, Email: "daniel@gmail.com"})
+		if err != nil {
+			t.Fatalf("error should be nil, received %v", err)
+		}
+
+		expected := oidcDomain.IdToken{Issuer: "http://localhost:8080", Audience: "7", Expires: 1600003600,
+			IssuedAt: 1600000000, UserInfo: oidcDomain.UserInfo{Subject: "1", Email: "daniel@gmail.com"}}
+		if claims := verify(t, s, idToken); claims != expected {
+			t.Errorf("Expected: %+v, Received: %+v", expected, claims)
+		}
+		if repository.lookups != 0 {
+			t.Error("The given user should not be fetched again")
+		}
+	})
+
+	t.Run("Should fetch the user when not given", func(t *testing.T) {
+		s, repository := newTestService(t)
+
+		idToken, err := s.IdToken(context.Background(), at, nil)
+		if err != nil {
+			t.Fatalf("error should be nil, received %v", err)
+		}
+		if claims := verify(t, s, idToken); claims.Email != "daniel@gmail.com" || repository.lookups != 1 {
+			t.Errorf("The claims should be read from the users API, received %+v", claims)
+		}
+	})
+}
+
+func TestServiceUserInfo(t *testing.T) {
+
+	s, _ := newTestService(t)
+
+	info, err := s.UserInfo(context.Background(), 1, []string{"openid", "profile"})
+	if err != nil {
+		t.Fatalf("error should be nil, received %v", err)
+	}
+	expected := oidcDomain.UserInfo{Subject: "1", Name: "Daniel Gomez", GivenName: "Daniel", FamilyName: "Gomez"}
+	if *info != expected {
+		t.Errorf("Expected: %+v, Received: %+v", expected, *info)
+	}
+
+	if _, err = s.UserInfo(context.Background(), 2, []string{"openid"}); err == nil || err.Status() != 404 {
+		t.Errorf("Unknown users should not be found, received %v", err)
+	}
+}
+
+func TestNewConfigFromConfig(t *testing.T) {
+
+	c, err := NewConfigFromConfig()
+	if err != nil {
+		t.Fatalf("error should be nil, received %v", err)
+	}
+	if c.Issuer != "http://localhost:8080" || c.SigningKey == nil || !c.KeyGenerated {
+		t.Errorf("A key should be generated without %s, received %+v", envOidcSigningKeyFile, c)
+	}
+
+	os.Setenv(envOidcSigningKeyFile, "does-not-exist.pem")
+	defer os.Unsetenv(envOidcSigningKeyFile)
+
+	if _, err = NewConfigFromConfig(); err == nil {
+		t.Error("A missing key file should be an error")
+	}
+}
@@ -0,0 +1,42 @@
+package tracing
+
+import (
+	"context"
+	"github.com/gocql/gocql"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+	"strings"
+)
+
+// QueryObserver records a client span for every CQL statement, set it as the gocql.ClusterConfig QueryObserver.
+// Queries are only linked to the request trace when they are run WithContext
+type QueryObserver struct{}
+
+func (QueryObserver) ObserveQuery(ctx context.Context, q gocql.ObservedQuery) {
+
+	operation := statementOperation(q.Statement)
+
+	_, span := Tracer().Start(ctx, "cql "+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithTimestamp(q.Start),
+		trace.WithAttributes(
+			semconv.DBSystemCassandra,
+			semconv.DBCassandraKeyspaceKey.String(q.Keyspace),
+			semconv.DBOperationKey.String(operation),
+			semconv.DBStatementKey.String(q.Statement),
+		))
+
+	if q.Err != nil {
+		SetError(span, q.Err)
+	}
+
+	span.End(trace.WithTimestamp(q.End))
+}
+
+func statementOperation(statement string) string {
+	fields := strings.Fields(statement)
+	if len(fields) == 0 {
+		return "UNKNOWN"
+	}
+	return strings.ToUpper(fields[0])
+}
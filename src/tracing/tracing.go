@@ -0,0 +1,136 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"github.com/danielgom/bookstore_oauthapi/src/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+	"net/http"
+	"os"
+)
+
+const (
+	instrumentationName = "github.com/danielgom/bookstore_oauthapi"
+	serviceName         = "bookstore_oauthapi"
+
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterFile   = "file"
+	ExporterOtlp   = "otlp"
+
+	envTracingExporter     = "TRACING_EXPORTER"
+	envTracingFile         = "TRACING_FILE"
+	envTracingOtlpEndpoint = "TRACING_OTLP_ENDPOINT"
+	envTracingOtlpInsecure = "TRACING_OTLP_INSECURE"
+	envTracingSampleRatio  = "TRACING_SAMPLE_RATIO"
+)
+
+type Config struct {
+	// Exporter is one of none, stdout, file or otlp
+	Exporter string
+	// File receives the spans as JSON when Exporter is file
+	File string
+	// OtlpEndpoint is the host:port of an OTLP/HTTP collector
+	OtlpEndpoint string
+	OtlpInsecure bool
+	// SampleRatio is the fraction of new traces recorded, traces started by a sampled caller are always recorded
+	SampleRatio float64
+}
+
+// Tracer returns the tracer used for every span created by the oauth api
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// InitFromConfig calls Init with the configuration read from the TRACING_* environment variables
+func InitFromConfig() (func(context.Context) error, error) {
+	return Init(Config{
+		Exporter:     config.GetString(envTracingExporter, ExporterNone),
+		File:         config.GetString(envTracingFile, "traces.json"),
+		OtlpEndpoint: config.GetString(envTracingOtlpEndpoint, "localhost:4318"),
+		OtlpInsecure: config.GetBool(envTracingOtlpInsecure, false),
+		SampleRatio:  config.GetFloat(envTracingSampleRatio, 1),
+	})
+}
+
+// Init installs the W3C trace context propagator and, unless the exporter is none, a tracer provider.
+// The returned func flushes pending spans and must be called on shutdown
+func Init(c Config) (func(context.Context) error, error) {
+
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	exporter, closer, err := newExporter(c)
+	if err != nil {
+		return nil, err
+	}
+	if exporter == nil {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(c.SampleRatio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(serviceName))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if closer != nil {
+			if closeErr := closer.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		return err
+	}, nil
+}
+
+func newExporter(c Config) (sdktrace.SpanExporter, io.Closer, error) {
+	switch c.Exporter {
+	case "", ExporterNone:
+		return nil, nil, nil
+	case ExporterStdout:
+		exporter, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+		return exporter, nil, err
+	case ExporterFile:
+		f, err := os.OpenFile(c.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, nil, err
+		}
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			_ = f.Close()
+			return nil, nil, err
+		}
+		return exporter, f, nil
+	case ExporterOtlp:
+		opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(c.OtlpEndpoint)}
+		if c.OtlpInsecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		exporter, err := otlptracehttp.New(context.Background(), opts...)
+		return exporter, nil, err
+	default:
+		return nil, nil, fmt.Errorf("unknown tracing exporter %q", c.Exporter)
+	}
+}
+
+// InjectHeaders propagates the trace context of ctx to an outbound request
+func InjectHeaders(ctx context.Context, header http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+// SetError records err on span and marks it as failed
+func SetError(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
@@ -0,0 +1,114 @@
+package tracing
+
+import (
+	"context"
+	errors2 "errors"
+	"github.com/gocql/gocql"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newRecorder(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() {
+		otel.SetTracerProvider(trace.NewNoopTracerProvider())
+	})
+	return recorder
+}
+
+func TestQueryObserver(t *testing.T) {
+
+	recorder := newRecorder(t)
+
+	ctx, parent := Tracer().Start(context.Background(), "accesstoken.Service/Create")
+	start := time.Now().Add(-time.Second)
+	end := start.Add(20 * time.Millisecond)
+
+	QueryObserver{}.ObserveQuery(ctx, gocql.ObservedQuery{
+		Keyspace:  "oauth",
+		Statement: "INSERT INTO access_tokens(accesstoken) VALUES (?);",
+		Start:     start,
+		End:       end,
+		Err:       errors2.New("timeout"),
+	})
+	parent.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans, received %d", len(spans))
+	}
+
+	span := spans[0]
+	if span.Name() != "cql INSERT" || span.SpanKind() != trace.SpanKindClient {
+		t.Errorf("Unexpected span %s, kind %s", span.Name(), span.SpanKind())
+	}
+	if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Error("Query span should be a child of the request span")
+	}
+	if !span.StartTime().Equal(start) || !span.EndTime().Equal(end) {
+		t.Errorf("Span should use the query timestamps, received %s - %s", span.StartTime(), span.EndTime())
+	}
+	if span.Status().Code != codes.Error {
+		t.Error("Failed query should be marked as an error")
+	}
+}
+
+func TestInjectHeaders(t *testing.T) {
+
+	newRecorder(t)
+	if _, err := Init(Config{Exporter: ExporterNone}); err != nil {
+		t.Fatal("error should be nil")
+	}
+
+	ctx, span := Tracer().Start(context.Background(), "POST /users/login")
+	defer span.End()
+
+	header := http.Header{}
+	InjectHeaders(ctx, header)
+
+	traceparent := header.Get("traceparent")
+	if !strings.Contains(traceparent, span.SpanContext().TraceID().String()) {
+		t.Errorf("traceparent should carry the trace id, received %q", traceparent)
+	}
+}
+
+func TestInit(t *testing.T) {
+
+	t.Run("Should write spans to the file exporter", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "traces.json")
+
+		shutdown, err := Init(Config{Exporter: ExporterFile, File: path, SampleRatio: 1})
+		if err != nil {
+			t.Fatal("error should be nil")
+		}
+		defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+		_, span := Tracer().Start(context.Background(), "GET /oauth/accessToken/:atId")
+		span.End()
+
+		if err = shutdown(context.Background()); err != nil {
+			t.Fatal("error should be nil")
+		}
+
+		b, err := os.ReadFile(path)
+		if err != nil || !strings.Contains(string(b), "GET /oauth/accessToken/:atId") {
+			t.Errorf("Span should be exported to %s, received %q, %v", path, b, err)
+		}
+	})
+
+	t.Run("Should reject an unknown exporter", func(t *testing.T) {
+		if _, err := Init(Config{Exporter: "jaeger"}); err == nil {
+			t.Error("error should not be nil")
+		}
+	})
+}
@@ -2,6 +2,7 @@ package cryptoutils
 
 import (
 	"crypto/md5"
+	"crypto/rand"
 	"encoding/hex"
 )
 
@@ -11,3 +12,12 @@ func GetMd5(in string) string {
 	hash.Write([]byte(in))
 	return hex.EncodeToString(hash.Sum(nil))
 }
+
+// GetRandomString returns n random bytes hex encoded
+func GetRandomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
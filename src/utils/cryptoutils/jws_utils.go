@@ -0,0 +1,96 @@
+package cryptoutils
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+)
+
+// AlgRS256 is the RSASSA-PKCS1-v1_5 SHA-256 JWS algorithm, the one every OpenID Connect client supports
+const AlgRS256 = "RS256"
+
+// JWK is the RFC 7517 JSON Web Key of an RSA public key
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Kid string `json:"kid,omitempty"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// NewSigningJWK returns the key verifying the RS256 signatures of key, identified by its thumbprint
+func NewSigningJWK(key *rsa.PublicKey) JWK {
+	jwk := JWK{
+		Kty: "RSA",
+		Use: "sig",
+		Alg: AlgRS256,
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+	jwk.Kid = jwk.Thumbprint()
+	return jwk
+}
+
+// Thumbprint returns the RFC 7638 thumbprint of the key, the SHA-256 of its required members in lexicographic order
+func (k JWK) Thumbprint() string {
+	members, _ := json.Marshal(struct {
+		E   string `json:"e"`
+		Kty string `json:"kty"`
+		N   string `json:"n"`
+	}{k.E, k.Kty, k.N})
+	sum := sha256.Sum256(members)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// SignRS256 returns claims as a compact JWS signed by key, keyId naming the key in the header
+func SignRS256(key *rsa.PrivateKey, keyId string, claims interface{}) (string, error) {
+
+	header, err := json.Marshal(map[string]string{"alg": AlgRS256, "typ": "JWT", "kid": keyId})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// ParseRSAPrivateKey reads a PEM encoded RSA private key, in PKCS #1 or PKCS #8 form
+func ParseRSAPrivateKey(pemBytes []byte) (*rsa.PrivateKey, error) {
+
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, errors.New("no PEM encoded key found")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("the PEM encoded key is not an RSA key")
+	}
+	return rsaKey, nil
+}
@@ -0,0 +1,101 @@
+package cryptoutils
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"strings"
+	"testing"
+)
+
+func TestSignRS256(t *testing.T) {
+	t.Parallel()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwk := NewSigningJWK(&key.PublicKey)
+
+	token, err := SignRS256(key, jwk.Kid, map[string]string{"sub": "1"})
+	if err != nil {
+		t.Fatalf("error should be nil, received %v", err)
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("Expected a compact JWS, received %s", token)
+	}
+
+	header := make(map[string]string)
+	b, _ := base64.RawURLEncoding.DecodeString(parts[0])
+	if err := json.Unmarshal(b, &header); err != nil || header["alg"] != "RS256" || header["kid"] != jwk.Kid {
+		t.Errorf("Unexpected header %s", b)
+	}
+	if b, _ = base64.RawURLEncoding.DecodeString(parts[1]); string(b) != `{"sub":"1"}` {
+		t.Errorf("Unexpected payload %s", b)
+	}
+
+	signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], signature); err != nil {
+		t.Errorf("signature should verify, received %v", err)
+	}
+}
+
+func TestNewSigningJWK(t *testing.T) {
+	t.Parallel()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwk := NewSigningJWK(&key.PublicKey)
+
+	if jwk.Kty != "RSA" || jwk.Alg != "RS256" || jwk.Use != "sig" || jwk.E != "AQAB" {
+		t.Errorf("Unexpected key %+v", jwk)
+	}
+	if n, _ := base64.RawURLEncoding.DecodeString(jwk.N); string(n) != string(key.N.Bytes()) {
+		t.Error("The modulus should be the one of the key")
+	}
+
+	members := `{"e":"AQAB","kty":"RSA","n":"` + jwk.N + `"}`
+	sum := sha256.Sum256([]byte(members))
+	if jwk.Kid != base64.RawURLEncoding.EncodeToString(sum[:]) {
+		t.Errorf("The key id should be the RFC 7638 thumbprint, received %s", jwk.Kid)
+	}
+}
+
+func TestParseRSAPrivateKey(t *testing.T) {
+	t.Parallel()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs8, _ := x509.MarshalPKCS8PrivateKey(key)
+
+	encodings := map[string][]byte{
+		"RSA PRIVATE KEY": x509.MarshalPKCS1PrivateKey(key),
+		"PRIVATE KEY":     pkcs8,
+	}
+	for blockType, der := range encodings {
+		parsed, err := ParseRSAPrivateKey(pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}))
+		if err != nil {
+			t.Fatalf("%s: error should be nil, received %v", blockType, err)
+		}
+		if !parsed.Equal(key) {
+			t.Errorf("%s: the parsed key should be the encoded one", blockType)
+		}
+	}
+
+	if _, err := ParseRSAPrivateKey([]byte("not a key")); err == nil {
+		t.Error("Keys which are not PEM encoded should be rejected")
+	}
+}
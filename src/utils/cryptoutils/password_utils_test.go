@@ -0,0 +1,50 @@
+package cryptoutils
+
+import "testing"
+
+func TestComparePasswordHash(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Should match bcrypt hash", func(t *testing.T) {
+		t.Parallel()
+		hash, err := GetBcrypt("the-password")
+		if err != nil {
+			t.Fatal("error should be nil")
+		}
+
+		if err = ComparePasswordHash(hash, "the-password"); err != nil {
+			t.Error("error should be nil")
+		}
+
+		if err = ComparePasswordHash(hash, "wrong-password"); err != ErrPasswordMismatch {
+			t.Errorf("Expected: %v, Received: %v", ErrPasswordMismatch, err)
+		}
+	})
+
+	t.Run("Should match argon2id hash", func(t *testing.T) {
+		t.Parallel()
+		hash, err := GetArgon2("the-password")
+		if err != nil {
+			t.Fatal("error should be nil")
+		}
+
+		if err = ComparePasswordHash(hash, "the-password"); err != nil {
+			t.Error("error should be nil")
+		}
+
+		if err = ComparePasswordHash(hash, "wrong-password"); err != ErrPasswordMismatch {
+			t.Errorf("Expected: %v, Received: %v", ErrPasswordMismatch, err)
+		}
+	})
+
+	t.Run("Should throw error on unknown hash", func(t *testing.T) {
+		t.Parallel()
+		if err := ComparePasswordHash("plain-text", "plain-text"); err != ErrUnknownHash {
+			t.Errorf("Expected: %v, Received: %v", ErrUnknownHash, err)
+		}
+
+		if err := ComparePasswordHash("$argon2id$v=19$broken", "the-password"); err != ErrUnknownHash {
+			t.Errorf("Expected: %v, Received: %v", ErrUnknownHash, err)
+		}
+	})
+}
@@ -0,0 +1,99 @@
+package cryptoutils
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 appendix B secret for SHA1
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestGetTotpCode(t *testing.T) {
+	t.Parallel()
+
+	// RFC 6238 test vectors truncated to 6 digits
+	vectors := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+
+	for unix, expected := range vectors {
+		code, err := GetTotpCode(rfcSecret, time.Unix(unix, 0))
+		if err != nil {
+			t.Fatal("error should be nil")
+		}
+		if code != expected {
+			t.Errorf("At %d expected: %s, Received: %s", unix, expected, code)
+		}
+	}
+}
+
+func TestValidateTotpCode(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(1111111109, 0)
+
+	t.Run("Should accept the current and adjacent periods", func(t *testing.T) {
+		t.Parallel()
+		for _, at := range []time.Time{now, now.Add(-30 * time.Second), now.Add(30 * time.Second)} {
+			code, _ := GetTotpCode(rfcSecret, at)
+			if !ValidateTotpCode(rfcSecret, code, now) {
+				t.Errorf("Code %s generated at %s should be valid", code, at)
+			}
+		}
+	})
+
+	t.Run("Should reject codes outside the skew window", func(t *testing.T) {
+		t.Parallel()
+		code, _ := GetTotpCode(rfcSecret, now.Add(-90*time.Second))
+		if ValidateTotpCode(rfcSecret, code, now) {
+			t.Error("Code should not be valid")
+		}
+	})
+
+	t.Run("Should reject malformed input", func(t *testing.T) {
+		t.Parallel()
+		if ValidateTotpCode(rfcSecret, "12345", now) {
+			t.Error("Short code should not be valid")
+		}
+		if ValidateTotpCode("not base32!", "081804", now) {
+			t.Error("Invalid secret should not be valid")
+		}
+	})
+}
+
+func TestTotpTimeStep(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(1111111109, 0)
+	code, _ := GetTotpCode(rfcSecret, now.Add(-30*time.Second))
+
+	step, ok := TotpTimeStep(rfcSecret, code, now)
+	if !ok || step != 1111111109/30-1 {
+		t.Errorf("Expected the previous step, received %d, %v", step, ok)
+	}
+}
+
+func TestGenerateTotpSecret(t *testing.T) {
+	t.Parallel()
+
+	secret, err := GenerateTotpSecret()
+	if err != nil {
+		t.Fatal("error should be nil")
+	}
+
+	if _, err = GetTotpCode(secret, time.Now()); err != nil {
+		t.Error("Generated secret should be valid base32")
+	}
+
+	uri := GetTotpUri("Bookstore", "daniel@gmail.com", secret)
+	if !strings.HasPrefix(uri, "otpauth://totp/Bookstore:daniel@gmail.com?") || !strings.Contains(uri, "secret="+secret) {
+		t.Errorf("Unexpected uri %s", uri)
+	}
+}